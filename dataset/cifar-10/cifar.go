@@ -5,12 +5,16 @@ import (
 	"fmt"
 	"math/rand"
 	"os"
+	"path/filepath"
 	"strings"
 
 	"github.com/atkhx/metal/dataset"
 )
 
-var ErrorIndexOutOfRange = errors.New("index out of range")
+var (
+	ErrorIndexOutOfRange = errors.New("index out of range")
+	ErrorCorruptFile     = errors.New("corrupt cifar-10 file")
+)
 
 const (
 	ImageWidth    = 32
@@ -37,48 +41,125 @@ var cifarLabels = []string{
 	"truck",
 }
 
+// Legacy layout: train batches concatenated into a single file by download.sh.
 const (
 	TrainImagesFileName = "cifar10-train-data.bin"
 	TestImagesFileName  = "cifar10-test-data.bin"
 )
 
-func CreateTrainingDataset(datasetPath string) (*Dataset, error) {
-	imagesFileName := fmt.Sprintf("%s/%s", strings.TrimRight(datasetPath, " /"), TrainImagesFileName)
+// Official layout of cifar-10-binary.tar.gz.
+const (
+	BatchesDirName    = "cifar-10-batches-bin"
+	TrainBatchesCount = 5
+	TestBatchFileName = "test_batch.bin"
+)
 
-	result, err := Open(imagesFileName, true)
+func TrainBatchFileNames() []string {
+	names := make([]string, TrainBatchesCount)
+	for i := range names {
+		names[i] = fmt.Sprintf("data_batch_%d.bin", i+1)
+	}
+	return names
+}
+
+func CreateTrainingDataset(datasetPath string) (*Dataset, error) {
+	result, err := OpenFiles(resolveFiles(datasetPath, TrainBatchFileNames(), TrainImagesFileName), true)
 	if err != nil {
-		return nil, fmt.Errorf("can't open cifar-10 training file: %w", err)
+		return nil, fmt.Errorf("can't open cifar-10 training files: %w", err)
 	}
 	return result, nil
 }
-func CreateTrainingDatasetGrayscale(datasetPath string) (*Dataset, error) {
-	imagesFileName := fmt.Sprintf("%s/%s", strings.TrimRight(datasetPath, " /"), TrainImagesFileName)
 
-	result, err := Open(imagesFileName, false)
+func CreateTrainingDatasetGrayscale(datasetPath string) (*Dataset, error) {
+	result, err := OpenFiles(resolveFiles(datasetPath, TrainBatchFileNames(), TrainImagesFileName), false)
 	if err != nil {
-		return nil, fmt.Errorf("can't open cifar-10 training file: %w", err)
+		return nil, fmt.Errorf("can't open cifar-10 training files: %w", err)
 	}
 	return result, nil
 }
 
 func CreateTestingDataset(datasetPath string) (*Dataset, error) {
-	imagesFileName := fmt.Sprintf("%s/%s", strings.TrimRight(datasetPath, " /"), TestImagesFileName)
-
-	result, err := Open(imagesFileName, true)
+	result, err := OpenFiles(resolveFiles(datasetPath, []string{TestBatchFileName}, TestImagesFileName), true)
 	if err != nil {
-		return nil, fmt.Errorf("can't open cifar-10 testing file: %w", err)
+		return nil, fmt.Errorf("can't open cifar-10 testing files: %w", err)
 	}
 	return result, nil
 }
 
+// resolveFiles prefers the official batches, looked up either directly in datasetPath
+// or in its BatchesDirName subdirectory, and falls back to the legacy concatenated file.
+func resolveFiles(datasetPath string, batchNames []string, legacyName string) []string {
+	datasetPath = strings.TrimRight(datasetPath, " /")
+
+	for _, dir := range []string{datasetPath, filepath.Join(datasetPath, BatchesDirName)} {
+		if _, err := os.Stat(filepath.Join(dir, batchNames[0])); err != nil {
+			continue
+		}
+		filenames := make([]string, len(batchNames))
+		for i, name := range batchNames {
+			filenames[i] = filepath.Join(dir, name)
+		}
+		return filenames
+	}
+	return []string{filepath.Join(datasetPath, legacyName)}
+}
+
 func Open(filename string, rgb bool) (*Dataset, error) {
-	b, err := os.ReadFile(filename)
-	if err != nil {
-		return nil, err
+	return OpenFiles([]string{filename}, rgb)
+}
+
+// OpenFiles reads and concatenates the given batch files.
+// Every file must consist of whole <1 x label><3072 x pixel> records.
+func OpenFiles(filenames []string, rgb bool) (*Dataset, error) {
+	var records []byte
+	for _, filename := range filenames {
+		b, err := os.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		if err = validateRecords(b); err != nil {
+			return nil, fmt.Errorf("%s: %w", filename, err)
+		}
+		records = append(records, b...)
 	}
 
-	imagesCount := len(b) / SampleSize
+	imagesCount := len(records) / SampleSize
+
+	var labelsIdx = make([]byte, imagesCount)
+	for i := 0; i < imagesCount; i++ {
+		labelsIdx[i] = records[i*SampleSize]
+	}
+
+	d := &Dataset{
+		labelsIdx:   labelsIdx,
+		images:      decodeImages(records, imagesCount, rgb),
+		imagesCount: imagesCount,
 
+		labels: cifarLabels,
+
+		rgb: rgb,
+	}
+	return d, nil
+}
+
+func validateRecords(b []byte) error {
+	if len(b) == 0 {
+		return fmt.Errorf("%w: file is empty", ErrorCorruptFile)
+	}
+	if len(b)%SampleSize != 0 {
+		return fmt.Errorf("%w: size %d is not a multiple of record size %d", ErrorCorruptFile, len(b), SampleSize)
+	}
+	for i := 0; i < len(b)/SampleSize; i++ {
+		if label := b[i*SampleSize]; label >= ClassesCount {
+			return fmt.Errorf("%w: record %d has label %d (expected < %d)", ErrorCorruptFile, i, label, ClassesCount)
+		}
+	}
+	return nil
+}
+
+// decodeImages converts records into normalized channel-first images.
+// Grayscale images are the mean of the R, G and B planes.
+func decodeImages(records []byte, imagesCount int, rgb bool) []float32 {
 	var images []float32
 
 	//nolint:gomnd
@@ -88,7 +169,7 @@ func Open(filename string, rgb bool) (*Dataset, error) {
 			imageOffset := i * ImageSizeRGB
 			sampleOffset := i * SampleSize
 			for j := 0; j < ImageSizeRGB; j++ {
-				images[imageOffset+j] = float32(b[sampleOffset+1+j]) / 255.0
+				images[imageOffset+j] = float32(records[sampleOffset+1+j]) / 255.0
 			}
 		}
 	} else {
@@ -98,30 +179,15 @@ func Open(filename string, rgb bool) (*Dataset, error) {
 			sampleOffset := i * SampleSize
 
 			for j := 0; j < ImageSizeGray; j++ {
-				R := float32(b[sampleOffset+1+j]) / 255.0
-				G := float32(b[sampleOffset+1+j+ImageWidth]) / 255.0
-				B := float32(b[sampleOffset+1+j+ImageWidth+ImageHeight]) / 255.0
+				R := float32(records[sampleOffset+1+j]) / 255.0
+				G := float32(records[sampleOffset+1+j+ImageSizeGray]) / 255.0
+				B := float32(records[sampleOffset+1+j+2*ImageSizeGray]) / 255.0
 
 				images[imageOffset+j] = (R + G + B) / 3
 			}
 		}
 	}
-
-	var labelsIdx = make([]byte, imagesCount)
-	for i := 0; i < imagesCount; i++ {
-		labelsIdx[i] = b[i*SampleSize]
-	}
-
-	d := &Dataset{
-		labelsIdx:   labelsIdx,
-		images:      images,
-		imagesCount: imagesCount,
-
-		labels: cifarLabels,
-
-		rgb: rgb,
-	}
-	return d, nil
+	return images
 }
 
 type Dataset struct {
@@ -143,6 +209,10 @@ func (d *Dataset) GetClasses() []string {
 }
 
 func (d *Dataset) ReadSample(index int) (dataset.Sample, error) {
+	if index < 0 || index >= d.imagesCount {
+		return dataset.Sample{}, fmt.Errorf("%w: index %d, count: %d", ErrorIndexOutOfRange, index, d.imagesCount)
+	}
+
 	var imageSize = ImageSizeGray
 	if d.rgb {
 		imageSize = ImageSizeRGB
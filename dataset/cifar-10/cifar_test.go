@@ -0,0 +1,62 @@
+package cifar_10
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func writeRecords(t *testing.T, filename string, labels ...byte) {
+	t.Helper()
+
+	b := make([]byte, 0, len(labels)*SampleSize)
+	for _, label := range labels {
+		record := make([]byte, SampleSize)
+		record[0] = label
+		record[1] = 255
+		b = append(b, record...)
+	}
+	require.NoError(t, os.WriteFile(filename, b, 0o644))
+}
+
+func TestCreateTrainingDataset_OfficialLayout(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, BatchesDirName)
+	require.NoError(t, os.Mkdir(dir, 0o755))
+
+	for i, name := range TrainBatchFileNames() {
+		writeRecords(t, filepath.Join(dir, name), byte(i), byte(i+1))
+	}
+	writeRecords(t, filepath.Join(dir, TestBatchFileName), 9)
+
+	train, err := CreateTrainingDataset(root)
+	require.NoError(t, err)
+	require.Equal(t, 2*TrainBatchesCount, train.GetSamplesCount())
+
+	sample, err := train.ReadSample(9)
+	require.NoError(t, err)
+	require.Equal(t, []float32{5}, sample.Target)
+	require.Equal(t, float32(1), sample.Input[0])
+
+	test, err := CreateTestingDataset(root)
+	require.NoError(t, err)
+	require.Equal(t, 1, test.GetSamplesCount())
+}
+
+func TestOpen_CorruptFile(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), TestBatchFileName)
+
+	writeRecords(t, filename, 1)
+	b, err := os.ReadFile(filename)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filename, b[:SampleSize-1], 0o644))
+
+	_, err = Open(filename, true)
+	require.ErrorIs(t, err, ErrorCorruptFile)
+
+	writeRecords(t, filename, ClassesCount)
+	_, err = Open(filename, true)
+	require.ErrorIs(t, err, ErrorCorruptFile)
+}
@@ -10,11 +10,25 @@ const (
 	ClassSize = 1
 	LabelSize = 1
 
-	ClassesCount = 100
+	ClassesCount       = 100
+	CoarseClassesCount = 20
 
 	ImageSizeGray = ImageWidth * ImageHeight
 	ImageSizeRGB  = ImageWidth * ImageHeight * ImageDepth
 	SampleSize    = ClassSize + LabelSize + ImageSizeRGB
 )
 
-var ErrorIndexOutOfRange = errors.New("index out of range")
+// LabelMode selects which of the two labels stored in every record is used as a target.
+type LabelMode int
+
+const (
+	// LabelsFine uses the 100 fine-grained labels (Labels).
+	LabelsFine LabelMode = iota
+	// LabelsCoarse uses the 20 superclasses (Classes).
+	LabelsCoarse
+)
+
+var (
+	ErrorIndexOutOfRange = errors.New("index out of range")
+	ErrorCorruptFile     = errors.New("corrupt cifar-100 file")
+)
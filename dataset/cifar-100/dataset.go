@@ -4,41 +4,80 @@ import (
 	"fmt"
 	"math/rand"
 	"os"
+	"path/filepath"
 	"strings"
 
 	"github.com/atkhx/metal/dataset"
 )
 
+// Legacy layout produced by download.sh.
 const (
 	TrainImagesFileName = "cifar100-train-data.bin"
 	TestImagesFileName  = "cifar100-test-data.bin"
 )
 
+// Official layout of cifar-100-binary.tar.gz.
+const (
+	BatchesDirName     = "cifar-100-binary"
+	TrainBatchFileName = "train.bin"
+	TestBatchFileName  = "test.bin"
+)
+
 func CreateTrainingDataset(datasetPath string) (*Dataset, error) {
-	imagesFileName := fmt.Sprintf("%s/%s", strings.TrimRight(datasetPath, " /"), TrainImagesFileName)
+	return CreateTrainingDatasetWithLabels(datasetPath, LabelsFine)
+}
 
-	result, err := Open(imagesFileName, true)
+func CreateTrainingDatasetWithLabels(datasetPath string, labelMode LabelMode) (*Dataset, error) {
+	result, err := OpenWithLabels(resolveFile(datasetPath, TrainBatchFileName, TrainImagesFileName), true, labelMode)
 	if err != nil {
-		return nil, fmt.Errorf("can't open cifar-10 training file: %w", err)
+		return nil, fmt.Errorf("can't open cifar-100 training file: %w", err)
 	}
 	return result, nil
 }
 
 func CreateTestingDataset(datasetPath string) (*Dataset, error) {
-	imagesFileName := fmt.Sprintf("%s/%s", strings.TrimRight(datasetPath, " /"), TestImagesFileName)
+	return CreateTestingDatasetWithLabels(datasetPath, LabelsFine)
+}
 
-	result, err := Open(imagesFileName, true)
+func CreateTestingDatasetWithLabels(datasetPath string, labelMode LabelMode) (*Dataset, error) {
+	result, err := OpenWithLabels(resolveFile(datasetPath, TestBatchFileName, TestImagesFileName), true, labelMode)
 	if err != nil {
-		return nil, fmt.Errorf("can't open cifar-10 testing file: %w", err)
+		return nil, fmt.Errorf("can't open cifar-100 testing file: %w", err)
 	}
 	return result, nil
 }
 
+// resolveFile prefers the official file, looked up either directly in datasetPath
+// or in its BatchesDirName subdirectory, and falls back to the legacy file name.
+func resolveFile(datasetPath string, officialName, legacyName string) string {
+	datasetPath = strings.TrimRight(datasetPath, " /")
+
+	for _, dir := range []string{datasetPath, filepath.Join(datasetPath, BatchesDirName)} {
+		if _, err := os.Stat(filepath.Join(dir, officialName)); err == nil {
+			return filepath.Join(dir, officialName)
+		}
+	}
+	return filepath.Join(datasetPath, legacyName)
+}
+
 func Open(filename string, rgb bool) (*Dataset, error) {
+	return OpenWithLabels(filename, rgb, LabelsFine)
+}
+
+// OpenWithLabels reads <1 x coarse label><1 x fine label><3072 x pixel> records
+// and uses the labels selected by labelMode as targets.
+func OpenWithLabels(filename string, rgb bool, labelMode LabelMode) (*Dataset, error) {
+	if labelMode != LabelsFine && labelMode != LabelsCoarse {
+		return nil, fmt.Errorf("unknown label mode: %d", labelMode)
+	}
+
 	b, err := os.ReadFile(filename)
 	if err != nil {
 		return nil, err
 	}
+	if err = validateRecords(b); err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
 
 	imagesCount := len(b) / SampleSize
 
@@ -62,8 +101,8 @@ func Open(filename string, rgb bool) (*Dataset, error) {
 
 			for j := 0; j < ImageSizeGray; j++ {
 				R := float32(b[sampleOffset+2+j]) / 255.0
-				G := float32(b[sampleOffset+2+j+ImageWidth]) / 255.0
-				B := float32(b[sampleOffset+2+j+ImageWidth+ImageHeight]) / 255.0
+				G := float32(b[sampleOffset+2+j+ImageSizeGray]) / 255.0
+				B := float32(b[sampleOffset+2+j+2*ImageSizeGray]) / 255.0
 
 				images[imageOffset+j] = (R + G + B) / 3
 			}
@@ -84,12 +123,31 @@ func Open(filename string, rgb bool) (*Dataset, error) {
 		samplesCount: imagesCount,
 		labelsIdx:    labelsIdx,
 		classesIdx:   classesIdx,
+		labelMode:    labelMode,
 		rgb:          rgb,
 	}
 
 	return res, nil
 }
 
+func validateRecords(b []byte) error {
+	if len(b) == 0 {
+		return fmt.Errorf("%w: file is empty", ErrorCorruptFile)
+	}
+	if len(b)%SampleSize != 0 {
+		return fmt.Errorf("%w: size %d is not a multiple of record size %d", ErrorCorruptFile, len(b), SampleSize)
+	}
+	for i := 0; i < len(b)/SampleSize; i++ {
+		if coarse := b[i*SampleSize]; coarse >= CoarseClassesCount {
+			return fmt.Errorf("%w: record %d has coarse label %d (expected < %d)", ErrorCorruptFile, i, coarse, CoarseClassesCount)
+		}
+		if fine := b[i*SampleSize+1]; fine >= ClassesCount {
+			return fmt.Errorf("%w: record %d has fine label %d (expected < %d)", ErrorCorruptFile, i, fine, ClassesCount)
+		}
+	}
+	return nil
+}
+
 type Dataset struct {
 	labels  []string
 	classes []string
@@ -99,25 +157,47 @@ type Dataset struct {
 	labelsIdx    []byte
 	classesIdx   []byte
 
-	rgb bool
+	labelMode LabelMode
+	rgb       bool
 }
 
 func (d *Dataset) GetSamplesCount() int {
 	return d.samplesCount
 }
 
+func (d *Dataset) GetLabelMode() LabelMode {
+	return d.labelMode
+}
+
+// GetClasses returns the names of the targets produced by the dataset:
+// fine labels for LabelsFine and superclasses for LabelsCoarse.
 func (d *Dataset) GetClasses() []string {
+	if d.labelMode == LabelsCoarse {
+		return d.classes
+	}
 	return d.labels
 }
 
 func (d *Dataset) GetLabel(index int) (string, error) {
-	if index > -1 && index < len(d.labels) {
-		return d.labels[index], nil
+	names := d.GetClasses()
+	if index > -1 && index < len(names) {
+		return names[index], nil
 	}
 	return "", ErrorIndexOutOfRange
 }
 
+func (d *Dataset) targets() []byte {
+	if d.labelMode == LabelsCoarse {
+		return d.classesIdx
+	}
+	return d.labelsIdx
+}
+
 func (d *Dataset) ReadSample(index int) (dataset.Sample, error) {
+	if index < 0 || index >= d.samplesCount {
+		return dataset.Sample{}, fmt.Errorf("%w: index %d, count: %d", ErrorIndexOutOfRange, index, d.samplesCount)
+	}
+
 	var imageSize = ImageSizeGray
 	if d.rgb {
 		imageSize = ImageSizeRGB
@@ -127,7 +207,7 @@ func (d *Dataset) ReadSample(index int) (dataset.Sample, error) {
 
 	return dataset.Sample{
 		Input:  images,
-		Target: []float32{float32(d.labelsIdx[index])},
+		Target: []float32{float32(d.targets()[index])},
 	}, nil
 }
 
@@ -138,12 +218,13 @@ func (d *Dataset) ReadRandomSampleBatch(batchSize int) (dataset.Sample, error) {
 	}
 	images := make([]float32, 0, batchSize*imageSize)
 	labels := make([]float32, 0, batchSize)
+	targets := d.targets()
 
 	for i := 0; i < batchSize; i++ {
 		index := rand.Intn(d.GetSamplesCount()) //nolint:gosec
 
 		images = append(images, d.images[index*imageSize:(index+1)*imageSize]...)
-		labels = append(labels, float32(d.labelsIdx[index]))
+		labels = append(labels, float32(targets[index]))
 	}
 	return dataset.Sample{
 		Input:  images,
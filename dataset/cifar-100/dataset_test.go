@@ -0,0 +1,41 @@
+package cifar_100
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// writeRecord writes one record with the coarse and fine labels, size cuts it to make a corrupt file.
+func writeRecord(t *testing.T, filename string, coarse, fine byte, size int) {
+	t.Helper()
+
+	record := make([]byte, SampleSize)
+	record[0], record[1] = coarse, fine
+	require.NoError(t, os.WriteFile(filename, record[:size], 0o644))
+}
+
+func TestOpenWithLabels(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), TrainBatchFileName)
+	writeRecord(t, filename, 3, 42, SampleSize)
+
+	fine, err := OpenWithLabels(filename, true, LabelsFine)
+	require.NoError(t, err)
+	sample, err := fine.ReadSample(0)
+	require.NoError(t, err)
+	require.Equal(t, []float32{42}, sample.Target)
+	require.Len(t, fine.GetClasses(), ClassesCount)
+
+	coarse, err := OpenWithLabels(filename, true, LabelsCoarse)
+	require.NoError(t, err)
+	sample, err = coarse.ReadSample(0)
+	require.NoError(t, err)
+	require.Equal(t, []float32{3}, sample.Target)
+	require.Len(t, coarse.GetClasses(), CoarseClassesCount)
+
+	writeRecord(t, filename, 3, 42, SampleSize-1)
+	_, err = OpenWithLabels(filename, true, LabelsFine)
+	require.ErrorIs(t, err, ErrorCorruptFile)
+}
@@ -0,0 +1,161 @@
+package imagefolder
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+const (
+	cacheMagic   = "IMGF"
+	cacheVersion = uint32(2)
+
+	maxCacheStringLength = 1 << 16
+)
+
+var errStaleCache = errors.New("stale cache")
+
+// Cache layout (little endian):
+//
+//	magic, version, imageSize, resizeMode,
+//	classesCount, [len, name] * classesCount,
+//	filesCount, [len, path, label, size, modTime] * filesCount,
+//	float32 images * filesCount * imageSize^2 * 3
+func writeCache(filename string, opts Options, d *Dataset, files []sourceFile) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	writeUint32 := func(v uint32) {
+		if err == nil {
+			err = binary.Write(w, binary.LittleEndian, v)
+		}
+	}
+	writeUint64 := func(v uint64) {
+		if err == nil {
+			err = binary.Write(w, binary.LittleEndian, v)
+		}
+	}
+	writeString := func(s string) {
+		writeUint32(uint32(len(s)))
+		if err == nil {
+			_, err = w.WriteString(s)
+		}
+	}
+
+	if _, err = w.WriteString(cacheMagic); err != nil {
+		return err
+	}
+	writeUint32(cacheVersion)
+	writeUint32(uint32(opts.ImageSize))
+	writeUint32(uint32(opts.ResizeMode))
+	writeUint32(uint32(len(d.classes)))
+	for _, class := range d.classes {
+		writeString(class)
+	}
+	writeUint32(uint32(len(files)))
+	for _, file := range files {
+		writeString(file.path)
+		writeUint32(uint32(file.label))
+		writeUint64(uint64(file.size))
+		writeUint64(uint64(file.modTime))
+	}
+	if err != nil {
+		return err
+	}
+	if err = binary.Write(w, binary.LittleEndian, d.images); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// readCache returns errStaleCache when the cache was built for other files or options,
+// including files changed in place since then (by size or modification time),
+// and io.ErrUnexpectedEOF when it was truncated.
+func readCache(filename string, opts Options, classes []string, files []sourceFile) (*Dataset, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	readUint32 := func() uint32 {
+		var v uint32
+		if err == nil {
+			err = binary.Read(r, binary.LittleEndian, &v)
+		}
+		return v
+	}
+	readUint64 := func() uint64 {
+		var v uint64
+		if err == nil {
+			err = binary.Read(r, binary.LittleEndian, &v)
+		}
+		return v
+	}
+	readString := func() string {
+		n := readUint32()
+		if n > maxCacheStringLength {
+			n, err = 0, errStaleCache
+		}
+		b := make([]byte, n)
+		if err == nil {
+			_, err = io.ReadFull(r, b)
+		}
+		return string(b)
+	}
+
+	magic := make([]byte, len(cacheMagic))
+	if _, err = io.ReadFull(r, magic); err != nil {
+		return nil, err
+	}
+	if string(magic) != cacheMagic || readUint32() != cacheVersion {
+		return nil, errStaleCache
+	}
+	if readUint32() != uint32(opts.ImageSize) || readUint32() != uint32(opts.ResizeMode) {
+		return nil, errStaleCache
+	}
+	if readUint32() != uint32(len(classes)) {
+		return nil, errStaleCache
+	}
+	for _, class := range classes {
+		if readString() != class {
+			return nil, errStaleCache
+		}
+	}
+	if readUint32() != uint32(len(files)) {
+		return nil, errStaleCache
+	}
+	labels := make([]int, len(files))
+	for i, file := range files {
+		if readString() != file.path || readUint32() != uint32(file.label) {
+			return nil, errStaleCache
+		}
+		if readUint64() != uint64(file.size) || readUint64() != uint64(file.modTime) {
+			return nil, errStaleCache
+		}
+		labels[i] = file.label
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	images := make([]float32, len(files)*opts.ImageSize*opts.ImageSize*ImageDepthRGB)
+	if err = binary.Read(r, binary.LittleEndian, images); err != nil {
+		return nil, fmt.Errorf("read images: %w", err)
+	}
+
+	return &Dataset{
+		classes:   classes,
+		imageSize: opts.ImageSize,
+		images:    images,
+		labels:    labels,
+	}, nil
+}
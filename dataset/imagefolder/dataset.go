@@ -0,0 +1,281 @@
+package imagefolder
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/atkhx/metal/dataset"
+)
+
+const ImageDepthRGB = 3
+
+var ErrOutOfRange = errors.New("index out of range")
+
+// ResizeMode defines how source images are brought to ImageSize x ImageSize.
+type ResizeMode int
+
+const (
+	// ResizeStretch scales the whole image, ignoring its aspect ratio.
+	ResizeStretch ResizeMode = iota
+	// ResizeCenterCrop takes the central square of the image and scales it.
+	ResizeCenterCrop
+)
+
+type Options struct {
+	ImageSize  int
+	ResizeMode ResizeMode
+
+	// CacheFile stores decoded images; it is rebuilt when the file list, sizes or
+	// modification times of files or options change.
+	CacheFile string
+
+	// ValFraction of every class goes to the validation dataset, chosen with Seed.
+	ValFraction float64
+	Seed        int64
+}
+
+// Open loads <dir>/<class name>/**/*.{jpg,jpeg,png}. Classes are sorted by name
+// and their indexes are used as targets. The validation dataset is nil when
+// opts.ValFraction is 0.
+func Open(dir string, opts Options) (train, val *Dataset, err error) {
+	if opts.ImageSize < 1 {
+		return nil, nil, fmt.Errorf("image size must be >= 1")
+	}
+	if opts.ResizeMode != ResizeStretch && opts.ResizeMode != ResizeCenterCrop {
+		return nil, nil, fmt.Errorf("unknown resize mode: %d", opts.ResizeMode)
+	}
+	if opts.ValFraction < 0 || opts.ValFraction >= 1 {
+		return nil, nil, fmt.Errorf("val fraction must be in [0, 1)")
+	}
+
+	classes, files, err := listFiles(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var all *Dataset
+	if opts.CacheFile != "" {
+		all, err = readCache(opts.CacheFile, opts, classes, files)
+		if err != nil && !isRebuildableCacheError(err) {
+			return nil, nil, fmt.Errorf("read cache: %w", err)
+		}
+	}
+
+	if all == nil {
+		if all, err = decodeFiles(dir, opts, classes, files); err != nil {
+			return nil, nil, err
+		}
+		if opts.CacheFile != "" {
+			if err = writeCache(opts.CacheFile, opts, all, files); err != nil {
+				return nil, nil, fmt.Errorf("write cache: %w", err)
+			}
+		}
+	}
+
+	if opts.ValFraction == 0 {
+		return all, nil, nil
+	}
+
+	trainIdx, valIdx := splitIndexes(all.labels, len(classes), opts.ValFraction, opts.Seed)
+	return all.subset(trainIdx), all.subset(valIdx), nil
+}
+
+func isRebuildableCacheError(err error) bool {
+	return errors.Is(err, os.ErrNotExist) ||
+		errors.Is(err, errStaleCache) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+type sourceFile struct {
+	path  string // relative to the dataset root
+	label int
+
+	// size and modTime (unix nanoseconds) detect files changed in place.
+	size    int64
+	modTime int64
+}
+
+func listFiles(dir string) ([]string, []sourceFile, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, nil, fmt.Errorf("read dir: %w", err)
+	}
+
+	var classes []string
+	for _, e := range entries {
+		if e.IsDir() && !strings.HasPrefix(e.Name(), ".") {
+			classes = append(classes, e.Name())
+		}
+	}
+	sort.Strings(classes)
+
+	if len(classes) == 0 {
+		return nil, nil, fmt.Errorf("no class directories found in %s", dir)
+	}
+
+	var files []sourceFile
+	for label, class := range classes {
+		err := filepath.WalkDir(filepath.Join(dir, class), func(path string, d os.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() || !isImageFile(d.Name()) {
+				return nil
+			}
+			rel, err := filepath.Rel(dir, path)
+			if err != nil {
+				return err
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			files = append(files, sourceFile{
+				path:    rel,
+				label:   label,
+				size:    info.Size(),
+				modTime: info.ModTime().UnixNano(),
+			})
+			return nil
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("walk class %s: %w", class, err)
+		}
+	}
+
+	if len(files) == 0 {
+		return nil, nil, fmt.Errorf("no images found in %s", dir)
+	}
+	return classes, files, nil
+}
+
+func isImageFile(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".jpg", ".jpeg", ".png":
+		return true
+	}
+	return false
+}
+
+func decodeFiles(dir string, opts Options, classes []string, files []sourceFile) (*Dataset, error) {
+	imageSize := opts.ImageSize * opts.ImageSize * ImageDepthRGB
+
+	d := &Dataset{
+		classes:   classes,
+		imageSize: opts.ImageSize,
+		images:    make([]float32, len(files)*imageSize),
+		labels:    make([]int, len(files)),
+	}
+
+	for i, f := range files {
+		fullPath := filepath.Join(dir, f.path)
+		if err := decodeImageTo(fullPath, opts.ImageSize, opts.ResizeMode, d.images[i*imageSize:(i+1)*imageSize]); err != nil {
+			return nil, fmt.Errorf("decode %s: %w", fullPath, err)
+		}
+		d.labels[i] = f.label
+	}
+	return d, nil
+}
+
+// splitIndexes splits every class separately so both parts keep the class balance.
+func splitIndexes(labels []int, classesCount int, valFraction float64, seed int64) (train, val []int) {
+	byClass := make([][]int, classesCount)
+	for i, label := range labels {
+		byClass[label] = append(byClass[label], i)
+	}
+
+	rng := rand.New(rand.NewSource(seed)) //nolint:gosec
+	for _, indexes := range byClass {
+		rng.Shuffle(len(indexes), func(i, j int) {
+			indexes[i], indexes[j] = indexes[j], indexes[i]
+		})
+
+		valCount := int(math.Round(float64(len(indexes)) * valFraction))
+		val = append(val, indexes[:valCount]...)
+		train = append(train, indexes[valCount:]...)
+	}
+
+	sort.Ints(train)
+	sort.Ints(val)
+	return train, val
+}
+
+// Dataset holds channel-first RGB images normalized to [0, 1].
+type Dataset struct {
+	classes   []string
+	imageSize int
+	images    []float32
+	labels    []int
+}
+
+func (d *Dataset) subset(indexes []int) *Dataset {
+	imageSize := d.imageSize * d.imageSize * ImageDepthRGB
+
+	result := &Dataset{
+		classes:   d.classes,
+		imageSize: d.imageSize,
+		images:    make([]float32, 0, len(indexes)*imageSize),
+		labels:    make([]int, 0, len(indexes)),
+	}
+	for _, index := range indexes {
+		result.images = append(result.images, d.images[index*imageSize:(index+1)*imageSize]...)
+		result.labels = append(result.labels, d.labels[index])
+	}
+	return result
+}
+
+func (d *Dataset) GetSamplesCount() int {
+	return len(d.labels)
+}
+
+func (d *Dataset) GetClasses() []string {
+	return d.classes
+}
+
+func (d *Dataset) GetImageSize() int {
+	return d.imageSize
+}
+
+func (d *Dataset) ReadSample(index int) (dataset.Sample, error) {
+	if index < 0 || index >= len(d.labels) {
+		return dataset.Sample{}, fmt.Errorf("%w: index %d, count: %d", ErrOutOfRange, index, len(d.labels))
+	}
+
+	imageSize := d.imageSize * d.imageSize * ImageDepthRGB
+	images := make([]float32, 0, imageSize)
+	images = append(images, d.images[index*imageSize:(index+1)*imageSize]...)
+
+	return dataset.Sample{
+		Input:  images,
+		Target: []float32{float32(d.labels[index])},
+	}, nil
+}
+
+func (d *Dataset) ReadRandomSampleBatch(batchSize int) (dataset.Sample, error) {
+	if batchSize < 1 {
+		return dataset.Sample{}, fmt.Errorf("batchSize must be >= 1")
+	}
+
+	imageSize := d.imageSize * d.imageSize * ImageDepthRGB
+	images := make([]float32, 0, batchSize*imageSize)
+	labels := make([]float32, 0, batchSize)
+
+	for i := 0; i < batchSize; i++ {
+		index := rand.Intn(len(d.labels)) //nolint:gosec
+
+		images = append(images, d.images[index*imageSize:(index+1)*imageSize]...)
+		labels = append(labels, float32(d.labels[index]))
+	}
+	return dataset.Sample{
+		Input:  images,
+		Target: labels,
+	}, nil
+}
@@ -0,0 +1,100 @@
+package imagefolder
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func writePNG(t *testing.T, filename string, w, h int, c color.RGBA) {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.SetRGBA(x, y, c)
+		}
+	}
+
+	require.NoError(t, os.MkdirAll(filepath.Dir(filename), 0o755))
+	f, err := os.Create(filename)
+	require.NoError(t, err)
+	defer f.Close()
+	require.NoError(t, png.Encode(f, img))
+}
+
+func TestOpen(t *testing.T) {
+	root := t.TempDir()
+	for i := 0; i < 4; i++ {
+		writePNG(t, filepath.Join(root, "cat", "img"+string(rune('a'+i))+".png"), 12, 8, color.RGBA{R: 255, A: 255})
+		writePNG(t, filepath.Join(root, "dog", "sub", "img"+string(rune('a'+i))+".png"), 3, 5, color.RGBA{B: 255, A: 255})
+	}
+
+	opts := Options{
+		ImageSize:   4,
+		ResizeMode:  ResizeCenterCrop,
+		CacheFile:   filepath.Join(t.TempDir(), "cache.bin"),
+		ValFraction: 0.25,
+		Seed:        1,
+	}
+
+	train, val, err := Open(root, opts)
+	require.NoError(t, err)
+	require.Equal(t, []string{"cat", "dog"}, train.GetClasses())
+	require.Equal(t, 6, train.GetSamplesCount())
+	require.Equal(t, 2, val.GetSamplesCount())
+
+	sample, err := val.ReadSample(1)
+	require.NoError(t, err)
+	require.Equal(t, []float32{1}, sample.Target)
+	require.Len(t, sample.Input, 4*4*ImageDepthRGB)
+	require.InDelta(t, 0, sample.Input[0], 1e-6)
+	require.InDelta(t, 1, sample.Input[2*16], 1e-6)
+
+	cachedTrain, cachedVal, err := Open(root, opts)
+	require.NoError(t, err)
+	require.Equal(t, train, cachedTrain)
+	require.Equal(t, val, cachedVal)
+
+	opts.ImageSize = 2
+	resized, _, err := Open(root, opts)
+	require.NoError(t, err)
+	sample, err = resized.ReadSample(0)
+	require.NoError(t, err)
+	require.Equal(t, []float32{1, 1, 1, 1, 0, 0, 0, 0, 0, 0, 0, 0}, sample.Input)
+}
+
+func TestOpen_RebuildsCacheOfChangedFile(t *testing.T) {
+	root := t.TempDir()
+	catFile := filepath.Join(root, "cat", "a.png")
+	writePNG(t, catFile, 2, 2, color.RGBA{R: 255, A: 255})
+	writePNG(t, filepath.Join(root, "dog", "a.png"), 2, 2, color.RGBA{B: 255, A: 255})
+
+	opts := Options{
+		ImageSize: 2,
+		CacheFile: filepath.Join(t.TempDir(), "cache.bin"),
+	}
+
+	all, _, err := Open(root, opts)
+	require.NoError(t, err)
+	sample, err := all.ReadSample(0)
+	require.NoError(t, err)
+	require.Equal(t, []float32{1, 1, 1, 1, 0, 0, 0, 0, 0, 0, 0, 0}, sample.Input)
+
+	// the same name and possibly the same size, the modification time differs
+	info, err := os.Stat(catFile)
+	require.NoError(t, err)
+	writePNG(t, catFile, 2, 2, color.RGBA{G: 255, A: 255})
+	modTime := info.ModTime().Add(time.Hour)
+	require.NoError(t, os.Chtimes(catFile, modTime, modTime))
+
+	all, _, err = Open(root, opts)
+	require.NoError(t, err)
+	sample, err = all.ReadSample(0)
+	require.NoError(t, err)
+	require.Equal(t, []float32{0, 0, 0, 0, 1, 1, 1, 1, 0, 0, 0, 0}, sample.Input)
+}
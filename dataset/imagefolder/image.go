@@ -0,0 +1,127 @@
+package imagefolder
+
+import (
+	"image"
+	"image/draw"
+	_ "image/jpeg"
+	_ "image/png"
+	"math"
+	"os"
+)
+
+// decodeImageTo decodes the file and writes the resized channel-first RGB planes to out.
+func decodeImageTo(path string, size int, mode ResizeMode, out []float32) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	src, _, err := image.Decode(f)
+	if err != nil {
+		return err
+	}
+
+	b := src.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), src, b.Min, draw.Src)
+
+	region := rgba.Bounds()
+	if mode == ResizeCenterCrop {
+		side := region.Dx()
+		if region.Dy() < side {
+			side = region.Dy()
+		}
+		x0 := (region.Dx() - side) / 2
+		y0 := (region.Dy() - side) / 2
+		region = image.Rect(x0, y0, x0+side, y0+side)
+	}
+
+	resizeTo(rgba, region, size, out)
+	return nil
+}
+
+// resizeTo scales the region of src to size x size. Every output pixel averages
+// the source pixels it covers, which falls back to bilinear sampling on upscaling.
+func resizeTo(src *image.RGBA, region image.Rectangle, size int, out []float32) {
+	wh := size * size
+	scaleX := float64(region.Dx()) / float64(size)
+	scaleY := float64(region.Dy()) / float64(size)
+
+	pixel := func(x, y int) (float32, float32, float32) {
+		off := y*src.Stride + x*4
+		return float32(src.Pix[off]) / 255.0, float32(src.Pix[off+1]) / 255.0, float32(src.Pix[off+2]) / 255.0
+	}
+
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			var r, g, b float32
+
+			if scaleX > 1 || scaleY > 1 {
+				x0, x1 := coveredRange(region.Min.X, region.Max.X, float64(x)*scaleX, float64(x+1)*scaleX)
+				y0, y1 := coveredRange(region.Min.Y, region.Max.Y, float64(y)*scaleY, float64(y+1)*scaleY)
+
+				for sy := y0; sy < y1; sy++ {
+					for sx := x0; sx < x1; sx++ {
+						pr, pg, pb := pixel(sx, sy)
+						r, g, b = r+pr, g+pg, b+pb
+					}
+				}
+				n := float32((x1 - x0) * (y1 - y0))
+				r, g, b = r/n, g/n, b/n
+			} else {
+				fx := (float64(x)+0.5)*scaleX - 0.5
+				fy := (float64(y)+0.5)*scaleY - 0.5
+				sx0, sx1, wx := bilinearRange(region.Min.X, region.Max.X, fx)
+				sy0, sy1, wy := bilinearRange(region.Min.Y, region.Max.Y, fy)
+
+				r00, g00, b00 := pixel(sx0, sy0)
+				r01, g01, b01 := pixel(sx1, sy0)
+				r10, g10, b10 := pixel(sx0, sy1)
+				r11, g11, b11 := pixel(sx1, sy1)
+
+				lerp := func(a, b, t float32) float32 { return a + (b-a)*t }
+				r = lerp(lerp(r00, r01, wx), lerp(r10, r11, wx), wy)
+				g = lerp(lerp(g00, g01, wx), lerp(g10, g11, wx), wy)
+				b = lerp(lerp(b00, b01, wx), lerp(b10, b11, wx), wy)
+			}
+
+			idx := y*size + x
+			out[idx] = r
+			out[wh+idx] = g
+			out[2*wh+idx] = b
+		}
+	}
+}
+
+// coveredRange returns source pixels [from, to) covered by [f0, f1) relative to min.
+func coveredRange(min, max int, f0, f1 float64) (int, int) {
+	from := min + int(math.Floor(f0))
+	to := min + int(math.Ceil(f1))
+	if to > max {
+		to = max
+	}
+	if from >= to {
+		from = to - 1
+	}
+	return from, to
+}
+
+// bilinearRange returns two neighbouring source pixels around f and the weight of the second one.
+func bilinearRange(min, max int, f float64) (int, int, float32) {
+	if f < 0 {
+		f = 0
+	}
+	i0 := int(math.Floor(f))
+	w := float32(f - float64(i0))
+
+	i0 += min
+	i1 := i0 + 1
+	if i1 >= max {
+		i1 = max - 1
+	}
+	if i0 >= max {
+		i0 = max - 1
+	}
+	return i0, i1, w
+}
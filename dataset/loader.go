@@ -0,0 +1,63 @@
+package dataset
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+func NewLoader(dataset Dataset, batchSize int, seed int64) *Loader {
+	return &Loader{dataset: dataset, batchSize: batchSize, seed: seed, epoch: -1}
+}
+
+// Loader reads batches of a dataset in a shuffled order, every epoch is shuffled anew.
+// The order depends on the seed only, so the loader is resumed by its cursor.
+type Loader struct {
+	dataset   Dataset
+	batchSize int
+	seed      int64
+
+	cursor int
+	epoch  int
+	order  []int
+}
+
+// Cursor returns the number of samples read, it is saved to resume training.
+func (l *Loader) Cursor() int {
+	return l.cursor
+}
+
+// Seek makes the loader continue from the cursor.
+func (l *Loader) Seek(cursor int) {
+	l.cursor = cursor
+}
+
+func (l *Loader) epochOrder(epoch int) []int {
+	if l.epoch != epoch {
+		rng := rand.New(rand.NewSource(l.seed + int64(epoch))) //nolint:gosec
+		l.order = rng.Perm(l.dataset.GetSamplesCount())
+		l.epoch = epoch
+	}
+	return l.order
+}
+
+// NextBatch reads the next batchSize samples, a batch may span two epochs.
+func (l *Loader) NextBatch() (Sample, error) {
+	samplesCount := l.dataset.GetSamplesCount()
+	if samplesCount == 0 {
+		return Sample{}, fmt.Errorf("dataset is empty")
+	}
+
+	var batch Sample
+	for i := 0; i < l.batchSize; i++ {
+		index := l.epochOrder(l.cursor / samplesCount)[l.cursor%samplesCount]
+
+		sample, err := l.dataset.ReadSample(index)
+		if err != nil {
+			return Sample{}, fmt.Errorf("read sample %d: %w", index, err)
+		}
+		batch.Input = append(batch.Input, sample.Input...)
+		batch.Target = append(batch.Target, sample.Target...)
+		l.cursor++
+	}
+	return batch, nil
+}
@@ -0,0 +1,51 @@
+package dataset
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type indexDataset int
+
+func (d indexDataset) GetSamplesCount() int {
+	return int(d)
+}
+
+func (d indexDataset) ReadSample(index int) (Sample, error) {
+	return Sample{Input: []float32{float32(index)}, Target: []float32{float32(-index)}}, nil
+}
+
+func (d indexDataset) ReadRandomSampleBatch(int) (Sample, error) {
+	panic("not used")
+}
+
+func TestLoader(t *testing.T) {
+	loader := NewLoader(indexDataset(5), 2, 1)
+
+	var inputs []float32
+	for i := 0; i < 5; i++ {
+		batch, err := loader.NextBatch()
+		require.NoError(t, err)
+		require.Len(t, batch.Input, 2)
+		require.Equal(t, []float32{-batch.Input[0], -batch.Input[1]}, batch.Target)
+		inputs = append(inputs, batch.Input...)
+	}
+	require.Equal(t, 10, loader.Cursor())
+
+	// every epoch contains every sample once
+	require.ElementsMatch(t, []float32{0, 1, 2, 3, 4}, inputs[:5])
+	require.ElementsMatch(t, []float32{0, 1, 2, 3, 4}, inputs[5:])
+	require.NotEqual(t, inputs[:5], inputs[5:])
+
+	resumed := NewLoader(indexDataset(5), 2, 1)
+	resumed.Seek(4)
+
+	var resumedInputs []float32
+	for i := 0; i < 3; i++ {
+		batch, err := resumed.NextBatch()
+		require.NoError(t, err)
+		resumedInputs = append(resumedInputs, batch.Input...)
+	}
+	require.Equal(t, inputs[4:10], resumedInputs)
+}
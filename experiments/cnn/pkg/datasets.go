@@ -0,0 +1,73 @@
+package pkg
+
+import (
+	"fmt"
+
+	"github.com/atkhx/metal/dataset"
+	"github.com/atkhx/metal/dataset/cifar-10"
+	"github.com/atkhx/metal/dataset/cifar-100"
+	"github.com/atkhx/metal/dataset/imagefolder"
+	"github.com/atkhx/metal/dataset/mnist"
+)
+
+const (
+	DatasetMNIST       = "mnist"
+	DatasetCIFAR10     = "cifar10"
+	DatasetCIFAR100    = "cifar100"
+	DatasetImageFolder = "imagefolder"
+)
+
+type Datasets struct {
+	Train, Test dataset.ClassifierDataset
+
+	ImageSize  int
+	ImageDepth int
+}
+
+// OpenDatasets opens train and test splits of the named dataset.
+// For imagefolder the test split is the validation part of the directory.
+func OpenDatasets(name, path string, folderOpts imagefolder.Options) (Datasets, error) {
+	switch name {
+	case DatasetMNIST:
+		train, err := mnist.CreateTrainingDataset(path)
+		if err != nil {
+			return Datasets{}, fmt.Errorf("mnist.CreateTrainingDataset: %w", err)
+		}
+		test, err := mnist.CreateTestingDataset(path)
+		if err != nil {
+			return Datasets{}, fmt.Errorf("mnist.CreateTestingDataset: %w", err)
+		}
+		return Datasets{Train: train, Test: test, ImageSize: mnist.ImageWidth, ImageDepth: mnist.ImageDepth}, nil
+	case DatasetCIFAR10:
+		train, err := cifar_10.CreateTrainingDataset(path)
+		if err != nil {
+			return Datasets{}, fmt.Errorf("cifar_10.CreateTrainingDataset: %w", err)
+		}
+		test, err := cifar_10.CreateTestingDataset(path)
+		if err != nil {
+			return Datasets{}, fmt.Errorf("cifar_10.CreateTestingDataset: %w", err)
+		}
+		return Datasets{Train: train, Test: test, ImageSize: cifar_10.ImageWidth, ImageDepth: cifar_10.ImageDepthRGB}, nil
+	case DatasetCIFAR100:
+		train, err := cifar_100.CreateTrainingDataset(path)
+		if err != nil {
+			return Datasets{}, fmt.Errorf("cifar_100.CreateTrainingDataset: %w", err)
+		}
+		test, err := cifar_100.CreateTestingDataset(path)
+		if err != nil {
+			return Datasets{}, fmt.Errorf("cifar_100.CreateTestingDataset: %w", err)
+		}
+		return Datasets{Train: train, Test: test, ImageSize: cifar_100.ImageWidth, ImageDepth: cifar_100.ImageDepth}, nil
+	case DatasetImageFolder:
+		if folderOpts.ValFraction == 0 {
+			return Datasets{}, fmt.Errorf("imagefolder requires a validation fraction > 0")
+		}
+		train, val, err := imagefolder.Open(path, folderOpts)
+		if err != nil {
+			return Datasets{}, fmt.Errorf("imagefolder.Open: %w", err)
+		}
+		return Datasets{Train: train, Test: val, ImageSize: folderOpts.ImageSize, ImageDepth: imagefolder.ImageDepthRGB}, nil
+	default:
+		return Datasets{}, fmt.Errorf("dataset '%s' is not recognized", name)
+	}
+}
@@ -0,0 +1,155 @@
+package pkg
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+)
+
+// ClassificationMetrics accumulates top-k hits and the confusion matrix over evaluated samples.
+type ClassificationMetrics struct {
+	classes   []string
+	confusion [][]int // [actual][predicted]
+	topKHits  map[int]int
+	total     int
+}
+
+func NewClassificationMetrics(classes []string, topK ...int) *ClassificationMetrics {
+	confusion := make([][]int, len(classes))
+	for i := range confusion {
+		confusion[i] = make([]int, len(classes))
+	}
+	hits := map[int]int{}
+	for _, k := range topK {
+		hits[k] = 0
+	}
+	return &ClassificationMetrics{
+		classes:   classes,
+		confusion: confusion,
+		topKHits:  hits,
+	}
+}
+
+// Add takes logits laid out as [count][classesCount] and one target index per sample.
+func (m *ClassificationMetrics) Add(logits, targets []float32, count int) {
+	classesCount := len(m.classes)
+	order := make([]int, classesCount)
+
+	for i := 0; i < count; i++ {
+		row := logits[i*classesCount : (i+1)*classesCount]
+		target := int(targets[i])
+
+		for j := range order {
+			order[j] = j
+		}
+		sort.SliceStable(order, func(a, b int) bool {
+			return row[order[a]] > row[order[b]]
+		})
+
+		m.confusion[target][order[0]]++
+		m.total++
+
+		for k := range m.topKHits {
+			for _, predicted := range order[:min(k, classesCount)] {
+				if predicted == target {
+					m.topKHits[k]++
+					break
+				}
+			}
+		}
+	}
+}
+
+func (m *ClassificationMetrics) GetSamplesCount() int {
+	return m.total
+}
+
+// TopK returns the share of samples whose target is among k highest logits.
+func (m *ClassificationMetrics) TopK(k int) float64 {
+	if m.total == 0 {
+		return 0
+	}
+	return float64(m.topKHits[k]) / float64(m.total)
+}
+
+func (m *ClassificationMetrics) Precision(class int) float64 {
+	predicted := 0
+	for actual := range m.confusion {
+		predicted += m.confusion[actual][class]
+	}
+	if predicted == 0 {
+		return 0
+	}
+	return float64(m.confusion[class][class]) / float64(predicted)
+}
+
+func (m *ClassificationMetrics) Recall(class int) float64 {
+	support := m.Support(class)
+	if support == 0 {
+		return 0
+	}
+	return float64(m.confusion[class][class]) / float64(support)
+}
+
+func (m *ClassificationMetrics) Support(class int) int {
+	support := 0
+	for _, count := range m.confusion[class] {
+		support += count
+	}
+	return support
+}
+
+func (m *ClassificationMetrics) PrintReport(w io.Writer) {
+	fmt.Fprintf(w, "%-24s %10s %10s %10s\n", "class", "precision", "recall", "support")
+	for class, name := range m.classes {
+		fmt.Fprintf(w, "%-24s %10.4f %10.4f %10d\n", name, m.Precision(class), m.Recall(class), m.Support(class))
+	}
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "confusion matrix (rows - actual, cols - predicted):")
+	for _, row := range m.confusion {
+		for _, count := range row {
+			fmt.Fprintf(w, "%6d", count)
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+func (m *ClassificationMetrics) WritePerClassCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"class", "precision", "recall", "support"}); err != nil {
+		return err
+	}
+	for class, name := range m.classes {
+		if err := cw.Write([]string{
+			name,
+			strconv.FormatFloat(m.Precision(class), 'f', 6, 64),
+			strconv.FormatFloat(m.Recall(class), 'f', 6, 64),
+			strconv.Itoa(m.Support(class)),
+		}); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func (m *ClassificationMetrics) WriteConfusionCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(append([]string{"actual/predicted"}, m.classes...)); err != nil {
+		return err
+	}
+	for class, row := range m.confusion {
+		record := []string{m.classes[class]}
+		for _, count := range row {
+			record = append(record, strconv.Itoa(count))
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,82 @@
+package pkg
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestMetrics() *ClassificationMetrics {
+	m := NewClassificationMetrics([]string{"a", "b", "c"}, 1, 2, 5)
+	m.Add([]float32{
+		3, 1, 0, // predicted 0
+		1, 2, 0, // predicted 1, the target is second
+		2, 2, 1, // tie, the lower class goes first: predicted 0
+	}, []float32{0, 0, 1}, 3)
+	m.Add([]float32{
+		1, 5, 0, // predicted 1, the target is last
+		0, 3, 1, // predicted 1
+		1, 2, 2, // tie, predicted 1
+	}, []float32{2, 1, 2}, 3)
+	return m
+}
+
+func TestClassificationMetrics(t *testing.T) {
+	m := newTestMetrics()
+
+	require.Equal(t, 6, m.GetSamplesCount())
+	require.Equal(t, [][]int{
+		{1, 1, 0},
+		{1, 1, 0},
+		{0, 2, 0},
+	}, m.confusion)
+
+	require.InDelta(t, 2.0/6, m.TopK(1), 1e-9)
+	require.InDelta(t, 5.0/6, m.TopK(2), 1e-9)
+	// k greater than the number of classes takes all of them
+	require.InDelta(t, 1, m.TopK(5), 1e-9)
+	// k which isn't accumulated
+	require.Zero(t, m.TopK(3))
+
+	require.InDelta(t, 0.5, m.Precision(0), 1e-9)
+	require.InDelta(t, 0.25, m.Precision(1), 1e-9)
+	// the class is never predicted
+	require.Zero(t, m.Precision(2))
+
+	require.InDelta(t, 0.5, m.Recall(0), 1e-9)
+	require.InDelta(t, 0.5, m.Recall(1), 1e-9)
+	require.Zero(t, m.Recall(2))
+
+	for class := 0; class < 3; class++ {
+		require.Equal(t, 2, m.Support(class))
+	}
+}
+
+func TestClassificationMetrics_Empty(t *testing.T) {
+	m := NewClassificationMetrics([]string{"a", "b"}, 1)
+
+	require.Zero(t, m.GetSamplesCount())
+	require.Zero(t, m.TopK(1))
+	require.Zero(t, m.Precision(0))
+	require.Zero(t, m.Recall(1))
+	require.Zero(t, m.Support(0))
+}
+
+func TestClassificationMetrics_CSV(t *testing.T) {
+	m := newTestMetrics()
+
+	perClass := &bytes.Buffer{}
+	require.NoError(t, m.WritePerClassCSV(perClass))
+	require.Equal(t, "class,precision,recall,support\n"+
+		"a,0.500000,0.500000,2\n"+
+		"b,0.250000,0.500000,2\n"+
+		"c,0.000000,0.000000,2\n", perClass.String())
+
+	confusion := &bytes.Buffer{}
+	require.NoError(t, m.WriteConfusionCSV(confusion))
+	require.Equal(t, "actual/predicted,a,b,c\n"+
+		"a,1,1,0\n"+
+		"b,1,1,0\n"+
+		"c,0,2,0\n", confusion.String())
+}
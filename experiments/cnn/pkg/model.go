@@ -11,6 +11,6 @@ const (
 	adamEPS          = 0.000000001
 )
 
-func CreateOptimizer(epochs int, device *proc.Device) proc.Optimizer {
-	return device.GetOptimizerAdam(epochs, adamBeta1, adamBeta2, adamLearningRate, adamEPS)
+func CreateOptimizer(device *proc.Device) proc.Optimizer {
+	return device.GetOptimizerAdam(adamBeta1, adamBeta2, adamLearningRate, adamEPS)
 }
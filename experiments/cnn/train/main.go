@@ -0,0 +1,335 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/atkhx/metal/dataset"
+	"github.com/atkhx/metal/dataset/imagefolder"
+	"github.com/atkhx/metal/experiments/cnn/pkg"
+	"github.com/atkhx/metal/mtl"
+	"github.com/atkhx/metal/nn/model"
+	"github.com/atkhx/metal/nn/num"
+	"github.com/atkhx/metal/nn/optimizer"
+	"github.com/atkhx/metal/nn/pipeline"
+	"github.com/atkhx/metal/nn/proc"
+)
+
+var (
+	datasetName = flag.String("dataset", pkg.DatasetMNIST, "mnist | cifar10 | cifar100 | imagefolder")
+	datasetPath = flag.String("data", "", "dataset path (default depends on dataset)")
+	outputPath  = flag.String("out", "./data/cnn-%s", "directory for checkpoints and metrics")
+
+	iterations = flag.Int("iterations", 10000, "training iterations (skipped ones are not counted)")
+	batchSize  = flag.Int("batch", 64, "mini-batch size")
+	statSize   = flag.Int("stat", 100, "print average train loss every N iterations")
+	evalEvery  = flag.Int("eval-every", 1000, "evaluate and save checkpoint every N iterations (0 - only at the end)")
+	evalOnly   = flag.Bool("eval", false, "only evaluate the saved checkpoint on the test split")
+	clipNorm   = flag.Float64("clip", 0, "clip the global gradient norm (0 disables clipping)")
+
+	filterSize      = flag.Int("filter-size", 3, "conv filter size")
+	filtersCount    = flag.Int("filters", 32, "conv filters count")
+	padding         = flag.Int("padding", 1, "conv padding")
+	convLayersCount = flag.Int("conv-layers", 2, "conv blocks count")
+	linearSize      = flag.Int("linear", 0, "hidden linear layer size (0 disables)")
+
+	imageSize   = flag.Int("image-size", 32, "imagefolder: image size")
+	centerCrop  = flag.Bool("center-crop", true, "imagefolder: center-crop instead of stretching")
+	valFraction = flag.Float64("val", 0.2, "imagefolder: validation fraction used as test split")
+	splitSeed   = flag.Int64("seed", 1, "imagefolder: split seed")
+	trainSeed   = flag.Int64("train-seed", 1, "seed of batch order and dropout masks")
+)
+
+const topK = 5
+
+var defaultDatasetPaths = map[string]string{
+	pkg.DatasetMNIST:       "./data/mnist",
+	pkg.DatasetCIFAR10:     "./data/cifar-10",
+	pkg.DatasetCIFAR100:    "./data/cifar-100",
+	pkg.DatasetImageFolder: "./data/imagefolder",
+}
+
+func main() {
+	var err error
+	defer func() {
+		if err != nil {
+			log.Fatalln(err)
+		}
+	}()
+
+	flag.Parse()
+
+	if *datasetPath == "" {
+		*datasetPath = defaultDatasetPaths[*datasetName]
+	}
+	*outputPath = fmt.Sprintf(*outputPath, *datasetName)
+
+	if err = os.MkdirAll(*outputPath, os.ModePerm); err != nil {
+		err = fmt.Errorf("failed to create output path: %w", err)
+		return
+	}
+
+	weightsFile := filepath.Join(*outputPath, "model.json")
+	stateFile := filepath.Join(*outputPath, "training.json")
+	metricsFile := filepath.Join(*outputPath, "metrics.csv")
+
+	folderOpts := imagefolder.Options{
+		ImageSize:   *imageSize,
+		CacheFile:   filepath.Join(*outputPath, "images.cache"),
+		ValFraction: *valFraction,
+		Seed:        *splitSeed,
+	}
+	if *centerCrop {
+		folderOpts.ResizeMode = imagefolder.ResizeCenterCrop
+	}
+
+	datasets, err := pkg.OpenDatasets(*datasetName, *datasetPath, folderOpts)
+	if err != nil {
+		return
+	}
+	classes := datasets.Train.GetClasses()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	device := proc.NewWithSystemDefaultDevice()
+	defer device.Release()
+	device.SetSeed(*trainSeed)
+
+	modelOptimizer := pkg.CreateOptimizer(device)
+
+	cnnModel := model.NewCNN(
+		datasets.ImageSize,
+		datasets.ImageDepth,
+		*batchSize,
+		len(classes),
+		*filterSize,
+		*filtersCount,
+		*padding,
+		*convLayersCount,
+		*linearSize,
+		nil,
+		device,
+		modelOptimizer,
+	)
+	output := cnnModel.Compile()
+
+	// training starts from scratch without a checkpoint, evaluation needs one
+	if _, err = cnnModel.LoadFromFileWith(weightsFile, model.LoadOptions{SkipMissingFile: !*evalOnly}); err != nil {
+		return
+	}
+
+	input := cnnModel.GetInput()
+	evalPipeline := device.GetInferencePipeline(output)
+
+	evaluate := func(iteration int, trainLoss float32) (*pkg.ClassificationMetrics, error) {
+		t := time.Now()
+		cnnModel.SetTraining(false)
+		metrics, err := evaluateDataset(datasets.Test, input, output, evalPipeline, *batchSize, classes)
+		cnnModel.SetTraining(true)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Println(
+			"eval iteration:", iteration, "\t",
+			fmt.Sprintf("top-1: %.4f", metrics.TopK(1)), "\t",
+			fmt.Sprintf("top-%d: %.4f", topK, metrics.TopK(topK)), "\t",
+			"duration:", time.Since(t),
+		)
+		return metrics, appendMetricsCSV(metricsFile, iteration, trainLoss, metrics)
+	}
+
+	if *evalOnly {
+		var metrics *pkg.ClassificationMetrics
+		if metrics, err = evaluate(0, 0); err != nil {
+			return
+		}
+		err = writeReport(*outputPath, metrics)
+		return
+	}
+
+	targets := device.NewData(mtl.NewMTLSize(1, 1, *batchSize))
+	loss := device.Mean(device.CrossEntropyPos(output, targets))
+	trainPipeline := device.GetTrainingPipeline(loss)
+	// output is read by the eval pipeline, its buffers are kept
+	fmt.Println("memory plan:", trainPipeline.PlanMemory(output))
+	clipper := optimizer.NewGradClipper(device.GetMTLDevice(), cnnModel.Layers.ForUpdate(), float32(*clipNorm))
+
+	loader := dataset.NewLoader(datasets.Train, *batchSize, *trainSeed)
+	state, err := cnnModel.LoadTrainingState(stateFile)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		err = nil
+	case err != nil:
+		return
+	default:
+		loader.Seek(state.Cursor)
+		fmt.Println("resume from iteration:", state.Step)
+	}
+
+	saveCheckpoint := func(nextIteration int) error {
+		if err := cnnModel.SaveToFile(weightsFile); err != nil {
+			return err
+		}
+		return cnnModel.SaveTrainingState(stateFile, model.TrainingState{
+			Step:   nextIteration,
+			Cursor: loader.Cursor(),
+		})
+	}
+
+	var t = time.Now()
+	var lossAvg, lastLossAvg float32
+	var iteration int
+
+	// iteration counts applied updates only: a skipped batch doesn't advance the optimizer step
+	// passed to Update and saved as TrainingState.Step.
+	for iteration = state.Step; iteration < *iterations; {
+		if ctx.Err() != nil {
+			break
+		}
+
+		var batch dataset.Sample
+		if batch, err = loader.NextBatch(); err != nil {
+			return
+		}
+		copy(input.Data.GetFloats(), batch.Input)
+		copy(targets.Data.GetFloats(), batch.Target)
+
+		trainPipeline.ComputeGrads(clipper.Encode)
+		if gradStats := clipper.Stats(); !gradStats.IsFinite() {
+			fmt.Println("skip iteration:", iteration, "\t", "grad norm:", gradStats.TotalNorm)
+			continue
+		}
+		trainPipeline.Update(func(b *mtl.CommandBuffer) {
+			cnnModel.Update(b, iteration)
+		})
+
+		lossAvg += loss.Data.GetFloats()[0]
+		if (iteration > 0 || *statSize == 1) && iteration%*statSize == 0 {
+			lossAvg /= float32(*statSize)
+			fmt.Println(
+				fmt.Sprintf("lossFunc: %.8f", lossAvg), "\t",
+				"iteration:", iteration, "\t",
+				"duration:", time.Since(t), "\t",
+			)
+			lastLossAvg = lossAvg
+			lossAvg = 0
+			t = time.Now()
+		}
+
+		if *evalEvery > 0 && iteration > 0 && iteration%*evalEvery == 0 {
+			if err = saveCheckpoint(iteration + 1); err != nil {
+				return
+			}
+			if _, err = evaluate(iteration, lastLossAvg); err != nil {
+				return
+			}
+		}
+		iteration++
+	}
+
+	if err = saveCheckpoint(iteration); err != nil {
+		return
+	}
+
+	metrics, err := evaluate(iteration, lastLossAvg)
+	if err != nil {
+		return
+	}
+	err = writeReport(*outputPath, metrics)
+}
+
+// evaluateDataset runs the whole dataset through the model in batches.
+// The last incomplete batch is padded with its last sample, padding is not counted.
+func evaluateDataset(
+	ds dataset.ClassifierDataset,
+	input, output *num.Data,
+	evalPipeline *pipeline.InferencePipeline,
+	batchSize int,
+	classes []string,
+) (*pkg.ClassificationMetrics, error) {
+	metrics := pkg.NewClassificationMetrics(classes, 1, topK)
+	samplesCount := ds.GetSamplesCount()
+	inputs := input.Data.GetFloats()
+	sampleSize := len(inputs) / batchSize
+	targets := make([]float32, batchSize)
+
+	for offset := 0; offset < samplesCount; offset += batchSize {
+		count := min(batchSize, samplesCount-offset)
+
+		for i := 0; i < batchSize; i++ {
+			sample, err := ds.ReadSample(offset + min(i, count-1))
+			if err != nil {
+				return nil, fmt.Errorf("read eval sample %d: %w", offset+min(i, count-1), err)
+			}
+			copy(inputs[i*sampleSize:(i+1)*sampleSize], sample.Input)
+			targets[i] = sample.Target[0]
+		}
+
+		evalPipeline.Forward()
+		metrics.Add(output.Data.GetFloats(), targets, count)
+	}
+	return metrics, nil
+}
+
+func appendMetricsCSV(filename string, iteration int, trainLoss float32, metrics *pkg.ClassificationMetrics) error {
+	_, err := os.Stat(filename)
+	writeHeader := errors.Is(err, os.ErrNotExist)
+
+	f, err := os.OpenFile(filename, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("open metrics file: %w", err)
+	}
+	defer f.Close()
+
+	if writeHeader {
+		if _, err = fmt.Fprintln(f, "time,iteration,train_loss,top1,top5,samples"); err != nil {
+			return fmt.Errorf("write metrics file: %w", err)
+		}
+	}
+	_, err = fmt.Fprintf(f, "%s,%d,%.8f,%.6f,%.6f,%d\n",
+		time.Now().Format(time.RFC3339),
+		iteration,
+		trainLoss,
+		metrics.TopK(1),
+		metrics.TopK(topK),
+		metrics.GetSamplesCount(),
+	)
+	if err != nil {
+		return fmt.Errorf("write metrics file: %w", err)
+	}
+	return nil
+}
+
+func writeReport(outputPath string, metrics *pkg.ClassificationMetrics) error {
+	metrics.PrintReport(os.Stdout)
+
+	perClass, err := os.Create(filepath.Join(outputPath, "per_class.csv"))
+	if err != nil {
+		return fmt.Errorf("create per-class file: %w", err)
+	}
+	defer perClass.Close()
+
+	if err = metrics.WritePerClassCSV(perClass); err != nil {
+		return fmt.Errorf("write per-class file: %w", err)
+	}
+
+	confusion, err := os.Create(filepath.Join(outputPath, "confusion.csv"))
+	if err != nil {
+		return fmt.Errorf("create confusion file: %w", err)
+	}
+	defer confusion.Close()
+
+	if err = metrics.WriteConfusionCSV(confusion); err != nil {
+		return fmt.Errorf("write confusion file: %w", err)
+	}
+	return nil
+}
@@ -14,6 +14,7 @@ import (
 
 	vaephoto "github.com/atkhx/metal/experiments/vae-photo/pkg"
 	"github.com/atkhx/metal/mtl"
+	"github.com/atkhx/metal/nn/model"
 	"github.com/atkhx/metal/nn/proc"
 )
 
@@ -74,11 +75,11 @@ func main() {
 		vaeModel.Compile()
 	}
 
-	if err = vaeModel.LoadFromFile(weightsFile); err != nil {
+	if _, err = vaeModel.LoadFromFileWith(weightsFile, model.LoadOptions{IgnoreUnexpected: true}); err != nil {
 		return
 	}
 	if decoderModel != nil {
-		if err = decoderModel.LoadFromFile(weightsFile); err != nil {
+		if _, err = decoderModel.LoadFromFileWith(weightsFile, model.LoadOptions{IgnoreUnexpected: true}); err != nil {
 			return
 		}
 	}
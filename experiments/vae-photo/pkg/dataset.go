@@ -21,6 +21,7 @@ const (
 
 type PhotoDataset struct {
 	images    []photoImage
+	patches   []photoPatch
 	patchSize int
 	rng       *rand.Rand
 }
@@ -30,6 +31,33 @@ type photoImage struct {
 	data []float32 // channel-first: R, G, B planes
 }
 
+// photoPatch is a sample read by index: the patch of the image at x0, y0.
+type photoPatch struct {
+	image  int
+	x0, y0 int
+}
+
+// gridPatches places patches on a grid with the half-patch stride, the last row
+// and column are aligned to the bottom and right edges of the image.
+func gridPatches(imageIndex int, img photoImage, patchSize int) []photoPatch {
+	stride := max(patchSize/2, 1)
+	offsets := func(size int) []int {
+		var result []int
+		for offset := 0; offset+patchSize < size; offset += stride {
+			result = append(result, offset)
+		}
+		return append(result, size-patchSize)
+	}
+
+	var patches []photoPatch
+	for _, y0 := range offsets(img.h) {
+		for _, x0 := range offsets(img.w) {
+			patches = append(patches, photoPatch{image: imageIndex, x0: x0, y0: y0})
+		}
+	}
+	return patches
+}
+
 func LoadPhotoDataset(dir string, patchSize int) (*PhotoDataset, error) {
 	if patchSize < 1 {
 		return nil, fmt.Errorf("patchSize must be >= 1")
@@ -64,38 +92,45 @@ func LoadPhotoDataset(dir string, patchSize int) (*PhotoDataset, error) {
 		return nil, fmt.Errorf("no images loaded from %s", dir)
 	}
 
+	var patches []photoPatch
+	for i, img := range images {
+		patches = append(patches, gridPatches(i, img, patchSize)...)
+	}
+
 	return &PhotoDataset{
 		images:    images,
+		patches:   patches,
 		patchSize: patchSize,
 		rng:       rand.New(rand.NewSource(time.Now().UnixNano())),
 	}, nil
 }
 
+// GetSamplesCount returns the number of patches on the grids of all images,
+// ReadSample reads them by index, e.g. for dataset.Loader.
+func (d *PhotoDataset) GetSamplesCount() int {
+	return len(d.patches)
+}
+
+func (d *PhotoDataset) ReadSample(index int) (dataset.Sample, error) {
+	if index < 0 || index >= len(d.patches) {
+		return dataset.Sample{}, fmt.Errorf("index out of range: %d, count: %d", index, len(d.patches))
+	}
+
+	patch := d.patches[index]
+	out := make([]float32, d.patchSize*d.patchSize*ImageDepthRGB)
+	d.copyPatch(out, d.images[patch.image], patch.x0, patch.y0)
+	return dataset.Sample{Input: out}, nil
+}
+
 func (d *PhotoDataset) ReadRandomSampleBatch(batchSize int) (dataset.Sample, error) {
 	if batchSize < 1 {
 		return dataset.Sample{}, fmt.Errorf("batchSize must be >= 1")
 	}
 
-	patchWH := d.patchSize * d.patchSize
-	out := make([]float32, batchSize*patchWH*ImageDepthRGB)
-
-	for i := 0; i < batchSize; i++ {
-		img := d.images[d.rng.Intn(len(d.images))]
-		x0 := d.rng.Intn(img.w - d.patchSize + 1)
-		y0 := d.rng.Intn(img.h - d.patchSize + 1)
-
-		for c := 0; c < ImageDepthRGB; c++ {
-			srcPlane := c * img.w * img.h
-			dstPlane := i*patchWH*ImageDepthRGB + c*patchWH
-
-			for y := 0; y < d.patchSize; y++ {
-				srcRow := (y0+y)*img.w + x0
-				dstRow := y * d.patchSize
-				copy(out[dstPlane+dstRow:dstPlane+dstRow+d.patchSize], img.data[srcPlane+srcRow:srcPlane+srcRow+d.patchSize])
-			}
-		}
+	out := make([]float32, batchSize*d.patchSize*d.patchSize*ImageDepthRGB)
+	if err := d.ReadRandomSampleBatchTo(batchSize, out); err != nil {
+		return dataset.Sample{}, err
 	}
-
 	return dataset.Sample{Input: out}, nil
 }
 
@@ -104,31 +139,36 @@ func (d *PhotoDataset) ReadRandomSampleBatchTo(batchSize int, out []float32) err
 		return fmt.Errorf("batchSize must be >= 1")
 	}
 
-	patchWH := d.patchSize * d.patchSize
-	//out := make([]float32, batchSize*patchWH*ImageDepthRGB)
-
+	patchSize := d.patchSize * d.patchSize * ImageDepthRGB
 	for i := 0; i < batchSize; i++ {
 		img := d.images[d.rng.Intn(len(d.images))]
 		x0 := d.rng.Intn(img.w - d.patchSize + 1)
 		y0 := d.rng.Intn(img.h - d.patchSize + 1)
 
-		for c := 0; c < ImageDepthRGB; c++ {
-			srcPlane := c * img.w * img.h
-			dstPlane := i*patchWH*ImageDepthRGB + c*patchWH
-
-			for y := 0; y < d.patchSize; y++ {
-				srcRow := (y0+y)*img.w + x0
-				dstRow := y * d.patchSize
-				copy(
-					out[dstPlane+dstRow:dstPlane+dstRow+d.patchSize],
-					img.data[srcPlane+srcRow:srcPlane+srcRow+d.patchSize],
-				)
-			}
-		}
+		d.copyPatch(out[i*patchSize:(i+1)*patchSize], img, x0, y0)
 	}
 	return nil
 }
 
+// copyPatch copies the channel-first patch of the image at x0, y0 to out.
+func (d *PhotoDataset) copyPatch(out []float32, img photoImage, x0, y0 int) {
+	patchWH := d.patchSize * d.patchSize
+
+	for c := 0; c < ImageDepthRGB; c++ {
+		srcPlane := c * img.w * img.h
+		dstPlane := c * patchWH
+
+		for y := 0; y < d.patchSize; y++ {
+			srcRow := (y0+y)*img.w + x0
+			dstRow := y * d.patchSize
+			copy(
+				out[dstPlane+dstRow:dstPlane+dstRow+d.patchSize],
+				img.data[srcPlane+srcRow:srcPlane+srcRow+d.patchSize],
+			)
+		}
+	}
+}
+
 func decodeImage(path string) (photoImage, error) {
 	f, err := os.Open(path)
 	if err != nil {
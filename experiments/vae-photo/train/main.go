@@ -2,14 +2,18 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
+	"github.com/atkhx/metal/dataset"
 	vaephoto "github.com/atkhx/metal/experiments/vae-photo/pkg"
 	"github.com/atkhx/metal/mtl"
+	"github.com/atkhx/metal/nn/model"
 	"github.com/atkhx/metal/nn/proc"
 )
 
@@ -18,10 +22,12 @@ var (
 	latentDim     = vaephoto.PhotoLatentDim
 	epochs        = 5000
 	statSize      = 100
+	trainSeed     = int64(1)
 	klBeta        = float32(latentDim) / float32(vaephoto.PhotoPatchSize*vaephoto.PhotoPatchSize*vaephoto.ImageDepthRGB)
 
 	datasetPath = "./data/vae-photo/data"
 	weightsFile = "./data/vae-photo/model.json"
+	stateFile   = "./data/vae-photo/training.json"
 )
 
 func main() {
@@ -37,24 +43,20 @@ func main() {
 
 	device := proc.NewWithSystemDefaultDevice()
 	defer device.Release()
+	device.SetSeed(trainSeed)
 
-	optimizer := device.GetOptimizerAdam(epochs, 0.9, 0.99, 0.0003, 0.000000001)
+	optimizer := device.GetOptimizerAdam(0.9, 0.99, 0.0003, 0.000000001)
 
 	vaeModel := vaephoto.CreatePhotoVAETrainModel(miniBatchSize, latentDim, device, optimizer)
 	vaeModel.Compile()
 
-	if err = vaeModel.LoadFromFile(weightsFile); err != nil {
+	if _, err = vaeModel.LoadFromFileWith(weightsFile, model.LoadOptions{SkipMissingFile: true}); err != nil {
 		return
 	}
 
 	input, output := vaeModel.GetInput(), vaeModel.GetOutput()
 
 	fmt.Println("input:", input.Dims, "output:", output.Dims)
-	defer func() {
-		if err := vaeModel.SaveToFile(weightsFile); err != nil {
-			log.Fatalln(err)
-		}
-	}()
 
 	reconLoss := device.BinaryCrossEntropy(output, input)
 	reconMean := device.Mean(reconLoss)
@@ -66,6 +68,7 @@ func main() {
 	klWeight := device.NewDataWithValues(klMean.Dims, []float32{klBeta})
 	totalLoss := device.Add(reconMean, device.MulEqual(klMean, klWeight))
 	pipeline := device.GetTrainingPipeline(totalLoss)
+	fmt.Println("memory plan:", pipeline.PlanMemory())
 
 	trainDataset, err := vaephoto.LoadPhotoDataset(datasetPath, vaephoto.PhotoPatchSize)
 	if err != nil {
@@ -73,35 +76,35 @@ func main() {
 		return
 	}
 
+	loader := dataset.NewLoader(trainDataset, miniBatchSize, trainSeed)
+	state, err := vaeModel.LoadTrainingState(stateFile)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		err = nil
+	case err != nil:
+		return
+	default:
+		loader.Seek(state.Cursor)
+		fmt.Println("resume from iteration:", state.Step)
+	}
+
 	var t = time.Now()
 	var lossAvg float32
-	for iteration := 0; iteration < epochs; iteration++ {
-		select {
-		case <-ctx.Done():
-			return
-		default:
+	var iteration int
+	for iteration = state.Step; iteration < epochs; iteration++ {
+		if ctx.Err() != nil {
+			break
 		}
 
-		//t0 := time.Now()
-		//t1 := time.Now()
-		trainDataset.ReadRandomSampleBatchTo(miniBatchSize, input.Data.GetFloats())
-		//sampleDuration := time.Since(t1)
-		//t1 = time.Now()
-		//var trainDuration, updateDuration time.Duration
+		var batch dataset.Sample
+		if batch, err = loader.NextBatch(); err != nil {
+			return
+		}
+		copy(input.Data.GetFloats(), batch.Input)
 		pipeline.TrainIteration(func(b *mtl.CommandBuffer) {
-			//trainDuration = time.Since(t1)
-			//t1 = time.Now()
 			vaeModel.Update(b, iteration)
-			//updateDuration = time.Since(t1)
 		})
 
-		//totalDuration := time.Since(t0)
-		//fmt.Println("sample:", sampleDuration, "\ttrain:", trainDuration, "\tupdate:", updateDuration, "\ttotal:", totalDuration)
-		//fmt.Println("sample:", sampleDuration, "\ttotal:", totalDuration)
-
-		// sample: _24.083µs       train: 267.125µs        update: 13.917µs        total: 49.560792ms
-		// sample: 246.083µs       train: 323.833µs        update: 14.958µs        total: 444.254ms
-
 		lossAvg += totalLoss.Data.GetFloats()[0]
 		if (iteration > 0 || statSize == 1) && iteration%statSize == 0 {
 			lossAvg /= float32(statSize)
@@ -114,4 +117,12 @@ func main() {
 			t = time.Now()
 		}
 	}
+
+	if err = vaeModel.SaveToFile(weightsFile); err != nil {
+		return
+	}
+	err = vaeModel.SaveTrainingState(stateFile, model.TrainingState{
+		Step:   iteration,
+		Cursor: loader.Cursor(),
+	})
 }
@@ -15,6 +15,7 @@ import (
 	cifar_10 "github.com/atkhx/metal/dataset/cifar-10"
 	"github.com/atkhx/metal/experiments/vae/pkg"
 	"github.com/atkhx/metal/mtl"
+	"github.com/atkhx/metal/nn/model"
 	"github.com/atkhx/metal/nn/proc"
 )
 
@@ -77,11 +78,11 @@ func main() {
 		vaeModel.Compile()
 	}
 
-	if err = vaeModel.LoadFromFile(weightsFile); err != nil {
+	if _, err = vaeModel.LoadFromFileWith(weightsFile, model.LoadOptions{IgnoreUnexpected: true}); err != nil {
 		return
 	}
 	if decoderModel != nil {
-		if err = decoderModel.LoadFromFile(weightsFile); err != nil {
+		if _, err = decoderModel.LoadFromFileWith(weightsFile, model.LoadOptions{IgnoreUnexpected: true}); err != nil {
 			return
 		}
 	}
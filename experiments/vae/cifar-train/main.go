@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -9,9 +10,11 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/atkhx/metal/dataset"
 	cifar_10 "github.com/atkhx/metal/dataset/cifar-10"
 	"github.com/atkhx/metal/experiments/vae/pkg"
 	"github.com/atkhx/metal/mtl"
+	"github.com/atkhx/metal/nn/model"
 	"github.com/atkhx/metal/nn/proc"
 )
 
@@ -20,11 +23,13 @@ var (
 	latentDim     = pkg.CIFARLatentDim
 	epochs        = 20000
 	statSize      = 100
+	trainSeed     = int64(1)
 	klBeta        = float32(latentDim) / float32(cifar_10.ImageSizeRGB)
 
 	datasetPath = "./data/cifar-10"
 	weightsPath = "./data/vae-cifar-10/"
 	weightsFile = weightsPath + "model.json"
+	stateFile   = weightsPath + "training.json"
 )
 
 func main() {
@@ -45,22 +50,17 @@ func main() {
 
 	device := proc.NewWithSystemDefaultDevice()
 	defer device.Release()
+	device.SetSeed(trainSeed)
 
-	optimizer := pkg.CreateOptimizer(epochs, device)
+	optimizer := pkg.CreateOptimizer(device)
 
 	vaeModel := pkg.CreateCifarVAETrainModel(miniBatchSize, latentDim, device, optimizer)
 	vaeModel.Compile()
 
-	if err = vaeModel.LoadFromFile(weightsFile); err != nil {
+	if _, err = vaeModel.LoadFromFileWith(weightsFile, model.LoadOptions{SkipMissingFile: true}); err != nil {
 		return
 	}
 
-	defer func() {
-		if err := vaeModel.SaveToFile(weightsFile); err != nil {
-			log.Fatalln(err)
-		}
-	}()
-
 	input, output := vaeModel.GetInput(), vaeModel.GetOutput()
 
 	reconLoss := device.BinaryCrossEntropy(output, input)
@@ -73,6 +73,7 @@ func main() {
 	klWeight := device.NewDataWithValues(klMean.Dims, []float32{klBeta})
 	totalLoss := device.Add(reconMean, device.MulEqual(klMean, klWeight))
 	pipeline := device.GetTrainingPipeline(totalLoss)
+	fmt.Println("memory plan:", pipeline.PlanMemory())
 
 	trainDataset, err := cifar_10.CreateTrainingDataset(datasetPath)
 	if err != nil {
@@ -80,17 +81,31 @@ func main() {
 		return
 	}
 
+	loader := dataset.NewLoader(trainDataset, miniBatchSize, trainSeed)
+	state, err := vaeModel.LoadTrainingState(stateFile)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		err = nil
+	case err != nil:
+		return
+	default:
+		loader.Seek(state.Cursor)
+		fmt.Println("resume from iteration:", state.Step)
+	}
+
 	var t = time.Now()
 	var lossAvg float32
-	for iteration := 0; iteration < epochs; iteration++ {
-		select {
-		case <-ctx.Done():
-			return
-		default:
+	var iteration int
+	for iteration = state.Step; iteration < epochs; iteration++ {
+		if ctx.Err() != nil {
+			break
 		}
 
-		batchInput, _ := trainDataset.ReadRandomSampleBatch(miniBatchSize)
-		copy(input.Data.GetFloats(), batchInput.Input)
+		var batch dataset.Sample
+		if batch, err = loader.NextBatch(); err != nil {
+			return
+		}
+		copy(input.Data.GetFloats(), batch.Input)
 		pipeline.TrainIteration(func(b *mtl.CommandBuffer) {
 			vaeModel.Update(b, iteration)
 		})
@@ -107,4 +122,12 @@ func main() {
 			t = time.Now()
 		}
 	}
+
+	if err = vaeModel.SaveToFile(weightsFile); err != nil {
+		return
+	}
+	err = vaeModel.SaveTrainingState(stateFile, model.TrainingState{
+		Step:   iteration,
+		Cursor: loader.Cursor(),
+	})
 }
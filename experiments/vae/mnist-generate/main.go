@@ -15,6 +15,7 @@ import (
 	"github.com/atkhx/metal/dataset/mnist"
 	"github.com/atkhx/metal/experiments/vae/pkg"
 	"github.com/atkhx/metal/mtl"
+	"github.com/atkhx/metal/nn/model"
 	"github.com/atkhx/metal/nn/proc"
 )
 
@@ -78,11 +79,11 @@ func main() {
 		vaeModel.Compile()
 	}
 
-	if err = vaeModel.LoadFromFile(weightsFile); err != nil {
+	if _, err = vaeModel.LoadFromFileWith(weightsFile, model.LoadOptions{IgnoreUnexpected: true}); err != nil {
 		return
 	}
 	if decoderModel != nil {
-		if err = decoderModel.LoadFromFile(weightsFile); err != nil {
+		if _, err = decoderModel.LoadFromFileWith(weightsFile, model.LoadOptions{IgnoreUnexpected: true}); err != nil {
 			return
 		}
 	}
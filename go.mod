@@ -2,13 +2,16 @@ module github.com/atkhx/metal
 
 go 1.21.1
 
+require (
+	github.com/json-iterator/go v1.1.12
+	github.com/stretchr/testify v1.8.4
+)
+
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
-	github.com/json-iterator/go v1.1.12 // indirect
 	github.com/modern-go/concurrent v0.0.0-20180228061459-e0a39a4cb421 // indirect
 	github.com/modern-go/reflect2 v1.0.2 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
 	github.com/stretchr/objx v0.5.0 // indirect
-	github.com/stretchr/testify v1.8.4 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -70,7 +70,13 @@ type Matrix struct {
 	id unsafe.Pointer
 }
 
+// CreateMatrixWithBuffer wraps buffer into a matrix. A nil buffer gives a nil matrix:
+// kernels create gradient matrices this way for graphs built without gradients.
 func CreateMatrixWithBuffer(descriptor *MatrixDescriptor, buffer *mtl.Buffer, offset int) *Matrix {
+	if buffer == nil {
+		return nil
+	}
+
 	id := unsafe.Pointer(C.mpsMatrixInitWithBuffer(
 		buffer.GetID(),
 		descriptor.GetID(),
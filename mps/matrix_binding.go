@@ -0,0 +1,37 @@
+package mps
+
+import "github.com/atkhx/metal/mtl"
+
+// MatrixBinding is a matrix over the buffer held by a pointer. The matrix is created on first use
+// and recreated when the buffer behind the pointer is replaced, e.g. by a memory planner.
+type MatrixBinding struct {
+	descriptor *MatrixDescriptor
+	buffer     **mtl.Buffer
+	offset     int
+
+	bound  *mtl.Buffer
+	matrix *Matrix
+}
+
+func NewMatrixBinding(descriptor *MatrixDescriptor, buffer **mtl.Buffer, offset int) *MatrixBinding {
+	return &MatrixBinding{descriptor: descriptor, buffer: buffer, offset: offset}
+}
+
+// Matrix returns the matrix over the current buffer, nil for a nil buffer.
+func (m *MatrixBinding) Matrix() *Matrix {
+	if m.matrix != nil && m.bound == *m.buffer {
+		return m.matrix
+	}
+
+	m.Release()
+	m.bound = *m.buffer
+	m.matrix = CreateMatrixWithBuffer(m.descriptor, m.bound, m.offset)
+	return m.matrix
+}
+
+func (m *MatrixBinding) Release() {
+	if m.matrix != nil {
+		m.matrix.Release()
+		m.matrix = nil
+	}
+}
@@ -0,0 +1,33 @@
+package mps
+
+import (
+	"testing"
+
+	"github.com/atkhx/metal/mtl"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatrixBinding(t *testing.T) {
+	device := mtl.MustCreateSystemDefaultDevice()
+	defer device.Release()
+
+	descriptor := CreateMatrixDescriptorFloat32(2, 2, 1, 4)
+	defer descriptor.Release()
+
+	buffer := device.NewBufferWithFloats([]float32{1, 2, 3, 4}, mtl.ResourceStorageModeShared)
+	other := device.NewBufferWithFloats([]float32{5, 6, 7, 8}, mtl.ResourceStorageModeShared)
+
+	binding := NewMatrixBinding(descriptor, &buffer, 0)
+	defer binding.Release()
+
+	matrix := binding.Matrix()
+	require.Same(t, matrix, binding.Matrix())
+	require.Equal(t, []float32{1, 2, 3, 4}, binding.Matrix().GetData().GetFloats())
+
+	buffer = other
+	require.NotSame(t, matrix, binding.Matrix())
+	require.Equal(t, []float32{5, 6, 7, 8}, binding.Matrix().GetData().GetFloats())
+
+	buffer = nil
+	require.Nil(t, binding.Matrix())
+}
@@ -102,6 +102,19 @@ func (b *CommandBuffer) GetStatus() uint64 {
 	return uint64(C.mtlCommandBufferGetStatus(b.id))
 }
 
+// Flush commits the work encoded so far, waits for it and continues with a new command buffer
+// of the same queue. Code holding b keeps encoding into it as if nothing happened,
+// and the host can read or write shared buffers in between.
+func (b *CommandBuffer) Flush() {
+	queue := C.mtlCommandBufferGetCommandQueue(b.id)
+
+	b.Commit()
+	b.WaitUntilCompleted()
+	b.Release()
+
+	b.id = CreateCommandQueue(queue).GetNewMTLCommandBuffer().id
+}
+
 func (b *CommandBuffer) GetMTLBlitCommandEncoderID() unsafe.Pointer {
 	return unsafe.Pointer(C.mtlCommandBufferGetMTLBlitCommandEncoder(b.id))
 }
@@ -0,0 +1,39 @@
+package mtl
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMTLCommandBuffer_Flush(t *testing.T) {
+	device, err := CreateSystemDefaultDevice()
+	require.NoError(t, err)
+	defer device.Release()
+
+	commandQueue := device.NewCommandQueue()
+	defer commandQueue.Release()
+
+	commandBuffer := commandQueue.GetNewMTLCommandBuffer()
+	defer commandBuffer.Release()
+
+	buffer := device.NewBufferWithBytes([]byte{1, 2, 3, 4}, ResourceStorageModeShared)
+	defer buffer.Release()
+
+	encoder := commandBuffer.GetMTLBlitCommandEncoder()
+	encoder.FillBuffer(buffer, NSRange{0, 2}, 0)
+	encoder.EndEncoding()
+
+	commandBuffer.Flush()
+	require.Equal(t, []byte{0, 0, 3, 4}, buffer.GetBytes())
+
+	buffer.GetBytes()[3] = 9
+
+	encoder = commandBuffer.GetMTLBlitCommandEncoder()
+	encoder.FillBuffer(buffer, NSRange{2, 1}, 7)
+	encoder.EndEncoding()
+	commandBuffer.Commit()
+	commandBuffer.WaitUntilCompleted()
+
+	require.Equal(t, []byte{0, 0, 7, 9}, buffer.GetBytes())
+}
@@ -0,0 +1,52 @@
+package layer
+
+import (
+	"fmt"
+
+	"github.com/atkhx/metal/nn/num"
+	"github.com/atkhx/metal/nn/proc"
+)
+
+// AvgPool2D applies 2D average pooling over width/height.
+type AvgPool2D struct {
+	poolSize        int
+	stride          int
+	padding         int
+	countIncludePad bool
+}
+
+func NewAvgPool2D(poolSize, stride, padding int, countIncludePad bool) *AvgPool2D {
+	if poolSize < 1 {
+		panic("AvgPool2D: poolSize must be >= 1")
+	}
+	if stride < 1 {
+		stride = poolSize
+	}
+	if padding < 0 {
+		padding = 0
+	}
+	return &AvgPool2D{
+		poolSize:        poolSize,
+		stride:          stride,
+		padding:         padding,
+		countIncludePad: countIncludePad,
+	}
+}
+
+func (l *AvgPool2D) Compile(device *proc.Device, input *num.Data) *num.Data {
+	if input.Dims.W+2*l.padding < l.poolSize || input.Dims.H+2*l.padding < l.poolSize {
+		panic(fmt.Sprintf("AvgPool2D: poolSize=%d exceeds input %dx%d", l.poolSize, input.Dims.W, input.Dims.H))
+	}
+	return device.AvgPool2D(input, l.poolSize, l.padding, l.stride, l.countIncludePad)
+}
+
+// GlobalAvgPool averages every channel of every image: (W, H, D) -> (1, 1, D).
+type GlobalAvgPool struct{}
+
+func NewGlobalAvgPool() *GlobalAvgPool {
+	return &GlobalAvgPool{}
+}
+
+func (l *GlobalAvgPool) Compile(device *proc.Device, input *num.Data) *num.Data {
+	return device.GlobalAvgPool(input)
+}
@@ -0,0 +1,115 @@
+package layer
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/atkhx/metal/mtl"
+	"github.com/atkhx/metal/nn/num"
+	"github.com/atkhx/metal/nn/proc"
+)
+
+// BatchNorm2D normalizes conv feature maps per channel using batch statistics in training mode
+// and running statistics in inference mode. Layers start in training mode.
+type BatchNorm2D struct {
+	channels  int
+	batchSize int
+	eps       float32
+	momentum  float32
+	training  bool
+
+	gamma       *num.Data
+	beta        *num.Data
+	runningMean *num.Data
+	runningVar  *num.Data
+	forUpdate   []*num.Data
+}
+
+func NewBatchNorm2D(channels, batchSize int, eps, momentum float32) *BatchNorm2D {
+	if eps <= 0 {
+		eps = 1e-5
+	}
+	if momentum <= 0 {
+		momentum = 0.1
+	}
+	if batchSize < 1 {
+		batchSize = 1
+	}
+	return &BatchNorm2D{
+		channels:  channels,
+		batchSize: batchSize,
+		eps:       eps,
+		momentum:  momentum,
+		training:  true,
+	}
+}
+
+func (l *BatchNorm2D) Compile(device *proc.Device, input *num.Data) *num.Data {
+	if input.Dims.D != l.channels*l.batchSize {
+		panic(fmt.Sprintf("BatchNorm2D: expected depth=%d got %d", l.channels*l.batchSize, input.Dims.D))
+	}
+
+	dims := mtl.NewMTLSize(1, 1, l.channels)
+	l.gamma = device.NewDataWithValues(dims, ones(l.channels))
+	l.beta = device.NewData(dims)
+	l.runningMean = device.NewData(dims)
+	l.runningVar = device.NewDataWithValues(dims, ones(l.channels))
+	l.forUpdate = []*num.Data{l.gamma, l.beta}
+	num.TagParams(num.ParamNorm, l.gamma, l.beta)
+
+	return device.BatchNorm2D(input, l.gamma, l.beta, l.runningMean, l.runningVar, l.batchSize, l.eps, l.momentum, &l.training)
+}
+
+func (l *BatchNorm2D) SetTraining(training bool) {
+	l.training = training
+}
+
+func (l *BatchNorm2D) ForUpdate() []*num.Data {
+	return l.forUpdate
+}
+
+func (l *BatchNorm2D) Params() []Param {
+	return []Param{
+		{Name: "weight", Data: l.gamma},
+		{Name: "bias", Data: l.beta},
+		{Name: "running_mean", Data: l.runningMean},
+		{Name: "running_var", Data: l.runningVar},
+	}
+}
+
+type batchNorm2DConfig struct {
+	Gamma       []float32
+	Beta        []float32
+	RunningMean []float32
+	RunningVar  []float32
+}
+
+func (l *BatchNorm2D) MarshalJSON() ([]byte, error) {
+	return json.Marshal(batchNorm2DConfig{
+		Gamma:       l.gamma.Data.GetFloats(),
+		Beta:        l.beta.Data.GetFloats(),
+		RunningMean: l.runningMean.Data.GetFloats(),
+		RunningVar:  l.runningVar.Data.GetFloats(),
+	})
+}
+
+func (l *BatchNorm2D) UnmarshalJSON(bytes []byte) error {
+	var cfg batchNorm2DConfig
+	if err := json.Unmarshal(bytes, &cfg); err != nil {
+		return err
+	}
+	return loadWeights("batch norm",
+		weightValues{name: "gamma", node: l.gamma, values: cfg.Gamma},
+		weightValues{name: "beta", node: l.beta, values: cfg.Beta},
+		weightValues{name: "running mean", node: l.runningMean, values: cfg.RunningMean},
+		weightValues{name: "running var", node: l.runningVar, values: cfg.RunningVar},
+	)
+}
+
+func ones(n int) []float32 {
+	values := make([]float32, n)
+	for i := range values {
+		values[i] = 1
+	}
+	return values
+}
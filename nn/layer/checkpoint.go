@@ -0,0 +1,42 @@
+package layer
+
+import (
+	"github.com/atkhx/metal/nn/num"
+	"github.com/atkhx/metal/nn/proc"
+)
+
+// NewCheckpoint wraps layers into a checkpoint segment: only its input is kept after forward,
+// activations of the layers are recomputed in backward (see proc.Device.Checkpoint).
+// The training pipeline must call PlanMemory to reuse the freed buffers.
+func NewCheckpoint(layers Layers) *Checkpoint {
+	return &Checkpoint{Layers: layers}
+}
+
+type Checkpoint struct {
+	Layers Layers
+}
+
+func (l *Checkpoint) Compile(device *proc.Device, input *num.Data) *num.Data {
+	_, output := l.Layers.Compile(device, input)
+	return device.Checkpoint(input, output)
+}
+
+func (l *Checkpoint) ForUpdate() []*num.Data {
+	return l.Layers.ForUpdate()
+}
+
+func (l *Checkpoint) Adapters() []*LoRA {
+	return l.Layers.Adapters()
+}
+
+func (l *Checkpoint) Params() []Param {
+	return l.Layers.Params()
+}
+
+func (l *Checkpoint) LoadFromProvider() {
+	l.Layers.LoadFromProvider()
+}
+
+func (l *Checkpoint) SetTraining(training bool) {
+	l.Layers.SetTraining(training)
+}
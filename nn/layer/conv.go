@@ -2,7 +2,6 @@ package layer
 
 import (
 	"encoding/json"
-	"fmt"
 
 	"github.com/atkhx/metal/mtl"
 	"github.com/atkhx/metal/nn/initializer"
@@ -18,24 +17,40 @@ func NewConv(
 	stride int,
 	initWeights initializer.Initializer,
 	provideWeights func(weights *num.Data),
+) *Conv {
+	return NewConv2D(filterSize, filterSize, filtersCount, batchSize, proc.ConvParams{
+		StrideW:  stride,
+		StrideH:  stride,
+		PaddingW: padding,
+		PaddingH: padding,
+	}, initWeights, provideWeights)
+}
+
+// NewConv2D creates convolution with rectangular filterW x filterH kernel
+// and independent stride, padding and dilation per axis.
+func NewConv2D(
+	filterW int,
+	filterH int,
+	filtersCount int,
+	batchSize int,
+	params proc.ConvParams,
+	initWeights initializer.Initializer,
+	provideWeights func(weights *num.Data),
 ) *Conv {
 	if initWeights == nil {
 		initWeights = initializer.KaimingNormalReLU
 	}
-	if stride < 1 {
-		stride = 1
-	}
 	if batchSize < 1 {
 		batchSize = 1
 	}
 	return &Conv{
 		initWeights:    initWeights,
 		provideWeights: provideWeights,
-		filterSize:     filterSize,
+		filterW:        filterW,
+		filterH:        filterH,
 		filtersCount:   filtersCount,
 		batchSize:      batchSize,
-		padding:        padding,
-		stride:         stride,
+		params:         params.Normalize(),
 	}
 }
 
@@ -43,11 +58,11 @@ type Conv struct {
 	initWeights    initializer.Initializer
 	provideWeights func(weights *num.Data)
 
-	filterSize   int
+	filterW      int
+	filterH      int
 	filtersCount int
 	batchSize    int
-	padding      int
-	stride       int
+	params       proc.ConvParams
 
 	// weights are stored in MPS layout: [out][kH][kW][in]
 	weightObj *num.Data
@@ -68,31 +83,31 @@ func (l *Conv) Compile(device *proc.Device, input *num.Data) *num.Data {
 	if input.Dims.D%l.batchSize != 0 {
 		panic("Conv: input depth must be divisible by batchSize")
 	}
-	if l.padding != 0 && l.padding != 1 {
-		panic(fmt.Sprintf("Conv: padding %d not supported (only 0 or 1)", l.padding))
-	}
-	if l.stride != 1 {
-		panic(fmt.Sprintf("Conv: stride %d not supported (only 1)", l.stride))
-	}
 
 	filterDepth := input.Dims.D / l.batchSize
-	fanIn := l.filterSize * l.filterSize * filterDepth
-	fanOut := l.filterSize * l.filterSize * l.filtersCount
+	fanIn := l.filterW * l.filterH * filterDepth
+	fanOut := l.filterW * l.filterH * l.filtersCount
 
-	mFilterSize := mtl.NewMTLSize(l.filterSize, l.filterSize, filterDepth*l.filtersCount)
+	mFilterSize := mtl.NewMTLSize(l.filterW, l.filterH, filterDepth*l.filtersCount)
 
 	// Init weights in OIHW then reorder to MPS layout OHWI.
 	l.weightObj = initWeights(device, l.initWeights, mFilterSize, fanIn, fanOut)
 	l.biasesObj = device.NewData(mtl.NewMTLSize(1, 1, l.filtersCount))
 	l.forUpdate = []*num.Data{l.weightObj, l.biasesObj}
+	num.TagParams(num.ParamWeight, l.weightObj)
+	num.TagParams(num.ParamBias, l.biasesObj)
 
-	return device.Conv(input, l.weightObj, l.biasesObj, l.filtersCount, l.batchSize, l.padding, l.stride)
+	return device.Conv2D(input, l.weightObj, l.biasesObj, l.filtersCount, l.batchSize, l.params)
 }
 
 func (l *Conv) ForUpdate() []*num.Data {
 	return l.forUpdate
 }
 
+func (l *Conv) Params() []Param {
+	return []Param{{Name: "weight", Data: l.weightObj}, {Name: "bias", Data: l.biasesObj}}
+}
+
 type convConfig struct {
 	Weights []float32
 	Bias    []float32
@@ -106,11 +121,14 @@ func (l *Conv) MarshalJSON() ([]byte, error) {
 }
 
 func (l *Conv) UnmarshalJSON(bytes []byte) error {
-	cfg := convConfig{
-		Weights: l.weightObj.Data.GetFloats(),
-		Bias:    l.biasesObj.Data.GetFloats(),
+	var cfg convConfig
+	if err := json.Unmarshal(bytes, &cfg); err != nil {
+		return err
 	}
-	return json.Unmarshal(bytes, &cfg)
+	return loadWeights("conv",
+		weightValues{name: "weights", node: l.weightObj, values: cfg.Weights},
+		weightValues{name: "bias", node: l.biasesObj, values: cfg.Bias},
+	)
 }
 
 func (l *Conv) LoadFromProvider() {
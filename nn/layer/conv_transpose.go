@@ -0,0 +1,115 @@
+package layer
+
+import (
+	"encoding/json"
+
+	"github.com/atkhx/metal/mtl"
+	"github.com/atkhx/metal/nn/initializer"
+	"github.com/atkhx/metal/nn/num"
+	"github.com/atkhx/metal/nn/proc"
+)
+
+// NewConvTranspose2D creates a learned upsampling layer (transposed convolution)
+// with filterW x filterH kernel producing filtersCount channels.
+func NewConvTranspose2D(
+	filterW int,
+	filterH int,
+	filtersCount int,
+	batchSize int,
+	params proc.ConvTransposeParams,
+	initWeights initializer.Initializer,
+	provideWeights func(weights *num.Data),
+) *ConvTranspose2D {
+	if initWeights == nil {
+		initWeights = initializer.KaimingNormalReLU
+	}
+	if batchSize < 1 {
+		batchSize = 1
+	}
+	return &ConvTranspose2D{
+		initWeights:    initWeights,
+		provideWeights: provideWeights,
+		filterW:        filterW,
+		filterH:        filterH,
+		filtersCount:   filtersCount,
+		batchSize:      batchSize,
+		params:         params.Normalize(),
+	}
+}
+
+type ConvTranspose2D struct {
+	initWeights    initializer.Initializer
+	provideWeights func(weights *num.Data)
+
+	filterW      int
+	filterH      int
+	filtersCount int
+	batchSize    int
+	params       proc.ConvTransposeParams
+
+	// weights are stored in [in][kH][kW][out] layout
+	weightObj *num.Data
+	biasesObj *num.Data
+
+	forUpdate []*num.Data
+}
+
+func (l *ConvTranspose2D) GetFiltersCount() int {
+	return l.filtersCount
+}
+
+func (l *ConvTranspose2D) GetWeights() *num.Data {
+	return l.weightObj
+}
+
+func (l *ConvTranspose2D) Compile(device *proc.Device, input *num.Data) *num.Data {
+	if input.Dims.D%l.batchSize != 0 {
+		panic("ConvTranspose2D: input depth must be divisible by batchSize")
+	}
+
+	inputChannels := input.Dims.D / l.batchSize
+	// Each output pixel receives contributions from kW*kH/(strideW*strideH) input pixels on average.
+	fanIn := l.filterW * l.filterH * inputChannels / (l.params.StrideW * l.params.StrideH)
+	if fanIn < 1 {
+		fanIn = 1
+	}
+	fanOut := l.filterW * l.filterH * l.filtersCount
+
+	l.weightObj = initWeights(device, l.initWeights, mtl.NewMTLSize(l.filterW, l.filterH, inputChannels*l.filtersCount), fanIn, fanOut)
+	l.biasesObj = device.NewData(mtl.NewMTLSize(1, 1, l.filtersCount))
+	l.forUpdate = []*num.Data{l.weightObj, l.biasesObj}
+	num.TagParams(num.ParamWeight, l.weightObj)
+	num.TagParams(num.ParamBias, l.biasesObj)
+
+	return device.ConvTranspose2D(input, l.weightObj, l.biasesObj, l.filtersCount, l.batchSize, l.params)
+}
+
+func (l *ConvTranspose2D) ForUpdate() []*num.Data {
+	return l.forUpdate
+}
+
+func (l *ConvTranspose2D) Params() []Param {
+	return []Param{{Name: "weight", Data: l.weightObj}, {Name: "bias", Data: l.biasesObj}}
+}
+
+func (l *ConvTranspose2D) MarshalJSON() ([]byte, error) {
+	return json.Marshal(convConfig{
+		Weights: l.weightObj.Data.GetFloats(),
+		Bias:    l.biasesObj.Data.GetFloats(),
+	})
+}
+
+func (l *ConvTranspose2D) UnmarshalJSON(bytes []byte) error {
+	var cfg convConfig
+	if err := json.Unmarshal(bytes, &cfg); err != nil {
+		return err
+	}
+	return loadWeights("conv transpose",
+		weightValues{name: "weights", node: l.weightObj, values: cfg.Weights},
+		weightValues{name: "bias", node: l.biasesObj, values: cfg.Bias},
+	)
+}
+
+func (l *ConvTranspose2D) LoadFromProvider() {
+	l.provideWeights(l.weightObj)
+}
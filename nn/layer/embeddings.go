@@ -11,6 +11,7 @@ func NewEmbeddings(
 	embeddings *num.Data,
 	provideWeights func(embeddings *num.Data),
 ) *Embeddings {
+	num.TagParams(num.ParamEmbedding, embeddings)
 	return &Embeddings{
 		embeddings:     embeddings,
 		provideWeights: provideWeights,
@@ -32,13 +33,20 @@ func (l *Embeddings) ForUpdate() []*num.Data {
 	return l.forUpdate
 }
 
+func (l *Embeddings) Params() []Param {
+	return []Param{{Name: "weight", Data: l.embeddings}}
+}
+
 func (l *Embeddings) MarshalJSON() ([]byte, error) {
 	return json.Marshal(l.embeddings.Data.GetFloats())
 }
 
 func (l *Embeddings) UnmarshalJSON(bytes []byte) error {
-	weights := l.embeddings.Data.GetFloats()
-	return json.Unmarshal(bytes, &weights)
+	var weights []float32
+	if err := json.Unmarshal(bytes, &weights); err != nil {
+		return err
+	}
+	return loadWeights("embeddings", weightValues{name: "table", node: l.embeddings, values: weights})
 }
 
 func (l *Embeddings) LoadFromProvider() {
@@ -0,0 +1,85 @@
+package layer
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/atkhx/metal/mtl"
+	"github.com/atkhx/metal/nn/num"
+	"github.com/atkhx/metal/nn/proc"
+)
+
+// GroupNorm normalizes groups of channels of every image independently of the batch.
+type GroupNorm struct {
+	channels    int
+	groupsCount int
+	batchSize   int
+	eps         float32
+
+	gamma     *num.Data
+	beta      *num.Data
+	forUpdate []*num.Data
+}
+
+func NewGroupNorm(channels, groupsCount, batchSize int, eps float32) *GroupNorm {
+	if eps <= 0 {
+		eps = 1e-5
+	}
+	if batchSize < 1 {
+		batchSize = 1
+	}
+	if groupsCount < 1 || channels%groupsCount != 0 {
+		panic(fmt.Sprintf("GroupNorm: channels %d must be divisible by groupsCount %d", channels, groupsCount))
+	}
+	return &GroupNorm{
+		channels:    channels,
+		groupsCount: groupsCount,
+		batchSize:   batchSize,
+		eps:         eps,
+	}
+}
+
+func (l *GroupNorm) Compile(device *proc.Device, input *num.Data) *num.Data {
+	if input.Dims.D != l.channels*l.batchSize {
+		panic(fmt.Sprintf("GroupNorm: expected depth=%d got %d", l.channels*l.batchSize, input.Dims.D))
+	}
+
+	dims := mtl.NewMTLSize(1, 1, l.channels)
+	l.gamma = device.NewDataWithValues(dims, ones(l.channels))
+	l.beta = device.NewData(dims)
+	l.forUpdate = []*num.Data{l.gamma, l.beta}
+	num.TagParams(num.ParamNorm, l.gamma, l.beta)
+
+	return device.GroupNorm(input, l.gamma, l.beta, l.groupsCount, l.batchSize, l.eps)
+}
+
+func (l *GroupNorm) ForUpdate() []*num.Data {
+	return l.forUpdate
+}
+
+func (l *GroupNorm) Params() []Param {
+	return []Param{{Name: "weight", Data: l.gamma}, {Name: "bias", Data: l.beta}}
+}
+
+type groupNormConfig struct {
+	Gamma []float32
+	Beta  []float32
+}
+
+func (l *GroupNorm) MarshalJSON() ([]byte, error) {
+	return json.Marshal(groupNormConfig{
+		Gamma: l.gamma.Data.GetFloats(),
+		Beta:  l.beta.Data.GetFloats(),
+	})
+}
+
+func (l *GroupNorm) UnmarshalJSON(bytes []byte) error {
+	var cfg groupNormConfig
+	if err := json.Unmarshal(bytes, &cfg); err != nil {
+		return err
+	}
+	return loadWeights("group norm",
+		weightValues{name: "gamma", node: l.gamma, values: cfg.Gamma},
+		weightValues{name: "beta", node: l.beta, values: cfg.Beta},
+	)
+}
@@ -16,3 +16,18 @@ type Updatable interface {
 type WithWeightsProvider interface {
 	LoadFromProvider()
 }
+
+// WithParams is implemented by layers with params and by containers of layers, see Param.
+type WithParams interface {
+	Params() []Param
+}
+
+// WithAdapters is implemented by layers LoRA adapters can be attached to and by containers of layers.
+type WithAdapters interface {
+	Adapters() []*LoRA
+}
+
+// WithTrainingMode is implemented by layers that behave differently in training and inference.
+type WithTrainingMode interface {
+	SetTraining(training bool)
+}
@@ -46,6 +46,7 @@ func (l *LayerNormAffine) Compile(device *proc.Device, input *num.Data) *num.Dat
 	l.gamma = device.NewDataWithValues(mtl.NewMTLSize(l.width), values)
 	l.beta = device.NewData(mtl.NewMTLSize(l.width))
 	l.forUpdate = []*num.Data{l.gamma, l.beta}
+	num.TagParams(num.ParamNorm, l.gamma, l.beta)
 
 	out := input
 	out = device.LayerNorm(out, l.width, l.eps)
@@ -58,6 +59,10 @@ func (l *LayerNormAffine) ForUpdate() []*num.Data {
 	return l.forUpdate
 }
 
+func (l *LayerNormAffine) Params() []Param {
+	return []Param{{Name: "weight", Data: l.gamma}, {Name: "bias", Data: l.beta}}
+}
+
 func (l *LayerNormAffine) LoadFromProvider() {
 	if l.provideWeights != nil {
 		l.provideWeights(l.gamma, l.beta)
@@ -46,6 +46,7 @@ func (l *LayerNormAffineOpt) Compile(device *proc.Device, input *num.Data) *num.
 	l.gamma = device.NewDataWithValues(mtl.NewMTLSize(l.width), values)
 	l.beta = device.NewData(mtl.NewMTLSize(l.width))
 	l.forUpdate = []*num.Data{l.gamma, l.beta}
+	num.TagParams(num.ParamNorm, l.gamma, l.beta)
 
 	out := input
 	out = device.LayerNormOpt(out, l.width, l.eps)
@@ -58,6 +59,10 @@ func (l *LayerNormAffineOpt) ForUpdate() []*num.Data {
 	return l.forUpdate
 }
 
+func (l *LayerNormAffineOpt) Params() []Param {
+	return []Param{{Name: "weight", Data: l.gamma}, {Name: "bias", Data: l.beta}}
+}
+
 func (l *LayerNormAffineOpt) LoadFromProvider() {
 	if l.provideWeights != nil {
 		l.provideWeights(l.gamma, l.beta)
@@ -1,6 +1,9 @@
 package layer
 
 import (
+	"fmt"
+	"strings"
+
 	"github.com/atkhx/metal/nn/num"
 	"github.com/atkhx/metal/nn/proc"
 )
@@ -27,6 +30,16 @@ func (s Layers) ForUpdate() []*num.Data {
 	return result
 }
 
+func (s Layers) Adapters() []*LoRA {
+	var result []*LoRA
+	for _, layer := range s {
+		if l, ok := layer.(WithAdapters); ok {
+			result = append(result, l.Adapters()...)
+		}
+	}
+	return result
+}
+
 func (s Layers) LoadFromProvider() {
 	for _, ll := range s {
 		if l, ok := ll.(WithWeightsProvider); ok {
@@ -34,3 +47,53 @@ func (s Layers) LoadFromProvider() {
 		}
 	}
 }
+
+func (s Layers) SetTraining(training bool) {
+	for _, ll := range s {
+		if l, ok := ll.(WithTrainingMode); ok {
+			l.SetTraining(training)
+		}
+	}
+}
+
+// Architecture describes types and names of layers including nested ones, e.g. for fingerprints
+// of models. Checkpoint segments don't change it.
+func (s Layers) Architecture() string {
+	return strings.Join(s.describe(), " ")
+}
+
+func (s Layers) describe() []string {
+	var result []string
+	for _, layer := range s {
+		result = append(result, describeLayer(layer)...)
+	}
+	return result
+}
+
+func describeLayer(layer Layer) []string {
+	nested := func(layers Layers) []string {
+		result := []string{fmt.Sprintf("%T[", layer)}
+		result = append(result, layers.describe()...)
+		return append(result, "]")
+	}
+
+	switch l := layer.(type) {
+	case *NamedLayer:
+		if l.Name == "" {
+			return describeLayer(l.Layer)
+		}
+		return append([]string{l.Name + ":"}, describeLayer(l.Layer)...)
+	case *Checkpoint:
+		return l.Layers.describe()
+	case *Residual:
+		return nested(l.Layers)
+	case *LayersBlock:
+		return nested(l.Layers)
+	case *VAEEncoder:
+		return nested(l.Layers)
+	case *VAEDecoder:
+		return nested(l.Layers)
+	default:
+		return []string{fmt.Sprintf("%T", layer)}
+	}
+}
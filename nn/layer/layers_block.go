@@ -18,6 +18,18 @@ func (l *LayersBlock) ForUpdate() []*num.Data {
 	return l.Layers.ForUpdate()
 }
 
+func (l *LayersBlock) Adapters() []*LoRA {
+	return l.Layers.Adapters()
+}
+
+func (l *LayersBlock) Params() []Param {
+	return l.Layers.Params()
+}
+
 func (l *LayersBlock) LoadFromProvider() {
 	l.Layers.LoadFromProvider()
 }
+
+func (l *LayersBlock) SetTraining(training bool) {
+	l.Layers.SetTraining(training)
+}
@@ -2,6 +2,7 @@ package layer
 
 import (
 	"encoding/json"
+	"fmt"
 
 	"github.com/atkhx/metal/mtl"
 	"github.com/atkhx/metal/nn/initializer"
@@ -37,6 +38,15 @@ type Linear struct {
 
 	output    *num.Data
 	forUpdate []*num.Data
+
+	lora *LoRA
+}
+
+// WithLoRA attaches a LoRA adapter to the weights, it must be called before Compile.
+// The weights and the bias are frozen, only the adapter is trained.
+func (l *Linear) WithLoRA(cfg LoRAConfig) *Linear {
+	l.lora = newLoRA(cfg)
+	return l
 }
 
 func (l *Linear) GetWeights() *num.Data {
@@ -48,16 +58,20 @@ func (l *Linear) Compile(device *proc.Device, input *num.Data) *num.Data {
 	outputDims := mtl.NewMTLSize(l.featuresCount, inputWidth)
 	l.weightObj = initWeights(device, l.initWeights, outputDims, inputWidth, l.featuresCount)
 	l.forUpdate = []*num.Data{l.weightObj}
+	num.TagParams(num.ParamWeight, l.weightObj)
 
 	result := device.MatrixMultiply(input, l.weightObj, 1)
+	result = l.lora.apply(device, result, input, l.weightObj, false)
 
 	if l.withBias {
 		l.biasesObj = device.NewData(mtl.NewMTLSize(l.featuresCount))
 		l.forUpdate = append(l.forUpdate, l.biasesObj)
+		num.TagParams(num.ParamBias, l.biasesObj)
 
 		result = device.AddRow(result, l.biasesObj, l.featuresCount)
 	}
 
+	l.forUpdate = withLoRA(l.forUpdate, l.lora)
 	l.output = result
 	return result
 }
@@ -70,6 +84,18 @@ func (l *Linear) ForUpdate() []*num.Data {
 	return l.forUpdate
 }
 
+func (l *Linear) Params() []Param {
+	params := []Param{{Name: "weight", Data: l.weightObj}}
+	if l.biasesObj != nil {
+		params = append(params, Param{Name: "bias", Data: l.biasesObj})
+	}
+	return append(params, loraParams("", l.lora)...)
+}
+
+func (l *Linear) Adapters() []*LoRA {
+	return nonNilAdapters(l.lora)
+}
+
 type linearConfig struct {
 	WithBias bool
 	Weights  []float32
@@ -88,14 +114,19 @@ func (l *Linear) MarshalJSON() ([]byte, error) {
 }
 
 func (l *Linear) UnmarshalJSON(bytes []byte) error {
-	cfg := linearConfig{
-		Weights:  l.weightObj.Data.GetFloats(),
-		WithBias: l.withBias,
+	var cfg linearConfig
+	if err := json.Unmarshal(bytes, &cfg); err != nil {
+		return err
 	}
-	if l.biasesObj != nil {
-		cfg.Bias = l.biasesObj.Data.GetFloats()
+	if cfg.WithBias != l.withBias {
+		return fmt.Errorf("linear: with bias %v, expected %v", cfg.WithBias, l.withBias)
+	}
+
+	weights := []weightValues{{name: "weights", node: l.weightObj, values: cfg.Weights}}
+	if l.withBias {
+		weights = append(weights, weightValues{name: "bias", node: l.biasesObj, values: cfg.Bias})
 	}
-	return json.Unmarshal(bytes, &cfg)
+	return loadWeights("linear", weights...)
 }
 
 func (l *Linear) LoadFromProvider() {
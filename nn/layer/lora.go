@@ -0,0 +1,214 @@
+package layer
+
+import (
+	"math"
+
+	"github.com/atkhx/metal/mtl"
+	"github.com/atkhx/metal/nn/num"
+	"github.com/atkhx/metal/nn/proc"
+)
+
+// LoRAConfig configures a low-rank adapter: the weights W of a layer are used as W + Alpha/Rank * A*B,
+// where only A and B are trained.
+type LoRAConfig struct {
+	Rank int
+	// Alpha scales the adapter output by Alpha/Rank, 0 means Rank (the scale 1).
+	Alpha float32
+	// Dropout is the probability to drop inputs of the adapter.
+	Dropout float32
+}
+
+func (c LoRAConfig) scale() float32 {
+	if c.Alpha == 0 {
+		return 1
+	}
+	return c.Alpha / float32(c.Rank)
+}
+
+// LoRATarget is a projection of an attention layer an adapter is attached to.
+type LoRATarget int
+
+const (
+	LoRAQuery LoRATarget = iota
+	LoRAKey
+	LoRAValue
+)
+
+// LoRA is a low-rank adapter of the weights of a layer, it is created by WithLoRA of the layer
+// and built when the layer is compiled. B starts from zeros, so the adapter doesn't change
+// the output until it's trained.
+type LoRA struct {
+	cfg LoRAConfig
+
+	a *num.Data
+	b *num.Data
+	// gate multiplies the adapter output by the scale, it is zeroed while the adapter is merged.
+	gate    *num.Data
+	weights *num.Data
+	// left is set for weights multiplied from the left (W*x) as in attention layers.
+	left   bool
+	merged bool
+}
+
+func newLoRA(cfg LoRAConfig) *LoRA {
+	if cfg.Rank <= 0 {
+		panic("lora: rank must be positive")
+	}
+	return &LoRA{cfg: cfg}
+}
+
+// newQKVLoRA creates adapters of attention projections indexed by LoRATarget, all of them without targets.
+func newQKVLoRA(cfg LoRAConfig, targets []LoRATarget) (adapters [3]*LoRA) {
+	if len(targets) == 0 {
+		targets = []LoRATarget{LoRAQuery, LoRAKey, LoRAValue}
+	}
+	for _, target := range targets {
+		adapters[target] = newLoRA(cfg)
+	}
+	return adapters
+}
+
+// apply adds the adapter output to the output of the layer computed from input and weights,
+// the output is returned as is for a nil adapter.
+func (a *LoRA) apply(device *proc.Device, output, input, weights *num.Data, left bool) *num.Data {
+	if a == nil {
+		return output
+	}
+
+	a.weights = weights
+	a.left = left
+
+	rank := a.cfg.Rank
+	input = device.Dropout(input, a.cfg.Dropout)
+
+	var delta *num.Data
+	if left {
+		// weights: (in, out) -> a: (in, rank), b: (rank, out), delta = b * (a * x)
+		a.a = device.NewDataRandUniformWeighted(mtl.NewMTLSize(weights.Dims.W, rank), loraInitLimit(weights.Dims.W))
+		a.b = device.NewData(mtl.NewMTLSize(rank, weights.Dims.H))
+		delta = device.MatrixMultiply(a.b, device.MatrixMultiply(a.a, input, 1), 1)
+	} else {
+		// weights: (out, in) -> a: (rank, in), b: (out, rank), delta = (x * a) * b
+		a.a = device.NewDataRandUniformWeighted(mtl.NewMTLSize(rank, weights.Dims.H), loraInitLimit(weights.Dims.H))
+		a.b = device.NewData(mtl.NewMTLSize(weights.Dims.W, rank))
+		delta = device.MatrixMultiply(device.MatrixMultiply(input, a.a, 1), a.b, 1)
+	}
+	num.TagParams(num.ParamAdapter, a.a, a.b)
+
+	a.gate = device.NewData(mtl.NewMTLSize(delta.Dims.W))
+	a.gate.Frozen = true
+	a.fillGate(a.cfg.scale())
+
+	return device.AddEqual(output, device.MulRow(delta, a.gate, delta.Dims.W))
+}
+
+func loraInitLimit(fanIn int) float32 {
+	return float32(1 / math.Sqrt(float64(fanIn)))
+}
+
+func (a *LoRA) fillGate(value float32) {
+	gate := a.gate.Data.GetFloats()
+	for i := range gate {
+		gate[i] = value
+	}
+}
+
+// Matrices returns A and B of the adapter, they are created when the layer is compiled.
+func (a *LoRA) Matrices() (*num.Data, *num.Data) {
+	return a.a, a.b
+}
+
+func (a *LoRA) IsMerged() bool {
+	return a.merged
+}
+
+// Merge adds the adapter to the weights of the layer and disables its output, so the layer
+// gives the same results, e.g. to save the fine-tuned weights. It must not be called while
+// command buffers using the weights are running.
+func (a *LoRA) Merge() {
+	if a.merged {
+		return
+	}
+	a.addToWeights(a.cfg.scale())
+	a.fillGate(0)
+	a.merged = true
+}
+
+// Unmerge subtracts the adapter from the weights and enables its output back.
+func (a *LoRA) Unmerge() {
+	if !a.merged {
+		return
+	}
+	a.addToWeights(-a.cfg.scale())
+	a.fillGate(a.cfg.scale())
+	a.merged = false
+}
+
+// addToWeights adds scale * p*q to the weights, where p*q is a*b or b*a for left weights.
+func (a *LoRA) addToWeights(scale float32) {
+	p, q := a.a, a.b
+	if a.left {
+		p, q = a.b, a.a
+	}
+
+	rows, cols, rank := p.Dims.H, q.Dims.W, a.cfg.Rank
+	pData, qData := p.Data.GetFloats(), q.Data.GetFloats()
+	weights := a.weights.Data.GetFloats()
+
+	for row := 0; row < rows; row++ {
+		for col := 0; col < cols; col++ {
+			var sum float32
+			for r := 0; r < rank; r++ {
+				sum += pData[row*rank+r] * qData[r*cols+col]
+			}
+			weights[row*cols+col] += scale * sum
+		}
+	}
+}
+
+// withLoRA freezes params of a layer with adapters and appends the params of the adapters,
+// params are returned as is without adapters.
+func withLoRA(params []*num.Data, adapters ...*LoRA) []*num.Data {
+	result := params
+	for _, adapter := range adapters {
+		if adapter == nil {
+			continue
+		}
+		if len(result) == len(params) {
+			num.SetFrozen(true, params...)
+		}
+		result = append(result, adapter.a, adapter.b)
+	}
+	return result
+}
+
+// loraParams returns the matrices of the adapter named with prefix, nothing for a nil adapter.
+func loraParams(prefix string, adapter *LoRA) []Param {
+	if adapter == nil {
+		return nil
+	}
+	return []Param{
+		{Name: JoinName(prefix, "lora_a"), Data: adapter.a},
+		{Name: JoinName(prefix, "lora_b"), Data: adapter.b},
+	}
+}
+
+// qkvLoRAParams returns the matrices of attention adapters named by their projections.
+func qkvLoRAParams(adapters [3]*LoRA) []Param {
+	var result []Param
+	for target, prefix := range []string{"q", "k", "v"} {
+		result = append(result, loraParams(prefix, adapters[target])...)
+	}
+	return result
+}
+
+// nonNilAdapters returns adapters which are attached.
+func nonNilAdapters(adapters ...*LoRA) []*LoRA {
+	var result []*LoRA
+	for _, adapter := range adapters {
+		if adapter != nil {
+			result = append(result, adapter)
+		}
+	}
+	return result
+}
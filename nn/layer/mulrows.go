@@ -34,6 +34,7 @@ func (l *MulRows) Compile(device *proc.Device, input *num.Data) *num.Data {
 	}
 	l.weightObj = device.NewDataWithValues(mtl.NewMTLSize(l.width), values)
 	l.forUpdate = []*num.Data{l.weightObj}
+	num.TagParams(num.ParamNorm, l.weightObj)
 
 	return device.MulRow(input, l.weightObj, l.width)
 }
@@ -42,6 +43,10 @@ func (l *MulRows) ForUpdate() []*num.Data {
 	return l.forUpdate
 }
 
+func (l *MulRows) Params() []Param {
+	return []Param{{Name: "weight", Data: l.weightObj}}
+}
+
 type mulRowsConfig struct {
 	Weights []float32
 }
@@ -53,10 +58,11 @@ func (l *MulRows) MarshalJSON() ([]byte, error) {
 }
 
 func (l *MulRows) UnmarshalJSON(bytes []byte) error {
-	config := mulRowsConfig{
-		Weights: l.weightObj.Data.GetFloats(),
+	var config mulRowsConfig
+	if err := json.Unmarshal(bytes, &config); err != nil {
+		return err
 	}
-	return json.Unmarshal(bytes, &config)
+	return loadWeights("mul rows", weightValues{name: "weights", node: l.weightObj, values: config.Weights})
 }
 
 func (l *MulRows) LoadFromProvider() {
@@ -0,0 +1,65 @@
+package layer
+
+import (
+	"encoding/json"
+
+	"github.com/atkhx/metal/nn/num"
+	"github.com/atkhx/metal/nn/proc"
+)
+
+// Named gives a layer the name its params are prefixed with instead of its index in Layers.
+// An empty name adds no prefix, e.g. for containers whose layers are named.
+// The layer is saved to JSON as is.
+func Named(name string, layer Layer) *NamedLayer {
+	return &NamedLayer{Name: name, Layer: layer}
+}
+
+type NamedLayer struct {
+	Name  string
+	Layer Layer
+}
+
+func (l *NamedLayer) Compile(device *proc.Device, input *num.Data) *num.Data {
+	return l.Layer.Compile(device, input)
+}
+
+func (l *NamedLayer) ForUpdate() []*num.Data {
+	if u, ok := l.Layer.(Updatable); ok {
+		return u.ForUpdate()
+	}
+	return nil
+}
+
+func (l *NamedLayer) Params() []Param {
+	if p, ok := l.Layer.(WithParams); ok {
+		return p.Params()
+	}
+	return nil
+}
+
+func (l *NamedLayer) Adapters() []*LoRA {
+	if a, ok := l.Layer.(WithAdapters); ok {
+		return a.Adapters()
+	}
+	return nil
+}
+
+func (l *NamedLayer) LoadFromProvider() {
+	if p, ok := l.Layer.(WithWeightsProvider); ok {
+		p.LoadFromProvider()
+	}
+}
+
+func (l *NamedLayer) SetTraining(training bool) {
+	if t, ok := l.Layer.(WithTrainingMode); ok {
+		t.SetTraining(training)
+	}
+}
+
+func (l *NamedLayer) MarshalJSON() ([]byte, error) {
+	return json.Marshal(l.Layer)
+}
+
+func (l *NamedLayer) UnmarshalJSON(bytes []byte) error {
+	return json.Unmarshal(bytes, l.Layer)
+}
@@ -0,0 +1,53 @@
+package layer
+
+import (
+	"strconv"
+
+	"github.com/atkhx/metal/nn/num"
+)
+
+// Param is a tensor of a layer with its name, names of nested layers are joined with dots,
+// e.g. "h.3.attn.q.weight". Unnamed layers are named by their index in Layers, see Named.
+type Param struct {
+	Name string
+	Data *num.Data
+}
+
+// JoinName joins parts of a hierarchical name skipping empty ones.
+func JoinName(prefix, name string) string {
+	switch {
+	case prefix == "":
+		return name
+	case name == "":
+		return prefix
+	default:
+		return prefix + "." + name
+	}
+}
+
+func prefixParams(prefix string, params []Param) []Param {
+	result := make([]Param, len(params))
+	for i, param := range params {
+		result[i] = Param{Name: JoinName(prefix, param.Name), Data: param.Data}
+	}
+	return result
+}
+
+// Params returns params of layers named by the names of layers or their indexes.
+// Layers create their params in Compile, so it's called after that.
+func (s Layers) Params() []Param {
+	var result []Param
+	for i, layer := range s {
+		l, ok := layer.(WithParams)
+		if !ok {
+			continue
+		}
+
+		prefix := strconv.Itoa(i)
+		if named, ok := layer.(*NamedLayer); ok {
+			prefix = named.Name
+		}
+		result = append(result, prefixParams(prefix, l.Params())...)
+	}
+	return result
+}
@@ -34,6 +34,7 @@ func (l *PositionalAdd) Compile(device *proc.Device, input *num.Data) *num.Data
 	l.weights = device.NewData(mtl.NewMTLSize(l.features, l.context, 1))
 
 	l.forUpdate = []*num.Data{l.weights}
+	num.TagParams(num.ParamEmbedding, l.weights)
 	return device.PositionalAdd(input, l.weights, l.features, l.context)
 }
 
@@ -41,6 +42,10 @@ func (l *PositionalAdd) ForUpdate() []*num.Data {
 	return l.forUpdate
 }
 
+func (l *PositionalAdd) Params() []Param {
+	return []Param{{Name: "weight", Data: l.weights}}
+}
+
 func (l *PositionalAdd) LoadFromProvider() {
 	if l.provideWeights != nil {
 		l.provideWeights(l.weights)
@@ -22,6 +22,18 @@ func (l *Residual) ForUpdate() []*num.Data {
 	return l.Layers.ForUpdate()
 }
 
+func (l *Residual) Adapters() []*LoRA {
+	return l.Layers.Adapters()
+}
+
+func (l *Residual) Params() []Param {
+	return l.Layers.Params()
+}
+
 func (l *Residual) LoadFromProvider() {
 	l.Layers.LoadFromProvider()
 }
+
+func (l *Residual) SetTraining(training bool) {
+	l.Layers.SetTraining(training)
+}
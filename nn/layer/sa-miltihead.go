@@ -45,6 +45,15 @@ type SAMultiHead struct {
 	contextLength int
 	headsCount    int
 	headSize      int
+
+	lora [3]*LoRA
+}
+
+// WithLoRA attaches LoRA adapters to the projections of targets (all of them without targets),
+// it must be called before Compile. The weights of the layer are frozen, only the adapters are trained.
+func (l *SAMultiHead) WithLoRA(cfg LoRAConfig, targets ...LoRATarget) *SAMultiHead {
+	l.lora = newQKVLoRA(cfg, targets)
+	return l
 }
 
 func (l *SAMultiHead) Compile(device *proc.Device, input *num.Data) *num.Data {
@@ -57,6 +66,7 @@ func (l *SAMultiHead) Compile(device *proc.Device, input *num.Data) *num.Data {
 	l.ValWeights = initWeights(device, l.initWeights, mtl.NewMTLSize(l.featuresCount, l.featuresCount), fanIn, fanOut)
 
 	l.forUpdate = []*num.Data{l.QryWeights, l.KeyWeights, l.ValWeights}
+	num.TagParams(num.ParamWeight, l.forUpdate...)
 
 	bx := device.Transpose(input) // bx - vertical
 
@@ -65,6 +75,11 @@ func (l *SAMultiHead) Compile(device *proc.Device, input *num.Data) *num.Data {
 	keyObject := device.MatrixMultiply(l.KeyWeights, bx, 1)
 	valObject := device.MatrixMultiply(l.ValWeights, bx, 1)
 
+	qryObject = l.lora[LoRAQuery].apply(device, qryObject, bx, l.QryWeights, true)
+	keyObject = l.lora[LoRAKey].apply(device, keyObject, bx, l.KeyWeights, true)
+	valObject = l.lora[LoRAValue].apply(device, valObject, bx, l.ValWeights, true)
+	l.forUpdate = withLoRA(l.forUpdate, l.lora[:]...)
+
 	// Apply RoPE
 	qryObject = device.RopeCols(qryObject, l.featuresCount, l.headSize, l.contextLength)
 	keyObject = device.RopeCols(keyObject, l.featuresCount, l.headSize, l.contextLength)
@@ -105,6 +120,18 @@ func (l *SAMultiHead) ForUpdate() []*num.Data {
 	return l.forUpdate
 }
 
+func (l *SAMultiHead) Params() []Param {
+	return append([]Param{
+		{Name: "q.weight", Data: l.QryWeights},
+		{Name: "k.weight", Data: l.KeyWeights},
+		{Name: "v.weight", Data: l.ValWeights},
+	}, qkvLoRAParams(l.lora)...)
+}
+
+func (l *SAMultiHead) Adapters() []*LoRA {
+	return nonNilAdapters(l.lora[:]...)
+}
+
 type saMultiHeadConfig struct {
 	QryWeights []float32
 	KeyWeights []float32
@@ -121,12 +148,15 @@ func (l *SAMultiHead) MarshalJSON() ([]byte, error) {
 }
 
 func (l *SAMultiHead) UnmarshalJSON(bytes []byte) error {
-	config := saMultiHeadConfig{
-		QryWeights: l.QryWeights.Data.GetFloats(),
-		KeyWeights: l.KeyWeights.Data.GetFloats(),
-		ValWeights: l.ValWeights.Data.GetFloats(),
+	var config saMultiHeadConfig
+	if err := json.Unmarshal(bytes, &config); err != nil {
+		return err
 	}
-	return json.Unmarshal(bytes, &config)
+	return loadWeights("attention",
+		weightValues{name: "query weights", node: l.QryWeights, values: config.QryWeights},
+		weightValues{name: "key weights", node: l.KeyWeights, values: config.KeyWeights},
+		weightValues{name: "value weights", node: l.ValWeights, values: config.ValWeights},
+	)
 }
 
 func (l *SAMultiHead) LoadFromProvider() {
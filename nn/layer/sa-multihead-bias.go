@@ -48,6 +48,15 @@ type SAMultiHeadWithBias struct {
 	headsCount    int
 	headSize      int
 	useRoPE       bool
+
+	lora [3]*LoRA
+}
+
+// WithLoRA attaches LoRA adapters to the projections of targets (all of them without targets),
+// it must be called before Compile. The weights and biases of the layer are frozen, only the adapters are trained.
+func (l *SAMultiHeadWithBias) WithLoRA(cfg LoRAConfig, targets ...LoRATarget) *SAMultiHeadWithBias {
+	l.lora = newQKVLoRA(cfg, targets)
+	return l
 }
 
 func (l *SAMultiHeadWithBias) Compile(device *proc.Device, input *num.Data) *num.Data {
@@ -64,6 +73,8 @@ func (l *SAMultiHeadWithBias) Compile(device *proc.Device, input *num.Data) *num
 	l.valBias = device.NewData(mtl.NewMTLSize(l.featuresCount))
 
 	l.forUpdate = []*num.Data{l.qryWeights, l.keyWeights, l.valWeights, l.qryBias, l.keyBias, l.valBias}
+	num.TagParams(num.ParamWeight, l.qryWeights, l.keyWeights, l.valWeights)
+	num.TagParams(num.ParamBias, l.qryBias, l.keyBias, l.valBias)
 
 	bx := input
 	bx = device.Transpose(bx)
@@ -73,6 +84,11 @@ func (l *SAMultiHeadWithBias) Compile(device *proc.Device, input *num.Data) *num
 	keyObject := device.MatrixMultiply(l.keyWeights, bx, 1)
 	valObject := device.MatrixMultiply(l.valWeights, bx, 1)
 
+	qryObject = l.lora[LoRAQuery].apply(device, qryObject, bx, l.qryWeights, true)
+	keyObject = l.lora[LoRAKey].apply(device, keyObject, bx, l.keyWeights, true)
+	valObject = l.lora[LoRAValue].apply(device, valObject, bx, l.valWeights, true)
+	l.forUpdate = withLoRA(l.forUpdate, l.lora[:]...)
+
 	// Add biases by rows (features)
 	qryObject = device.AddCol(qryObject, l.qryBias, qryObject.Dims.W, qryObject.Dims.H)
 	keyObject = device.AddCol(keyObject, l.keyBias, keyObject.Dims.W, keyObject.Dims.H)
@@ -119,6 +135,21 @@ func (l *SAMultiHeadWithBias) ForUpdate() []*num.Data {
 	return l.forUpdate
 }
 
+func (l *SAMultiHeadWithBias) Params() []Param {
+	return append([]Param{
+		{Name: "q.weight", Data: l.qryWeights},
+		{Name: "q.bias", Data: l.qryBias},
+		{Name: "k.weight", Data: l.keyWeights},
+		{Name: "k.bias", Data: l.keyBias},
+		{Name: "v.weight", Data: l.valWeights},
+		{Name: "v.bias", Data: l.valBias},
+	}, qkvLoRAParams(l.lora)...)
+}
+
+func (l *SAMultiHeadWithBias) Adapters() []*LoRA {
+	return nonNilAdapters(l.lora[:]...)
+}
+
 func (l *SAMultiHeadWithBias) LoadFromProvider() {
 	if l.provideWeights != nil {
 		l.provideWeights(l.qryWeights, l.keyWeights, l.valWeights, l.qryBias, l.keyBias, l.valBias)
@@ -149,14 +180,16 @@ func (l *SAMultiHeadWithBias) MarshalJSON() ([]byte, error) {
 }
 
 func (l *SAMultiHeadWithBias) UnmarshalJSON(bytes []byte) error {
-	config := saMultiHeadWithBiasConfig{
-		QryWeights: l.qryWeights.Data.GetFloats(),
-		KeyWeights: l.keyWeights.Data.GetFloats(),
-		ValWeights: l.valWeights.Data.GetFloats(),
-
-		QryBias: l.qryBias.Data.GetFloats(),
-		KeyBias: l.keyBias.Data.GetFloats(),
-		ValBias: l.valBias.Data.GetFloats(),
+	var config saMultiHeadWithBiasConfig
+	if err := json.Unmarshal(bytes, &config); err != nil {
+		return err
 	}
-	return json.Unmarshal(bytes, &config)
+	return loadWeights("attention",
+		weightValues{name: "query weights", node: l.qryWeights, values: config.QryWeights},
+		weightValues{name: "key weights", node: l.keyWeights, values: config.KeyWeights},
+		weightValues{name: "value weights", node: l.valWeights, values: config.ValWeights},
+		weightValues{name: "query bias", node: l.qryBias, values: config.QryBias},
+		weightValues{name: "key bias", node: l.keyBias, values: config.KeyBias},
+		weightValues{name: "value bias", node: l.valBias, values: config.ValBias},
+	)
 }
@@ -43,6 +43,7 @@ func (l *SwiGLU) Compile(device *proc.Device, input *num.Data) *num.Data {
 	w1SiLU := device.SiLu(w1Projection)
 
 	l.forUpdate = []*num.Data{l.weights1, l.weights2, l.weights3}
+	num.TagParams(num.ParamWeight, l.forUpdate...)
 
 	return device.MatrixMultiply(device.MulEqual(w1SiLU, w2Projection), l.weights3, 1)
 }
@@ -51,6 +52,14 @@ func (l *SwiGLU) ForUpdate() []*num.Data {
 	return l.forUpdate
 }
 
+func (l *SwiGLU) Params() []Param {
+	return []Param{
+		{Name: "w1", Data: l.weights1},
+		{Name: "w2", Data: l.weights2},
+		{Name: "w3", Data: l.weights3},
+	}
+}
+
 type SwiGLUConfig struct {
 	Weights1 []float32
 	Weights2 []float32
@@ -66,12 +75,15 @@ func (l *SwiGLU) MarshalJSON() ([]byte, error) {
 }
 
 func (l *SwiGLU) UnmarshalJSON(bytes []byte) error {
-	config := SwiGLUConfig{
-		Weights1: l.weights1.Data.GetFloats(),
-		Weights2: l.weights2.Data.GetFloats(),
-		Weights3: l.weights3.Data.GetFloats(),
+	var config SwiGLUConfig
+	if err := json.Unmarshal(bytes, &config); err != nil {
+		return err
 	}
-	return json.Unmarshal(bytes, &config)
+	return loadWeights("swiglu",
+		weightValues{name: "weights1", node: l.weights1, values: config.Weights1},
+		weightValues{name: "weights2", node: l.weights2, values: config.Weights2},
+		weightValues{name: "weights3", node: l.weights3, values: config.Weights3},
+	)
 }
 
 func (l *SwiGLU) LoadFromProvider() {
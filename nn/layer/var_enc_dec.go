@@ -24,10 +24,22 @@ func (l *VAEEncoder) ForUpdate() []*num.Data {
 	return l.Layers.ForUpdate()
 }
 
+func (l *VAEEncoder) Adapters() []*LoRA {
+	return l.Layers.Adapters()
+}
+
+func (l *VAEEncoder) Params() []Param {
+	return l.Layers.Params()
+}
+
 func (l *VAEEncoder) LoadFromProvider() {
 	l.Layers.LoadFromProvider()
 }
 
+func (l *VAEEncoder) SetTraining(training bool) {
+	l.Layers.SetTraining(training)
+}
+
 type VAEDecoder struct {
 	Layers Layers `json:"VAEDecoder"`
 }
@@ -41,6 +53,18 @@ func (l *VAEDecoder) ForUpdate() []*num.Data {
 	return l.Layers.ForUpdate()
 }
 
+func (l *VAEDecoder) Adapters() []*LoRA {
+	return l.Layers.Adapters()
+}
+
+func (l *VAEDecoder) Params() []Param {
+	return l.Layers.Params()
+}
+
 func (l *VAEDecoder) LoadFromProvider() {
 	l.Layers.LoadFromProvider()
 }
+
+func (l *VAEDecoder) SetTraining(training bool) {
+	l.Layers.SetTraining(training)
+}
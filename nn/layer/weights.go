@@ -1,6 +1,8 @@
 package layer
 
 import (
+	"fmt"
+
 	"github.com/atkhx/metal/mtl"
 	"github.com/atkhx/metal/nn/initializer"
 	"github.com/atkhx/metal/nn/num"
@@ -14,3 +16,24 @@ func initWeights(device *proc.Device, init initializer.Initializer, dims mtl.MTL
 	}
 	return device.NewDataRandUniformWeighted(dims, w)
 }
+
+// weightValues are values of a param of a layer decoded from JSON.
+type weightValues struct {
+	name   string
+	node   *num.Data
+	values []float32
+}
+
+// loadWeights copies decoded values into params of a layer. Nothing is copied
+// unless the number of values of every param matches its length.
+func loadWeights(layerName string, weights ...weightValues) error {
+	for _, w := range weights {
+		if length := len(w.node.Data.GetFloats()); len(w.values) != length {
+			return fmt.Errorf("%s %s: %d values, expected %d", layerName, w.name, len(w.values), length)
+		}
+	}
+	for _, w := range weights {
+		copy(w.node.Data.GetFloats(), w.values)
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package model
+
+import (
+	"fmt"
+
+	"github.com/atkhx/metal/nn/layer"
+	"github.com/atkhx/metal/nn/num"
+)
+
+// Adapters returns LoRA adapters attached to layers of the model in the order of layers.
+func (s *Model) Adapters() []*layer.LoRA {
+	return s.Layers.Adapters()
+}
+
+// MergeAdapters adds adapters to the base weights, see layer.LoRA.Merge.
+func (s *Model) MergeAdapters() {
+	for _, adapter := range s.Adapters() {
+		adapter.Merge()
+	}
+}
+
+// UnmergeAdapters subtracts adapters from the base weights, see layer.LoRA.Unmerge.
+func (s *Model) UnmergeAdapters() {
+	for _, adapter := range s.Adapters() {
+		adapter.Unmerge()
+	}
+}
+
+// adapterParams returns the matrices of adapters named as other params of the model.
+func (s *Model) adapterParams() []layer.Param {
+	var result []layer.Param
+	for _, param := range s.Layers.Params() {
+		if param.Data.GetParamKind() == num.ParamAdapter {
+			result = append(result, param)
+		}
+	}
+	return result
+}
+
+// SaveAdapters writes only the adapters to a safetensors file, base weights are saved separately.
+func (s *Model) SaveAdapters(filename string) error {
+	return WriteStateDict(filename, stateDict(s.adapterParams()))
+}
+
+// LoadAdapters reads adapters saved by SaveAdapters into the adapters of the model,
+// they must be attached the same way and not merged. Nothing is loaded on mismatch.
+func (s *Model) LoadAdapters(filename string) error {
+	for _, adapter := range s.Adapters() {
+		if adapter.IsMerged() {
+			return fmt.Errorf("adapters are merged, unmerge them before loading")
+		}
+	}
+
+	state, err := ReadStateDict(filename)
+	if err != nil {
+		return err
+	}
+	_, err = loadStateDict(s.adapterParams(), state, true)
+	return err
+}
@@ -0,0 +1,134 @@
+package model
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/atkhx/metal/mtl"
+	"github.com/atkhx/metal/nn/layer"
+	"github.com/atkhx/metal/nn/num"
+	"github.com/atkhx/metal/nn/optimizer"
+	"github.com/atkhx/metal/nn/proc"
+	"github.com/stretchr/testify/require"
+)
+
+type loraRun struct {
+	model   *Model
+	head    *layer.Linear
+	forward func() []float32
+	train   func(iterations int)
+}
+
+func newLoRARun(t *testing.T, cfg layer.LoRAConfig) *loraRun {
+	device := proc.NewWithSystemDefaultDevice()
+	t.Cleanup(device.Release)
+
+	head := layer.NewLinear(2, nil, true, nil)
+	m := New(mtl.NewMTLSize(4, 3, 2), layer.Layers{
+		layer.NewLinear(4, nil, true, nil).WithLoRA(cfg),
+		layer.NewSAMultiHeadWithBias(4, 2, 2, 3, false, nil, nil).WithLoRA(cfg, layer.LoRAQuery, layer.LoRAValue),
+		head,
+	}, device, optimizer.AdamW(device.GetMTLDevice(), optimizer.AdamWConfig{
+		LearningRate: 0.05,
+		Beta1:        0.9,
+		Beta2:        0.999,
+		Eps:          1e-8,
+	}))
+	output := m.Compile()
+	copy(m.GetInput().Data.GetFloats(), []float32{
+		1, -2, 3, 0.5, -1, 0.5, 2, 1, 0, 1, -1, 2,
+		2, 1, -0.5, 1, 0.25, -1, 1, 0, 3, -2, 1, 1,
+	})
+
+	targets := device.NewData(output.Dims)
+	for i := range targets.Data.GetFloats() {
+		targets.Data.GetFloats()[i] = float32(i%3) / 2
+	}
+	diff := device.Sub(output, targets)
+	loss := device.Mean(device.Mul(diff, diff))
+
+	inference := device.GetInferencePipeline(output)
+	training := device.GetTrainingPipeline(loss)
+
+	return &loraRun{
+		model: m,
+		head:  head,
+		forward: func() []float32 {
+			inference.Forward()
+			return append([]float32(nil), output.Data.GetFloats()...)
+		},
+		train: func(iterations int) {
+			for iteration := 0; iteration < iterations; iteration++ {
+				training.TrainIteration(func(b *mtl.CommandBuffer) {
+					m.Update(b, iteration)
+				})
+			}
+		},
+	}
+}
+
+func (r *loraRun) frozenWeights() [][]float32 {
+	var result [][]float32
+	for _, node := range r.model.Layers.ForUpdate() {
+		if node.Frozen {
+			result = append(result, append([]float32(nil), node.Data.GetFloats()...))
+		}
+	}
+	return result
+}
+
+func TestModel_LoRA(t *testing.T) {
+	cfg := layer.LoRAConfig{Rank: 2, Alpha: 4}
+	run := newLoRARun(t, cfg)
+
+	adapters := run.model.Adapters()
+	require.Len(t, adapters, 3)
+
+	// the base weights of layers with adapters are frozen, the last layer and the adapters are trained
+	headParams := run.head.ForUpdate()
+	for _, node := range run.model.Layers.ForUpdate() {
+		trainable := node.GetParamKind() == num.ParamAdapter || slices.Contains(headParams, node)
+		require.Equal(t, trainable, !node.Frozen)
+	}
+
+	// b starts from zeros, adapters don't change outputs before training
+	for _, adapter := range adapters {
+		_, b := adapter.Matrices()
+		require.Equal(t, make([]float32, b.Dims.Length()), b.Data.GetFloats())
+	}
+
+	baseWeights := run.frozenWeights()
+	run.train(5)
+	require.Equal(t, baseWeights, run.frozenWeights())
+
+	trained := run.forward()
+
+	run.model.MergeAdapters()
+	require.True(t, adapters[0].IsMerged())
+	require.NotEqual(t, baseWeights, run.frozenWeights())
+	require.InDeltaSlice(t, trained, run.forward(), 1e-4)
+
+	run.model.UnmergeAdapters()
+	for i, weights := range run.frozenWeights() {
+		require.InDeltaSlice(t, baseWeights[i], weights, 1e-5)
+	}
+	require.InDeltaSlice(t, trained, run.forward(), 1e-4)
+
+	dir := t.TempDir()
+	weightsFile := filepath.Join(dir, "model.json")
+	adaptersFile := filepath.Join(dir, "adapters.safetensors")
+	require.NoError(t, run.model.SaveToFile(weightsFile))
+	require.NoError(t, run.model.SaveAdapters(adaptersFile))
+
+	loaded := newLoRARun(t, cfg)
+	require.NoError(t, loaded.model.LoadFromFile(weightsFile))
+	require.NoError(t, loaded.model.LoadAdapters(adaptersFile))
+	require.Equal(t, trained, loaded.forward())
+
+	other := newLoRARun(t, layer.LoRAConfig{Rank: 3})
+	require.ErrorContains(t, other.model.LoadAdapters(adaptersFile), "shape")
+
+	loaded.model.MergeAdapters()
+	require.ErrorContains(t, loaded.model.LoadAdapters(adaptersFile), "merged")
+}
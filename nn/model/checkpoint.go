@@ -0,0 +1,71 @@
+package model
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// checkpoint is the file format of SaveToFile. Files saved before fingerprints have
+// only Layers: the layers of the model marshalled in order.
+type checkpoint struct {
+	Fingerprint string
+	Tensors     StateDict           `json:",omitempty"`
+	Layers      jsoniter.RawMessage `json:",omitempty"`
+}
+
+// Fingerprint identifies the architecture of the compiled model: types and names of layers
+// and names and shapes of params. It doesn't depend on the batch size of the input.
+func (s *Model) Fingerprint() string {
+	h := sha256.New()
+	fmt.Fprintf(h, "layers: %s\n", s.Layers.Architecture())
+	for _, param := range s.Layers.Params() {
+		fmt.Fprintf(h, "%s %v\n", param.Name, tensorShape(param.Data.Dims))
+	}
+	return hex.EncodeToString(h.Sum(nil)[:8])
+}
+
+// checkCheckpoint checks the checkpoint was saved by a model of the same architecture
+// and its tensors match the params, report is the result of checkStateDict.
+func (s *Model) checkCheckpoint(cp checkpoint, report LoadReport, ignoreUnexpected bool) error {
+	if ignoreUnexpected {
+		report.Unexpected = nil
+		return report.Err()
+	}
+
+	if fingerprint := s.Fingerprint(); cp.Fingerprint != fingerprint {
+		if err := report.Err(); err != nil {
+			return fmt.Errorf("architecture fingerprint %s doesn't match the model %s: %w", cp.Fingerprint, fingerprint, err)
+		}
+		return fmt.Errorf("architecture fingerprint %s doesn't match the model %s: layers differ", cp.Fingerprint, fingerprint)
+	}
+	return report.Err()
+}
+
+// loadLayers loads a checkpoint saved before fingerprints by layers, lengths of weights are
+// checked by layers. Weights loaded before an error are restored.
+func (s *Model) loadLayers(layers jsoniter.RawMessage) error {
+	if len(layers) == 0 {
+		return fmt.Errorf("checkpoint has no tensors")
+	}
+
+	var rawLayers []jsoniter.RawMessage
+	if err := json.Unmarshal(layers, &rawLayers); err != nil {
+		return err
+	}
+	if len(rawLayers) != len(s.Layers) {
+		return fmt.Errorf("checkpoint has %d layers, the model has %d", len(rawLayers), len(s.Layers))
+	}
+
+	params := s.Layers.Params()
+	backup := stateDict(params).Clone()
+	for i, raw := range rawLayers {
+		if err := json.Unmarshal(raw, s.Layers[i]); err != nil {
+			copyStateDict(params, backup)
+			return fmt.Errorf("layer %d: %w", i, err)
+		}
+	}
+	return nil
+}
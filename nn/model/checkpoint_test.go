@@ -0,0 +1,120 @@
+package model
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/atkhx/metal/mtl"
+	"github.com/atkhx/metal/nn/layer"
+	"github.com/atkhx/metal/nn/proc"
+	"github.com/stretchr/testify/require"
+)
+
+func newCheckpointModel(t *testing.T, layers layer.Layers) *Model {
+	device := proc.NewWithSystemDefaultDevice()
+	t.Cleanup(device.Release)
+
+	m := New(mtl.NewMTLSize(3, 2), layers, device, nil)
+	m.Compile()
+	return m
+}
+
+func TestModel_LoadFromFile(t *testing.T) {
+	weightsFile := filepath.Join(t.TempDir(), "model.json")
+
+	source := newStateDictModel(t, 2)
+	require.NoError(t, source.SaveToFile(weightsFile))
+
+	m := newStateDictModel(t, 2)
+	require.Equal(t, source.Fingerprint(), m.Fingerprint())
+	require.NoError(t, m.LoadFromFile(weightsFile))
+	require.Equal(t, source.StateDict(), m.StateDict())
+}
+
+func TestModel_LoadFromFile_MissingFile(t *testing.T) {
+	weightsFile := filepath.Join(t.TempDir(), "model.json")
+
+	m := newStateDictModel(t, 2)
+	before := m.StateDict().Clone()
+
+	require.ErrorIs(t, m.LoadFromFile(weightsFile), os.ErrNotExist)
+
+	report, err := m.LoadFromFileWith(weightsFile, LoadOptions{SkipMissingFile: true})
+	require.NoError(t, err)
+	require.Equal(t, LoadReport{}, report)
+	require.Equal(t, before, m.StateDict())
+}
+
+func TestModel_LoadFromFile_Mismatch(t *testing.T) {
+	weightsFile := filepath.Join(t.TempDir(), "model.json")
+	require.NoError(t, newStateDictModel(t, 2).SaveToFile(weightsFile))
+
+	m := newStateDictModel(t, 3)
+	before := m.StateDict().Clone()
+
+	err := m.LoadFromFile(weightsFile)
+	require.ErrorContains(t, err, "architecture fingerprint")
+	require.ErrorContains(t, err, "shape mismatch: 1.weight [3 2], expected [3 3], 1.bias [2], expected [3]")
+	require.Equal(t, before, m.StateDict())
+
+	// the same params in layers of other types
+	require.NoError(t, newCheckpointModel(t, layer.Layers{
+		layer.NewLinear(4, nil, true, nil),
+		layer.NewReLu(),
+	}).SaveToFile(weightsFile))
+
+	err = newCheckpointModel(t, layer.Layers{
+		layer.NewLinear(4, nil, true, nil),
+		layer.NewRMSLNorm(),
+	}).LoadFromFile(weightsFile)
+	require.ErrorContains(t, err, "layers differ")
+}
+
+func TestModel_LoadFromFile_IgnoreUnexpected(t *testing.T) {
+	weightsFile := filepath.Join(t.TempDir(), "model.json")
+
+	source := newStateDictModel(t, 2)
+	require.NoError(t, source.SaveToFile(weightsFile))
+
+	// the model has only the encoder of the saved one
+	encoder := newCheckpointModel(t, layer.Layers{
+		layer.Named("encoder", &layer.LayersBlock{Layers: layer.Layers{
+			layer.NewLinear(4, nil, true, nil),
+			layer.NewReLu(),
+			layer.NewLinear(3, nil, false, nil),
+		}}),
+	})
+	require.ErrorContains(t, encoder.LoadFromFile(weightsFile), "unexpected: 1.bias, 1.weight")
+
+	report, err := encoder.LoadFromFileWith(weightsFile, LoadOptions{IgnoreUnexpected: true})
+	require.NoError(t, err)
+	require.Equal(t, LoadReport{Unexpected: []string{"1.bias", "1.weight"}}, report)
+
+	sourceState := source.StateDict()
+	for name, tensor := range encoder.StateDict() {
+		require.Equal(t, sourceState[name], tensor)
+	}
+}
+
+func TestModel_LoadFromFile_Layers(t *testing.T) {
+	weightsFile := filepath.Join(t.TempDir(), "model.json")
+
+	// files saved before fingerprints are the layers marshalled in order
+	source := newStateDictModel(t, 2)
+	layersBytes, err := json.Marshal(struct{ Layers layer.Layers }{source.Layers})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(weightsFile, layersBytes, os.ModePerm))
+
+	m := newStateDictModel(t, 2)
+	require.NoError(t, m.LoadFromFile(weightsFile))
+	require.Equal(t, source.StateDict(), m.StateDict())
+
+	// the last layer has less outputs, weights loaded before the error are restored
+	other := newStateDictModel(t, 3)
+	before := other.StateDict().Clone()
+	err = other.LoadFromFile(weightsFile)
+	require.ErrorContains(t, err, "layer 1:")
+	require.ErrorContains(t, err, "linear weights: 6 values, expected 9")
+	require.Equal(t, before, other.StateDict())
+}
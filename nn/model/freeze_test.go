@@ -0,0 +1,101 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/atkhx/metal/mtl"
+	"github.com/atkhx/metal/nn/layer"
+	"github.com/atkhx/metal/nn/num"
+	"github.com/atkhx/metal/nn/optimizer"
+	"github.com/atkhx/metal/nn/proc"
+	"github.com/stretchr/testify/require"
+)
+
+func TestModel_Freeze(t *testing.T) {
+	device := proc.NewWithSystemDefaultDevice()
+	defer device.Release()
+
+	body := layer.NewLinear(4, nil, true, nil)
+	head := layer.NewLinear(2, nil, true, nil)
+
+	m := New(mtl.NewMTLSize(3, 2), layer.Layers{
+		body,
+		layer.NewReLu(),
+		head,
+	}, device, optimizer.SGD(device.GetMTLDevice(), optimizer.SGDConfig{LearningRate: 0.1}))
+	m.Freeze(body)
+	m.FreezeParams(optimizer.ByKind(num.ParamBias))
+	m.FreezeInput()
+	output := m.Compile()
+
+	// only the weights of the head are trainable
+	require.Equal(t, 2*4, m.GetTrainableParamsCount())
+
+	copy(m.GetInput().Data.GetFloats(), []float32{1, -2, 3, -1, 0.5, 2})
+	targets := device.NewDataWithValues(output.Dims, []float32{1, 0, 0, 1})
+	diff := device.Sub(output, targets)
+	loss := device.Mean(device.Mul(diff, diff))
+
+	params := m.Layers.ForUpdate()
+	before := make([][]float32, len(params))
+	for i, node := range params {
+		before[i] = append([]float32(nil), node.Data.GetFloats()...)
+	}
+
+	device.GetTrainingPipeline(loss).TrainIteration(func(b *mtl.CommandBuffer) {
+		m.Update(b, 0)
+	})
+
+	for i, node := range params {
+		if node == head.GetWeights() {
+			require.NotEqual(t, before[i], node.Data.GetFloats())
+			continue
+		}
+		require.True(t, node.Frozen)
+		require.Equal(t, before[i], node.Data.GetFloats())
+	}
+
+	// backward of the body is pruned, its grads are not computed
+	for _, value := range body.GetWeights().Grad.GetFloats() {
+		require.Zero(t, value)
+	}
+}
+
+// TestModel_FreezeInput checks the grad of the input is computed unless the input is frozen.
+func TestModel_FreezeInput(t *testing.T) {
+	run := func(freezeInput bool) (inputGrad, bodyGrad []float32) {
+		device := proc.NewWithSystemDefaultDevice()
+		t.Cleanup(device.Release)
+
+		body := layer.NewLinear(4, nil, true, nil)
+		m := New(mtl.NewMTLSize(3, 2), layer.Layers{
+			body,
+			layer.NewReLu(),
+			layer.NewLinear(2, nil, true, nil),
+		}, device, nil)
+		m.Freeze(body)
+		if freezeInput {
+			m.FreezeInput()
+		}
+		output := m.Compile()
+
+		copy(m.GetInput().Data.GetFloats(), []float32{1, -2, 3, -1, 0.5, 2})
+		loss := device.Mean(device.Mul(output, output))
+
+		pipeline := device.GetTestingPipeline(loss)
+		pipeline.Forward()
+		pipeline.Reset()
+		pipeline.Backward()
+
+		return m.GetInput().Grad.GetFloats(), body.GetWeights().Grad.GetFloats()
+	}
+
+	// grads flow through the frozen body to the input, e.g. for saliency maps
+	inputGrad, _ := run(false)
+	require.NotEqual(t, make([]float32, 6), inputGrad)
+
+	// backward of the frozen body is pruned, the input gets no grad
+	inputGrad, bodyGrad := run(true)
+	require.Equal(t, make([]float32, 6), inputGrad)
+	require.Equal(t, make([]float32, 12), bodyGrad)
+}
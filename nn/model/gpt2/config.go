@@ -3,6 +3,8 @@ package gpt2
 import (
 	"fmt"
 	"os"
+
+	"github.com/atkhx/metal/nn/layer"
 )
 
 type (
@@ -18,6 +20,12 @@ type (
 		DropoutProb     float32
 		LayerNormEps    float32
 		WeightsProvider *WeightsProvider
+		// Checkpoint recomputes activations of every block in backward instead of keeping them.
+		// Memory is saved only after PlanMemory of the training pipeline.
+		Checkpoint bool
+		// LoRA attaches adapters to the query and value projections of every block,
+		// all other weights are frozen.
+		LoRA *layer.LoRAConfig
 	}
 	hfGPT2Config struct {
 		NEmb         int     `json:"n_embd"`
@@ -1,6 +1,8 @@
 package gpt2
 
 import (
+	"fmt"
+
 	"github.com/atkhx/metal/mtl"
 	"github.com/atkhx/metal/nn/initializer"
 	"github.com/atkhx/metal/nn/layer"
@@ -14,7 +16,13 @@ import (
 
 var json = jsoniter.ConfigCompatibleWithStandardLibrary
 
+// NewModelForTest builds the model for inference only, without gradient buffers.
 func NewModelForTest(cfg Config, device *proc.Device) (input *num.Data, output *num.Data, pipeline *pipeline.InferencePipeline) {
+	// The token embeddings table is created by NewModel, outside of Compile.
+	noGrad := device.IsNoGrad()
+	device.SetNoGrad(true)
+	defer device.SetNoGrad(noGrad)
+
 	gpt2Model := NewModel(cfg, device, nil)
 	gpt2Model.Compile()
 	if cfg.WeightsProvider != nil {
@@ -40,41 +48,61 @@ func NewModel(cfg Config, device *proc.Device, optimizer proc.Optimizer) *model.
 	embeddingsOut := device.Transpose(embeddingsIn)
 
 	layers := layer.Layers{
-		layer.NewEmbeddings(embeddingsIn, provider.ProvideWTE),
-		layer.NewPositionalAdd(cfg.ContextLength, cfg.FeaturesCount, provider.ProvideWPE),
+		layer.Named("wte", layer.NewEmbeddings(embeddingsIn, provider.ProvideWTE)),
+		layer.Named("wpe", layer.NewPositionalAdd(cfg.ContextLength, cfg.FeaturesCount, provider.ProvideWPE)),
 	}
 	for i := 0; i < cfg.BlocksCount; i++ {
 		block := i
-		layers = append(layers,
-			layer.NewResidual(layer.Layers{
-				layer.NewLayerNormAffine(cfg.FeaturesCount, cfg.LayerNormEps, provider.ProvideBlockLN1(block)),
-				layer.NewSAMultiHeadWithBias(
-					cfg.FeaturesCount,
-					cfg.HeadSize,
-					cfg.HeadsCount,
-					cfg.ContextLength,
-					false,
-					initializer.XavierNormalLinear,
-					provider.ProvideSeparateBlockQKV(block),
-				),
-				layer.NewLinear(cfg.FeaturesCount, initializer.XavierNormalLinear, true, provider.ProvideBlockAttnProj(block)),
+		name := fmt.Sprintf("h.%d", block)
+		attention := layer.NewSAMultiHeadWithBias(
+			cfg.FeaturesCount,
+			cfg.HeadSize,
+			cfg.HeadsCount,
+			cfg.ContextLength,
+			false,
+			initializer.XavierNormalLinear,
+			provider.ProvideSeparateBlockQKV(block),
+		)
+		if cfg.LoRA != nil {
+			attention.WithLoRA(*cfg.LoRA, layer.LoRAQuery, layer.LoRAValue)
+		}
+
+		// Params are named as in the HF checkpoint, e.g. "h.3.attn.c_proj.weight",
+		// except for q, k and v which are separate.
+		blockLayers := layer.Layers{
+			layer.Named(name, layer.NewResidual(layer.Layers{
+				layer.Named("ln_1", layer.NewLayerNormAffine(cfg.FeaturesCount, cfg.LayerNormEps, provider.ProvideBlockLN1(block))),
+				layer.Named("attn", attention),
+				layer.Named("attn.c_proj", layer.NewLinear(cfg.FeaturesCount, initializer.XavierNormalLinear, true, provider.ProvideBlockAttnProj(block))),
 				layer.NewDropout(cfg.DropoutProb),
-			}),
-			layer.NewResidual(layer.Layers{
-				layer.NewLayerNormAffine(cfg.FeaturesCount, cfg.LayerNormEps, provider.ProvideBlockLN2(block)),
-				layer.NewLinear(cfg.HiddenDim, initializer.KaimingNormalReLU, true, provider.ProvideBlockMLPFC(block)),
+			})),
+			layer.Named(name, layer.NewResidual(layer.Layers{
+				layer.Named("ln_2", layer.NewLayerNormAffine(cfg.FeaturesCount, cfg.LayerNormEps, provider.ProvideBlockLN2(block))),
+				layer.Named("mlp.c_fc", layer.NewLinear(cfg.HiddenDim, initializer.KaimingNormalReLU, true, provider.ProvideBlockMLPFC(block))),
 				layer.NewGeLuNew(),
-				layer.NewLinear(cfg.FeaturesCount, initializer.KaimingNormalReLU, true, provider.ProvideBlockMLPProj(block)),
+				layer.Named("mlp.c_proj", layer.NewLinear(cfg.FeaturesCount, initializer.KaimingNormalReLU, true, provider.ProvideBlockMLPProj(block))),
 				layer.NewDropout(cfg.DropoutProb),
-			}),
-		)
+			})),
+		}
+		if cfg.Checkpoint {
+			blockLayers = layer.Layers{layer.Named("", layer.NewCheckpoint(blockLayers))}
+		}
+		layers = append(layers, blockLayers...)
 	}
 
 	layers = append(layers,
-		layer.NewLayerNormAffine(cfg.FeaturesCount, cfg.LayerNormEps, provider.ProvideFinalLN()),
+		layer.Named("ln_f", layer.NewLayerNormAffine(cfg.FeaturesCount, cfg.LayerNormEps, provider.ProvideFinalLN())),
 		layer.NewLinearWithImmutableWeights(embeddingsOut),
 		layer.NewReshape(mtl.NewMTLSize(cfg.VocabSize, cfg.BatchSize*cfg.ContextLength)),
 	)
 
-	return model.New(inDims, layers, device, optimizer)
+	gpt2Model := model.New(inDims, layers, device, optimizer)
+	if cfg.LoRA != nil {
+		// the input is token indexes, the embeddings are frozen with other base weights
+		gpt2Model.FreezeInput()
+		gpt2Model.FreezeParams(func(node *num.Data) bool {
+			return node.GetParamKind() != num.ParamAdapter
+		})
+	}
+	return gpt2Model
 }
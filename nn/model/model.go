@@ -40,20 +40,73 @@ type Model struct {
 	update []*num.Data
 	device *proc.Device
 
-	optimizer  proc.Optimizer
-	updateFunc func(b *mtl.CommandBuffer, iteration int)
+	optimizer      proc.Optimizer
+	optimizerState proc.OptimizerState
+	updateFunc     func(b *mtl.CommandBuffer, iteration int)
+
+	frozenLayers []layer.Layer
+	frozenParams []func(node *num.Data) bool
+	frozenInput  bool
+}
+
+// Freeze freezes params of layers when the model is compiled: the optimizer doesn't update them
+// and backward doesn't compute grads which are needed only for them.
+func (s *Model) Freeze(layers ...layer.Layer) {
+	s.frozenLayers = append(s.frozenLayers, layers...)
+}
+
+// FreezeParams freezes params matched by match when the model is compiled, e.g. by kind
+// with optimizer.ByKind or particular params of a layer, see Freeze.
+func (s *Model) FreezeParams(match func(node *num.Data) bool) {
+	s.frozenParams = append(s.frozenParams, match)
+}
+
+// FreezeInput marks the input as needing no grad when the model is compiled, so frozen layers
+// at the bottom get no backward pass. Without it the grad of the input is computed by backward,
+// e.g. for saliency maps, and the layers between the input and trainable params are not pruned.
+func (s *Model) FreezeInput() {
+	s.frozenInput = true
 }
 
 func (s *Model) Compile() *num.Data {
 	s.input = s.device.NewData(s.inDims)
+	s.input.Frozen = s.frozenInput
 	s.outObj, s.output = s.Layers.Compile(s.device, s.input)
-	s.update = append(s.update, s.Layers.ForUpdate()...)
-	if s.optimizer != nil {
-		s.updateFunc = s.optimizer(s.update)
+	s.freeze()
+	s.update = append(s.update, num.Trainable(s.Layers.ForUpdate())...)
+	if s.optimizer != nil && !s.device.IsNoGrad() {
+		s.updateFunc, s.optimizerState = s.optimizer(s.update)
 	}
 	return s.output
 }
 
+func (s *Model) freeze() {
+	for _, l := range s.frozenLayers {
+		if u, ok := l.(layer.Updatable); ok {
+			num.SetFrozen(true, u.ForUpdate()...)
+		}
+	}
+
+	for _, node := range s.Layers.ForUpdate() {
+		for _, match := range s.frozenParams {
+			if match(node) {
+				node.Frozen = true
+			}
+		}
+	}
+}
+
+// CompileNoGrad builds the model for inference only: activations and weights get
+// no gradient buffers and the optimizer is not created.
+func (s *Model) CompileNoGrad() *num.Data {
+	noGrad := s.device.IsNoGrad()
+	s.device.SetNoGrad(true)
+	defer s.device.SetNoGrad(noGrad)
+
+	return s.Compile()
+}
+
+// GetInput returns the input of the compiled model, its Grad is computed unless FreezeInput is called.
 func (s *Model) GetInput() *num.Data {
 	return s.input
 }
@@ -74,27 +127,70 @@ func (s *Model) GetTrainableParamsCount() (result int) {
 }
 
 func (s *Model) Update(b *mtl.CommandBuffer, iteration int) {
+	if s.updateFunc == nil {
+		panic("model has no optimizer or was compiled without gradients")
+	}
 	s.updateFunc(b, iteration)
 }
 
+// LoadOptions relax the checks of LoadFromFileWith.
+type LoadOptions struct {
+	// SkipMissingFile keeps weights of the model when the file doesn't exist.
+	SkipMissingFile bool
+	// IgnoreUnexpected allows tensors without params in the model, e.g. to load the decoder
+	// from the weights of an autoencoder. The fingerprint is not checked then.
+	IgnoreUnexpected bool
+	// NonStrict loads matching tensors only and returns the report of the others,
+	// the fingerprint is not checked.
+	NonStrict bool
+}
+
+// LoadFromFile loads weights saved by SaveToFile, the checkpoint must match the model exactly.
 func (s *Model) LoadFromFile(filename string) error {
+	_, err := s.LoadFromFileWith(filename, LoadOptions{})
+	return err
+}
+
+// LoadFromFileWith loads weights saved by SaveToFile. The architecture fingerprint and names
+// and shapes of all tensors are checked, nothing is loaded on mismatch unless opts allow it.
+// Files saved before fingerprints are loaded by layers.
+func (s *Model) LoadFromFileWith(filename string, opts LoadOptions) (LoadReport, error) {
 	t := time.Now()
 	config, err := os.ReadFile(filename)
-	if err != nil && errors.Is(err, os.ErrNotExist) {
+	if err != nil && errors.Is(err, os.ErrNotExist) && opts.SkipMissingFile {
 		log.Println("trained config not found (skip)")
-		return nil
+		return LoadReport{}, nil
 	}
 	if err != nil {
-		return fmt.Errorf("read file failed: %w", err)
+		return LoadReport{}, fmt.Errorf("read file failed: %w", err)
 	}
 	fmt.Println("read config success:", time.Since(t))
 
 	t = time.Now()
-	if err = json.Unmarshal(config, s); err != nil {
-		return fmt.Errorf("unmarshal config failed: %w", err)
+	var cp checkpoint
+	if err = json.Unmarshal(config, &cp); err != nil {
+		return LoadReport{}, fmt.Errorf("unmarshal config failed: %w", err)
+	}
+
+	if cp.Tensors == nil {
+		if err = s.loadLayers(cp.Layers); err != nil {
+			return LoadReport{}, fmt.Errorf("unmarshal config failed: %w", err)
+		}
+		fmt.Println("unmarshal success:", time.Since(t))
+		return LoadReport{}, nil
+	}
+
+	params := s.Layers.Params()
+	report := checkStateDict(params, cp.Tensors)
+	if !opts.NonStrict {
+		if err = s.checkCheckpoint(cp, report, opts.IgnoreUnexpected); err != nil {
+			return report, fmt.Errorf("load %s failed: %w", filename, err)
+		}
 	}
+
+	copyStateDict(params, cp.Tensors)
 	fmt.Println("unmarshal success:", time.Since(t))
-	return nil
+	return report, nil
 }
 
 func (s *Model) LoadFromProvider() {
@@ -105,9 +201,18 @@ func (s *Model) LoadFromProvider() {
 	}
 }
 
+// SetTraining switches layers with separate training and inference behaviour (e.g. BatchNorm2D).
+func (s *Model) SetTraining(training bool) {
+	s.Layers.SetTraining(training)
+}
+
+// SaveToFile writes the tensors of params by their names with the architecture fingerprint.
 func (s *Model) SaveToFile(filename string) error {
 	t := time.Now()
-	nnBytes, err := json.Marshal(s)
+	nnBytes, err := json.Marshal(checkpoint{
+		Fingerprint: s.Fingerprint(),
+		Tensors:     s.StateDict(),
+	})
 	if err != nil {
 		return fmt.Errorf("marshal model config failed: %w", err)
 	}
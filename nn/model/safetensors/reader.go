@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"math"
+	"sort"
 )
 
 type (
@@ -34,6 +35,18 @@ func NewReader(r ReadReadAt) (*reader, error) {
 	return &reader{f: r, headers: headers, headerLen: headerLen}, nil
 }
 
+// Names returns names of tensors in the file in sorted order.
+func (r *reader) Names() []string {
+	names := make([]string, 0, len(r.headers))
+	for name := range r.headers {
+		if name != "__metadata__" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
 func (r *reader) TensorShape(name string) ([]int, error) {
 	if _, ok := r.headers[name]; !ok {
 		return nil, fmt.Errorf("block %s not found", name)
@@ -0,0 +1,73 @@
+package safetensors
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+)
+
+// Tensor is a float32 tensor to write, Shape is in row-major order (outer axis first).
+type Tensor struct {
+	Shape []int
+	Data  []float32
+}
+
+// Write writes tensors in the safetensors format with F32 data ordered by name.
+func Write(w io.Writer, tensors map[string]Tensor) error {
+	names := make([]string, 0, len(tensors))
+	for name := range tensors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	headers := make(map[string]header, len(tensors))
+	offset := uint64(0)
+	for _, name := range names {
+		tensor := tensors[name]
+
+		length := 1
+		for _, n := range tensor.Shape {
+			length *= n
+		}
+		if length != len(tensor.Data) {
+			return fmt.Errorf("tensor %s: shape %v has %d values, data has %d", name, tensor.Shape, length, len(tensor.Data))
+		}
+
+		size := uint64(4 * len(tensor.Data))
+		headers[name] = header{DType: "F32", Shape: tensor.Shape, Offsets: []uint64{offset, offset + size}}
+		offset += size
+	}
+
+	headerBytes, err := json.Marshal(headers)
+	if err != nil {
+		return fmt.Errorf("marshal header: %v", err)
+	}
+	// The data is aligned to 8 bytes by padding the header with spaces.
+	if pad := len(headerBytes) % 8; pad != 0 {
+		headerBytes = append(headerBytes, bytes.Repeat([]byte(" "), 8-pad)...)
+	}
+
+	bw := bufio.NewWriter(w)
+	if err = binary.Write(bw, binary.LittleEndian, uint64(len(headerBytes))); err != nil {
+		return fmt.Errorf("write header length: %v", err)
+	}
+	if _, err = bw.Write(headerBytes); err != nil {
+		return fmt.Errorf("write header: %v", err)
+	}
+
+	value := make([]byte, 4)
+	for _, name := range names {
+		for _, v := range tensors[name].Data {
+			binary.LittleEndian.PutUint32(value, math.Float32bits(v))
+			if _, err = bw.Write(value); err != nil {
+				return fmt.Errorf("write block %s: %v", name, err)
+			}
+		}
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,39 @@
+package safetensors
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWrite(t *testing.T) {
+	tensors := map[string]Tensor{
+		"b.weight": {Shape: []int{2, 3}, Data: []float32{1, 2, 3, 4, 5, 6}},
+		"a.bias":   {Shape: []int{3}, Data: []float32{-1, 0.5, 7}},
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, Write(&buf, tensors))
+	require.Zero(t, (buf.Len()-8)%4)
+
+	r, err := NewReader(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	require.Zero(t, r.headerLen%8)
+	require.Equal(t, []string{"a.bias", "b.weight"}, r.Names())
+
+	for name, tensor := range tensors {
+		shape, err := r.TensorShape(name)
+		require.NoError(t, err)
+		require.Equal(t, tensor.Shape, shape)
+
+		data, err := r.ReadTensor(name)
+		require.NoError(t, err)
+		require.Equal(t, tensor.Data, data)
+	}
+}
+
+func TestWrite_ShapeMismatch(t *testing.T) {
+	err := Write(&bytes.Buffer{}, map[string]Tensor{"w": {Shape: []int{2, 2}, Data: []float32{1, 2, 3}}})
+	require.ErrorContains(t, err, "tensor w")
+}
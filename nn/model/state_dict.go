@@ -0,0 +1,202 @@
+package model
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/atkhx/metal/mtl"
+	"github.com/atkhx/metal/nn/layer"
+	"github.com/atkhx/metal/nn/model/safetensors"
+)
+
+// StateDict maps hierarchical names of params to their values, see layer.Param.
+type StateDict map[string]safetensors.Tensor
+
+// ShapeMismatch is a tensor whose shape differs from the shape of the param with the same name.
+type ShapeMismatch struct {
+	Name     string
+	Shape    []int
+	Expected []int
+}
+
+// LoadReport lists the differences between a state dict and params of a model.
+type LoadReport struct {
+	// Missing are params without tensors in the state dict.
+	Missing []string
+	// Unexpected are tensors without params in the model.
+	Unexpected []string
+	Mismatched []ShapeMismatch
+}
+
+// Err returns the error describing all differences, nil when there are none.
+func (r LoadReport) Err() error {
+	var parts []string
+	if len(r.Missing) > 0 {
+		parts = append(parts, "missing: "+strings.Join(r.Missing, ", "))
+	}
+	if len(r.Unexpected) > 0 {
+		parts = append(parts, "unexpected: "+strings.Join(r.Unexpected, ", "))
+	}
+	if len(r.Mismatched) > 0 {
+		mismatched := make([]string, len(r.Mismatched))
+		for i, m := range r.Mismatched {
+			mismatched[i] = fmt.Sprintf("%s %v, expected %v", m.Name, m.Shape, m.Expected)
+		}
+		parts = append(parts, "shape mismatch: "+strings.Join(mismatched, ", "))
+	}
+	if len(parts) == 0 {
+		return nil
+	}
+	return fmt.Errorf("state dict doesn't match the model: %s", strings.Join(parts, "; "))
+}
+
+// tensorShape returns dims from the outer axis, outer axes of size 1 are dropped.
+func tensorShape(dims mtl.MTLSize) []int {
+	switch {
+	case dims.D > 1:
+		return []int{dims.D, dims.H, dims.W}
+	case dims.H > 1:
+		return []int{dims.H, dims.W}
+	default:
+		return []int{dims.W}
+	}
+}
+
+// stateDict returns tensors of params, their data aliases the buffers of params.
+func stateDict(params []layer.Param) StateDict {
+	result := make(StateDict, len(params))
+	for _, param := range params {
+		if _, ok := result[param.Name]; ok {
+			panic(fmt.Sprintf("model: duplicate param name %q", param.Name))
+		}
+		result[param.Name] = safetensors.Tensor{
+			Shape: tensorShape(param.Data.Dims),
+			Data:  param.Data.Data.GetFloats(),
+		}
+	}
+	return result
+}
+
+// Clone returns a copy of the state dict which doesn't alias buffers of params.
+func (d StateDict) Clone() StateDict {
+	result := make(StateDict, len(d))
+	for name, tensor := range d {
+		result[name] = safetensors.Tensor{
+			Shape: slices.Clone(tensor.Shape),
+			Data:  slices.Clone(tensor.Data),
+		}
+	}
+	return result
+}
+
+// checkStateDict compares tensors of the state dict with params by names and shapes.
+func checkStateDict(params []layer.Param, state StateDict) LoadReport {
+	report := LoadReport{}
+	expected := stateDict(params)
+
+	for _, param := range params {
+		tensor, ok := state[param.Name]
+		if !ok {
+			report.Missing = append(report.Missing, param.Name)
+			continue
+		}
+		if shape := expected[param.Name].Shape; !matchesShape(tensor, shape) {
+			report.Mismatched = append(report.Mismatched, ShapeMismatch{Name: param.Name, Shape: tensor.Shape, Expected: shape})
+		}
+	}
+
+	for name := range state {
+		if _, ok := expected[name]; !ok {
+			report.Unexpected = append(report.Unexpected, name)
+		}
+	}
+	slices.Sort(report.Unexpected)
+	return report
+}
+
+func matchesShape(tensor safetensors.Tensor, shape []int) bool {
+	length := 1
+	for _, n := range shape {
+		length *= n
+	}
+	return slices.Equal(tensor.Shape, shape) && len(tensor.Data) == length
+}
+
+// copyStateDict copies tensors of the state dict into params with the same names and shapes.
+func copyStateDict(params []layer.Param, state StateDict) {
+	for _, param := range params {
+		tensor, ok := state[param.Name]
+		if ok && matchesShape(tensor, tensorShape(param.Data.Dims)) {
+			copy(param.Data.Data.GetFloats(), tensor.Data)
+		}
+	}
+}
+
+// loadStateDict copies tensors of the state dict into params with the same names and shapes.
+// In strict mode nothing is loaded when the state dict doesn't match the params exactly.
+func loadStateDict(params []layer.Param, state StateDict, strict bool) (LoadReport, error) {
+	report := checkStateDict(params, state)
+	if err := report.Err(); err != nil && strict {
+		return report, err
+	}
+
+	copyStateDict(params, state)
+	return report, nil
+}
+
+// StateDict returns tensors of all params of the compiled model by their hierarchical names.
+// Data of tensors aliases the buffers of params, it must be copied to keep the values.
+func (s *Model) StateDict() StateDict {
+	return stateDict(s.Layers.Params())
+}
+
+// LoadStateDict copies tensors of the state dict into params of the model by names.
+// In strict mode any missing, unexpected or shape-mismatched tensor is an error and nothing
+// is loaded, otherwise matching tensors are loaded and the report lists the rest.
+func (s *Model) LoadStateDict(state StateDict, strict bool) (LoadReport, error) {
+	return loadStateDict(s.Layers.Params(), state, strict)
+}
+
+// WriteStateDict writes the state dict to a safetensors file.
+func WriteStateDict(filename string, state StateDict) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("create state dict file failed: %w", err)
+	}
+	defer f.Close()
+
+	if err = safetensors.Write(f, state); err != nil {
+		return fmt.Errorf("write state dict failed: %w", err)
+	}
+	return f.Close()
+}
+
+// ReadStateDict reads all tensors of a safetensors file.
+func ReadStateDict(filename string) (StateDict, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("open state dict file failed: %w", err)
+	}
+	defer f.Close()
+
+	r, err := safetensors.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("read state dict failed: %w", err)
+	}
+
+	state := StateDict{}
+	for _, name := range r.Names() {
+		shape, err := r.TensorShape(name)
+		if err != nil {
+			return nil, err
+		}
+		data, err := r.ReadTensor(name)
+		if err != nil {
+			return nil, fmt.Errorf("read tensor failed: %w", err)
+		}
+		state[name] = safetensors.Tensor{Shape: shape, Data: data}
+	}
+	return state, nil
+}
@@ -0,0 +1,86 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/atkhx/metal/mtl"
+	"github.com/atkhx/metal/nn/layer"
+	"github.com/atkhx/metal/nn/model/safetensors"
+	"github.com/atkhx/metal/nn/proc"
+	"github.com/stretchr/testify/require"
+)
+
+func newStateDictModel(t *testing.T, outputs int) *Model {
+	device := proc.NewWithSystemDefaultDevice()
+	t.Cleanup(device.Release)
+
+	m := New(mtl.NewMTLSize(3, 2), layer.Layers{
+		layer.Named("encoder", &layer.LayersBlock{Layers: layer.Layers{
+			layer.NewLinear(4, nil, true, nil),
+			layer.NewReLu(),
+			layer.NewLinear(3, nil, false, nil),
+		}}),
+		layer.NewLinear(outputs, nil, true, nil),
+	}, device, nil)
+	m.Compile()
+	return m
+}
+
+func TestModel_StateDict(t *testing.T) {
+	state := newStateDictModel(t, 2).StateDict()
+
+	shapes := map[string][]int{}
+	for name, tensor := range state {
+		shapes[name] = tensor.Shape
+	}
+	require.Equal(t, map[string][]int{
+		"encoder.0.weight": {3, 4},
+		"encoder.0.bias":   {4},
+		"encoder.2.weight": {4, 3},
+		"1.weight":         {3, 2},
+		"1.bias":           {2},
+	}, shapes)
+
+	other := newStateDictModel(t, 2)
+	report, err := other.LoadStateDict(state, true)
+	require.NoError(t, err)
+	require.Equal(t, LoadReport{}, report)
+	require.Equal(t, state, other.StateDict())
+}
+
+func TestModel_LoadStateDict_Mismatch(t *testing.T) {
+	source := newStateDictModel(t, 3).StateDict().Clone()
+	delete(source, "encoder.0.bias")
+	source["decoder.weight"] = safetensors.Tensor{Shape: []int{1}, Data: []float32{1}}
+
+	m := newStateDictModel(t, 2)
+	before := m.StateDict().Clone()
+
+	expectedReport := LoadReport{
+		Missing:    []string{"encoder.0.bias"},
+		Unexpected: []string{"decoder.weight"},
+		Mismatched: []ShapeMismatch{
+			{Name: "1.weight", Shape: []int{3, 3}, Expected: []int{3, 2}},
+			{Name: "1.bias", Shape: []int{3}, Expected: []int{2}},
+		},
+	}
+
+	// strict mode loads nothing
+	report, err := m.LoadStateDict(source, true)
+	require.Equal(t, expectedReport, report)
+	require.EqualError(t, err, "state dict doesn't match the model: missing: encoder.0.bias; "+
+		"unexpected: decoder.weight; shape mismatch: 1.weight [3 3], expected [3 2], 1.bias [3], expected [2]")
+	require.Equal(t, before, m.StateDict())
+
+	// non-strict mode loads matching tensors
+	report, err = m.LoadStateDict(source, false)
+	require.NoError(t, err)
+	require.Equal(t, expectedReport, report)
+
+	loaded := m.StateDict()
+	require.Equal(t, source["encoder.0.weight"], loaded["encoder.0.weight"])
+	require.Equal(t, source["encoder.2.weight"], loaded["encoder.2.weight"])
+	for _, name := range []string{"encoder.0.bias", "1.weight", "1.bias"} {
+		require.Equal(t, before[name], loaded[name])
+	}
+}
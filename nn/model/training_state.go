@@ -0,0 +1,131 @@
+package model
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/atkhx/metal/nn/proc"
+	"github.com/atkhx/metal/nn/schedule"
+)
+
+// TrainingState is the progress of a training loop saved next to weights to resume training.
+type TrainingState struct {
+	// Step is the iteration to continue from, it is passed to Update.
+	Step int
+	// Cursor is the position of the data loader, see dataset.Loader.
+	Cursor int
+	// Plateau is the state of a schedule.ReduceOnPlateau of the optimizer, if it has one:
+	// unlike other schedules its factor depends on the observed metrics, not only on Step.
+	Plateau *schedule.PlateauState `json:",omitempty"`
+}
+
+type trainingStateConfig struct {
+	TrainingState
+	Random    proc.RandomState
+	Optimizer map[string][][]float32
+}
+
+// SaveTrainingState writes the state of the loop together with the optimizer state
+// and the state of random ops of the device. Weights are saved by SaveToFile.
+func (s *Model) SaveTrainingState(filename string, state TrainingState) error {
+	if s.updateFunc == nil {
+		return fmt.Errorf("model has no optimizer or was compiled without gradients")
+	}
+
+	cfg := trainingStateConfig{
+		TrainingState: state,
+		Random:        s.device.GetRandomState(),
+		Optimizer:     make(map[string][][]float32, len(s.optimizerState)),
+	}
+
+	for name, buffers := range s.optimizerState {
+		values := make([][]float32, len(buffers))
+		for i, buffer := range buffers {
+			if buffer != nil {
+				values[i] = buffer.GetFloats()
+			}
+		}
+		cfg.Optimizer[name] = values
+	}
+
+	stateBytes, err := json.Marshal(cfg)
+	if err != nil {
+		return fmt.Errorf("marshal training state failed: %w", err)
+	}
+	if err = os.WriteFile(filename, stateBytes, os.ModePerm); err != nil {
+		return fmt.Errorf("write training state failed: %w", err)
+	}
+	return nil
+}
+
+// LoadTrainingState restores the optimizer state and random ops saved by SaveTrainingState
+// and returns the state of the loop. The model must be built the same way, random ops
+// after device.SetSeed with the seed of the saved state.
+func (s *Model) LoadTrainingState(filename string) (TrainingState, error) {
+	if s.updateFunc == nil {
+		return TrainingState{}, fmt.Errorf("model has no optimizer or was compiled without gradients")
+	}
+
+	stateBytes, err := os.ReadFile(filename)
+	if err != nil {
+		return TrainingState{}, fmt.Errorf("read training state failed: %w", err)
+	}
+
+	var cfg trainingStateConfig
+	if err = json.Unmarshal(stateBytes, &cfg); err != nil {
+		return TrainingState{}, fmt.Errorf("unmarshal training state failed: %w", err)
+	}
+
+	if err = s.checkOptimizerState(cfg.Optimizer); err != nil {
+		return TrainingState{}, err
+	}
+	if err = s.device.RestoreRandomState(cfg.Random); err != nil {
+		return TrainingState{}, fmt.Errorf("restore random state failed: %w", err)
+	}
+
+	for name, buffers := range s.optimizerState {
+		for i, buffer := range buffers {
+			if buffer != nil {
+				copy(buffer.GetFloats(), cfg.Optimizer[name][i])
+			}
+		}
+	}
+	return cfg.TrainingState, nil
+}
+
+// checkOptimizerState checks the saved state matches the state of the optimizer of the model,
+// nothing is restored on mismatch.
+func (s *Model) checkOptimizerState(saved map[string][][]float32) error {
+	names := make([]string, 0, len(s.optimizerState))
+	for name := range s.optimizerState {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	if len(saved) != len(names) {
+		return fmt.Errorf("optimizer state has %d buffer sets, saved state has %d", len(names), len(saved))
+	}
+
+	for _, name := range names {
+		buffers := s.optimizerState[name]
+		values, ok := saved[name]
+		if !ok {
+			return fmt.Errorf("saved state has no optimizer buffers %q", name)
+		}
+		if len(values) != len(buffers) {
+			return fmt.Errorf("optimizer buffers %q: %d params, saved state has %d", name, len(buffers), len(values))
+		}
+
+		for i, buffer := range buffers {
+			length := 0
+			if buffer != nil {
+				length = len(buffer.GetFloats())
+			}
+			if len(values[i]) != length {
+				return fmt.Errorf("optimizer buffer %q of param %d: length %d, saved state has %d", name, i, length, len(values[i]))
+			}
+		}
+	}
+	return nil
+}
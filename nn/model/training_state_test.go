@@ -0,0 +1,163 @@
+package model
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/atkhx/metal/dataset"
+	"github.com/atkhx/metal/mtl"
+	"github.com/atkhx/metal/nn/layer"
+	"github.com/atkhx/metal/nn/optimizer"
+	"github.com/atkhx/metal/nn/proc"
+	"github.com/atkhx/metal/nn/schedule"
+	"github.com/stretchr/testify/require"
+)
+
+type regressionDataset struct{}
+
+func (regressionDataset) GetSamplesCount() int {
+	return 10
+}
+
+func (regressionDataset) ReadSample(index int) (dataset.Sample, error) {
+	x := float32(index)/10 - 0.5
+	return dataset.Sample{
+		Input:  []float32{x, x * x, 1 - x},
+		Target: []float32{2*x + 1, -x},
+	}, nil
+}
+
+func (regressionDataset) ReadRandomSampleBatch(int) (dataset.Sample, error) {
+	panic("not used")
+}
+
+type trainingRun struct {
+	device  *proc.Device
+	model   *Model
+	loader  *dataset.Loader
+	plateau *schedule.ReduceOnPlateau
+	train   func(from, to int)
+}
+
+func newTrainingRun(t *testing.T) *trainingRun {
+	const batchSize = 4
+
+	device := proc.NewWithSystemDefaultDevice()
+	t.Cleanup(device.Release)
+	device.SetSeed(42)
+
+	// the loss must fall by a half at every iteration, otherwise the factor is halved
+	plateau := schedule.NewReduceOnPlateau(0.5, 0, 0.5, 0.01)
+	cosine := schedule.Cosine(10, 0.1)
+
+	mtlDevice := device.GetMTLDevice()
+	adamw := optimizer.AdamW(mtlDevice, optimizer.AdamWConfig{
+		LearningRate: 0.01,
+		Beta1:        0.9,
+		Beta2:        0.999,
+		Eps:          1e-8,
+		WeightDecay:  0.1,
+		Schedule: schedule.Warmup(3, schedule.Func(func(iteration int) float32 {
+			return cosine.Factor(iteration) * plateau.Factor(iteration)
+		})),
+	})
+
+	m := New(mtl.NewMTLSize(3, batchSize), layer.Layers{
+		layer.NewLinear(8, nil, true, nil),
+		layer.NewReLu(),
+		layer.NewDropout(0.3),
+		layer.NewLinear(2, nil, true, nil),
+	}, device, adamw)
+	output := m.Compile()
+
+	targets := device.NewData(output.Dims)
+	diff := device.Sub(output, targets)
+	loss := device.Mean(device.Mul(diff, diff))
+	pipeline := device.GetTrainingPipeline(loss)
+
+	run := &trainingRun{
+		device:  device,
+		model:   m,
+		loader:  dataset.NewLoader(regressionDataset{}, batchSize, 7),
+		plateau: plateau,
+	}
+	run.train = func(from, to int) {
+		for iteration := from; iteration < to; iteration++ {
+			batch, err := run.loader.NextBatch()
+			require.NoError(t, err)
+			copy(m.GetInput().Data.GetFloats(), batch.Input)
+			copy(targets.Data.GetFloats(), batch.Target)
+
+			pipeline.TrainIteration(func(b *mtl.CommandBuffer) {
+				m.Update(b, iteration)
+			})
+			plateau.Observe(loss.Data.GetFloats()[0])
+		}
+	}
+	return run
+}
+
+func (r *trainingRun) weights() [][]float32 {
+	var result [][]float32
+	for _, node := range r.model.Layers.ForUpdate() {
+		result = append(result, append([]float32(nil), node.Data.GetFloats()...))
+	}
+	return result
+}
+
+// TestModel_ResumeTraining checks training stopped and resumed from a checkpoint ends
+// with the same weights as training without interruption.
+func TestModel_ResumeTraining(t *testing.T) {
+	dir := t.TempDir()
+	initialWeights := filepath.Join(dir, "initial.json")
+	weightsFile := filepath.Join(dir, "model.json")
+	stateFile := filepath.Join(dir, "training.json")
+
+	uninterrupted := newTrainingRun(t)
+	require.NoError(t, uninterrupted.model.SaveToFile(initialWeights))
+	uninterrupted.train(0, 8)
+
+	interrupted := newTrainingRun(t)
+	require.NoError(t, interrupted.model.LoadFromFile(initialWeights))
+	interrupted.train(0, 5)
+	require.NoError(t, interrupted.model.SaveToFile(weightsFile))
+	plateau := interrupted.plateau.State()
+	require.NoError(t, interrupted.model.SaveTrainingState(stateFile, TrainingState{
+		Step:    5,
+		Cursor:  interrupted.loader.Cursor(),
+		Plateau: &plateau,
+	}))
+	// the plateau has reduced the factor before the interruption
+	require.Less(t, plateau.Factor, float32(1))
+
+	resumed := newTrainingRun(t)
+	require.NoError(t, resumed.model.LoadFromFile(weightsFile))
+	state, err := resumed.model.LoadTrainingState(stateFile)
+	require.NoError(t, err)
+	require.Equal(t, TrainingState{Step: 5, Cursor: 20, Plateau: &plateau}, state)
+
+	resumed.loader.Seek(state.Cursor)
+	resumed.plateau.SetState(*state.Plateau)
+	resumed.train(state.Step, 8)
+
+	require.Equal(t, uninterrupted.weights(), resumed.weights())
+}
+
+func TestModel_LoadTrainingState_Mismatch(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "training.json")
+
+	run := newTrainingRun(t)
+	run.train(0, 1)
+	require.NoError(t, run.model.SaveTrainingState(stateFile, TrainingState{Step: 1}))
+
+	device := proc.NewWithSystemDefaultDevice()
+	defer device.Release()
+
+	other := New(mtl.NewMTLSize(3, 4), layer.Layers{
+		layer.NewLinear(2, nil, true, nil),
+	}, device, optimizer.AdamW(device.GetMTLDevice(), optimizer.AdamWConfig{LearningRate: 0.01}))
+	other.Compile()
+
+	_, err := other.LoadTrainingState(stateFile)
+	require.ErrorContains(t, err, "params")
+}
@@ -26,6 +26,9 @@ type TransformerBlockConfig struct {
 	UseRMSNorm bool
 	UseMulRows bool
 	UseDropout bool
+	// UseCheckpoint recomputes activations of the block in backward instead of keeping them.
+	// Memory is saved only after PlanMemory of the training pipeline.
+	UseCheckpoint bool
 }
 
 // NewTransformer builds a GPT-style LM with tied input/output embeddings.
@@ -135,8 +138,12 @@ func NewTransformerBlock(
 		ffn = append(ffn, layer.NewDropout(dropProb))
 	}
 
-	return layer.Layers{
+	block := layer.Layers{
 		layer.NewResidual(append(buildPre(), attn...)),
 		layer.NewResidual(append(buildPre(), ffn...)),
 	}
+	if cfg.UseCheckpoint {
+		return layer.Layers{layer.NewCheckpoint(block)}
+	}
+	return block
 }
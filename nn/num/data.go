@@ -8,8 +8,41 @@ type Data struct {
 	Dims mtl.MTLSize
 	Deps []*Data
 
+	// Shape is an optional N-dimensional view of the data, Dims is its folded form.
+	// Zero value means contiguous Dims.
+	Shape Shape
+
 	CalcData func(b *mtl.CommandBuffer)
 	CalcGrad func(b *mtl.CommandBuffer)
 
+	// RecalcData computes Data again in the backward pass of a checkpoint segment, nil means CalcData.
+	// Ops which change their state in forward (random masks, running statistics) set it to avoid that.
+	RecalcData func(b *mtl.CommandBuffer)
+	// Checkpoint lists nodes of the checkpoint segment ending at this node in forward order:
+	// pipelines compute their Data again right before CalcGrad of this node.
+	Checkpoint []*Data
+
+	// Param is the kind of a trainable node set by its layer, see GetParamKind.
+	Param ParamKind
+	// Frozen marks a leaf which needs no grad: a param the optimizer must not update or an input.
+	// Pipelines skip CalcGrad of nodes whose grads flow only to frozen leaves.
+	Frozen bool
+
 	SkipResetGrad bool
+	// KeepBuffers forbids replacing Data and Grad once kernels are built:
+	// it is set for nodes whose buffers are captured by kernels at construction.
+	KeepBuffers bool
+}
+
+func (d *Data) GetShape() Shape {
+	if d.Shape.Rank == 0 {
+		return ShapeFromMTLSize(d.Dims)
+	}
+	return d.Shape
+}
+
+// IsContiguous reports whether the data is laid out as its Dims say.
+// Only such data can be passed to kernels which are not elementwise.
+func (d *Data) IsContiguous() bool {
+	return d.Shape.Rank == 0 || d.Shape.IsContiguous()
 }
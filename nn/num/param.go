@@ -0,0 +1,84 @@
+package num
+
+// ParamKind tells optimizers what a trainable node is, e.g. to apply weight decay only to weights.
+type ParamKind int
+
+const (
+	// ParamAuto is the kind of untagged nodes, GetParamKind guesses it by dims.
+	ParamAuto ParamKind = iota
+	// ParamWeight is a matrix or a filter of a linear transformation.
+	ParamWeight
+	// ParamBias is added to outputs of a layer.
+	ParamBias
+	// ParamNorm is a gain or a shift of a normalization layer.
+	ParamNorm
+	// ParamEmbedding is a table of token or position embeddings.
+	ParamEmbedding
+	// ParamAdapter is a low-rank matrix of an adapter trained instead of a frozen weight.
+	ParamAdapter
+)
+
+func (k ParamKind) String() string {
+	switch k {
+	case ParamWeight:
+		return "weight"
+	case ParamBias:
+		return "bias"
+	case ParamNorm:
+		return "norm"
+	case ParamEmbedding:
+		return "embedding"
+	case ParamAdapter:
+		return "adapter"
+	default:
+		return "auto"
+	}
+}
+
+// GetParamKind returns the kind the node is tagged with. Untagged nodes with a single
+// axis longer than 1 are treated as biases, others as weights.
+func (d *Data) GetParamKind() ParamKind {
+	if d.Param != ParamAuto {
+		return d.Param
+	}
+
+	axes := 0
+	for _, n := range []int{d.Dims.W, d.Dims.H, d.Dims.D} {
+		if n > 1 {
+			axes++
+		}
+	}
+	if axes <= 1 {
+		return ParamBias
+	}
+	return ParamWeight
+}
+
+// TagParams sets the kind of nodes, layers call it for the nodes they return from ForUpdate.
+func TagParams(kind ParamKind, nodes ...*Data) {
+	for _, node := range nodes {
+		if node != nil {
+			node.Param = kind
+		}
+	}
+}
+
+// SetFrozen freezes or unfreezes nodes, it must be done before pipelines and optimizers are built.
+func SetFrozen(frozen bool, nodes ...*Data) {
+	for _, node := range nodes {
+		if node != nil {
+			node.Frozen = frozen
+		}
+	}
+}
+
+// Trainable returns nodes which are not frozen.
+func Trainable(nodes []*Data) []*Data {
+	result := make([]*Data, 0, len(nodes))
+	for _, node := range nodes {
+		if !node.Frozen {
+			result = append(result, node)
+		}
+	}
+	return result
+}
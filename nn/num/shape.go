@@ -0,0 +1,138 @@
+package num
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/atkhx/metal/mtl"
+)
+
+// MaxDims is the largest number of axes a Shape can have.
+const MaxDims = 6
+
+// Shape is an N-dimensional view of a flat buffer.
+// Axes go from the innermost to the outermost like in mtl.MTLSize: Dims[0] is the width.
+// Strides are in elements, a contiguous shape has Strides[0] == 1.
+//
+// Only view ops (View, Permute, Reshape, Contiguous), elementwise ops and the broadcast ops
+// (Add, Sub, Mul, Div) of proc.Device understand shapes. Other kernels, e.g. matrix multiplication
+// and convolution, work with the folded W x H x D Dims, so layers like Conv and SAMultiHead
+// still fold batch into D.
+type Shape struct {
+	Rank    int
+	Dims    [MaxDims]int
+	Strides [MaxDims]int
+}
+
+// NewShape creates contiguous shape, dims go from the innermost axis.
+func NewShape(dims ...int) Shape {
+	if len(dims) == 0 || len(dims) > MaxDims {
+		panic(fmt.Sprintf("shape rank must be from 1 to %d, got %d", MaxDims, len(dims)))
+	}
+
+	s := Shape{Rank: len(dims)}
+	stride := 1
+	for i, dim := range dims {
+		if dim < 1 {
+			panic(fmt.Sprintf("shape dims must be positive, got %v", dims))
+		}
+		s.Dims[i] = dim
+		s.Strides[i] = stride
+		stride *= dim
+	}
+	return s
+}
+
+// ShapeFromMTLSize returns contiguous shape of rank 3 with the same axes.
+func ShapeFromMTLSize(size mtl.MTLSize) Shape {
+	return NewShape(size.W, size.H, size.D)
+}
+
+func (s Shape) Length() int {
+	length := 1
+	for i := 0; i < s.Rank; i++ {
+		length *= s.Dims[i]
+	}
+	return length
+}
+
+func (s Shape) IsContiguous() bool {
+	stride := 1
+	for i := 0; i < s.Rank; i++ {
+		if s.Dims[i] > 1 && s.Strides[i] != stride {
+			return false
+		}
+		stride *= s.Dims[i]
+	}
+	return true
+}
+
+// Permute returns the view with reordered axes without moving data:
+// axis i of the result is axis axes[i] of s.
+func (s Shape) Permute(axes ...int) Shape {
+	if len(axes) != s.Rank {
+		panic(fmt.Sprintf("permute: expected %d axes, got %v", s.Rank, axes))
+	}
+
+	r := Shape{Rank: s.Rank}
+	used := [MaxDims]bool{}
+	for i, axis := range axes {
+		if axis < 0 || axis >= s.Rank || used[axis] {
+			panic(fmt.Sprintf("permute: invalid axes %v for rank %d", axes, s.Rank))
+		}
+		used[axis] = true
+		r.Dims[i] = s.Dims[axis]
+		r.Strides[i] = s.Strides[axis]
+	}
+	return r
+}
+
+// Reshape returns contiguous shape with the same length. It panics on non-contiguous shapes:
+// their data has to be copied first.
+func (s Shape) Reshape(dims ...int) Shape {
+	if !s.IsContiguous() {
+		panic(fmt.Sprintf("reshape: shape %v is not contiguous", s))
+	}
+	r := NewShape(dims...)
+	if r.Length() != s.Length() {
+		panic(fmt.Sprintf("reshape: cannot reshape %v to %v", s, r))
+	}
+	return r
+}
+
+// MTLSize folds the shape into three axes for kernels which work with W, H and D:
+// the axes after the second are multiplied into D.
+func (s Shape) MTLSize() mtl.MTLSize {
+	size := mtl.MTLSize{W: 1, H: 1, D: 1}
+	for i := 0; i < s.Rank; i++ {
+		switch i {
+		case 0:
+			size.W = s.Dims[i]
+		case 1:
+			size.H = s.Dims[i]
+		default:
+			size.D *= s.Dims[i]
+		}
+	}
+	return size
+}
+
+// Offset returns position of the element with the given coordinates in the buffer.
+func (s Shape) Offset(index ...int) int {
+	if len(index) != s.Rank {
+		panic(fmt.Sprintf("offset: expected %d coordinates, got %v", s.Rank, index))
+	}
+	offset := 0
+	for i, v := range index {
+		offset += v * s.Strides[i]
+	}
+	return offset
+}
+
+func (s Shape) String() string {
+	dims := make([]string, s.Rank)
+	for i := 0; i < s.Rank; i++ {
+		dims[i] = fmt.Sprint(s.Dims[i])
+	}
+	return "(" + strings.Join(dims, ", ") + ")"
+}
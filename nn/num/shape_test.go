@@ -0,0 +1,62 @@
+package num
+
+import (
+	"testing"
+
+	"github.com/atkhx/metal/mtl"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewShape(t *testing.T) {
+	s := NewShape(4, 3, 2, 5)
+	require.Equal(t, 4, s.Rank)
+	require.Equal(t, [MaxDims]int{4, 3, 2, 5}, s.Dims)
+	require.Equal(t, [MaxDims]int{1, 4, 12, 24}, s.Strides)
+	require.Equal(t, 120, s.Length())
+	require.True(t, s.IsContiguous())
+	require.Equal(t, mtl.NewMTLSize(4, 3, 10), s.MTLSize())
+	require.Equal(t, "(4, 3, 2, 5)", s.String())
+
+	require.Panics(t, func() { NewShape() })
+	require.Panics(t, func() { NewShape(1, 2, 3, 4, 5, 6, 7) })
+	require.Panics(t, func() { NewShape(2, 0) })
+}
+
+func TestShape_Permute(t *testing.T) {
+	s := NewShape(2, 3, 4).Permute(1, 0, 2)
+	require.Equal(t, [MaxDims]int{3, 2, 4}, s.Dims)
+	require.Equal(t, [MaxDims]int{2, 1, 6}, s.Strides)
+	require.False(t, s.IsContiguous())
+	require.Equal(t, 24, s.Length())
+
+	// element (x=2, y=1, z=3) of the view is element (1, 2, 3) of the original
+	require.Equal(t, NewShape(2, 3, 4).Offset(1, 2, 3), s.Offset(2, 1, 3))
+
+	// permuting back restores the original
+	require.Equal(t, NewShape(2, 3, 4), s.Permute(1, 0, 2))
+
+	// moving axes of size 1 keeps the layout
+	require.True(t, NewShape(5, 1, 1).Permute(0, 2, 1).IsContiguous())
+
+	require.Panics(t, func() { s.Permute(0, 1) })
+	require.Panics(t, func() { s.Permute(0, 0, 1) })
+	require.Panics(t, func() { s.Permute(0, 1, 3) })
+}
+
+func TestShape_Reshape(t *testing.T) {
+	s := NewShape(4, 6).Reshape(2, 2, 3, 2)
+	require.Equal(t, NewShape(2, 2, 3, 2), s)
+
+	require.Panics(t, func() { NewShape(4, 6).Reshape(5, 5) })
+	require.Panics(t, func() { NewShape(4, 6).Permute(1, 0).Reshape(24) })
+}
+
+func TestData_GetShape(t *testing.T) {
+	data := &Data{Dims: mtl.NewMTLSize(3, 2, 4)}
+	require.Equal(t, NewShape(3, 2, 4), data.GetShape())
+	require.True(t, data.IsContiguous())
+
+	data.Shape = NewShape(3, 2, 2, 2).Permute(1, 0, 2, 3)
+	require.Equal(t, data.Shape, data.GetShape())
+	require.False(t, data.IsContiguous())
+}
@@ -0,0 +1,110 @@
+package adafactor
+
+/*
+#cgo CFLAGS: -x objective-c
+#cgo LDFLAGS: -framework Metal -framework MetalPerformanceShaders -framework CoreGraphics -framework Foundation
+
+#include "kernel.h"
+
+void* adafactorKernelCreate(void *device, const char *kernelSource) {
+    return [[AdafactorKernelImpl alloc] initWithDevice:(id<MTLDevice>)device
+		kernelSource:[NSString stringWithUTF8String:kernelSource]];
+}
+
+void adafactorUpdate(
+    void *kernel,
+    void *commandBuffer,
+    void *dataBuffer,
+    void *gradBuffer,
+    void *rowBuffer,
+    void *colBuffer,
+    void *statsBuffer,
+    AdafactorParams params
+) {
+    [(__bridge AdafactorKernelImpl*)kernel update:(id<MTLCommandBuffer>)commandBuffer
+        dataBuffer:(id<MTLBuffer>)dataBuffer
+        gradBuffer:(id<MTLBuffer>)gradBuffer
+        rowBuffer:(id<MTLBuffer>)rowBuffer
+        colBuffer:(id<MTLBuffer>)colBuffer
+        statsBuffer:(id<MTLBuffer>)statsBuffer
+        params:params];
+}
+*/
+import "C"
+import (
+	_ "embed"
+	"unsafe"
+
+	"github.com/atkhx/metal/mtl"
+)
+
+//go:embed kernel.metal
+var metalFunctions string
+
+func New(device *mtl.Device) *Kernel {
+	cKernelString := C.CString(metalFunctions)
+	defer C.free(unsafe.Pointer(cKernelString))
+
+	return &Kernel{
+		kernelID: C.adafactorKernelCreate(device.GetID(), cKernelString),
+	}
+}
+
+type Kernel struct {
+	kernelID unsafe.Pointer
+}
+
+// StatsLength returns the length of the scratch buffer for the update of data with rows rows.
+func StatsLength(rows int) int {
+	return rows + 2
+}
+
+// UpdateFactored updates data viewed as a rows x cols matrix. Second moments are factored into
+// running averages of squared gradients by rows and by columns: v[i][j] = row[i]*col[j]/mean(row).
+// The update grad/sqrt(v) is scaled down when its RMS exceeds clipThreshold (0 disables clipping).
+func (k *Kernel) UpdateFactored(
+	b *mtl.CommandBuffer,
+	data, grad, rowAvg, colAvg, stats *mtl.Buffer,
+	rows, cols int,
+	learningRate, beta2, eps, clipThreshold float32,
+) {
+	k.update(b, data, grad, rowAvg, colAvg, stats, C.AdafactorParams{
+		rows:          C.uint(rows),
+		cols:          C.uint(cols),
+		factored:      1,
+		learningRate:  C.float(learningRate),
+		beta2:         C.float(beta2),
+		eps:           C.float(eps),
+		clipThreshold: C.float(clipThreshold),
+	})
+}
+
+// Update keeps the full second moment v = beta2*v + (1-beta2)*(grad^2 + eps),
+// it is used for vectors. Stats must hold StatsLength(1) values.
+func (k *Kernel) Update(
+	b *mtl.CommandBuffer,
+	data, grad, secondMoment, stats *mtl.Buffer,
+	learningRate, beta2, eps, clipThreshold float32,
+) {
+	k.update(b, data, grad, secondMoment, secondMoment, stats, C.AdafactorParams{
+		rows:          1,
+		cols:          C.uint(data.GetLengthFloats()),
+		learningRate:  C.float(learningRate),
+		beta2:         C.float(beta2),
+		eps:           C.float(eps),
+		clipThreshold: C.float(clipThreshold),
+	})
+}
+
+func (k *Kernel) update(b *mtl.CommandBuffer, data, grad, rowBuffer, colBuffer, stats *mtl.Buffer, params C.AdafactorParams) {
+	C.adafactorUpdate(
+		k.kernelID,
+		b.GetID(),
+		data.GetID(),
+		grad.GetID(),
+		rowBuffer.GetID(),
+		colBuffer.GetID(),
+		stats.GetID(),
+		params,
+	)
+}
@@ -0,0 +1,35 @@
+#ifndef AdafactorKernel_h
+#define AdafactorKernel_h
+
+#import <Foundation/Foundation.h>
+#import <Metal/Metal.h>
+
+typedef struct {
+    uint rows;
+    uint cols;
+    uint factored;
+    float learningRate;
+    float beta2;
+    float eps;
+    float clipThreshold;
+} AdafactorParams;
+
+@protocol AdafactorKernel <NSObject>
+
+- (instancetype) initWithDevice:(id<MTLDevice>)device kernelSource:(NSString*)kernelSource;
+
+- (void) update:(id<MTLCommandBuffer>)commandBuffer
+        dataBuffer:(id<MTLBuffer>)dataBuffer
+        gradBuffer:(id<MTLBuffer>)gradBuffer
+        rowBuffer:(id<MTLBuffer>)rowBuffer
+        colBuffer:(id<MTLBuffer>)colBuffer
+        statsBuffer:(id<MTLBuffer>)statsBuffer
+        params:(AdafactorParams)params;
+
+@end
+
+@interface AdafactorKernelImpl : NSObject <AdafactorKernel>
+    @property (nonatomic, strong) id<MTLLibrary> library;
+@end
+
+#endif /* AdafactorKernel_h */
@@ -0,0 +1,115 @@
+#import "kernel.h"
+#import <Foundation/Foundation.h>
+#include <stdio.h>
+
+static inline MTLSize threadgroupSize1D(id<MTLComputePipelineState> pso) {
+    NSUInteger w = pso.threadExecutionWidth;
+    NSUInteger max = pso.maxTotalThreadsPerThreadgroup;
+    if (w > max) {
+        w = max;
+    }
+    return MTLSizeMake(w, 1, 1);
+}
+
+@implementation AdafactorKernelImpl {
+    id<MTLDevice> _device;
+
+    id<MTLComputePipelineState> _rowStatsPSO;
+    id<MTLComputePipelineState> _colStatsPSO;
+    id<MTLComputePipelineState> _secondMomentPSO;
+    id<MTLComputePipelineState> _rowMeanPSO;
+    id<MTLComputePipelineState> _sumSquaresPSO;
+    id<MTLComputePipelineState> _rmsPSO;
+    id<MTLComputePipelineState> _applyPSO;
+
+    NSError *error;
+}
+
+- (id<MTLComputePipelineState>)createPipelineStateWithFunctionName:(NSString *)functionName {
+    id<MTLFunction> function = [self.library newFunctionWithName:functionName];
+    if (!function) {
+        printf("Failed to load function %s!\n", [functionName UTF8String]);
+        return nil;
+    }
+
+    id<MTLComputePipelineState> pipelineState = [_device newComputePipelineStateWithFunction:function error:&error];
+    if (error != nil) {
+        const char *errorCString = [[error localizedDescription] UTF8String];
+        printf("Failed to create pipeline state: %s\n", errorCString);
+        return nil;
+    }
+    return pipelineState;
+}
+
+- (instancetype)initWithDevice:(id<MTLDevice>)device kernelSource:(NSString*)kernelSource {
+    self = [super init];
+    if (self) {
+        _device = device;
+
+        self.library = [_device newLibraryWithSource:kernelSource options:nil error:&error];
+
+        _rowStatsPSO = [self createPipelineStateWithFunctionName:@"adafactorRowStats"];
+        _colStatsPSO = [self createPipelineStateWithFunctionName:@"adafactorColStats"];
+        _secondMomentPSO = [self createPipelineStateWithFunctionName:@"adafactorSecondMoment"];
+        _rowMeanPSO = [self createPipelineStateWithFunctionName:@"adafactorRowMean"];
+        _sumSquaresPSO = [self createPipelineStateWithFunctionName:@"adafactorSumSquares"];
+        _rmsPSO = [self createPipelineStateWithFunctionName:@"adafactorRMS"];
+        _applyPSO = [self createPipelineStateWithFunctionName:@"adafactorApply"];
+    }
+    return self;
+}
+
+// All passes share the same buffer indices, so every pass gets all of them.
+- (void) encode:(id<MTLCommandBuffer>)commandBuffer
+        pso:(id<MTLComputePipelineState>)pso
+        threads:(NSUInteger)threads
+        dataBuffer:(id<MTLBuffer>)dataBuffer
+        gradBuffer:(id<MTLBuffer>)gradBuffer
+        rowBuffer:(id<MTLBuffer>)rowBuffer
+        colBuffer:(id<MTLBuffer>)colBuffer
+        statsBuffer:(id<MTLBuffer>)statsBuffer
+        params:(AdafactorParams)params
+{
+    id<MTLComputeCommandEncoder> encoder = [commandBuffer computeCommandEncoder];
+    [encoder setComputePipelineState:pso];
+    [encoder setBuffer:dataBuffer offset:0 atIndex:0];
+    [encoder setBuffer:gradBuffer offset:0 atIndex:1];
+    [encoder setBuffer:rowBuffer offset:0 atIndex:2];
+    [encoder setBuffer:colBuffer offset:0 atIndex:3];
+    [encoder setBuffer:statsBuffer offset:0 atIndex:4];
+    [encoder setBytes:&params length:sizeof(AdafactorParams) atIndex:5];
+    [encoder dispatchThreads:MTLSizeMake(threads, 1, 1) threadsPerThreadgroup:threadgroupSize1D(pso)];
+    [encoder endEncoding];
+}
+
+- (void) update:(id<MTLCommandBuffer>)commandBuffer
+        dataBuffer:(id<MTLBuffer>)dataBuffer
+        gradBuffer:(id<MTLBuffer>)gradBuffer
+        rowBuffer:(id<MTLBuffer>)rowBuffer
+        colBuffer:(id<MTLBuffer>)colBuffer
+        statsBuffer:(id<MTLBuffer>)statsBuffer
+        params:(AdafactorParams)params
+{
+    NSUInteger length = params.rows * params.cols;
+
+    if (params.factored) {
+        [self encode:commandBuffer pso:_rowStatsPSO threads:params.rows
+            dataBuffer:dataBuffer gradBuffer:gradBuffer rowBuffer:rowBuffer colBuffer:colBuffer statsBuffer:statsBuffer params:params];
+        [self encode:commandBuffer pso:_colStatsPSO threads:params.cols
+            dataBuffer:dataBuffer gradBuffer:gradBuffer rowBuffer:rowBuffer colBuffer:colBuffer statsBuffer:statsBuffer params:params];
+        [self encode:commandBuffer pso:_rowMeanPSO threads:1
+            dataBuffer:dataBuffer gradBuffer:gradBuffer rowBuffer:rowBuffer colBuffer:colBuffer statsBuffer:statsBuffer params:params];
+    } else {
+        [self encode:commandBuffer pso:_secondMomentPSO threads:length
+            dataBuffer:dataBuffer gradBuffer:gradBuffer rowBuffer:rowBuffer colBuffer:colBuffer statsBuffer:statsBuffer params:params];
+    }
+
+    [self encode:commandBuffer pso:_sumSquaresPSO threads:params.rows
+        dataBuffer:dataBuffer gradBuffer:gradBuffer rowBuffer:rowBuffer colBuffer:colBuffer statsBuffer:statsBuffer params:params];
+    [self encode:commandBuffer pso:_rmsPSO threads:1
+        dataBuffer:dataBuffer gradBuffer:gradBuffer rowBuffer:rowBuffer colBuffer:colBuffer statsBuffer:statsBuffer params:params];
+    [self encode:commandBuffer pso:_applyPSO threads:length
+        dataBuffer:dataBuffer gradBuffer:gradBuffer rowBuffer:rowBuffer colBuffer:colBuffer statsBuffer:statsBuffer params:params];
+}
+
+@end
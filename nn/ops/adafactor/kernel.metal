@@ -0,0 +1,133 @@
+#include <metal_stdlib>
+
+using namespace metal;
+
+// Data is viewed as a rows x cols matrix. Factored second moments are kept as running averages
+// of squared gradients by rows (rowBuffer) and by columns (colBuffer), otherwise rowBuffer holds
+// the full second moment. Stats hold sums of squared updates by rows, then the mean of row
+// averages and the RMS of the update.
+struct AdafactorParams {
+    uint rows;
+    uint cols;
+    uint factored;
+    float learningRate;
+    float beta2;
+    float eps;
+    float clipThreshold;
+};
+
+// Non-finite gradients are treated as zeros like in adamw.
+static inline float finiteGrad(float g) {
+    return (isnan(g) || isinf(g)) ? 0.0 : g;
+}
+
+static inline float secondMoment(
+    device const float *rowBuffer,
+    device const float *colBuffer,
+    device const float *statsBuffer,
+    constant AdafactorParams& p,
+    uint i,
+    uint j
+) {
+    if (p.factored) {
+        return rowBuffer[i] * colBuffer[j] / statsBuffer[p.rows];
+    }
+    return rowBuffer[i * p.cols + j];
+}
+
+kernel void adafactorRowStats(
+    device const float *gradBuffer [[ buffer(1) ]],
+    device float *rowBuffer [[ buffer(2) ]],
+    constant AdafactorParams& p [[ buffer(5) ]],
+    const uint id [[ thread_position_in_grid ]] )
+{
+    float sum = 0.0;
+    for (uint j = 0; j < p.cols; j++) {
+        float g = finiteGrad(gradBuffer[id * p.cols + j]);
+        sum += g * g;
+    }
+    rowBuffer[id] = p.beta2 * rowBuffer[id] + (1 - p.beta2) * (sum / p.cols + p.eps);
+}
+
+kernel void adafactorColStats(
+    device const float *gradBuffer [[ buffer(1) ]],
+    device float *colBuffer [[ buffer(3) ]],
+    constant AdafactorParams& p [[ buffer(5) ]],
+    const uint id [[ thread_position_in_grid ]] )
+{
+    float sum = 0.0;
+    for (uint i = 0; i < p.rows; i++) {
+        float g = finiteGrad(gradBuffer[i * p.cols + id]);
+        sum += g * g;
+    }
+    colBuffer[id] = p.beta2 * colBuffer[id] + (1 - p.beta2) * (sum / p.rows + p.eps);
+}
+
+kernel void adafactorSecondMoment(
+    device const float *gradBuffer [[ buffer(1) ]],
+    device float *rowBuffer [[ buffer(2) ]],
+    constant AdafactorParams& p [[ buffer(5) ]],
+    const uint id [[ thread_position_in_grid ]] )
+{
+    float g = finiteGrad(gradBuffer[id]);
+    rowBuffer[id] = p.beta2 * rowBuffer[id] + (1 - p.beta2) * (g * g + p.eps);
+}
+
+kernel void adafactorRowMean(
+    device const float *rowBuffer [[ buffer(2) ]],
+    device float *statsBuffer [[ buffer(4) ]],
+    constant AdafactorParams& p [[ buffer(5) ]],
+    const uint id [[ thread_position_in_grid ]] )
+{
+    float sum = 0.0;
+    for (uint i = 0; i < p.rows; i++) {
+        sum += rowBuffer[i];
+    }
+    statsBuffer[p.rows] = sum / p.rows;
+}
+
+kernel void adafactorSumSquares(
+    device const float *gradBuffer [[ buffer(1) ]],
+    device const float *rowBuffer [[ buffer(2) ]],
+    device const float *colBuffer [[ buffer(3) ]],
+    device float *statsBuffer [[ buffer(4) ]],
+    constant AdafactorParams& p [[ buffer(5) ]],
+    const uint id [[ thread_position_in_grid ]] )
+{
+    float sum = 0.0;
+    for (uint j = 0; j < p.cols; j++) {
+        float u = finiteGrad(gradBuffer[id * p.cols + j]) / sqrt(secondMoment(rowBuffer, colBuffer, statsBuffer, p, id, j));
+        sum += u * u;
+    }
+    statsBuffer[id] = sum;
+}
+
+kernel void adafactorRMS(
+    device float *statsBuffer [[ buffer(4) ]],
+    constant AdafactorParams& p [[ buffer(5) ]],
+    const uint id [[ thread_position_in_grid ]] )
+{
+    float sum = 0.0;
+    for (uint i = 0; i < p.rows; i++) {
+        sum += statsBuffer[i];
+    }
+    statsBuffer[p.rows + 1] = sqrt(sum / (p.rows * p.cols));
+}
+
+kernel void adafactorApply(
+    device float *dataBuffer [[ buffer(0) ]],
+    device const float *gradBuffer [[ buffer(1) ]],
+    device const float *rowBuffer [[ buffer(2) ]],
+    device const float *colBuffer [[ buffer(3) ]],
+    device const float *statsBuffer [[ buffer(4) ]],
+    constant AdafactorParams& p [[ buffer(5) ]],
+    const uint id [[ thread_position_in_grid ]] )
+{
+    uint i = id / p.cols;
+    uint j = id % p.cols;
+
+    float u = finiteGrad(gradBuffer[id]) / sqrt(secondMoment(rowBuffer, colBuffer, statsBuffer, p, i, j));
+    float scale = p.clipThreshold > 0 ? max(1.0, statsBuffer[p.rows + 1] / p.clipThreshold) : 1.0;
+
+    dataBuffer[id] -= p.learningRate * u / scale;
+}
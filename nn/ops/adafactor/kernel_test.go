@@ -0,0 +1,77 @@
+package adafactor
+
+import (
+	"testing"
+
+	"github.com/atkhx/metal/mtl"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKernel_UpdateFactored(t *testing.T) {
+	device := mtl.MustCreateSystemDefaultDevice()
+	defer device.Release()
+
+	kernel := New(device)
+
+	testCases := []struct {
+		name          string
+		clipThreshold float32
+		expData       []float32
+	}{
+		{
+			// row = 0.5*[2.5, 12.5], col = 0.5*[5, 10], v = row*col/mean(row)
+			name:    "no clipping",
+			expData: []float32{0.8904555, 0.8450807, 0.8530306, 0.8614359},
+		},
+		{
+			// RMS of the update is 1.3856406
+			name:          "clipping",
+			clipThreshold: 1,
+			expData:       []float32{0.9209431, 0.8881966, 0.8939340, 0.9},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			data := device.NewBufferWithFloats([]float32{1, 1, 1, 1}, mtl.ResourceStorageModeShared)
+			grad := device.NewBufferWithFloats([]float32{1, 2, 3, 4}, mtl.ResourceStorageModeShared)
+			rowAvg := device.NewBufferEmptyFloatsBuffer(2, mtl.ResourceStorageModeShared)
+			colAvg := device.NewBufferEmptyFloatsBuffer(2, mtl.ResourceStorageModeShared)
+			stats := device.NewBufferEmptyFloatsBuffer(StatsLength(2), mtl.ResourceStorageModeShared)
+
+			cmd := device.NewCommandQueue().GetNewMTLCommandBuffer()
+			defer cmd.Release()
+
+			kernel.UpdateFactored(cmd, data, grad, rowAvg, colAvg, stats, 2, 2, 0.1, 0.5, 0, tc.clipThreshold)
+			cmd.Commit()
+			cmd.WaitUntilCompleted()
+
+			require.InDeltaSlice(t, []float32{1.25, 6.25}, rowAvg.GetFloats(), 1e-6)
+			require.InDeltaSlice(t, []float32{2.5, 5}, colAvg.GetFloats(), 1e-6)
+			require.InDeltaSlice(t, tc.expData, data.GetFloats(), 1e-6)
+		})
+	}
+}
+
+func TestKernel_Update(t *testing.T) {
+	device := mtl.MustCreateSystemDefaultDevice()
+	defer device.Release()
+
+	kernel := New(device)
+
+	data := device.NewBufferWithFloats([]float32{1, 1}, mtl.ResourceStorageModeShared)
+	grad := device.NewBufferWithFloats([]float32{1, -2}, mtl.ResourceStorageModeShared)
+	secondMoment := device.NewBufferEmptyFloatsBuffer(2, mtl.ResourceStorageModeShared)
+	stats := device.NewBufferEmptyFloatsBuffer(StatsLength(1), mtl.ResourceStorageModeShared)
+
+	cmd := device.NewCommandQueue().GetNewMTLCommandBuffer()
+	defer cmd.Release()
+
+	kernel.Update(cmd, data, grad, secondMoment, stats, 0.1, 0.5, 0, 0)
+	cmd.Commit()
+	cmd.WaitUntilCompleted()
+
+	// v = 0.5*grad^2, update = grad/sqrt(v) = sqrt(2)*sign(grad)
+	require.InDeltaSlice(t, []float32{0.5, 2}, secondMoment.GetFloats(), 1e-6)
+	require.InDeltaSlice(t, []float32{0.8585786, 1.1414214}, data.GetFloats(), 1e-6)
+}
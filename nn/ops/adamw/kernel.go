@@ -37,6 +37,22 @@ void adamWUpdate(
         eps:eps];
 }
 
+void adamWUpdateDecoupled(
+    void *kernelID,
+    void *commandBufferID,
+    void *dataBufferID,
+    void *gradBufferID,
+    void *mBufferID,
+    void *vBufferID,
+    AdamWParams params
+) {
+    [(__bridge MPSAdamWImpl*)kernelID updateWithAdamW:(id<MTLCommandBuffer>)commandBufferID
+        dataBuffer:(id<MTLBuffer>)dataBufferID
+        gradBuffer:(id<MTLBuffer>)gradBufferID
+        mBuffer:(id<MTLBuffer>)mBufferID
+        vBuffer:(id<MTLBuffer>)vBufferID
+        params:params];
+}
 
 */
 import "C"
@@ -92,3 +108,41 @@ func (k *Kernel) UpdateWithAdam(
 		C.float(eps),
 	)
 }
+
+// UpdateWithAdamW applies Adam with the weight decay decoupled from the gradient:
+// data is multiplied by 1 - learningRate*weightDecay before the Adam step.
+// Bias corrections are 1 / (1 - beta^t) for the step t counted from 1.
+func (k *Kernel) UpdateWithAdamW(
+	commandBuffer *mtl.CommandBuffer,
+	dataBuffer *mtl.Buffer,
+	gradBuffer *mtl.Buffer,
+	mBuffer *mtl.Buffer,
+	vBuffer *mtl.Buffer,
+	learningRate float32,
+	beta1 float32,
+	beta2 float32,
+	biasCorrection1 float32,
+	biasCorrection2 float32,
+	eps float32,
+	weightDecay float32,
+) {
+	C.adamWUpdateDecoupled(
+		k.kernelID,
+		commandBuffer.GetID(),
+
+		dataBuffer.GetID(),
+		gradBuffer.GetID(),
+		mBuffer.GetID(),
+		vBuffer.GetID(),
+
+		C.AdamWParams{
+			learningRate:    C.float(learningRate),
+			beta1:           C.float(beta1),
+			beta2:           C.float(beta2),
+			biasCorrection1: C.float(biasCorrection1),
+			biasCorrection2: C.float(biasCorrection2),
+			eps:             C.float(eps),
+			weightDecay:     C.float(weightDecay),
+		},
+	)
+}
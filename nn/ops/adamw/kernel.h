@@ -4,6 +4,16 @@
 #import <Foundation/Foundation.h>
 #import <Metal/Metal.h>
 
+typedef struct {
+    float learningRate;
+    float beta1;
+    float beta2;
+    float biasCorrection1;
+    float biasCorrection2;
+    float eps;
+    float weightDecay;
+} AdamWParams;
+
 @protocol MPSAdamW <NSObject>
 
 - (instancetype) initWithDevice:(id<MTLDevice>)device kernelSource:(NSString*)kernelSource;
@@ -19,6 +29,13 @@
         beta2powIteration:(float)beta2powIteration
         eps:(float)eps;
 
+- (void) updateWithAdamW:(id<MTLCommandBuffer>)commandBuffer
+        dataBuffer:(id<MTLBuffer>)dataBuffer
+        gradBuffer:(id<MTLBuffer>)gradBuffer
+        mBuffer:(id<MTLBuffer>)mBuffer
+        vBuffer:(id<MTLBuffer>)vBuffer
+        params:(AdamWParams)params;
+
 @end
 
 
@@ -9,6 +9,7 @@ struct Parameters {
 @implementation MPSAdamWImpl {
     id<MTLDevice> _device;
     id<MTLComputePipelineState> _updateWithAdamPSO;
+    id<MTLComputePipelineState> _updateWithAdamWPSO;
     NSError *error;
 }
 
@@ -35,6 +36,7 @@ struct Parameters {
         _device = device;
         self.library = [_device newLibraryWithSource:kernelSource options:nil error:&error];
         _updateWithAdamPSO = [self createPipelineStateWithFunctionName:@"updateWithAdam"];
+        _updateWithAdamWPSO = [self createPipelineStateWithFunctionName:@"updateWithAdamW"];
     }
     return self;
 }
@@ -72,4 +74,28 @@ struct Parameters {
     [updateWithAdam endEncoding];
 }
 
+- (void) updateWithAdamW:(id<MTLCommandBuffer>)commandBuffer
+        dataBuffer:(id<MTLBuffer>)dataBuffer
+        gradBuffer:(id<MTLBuffer>)gradBuffer
+        mBuffer:(id<MTLBuffer>)mBuffer
+        vBuffer:(id<MTLBuffer>)vBuffer
+        params:(AdamWParams)params
+{
+    id<MTLComputeCommandEncoder> updateWithAdamW = [commandBuffer computeCommandEncoder];
+    [updateWithAdamW setComputePipelineState:_updateWithAdamWPSO];
+
+    [updateWithAdamW setBuffer:dataBuffer offset:0 atIndex:0];
+    [updateWithAdamW setBuffer:gradBuffer offset:0 atIndex:1];
+
+    [updateWithAdamW setBuffer:mBuffer offset:0 atIndex:2];
+    [updateWithAdamW setBuffer:vBuffer offset:0 atIndex:3];
+
+    [updateWithAdamW setBytes:&params length:sizeof(AdamWParams) atIndex:4];
+
+    [updateWithAdamW dispatchThreads:MTLSizeMake(dataBuffer.length / sizeof(float), 1, 1)
+              threadsPerThreadgroup:MTLSizeMake(256, 1, 1)];
+
+    [updateWithAdamW endEncoding];
+}
+
 @end
@@ -2,6 +2,16 @@
 
 using namespace metal;
 
+struct AdamWParams {
+    float learningRate;
+    float beta1;
+    float beta2;
+    float biasCorrection1;
+    float biasCorrection2;
+    float eps;
+    float weightDecay;
+};
+
 kernel void updateWithAdam(
     device float *dataBuffer [[ buffer(0) ]],
     device float *gradBuffer [[ buffer(1) ]],
@@ -23,3 +33,26 @@ kernel void updateWithAdam(
 
     dataBuffer[id] -= mBuffer[id] * beta1powIterationLR / (sqrt(vBuffer[id] * beta2powIteration) + eps);
 }
+
+// updateWithAdamW decays weights apart from the gradient (Loshchilov and Hutter, 2019),
+// biasCorrection1 and biasCorrection2 are 1 / (1 - beta^t) for the step t.
+kernel void updateWithAdamW(
+    device float *dataBuffer [[ buffer(0) ]],
+    device const float *gradBuffer [[ buffer(1) ]],
+    device float *mBuffer [[ buffer(2) ]],
+    device float *vBuffer [[ buffer(3) ]],
+    constant AdamWParams& p [[ buffer(4) ]],
+    const uint id [[ thread_position_in_grid ]] )
+{
+    float g = gradBuffer[id];
+    if (isnan(g) || isinf(g)) {
+        g = 0.0;
+    }
+    float m = p.beta1*mBuffer[id] + (1 - p.beta1)*g;
+    float v = p.beta2*vBuffer[id] + (1 - p.beta2)*g*g;
+    mBuffer[id] = m;
+    vBuffer[id] = v;
+
+    float data = dataBuffer[id] * (1 - p.learningRate*p.weightDecay);
+    dataBuffer[id] = data - p.learningRate * m * p.biasCorrection1 / (sqrt(v * p.biasCorrection2) + p.eps);
+}
@@ -63,3 +63,35 @@ func TestAdamW_IgnoresNaNGrad(t *testing.T) {
 	require.InDelta(t, 0, float64(v.GetFloats()[0]), 1e-6)
 	require.InDelta(t, 1, float64(data.GetFloats()[0]), 1e-6)
 }
+
+func TestAdamW_DecoupledWeightDecay(t *testing.T) {
+	device := mtl.MustCreateSystemDefaultDevice()
+	defer device.Release()
+
+	kernel := New(device)
+
+	run := func(weightDecay float32) (data, m, v float32) {
+		dataBuffer := device.NewBufferWithFloats([]float32{1}, mtl.ResourceStorageModeShared)
+		gradBuffer := device.NewBufferWithFloats([]float32{0.5}, mtl.ResourceStorageModeShared)
+		mBuffer := device.NewBufferWithFloats([]float32{0}, mtl.ResourceStorageModeShared)
+		vBuffer := device.NewBufferWithFloats([]float32{0}, mtl.ResourceStorageModeShared)
+
+		cmd := device.NewCommandQueue().GetNewMTLCommandBuffer()
+		defer cmd.Release()
+
+		// The first step: bias corrections are 1/(1-0.9) and 1/(1-0.999).
+		kernel.UpdateWithAdamW(cmd, dataBuffer, gradBuffer, mBuffer, vBuffer, 0.1, 0.9, 0.999, 10, 1000, 0, weightDecay)
+		cmd.Commit()
+		cmd.WaitUntilCompleted()
+
+		return dataBuffer.GetFloats()[0], mBuffer.GetFloats()[0], vBuffer.GetFloats()[0]
+	}
+
+	data, m, v := run(0)
+	require.InDelta(t, 0.9, float64(data), 1e-5)
+	require.InDelta(t, 0.05, float64(m), 1e-6)
+	require.InDelta(t, 0.00025, float64(v), 1e-7)
+
+	data, _, _ = run(0.5)
+	require.InDelta(t, 0.85, float64(data), 1e-5)
+}
@@ -0,0 +1,131 @@
+package avgpool
+
+/*
+#cgo CFLAGS: -x objective-c
+#cgo LDFLAGS: -framework Metal -framework MetalPerformanceShaders -framework CoreGraphics -framework Foundation
+
+#include "kernel.h"
+
+void* avgPoolKernelCreate(void *device, const char *kernelSource) {
+    return [[AvgPoolKernelImpl alloc] initWithDevice:(id<MTLDevice>)device
+		kernelSource:[NSString stringWithUTF8String:kernelSource]];
+}
+
+void avgPoolForward(
+    void *kernel,
+    void *commandBuffer,
+    void *inputData,
+    void *outputData,
+    AvgPoolParams params
+) {
+    [(__bridge AvgPoolKernelImpl*)kernel forward:(id<MTLCommandBuffer>)commandBuffer
+        inputData:(id<MTLBuffer>)inputData
+        outputData:(id<MTLBuffer>)outputData
+        params:params];
+}
+
+void avgPoolBackward(
+    void *kernel,
+    void *commandBuffer,
+    void *inputGrad,
+    void *outputGrad,
+    AvgPoolParams params
+) {
+    [(__bridge AvgPoolKernelImpl*)kernel backward:(id<MTLCommandBuffer>)commandBuffer
+        inputGrad:(id<MTLBuffer>)inputGrad
+        outputGrad:(id<MTLBuffer>)outputGrad
+        params:params];
+}
+*/
+import "C"
+import (
+	_ "embed"
+	"unsafe"
+
+	"github.com/atkhx/metal/mtl"
+	"github.com/atkhx/metal/nn/num"
+)
+
+//go:embed kernel.metal
+var metalFunctions string
+
+// Params describes the pooling window. With CountIncludePad the divisor counts
+// padded positions inside the window, otherwise only the input positions.
+type Params struct {
+	PoolW           int
+	PoolH           int
+	StrideW         int
+	StrideH         int
+	PaddingW        int
+	PaddingH        int
+	CountIncludePad bool
+}
+
+// OutputSize returns the spatial size of the pooling output.
+func (p Params) OutputSize(inW, inH int) (outW, outH int) {
+	outW = (inW+2*p.PaddingW-p.PoolW)/p.StrideW + 1
+	outH = (inH+2*p.PaddingH-p.PoolH)/p.StrideH + 1
+	return
+}
+
+func New(
+	device *mtl.Device,
+	input *num.Data,
+	output *num.Data,
+	params Params,
+) *Kernel {
+	cKernelString := C.CString(metalFunctions)
+	defer C.free(unsafe.Pointer(cKernelString))
+
+	countIncludePad := 0
+	if params.CountIncludePad {
+		countIncludePad = 1
+	}
+
+	return &Kernel{
+		kernelID: C.avgPoolKernelCreate(device.GetID(), cKernelString),
+		input:    input,
+		output:   output,
+		params: C.AvgPoolParams{
+			inW:             C.uint(input.Dims.W),
+			inH:             C.uint(input.Dims.H),
+			outW:            C.uint(output.Dims.W),
+			outH:            C.uint(output.Dims.H),
+			depth:           C.uint(input.Dims.D),
+			poolW:           C.uint(params.PoolW),
+			poolH:           C.uint(params.PoolH),
+			strideW:         C.uint(params.StrideW),
+			strideH:         C.uint(params.StrideH),
+			padW:            C.uint(params.PaddingW),
+			padH:            C.uint(params.PaddingH),
+			countIncludePad: C.uint(countIncludePad),
+		},
+	}
+}
+
+type Kernel struct {
+	kernelID unsafe.Pointer
+	input    *num.Data
+	output   *num.Data
+	params   C.AvgPoolParams
+}
+
+func (k *Kernel) Forward(b *mtl.CommandBuffer) {
+	C.avgPoolForward(
+		k.kernelID,
+		b.GetID(),
+		k.input.Data.GetID(),
+		k.output.Data.GetID(),
+		k.params,
+	)
+}
+
+func (k *Kernel) Backward(b *mtl.CommandBuffer) {
+	C.avgPoolBackward(
+		k.kernelID,
+		b.GetID(),
+		k.input.Grad.GetID(),
+		k.output.Grad.GetID(),
+		k.params,
+	)
+}
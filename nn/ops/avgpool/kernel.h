@@ -0,0 +1,42 @@
+#ifndef AvgPoolKernel_h
+#define AvgPoolKernel_h
+
+#import <Foundation/Foundation.h>
+#import <Metal/Metal.h>
+
+typedef struct {
+    uint inW;
+    uint inH;
+    uint outW;
+    uint outH;
+    uint depth;
+    uint poolW;
+    uint poolH;
+    uint strideW;
+    uint strideH;
+    uint padW;
+    uint padH;
+    uint countIncludePad;
+} AvgPoolParams;
+
+@protocol AvgPoolKernel <NSObject>
+
+- (instancetype) initWithDevice:(id<MTLDevice>)device kernelSource:(NSString*)kernelSource;
+
+- (void) forward:(id<MTLCommandBuffer>)commandBuffer
+        inputData:(id<MTLBuffer>)inputData
+        outputData:(id<MTLBuffer>)outputData
+        params:(AvgPoolParams)params;
+
+- (void) backward:(id<MTLCommandBuffer>)commandBuffer
+        inputGrad:(id<MTLBuffer>)inputGrad
+        outputGrad:(id<MTLBuffer>)outputGrad
+        params:(AvgPoolParams)params;
+
+@end
+
+@interface AvgPoolKernelImpl : NSObject <AvgPoolKernel>
+    @property (nonatomic, strong) id<MTLLibrary> library;
+@end
+
+#endif /* AvgPoolKernel_h */
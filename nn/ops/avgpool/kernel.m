@@ -0,0 +1,83 @@
+#import "kernel.h"
+#import <Foundation/Foundation.h>
+#include <stdio.h>
+
+static inline MTLSize threadgroupSize2D(id<MTLComputePipelineState> pso) {
+    NSUInteger w = pso.threadExecutionWidth;
+    NSUInteger max = pso.maxTotalThreadsPerThreadgroup;
+    NSUInteger h = max / w;
+    if (h < 1) {
+        h = 1;
+    }
+    return MTLSizeMake(w, h, 1);
+}
+
+@implementation AvgPoolKernelImpl {
+    id<MTLDevice> _device;
+
+    id<MTLComputePipelineState> _forwardPSO;
+    id<MTLComputePipelineState> _backwardPSO;
+
+    NSError *error;
+}
+
+- (id<MTLComputePipelineState>)createPipelineStateWithFunctionName:(NSString *)functionName {
+    id<MTLFunction> function = [self.library newFunctionWithName:functionName];
+    if (!function) {
+        printf("Failed to load function %s!\n", [functionName UTF8String]);
+        return nil;
+    }
+
+    id<MTLComputePipelineState> pipelineState = [_device newComputePipelineStateWithFunction:function error:&error];
+    if (error != nil) {
+        const char *errorCString = [[error localizedDescription] UTF8String];
+        printf("Failed to create pipeline state: %s\n", errorCString);
+        return nil;
+    }
+    return pipelineState;
+}
+
+- (instancetype)initWithDevice:(id<MTLDevice>)device kernelSource:(NSString*)kernelSource {
+    self = [super init];
+    if (self) {
+        _device = device;
+
+        self.library = [_device newLibraryWithSource:kernelSource options:nil error:&error];
+
+        _forwardPSO = [self createPipelineStateWithFunctionName:@"avgPoolForward"];
+        _backwardPSO = [self createPipelineStateWithFunctionName:@"avgPoolBackward"];
+    }
+    return self;
+}
+
+- (void) forward:(id<MTLCommandBuffer>)commandBuffer
+        inputData:(id<MTLBuffer>)inputData
+        outputData:(id<MTLBuffer>)outputData
+        params:(AvgPoolParams)params
+{
+    id<MTLComputeCommandEncoder> forward = [commandBuffer computeCommandEncoder];
+    [forward setComputePipelineState:_forwardPSO];
+    [forward setBuffer:inputData offset:0 atIndex:0];
+    [forward setBuffer:outputData offset:0 atIndex:1];
+    [forward setBytes:&params length:sizeof(AvgPoolParams) atIndex:2];
+    [forward dispatchThreads:MTLSizeMake(params.outW, params.outH, params.depth)
+       threadsPerThreadgroup:threadgroupSize2D(_forwardPSO)];
+    [forward endEncoding];
+}
+
+- (void) backward:(id<MTLCommandBuffer>)commandBuffer
+        inputGrad:(id<MTLBuffer>)inputGrad
+        outputGrad:(id<MTLBuffer>)outputGrad
+        params:(AvgPoolParams)params
+{
+    id<MTLComputeCommandEncoder> backward = [commandBuffer computeCommandEncoder];
+    [backward setComputePipelineState:_backwardPSO];
+    [backward setBuffer:inputGrad offset:0 atIndex:0];
+    [backward setBuffer:outputGrad offset:0 atIndex:1];
+    [backward setBytes:&params length:sizeof(AvgPoolParams) atIndex:2];
+    [backward dispatchThreads:MTLSizeMake(params.inW, params.inH, params.depth)
+        threadsPerThreadgroup:threadgroupSize2D(_backwardPSO)];
+    [backward endEncoding];
+}
+
+@end
@@ -0,0 +1,101 @@
+#include <metal_stdlib>
+
+using namespace metal;
+
+struct AvgPoolParams {
+    uint inW;
+    uint inH;
+    uint outW;
+    uint outH;
+    uint depth;
+    uint poolW;
+    uint poolH;
+    uint strideW;
+    uint strideH;
+    uint padW;
+    uint padH;
+    uint countIncludePad;
+};
+
+// windowRange returns the window [start, end) of output position o clipped to the input
+// and the number of positions counted by the divisor along one axis.
+static int2 windowRange(uint o, uint stride, uint pad, uint pool, uint in, uint countIncludePad, thread uint& count) {
+    int start = int(o * stride) - int(pad);
+    int end = min(start + int(pool), int(in + pad));
+    int paddedCount = end - start;
+
+    start = max(start, 0);
+    end = min(end, int(in));
+
+    count = countIncludePad != 0 ? uint(paddedCount) : uint(max(end - start, 0));
+    return int2(start, end);
+}
+
+kernel void avgPoolForward(
+    device const float *inputData [[ buffer(0) ]],
+    device float *outputData [[ buffer(1) ]],
+    constant AvgPoolParams& p [[ buffer(2) ]],
+    const uint3 gid [[ thread_position_in_grid ]] )
+{
+    if (gid.x >= p.outW || gid.y >= p.outH || gid.z >= p.depth) {
+        return;
+    }
+
+    uint countW, countH;
+    int2 rx = windowRange(gid.x, p.strideW, p.padW, p.poolW, p.inW, p.countIncludePad, countW);
+    int2 ry = windowRange(gid.y, p.strideH, p.padH, p.poolH, p.inH, p.countIncludePad, countH);
+
+    uint base = gid.z * p.inH * p.inW;
+
+    float sum = 0.0;
+    for (int iy = ry.x; iy < ry.y; ++iy) {
+        for (int ix = rx.x; ix < rx.y; ++ix) {
+            sum += inputData[base + uint(iy) * p.inW + uint(ix)];
+        }
+    }
+
+    uint count = countW * countH;
+    outputData[(gid.z * p.outH + gid.y) * p.outW + gid.x] = count > 0 ? sum / float(count) : 0.0;
+}
+
+kernel void avgPoolBackward(
+    device float *inputGrad [[ buffer(0) ]],
+    device const float *outputGrad [[ buffer(1) ]],
+    constant AvgPoolParams& p [[ buffer(2) ]],
+    const uint3 gid [[ thread_position_in_grid ]] )
+{
+    if (gid.x >= p.inW || gid.y >= p.inH || gid.z >= p.depth) {
+        return;
+    }
+
+    // Output positions whose window covers the input pixel:
+    // o*stride - pad <= i < o*stride - pad + pool.
+    int ty = int(gid.y) + int(p.padH);
+    int tx = int(gid.x) + int(p.padW);
+
+    int oy0 = max(0, (ty - int(p.poolH) + int(p.strideH)) / int(p.strideH));
+    int oy1 = min(int(p.outH) - 1, ty / int(p.strideH));
+    int ox0 = max(0, (tx - int(p.poolW) + int(p.strideW)) / int(p.strideW));
+    int ox1 = min(int(p.outW) - 1, tx / int(p.strideW));
+
+    uint base = gid.z * p.outH * p.outW;
+
+    float sum = 0.0;
+    for (int oy = oy0; oy <= oy1; ++oy) {
+        uint countH;
+        int2 ry = windowRange(uint(oy), p.strideH, p.padH, p.poolH, p.inH, p.countIncludePad, countH);
+        if (int(gid.y) < ry.x || int(gid.y) >= ry.y) {
+            continue;
+        }
+        for (int ox = ox0; ox <= ox1; ++ox) {
+            uint countW;
+            int2 rx = windowRange(uint(ox), p.strideW, p.padW, p.poolW, p.inW, p.countIncludePad, countW);
+            if (int(gid.x) < rx.x || int(gid.x) >= rx.y) {
+                continue;
+            }
+            sum += outputGrad[base + uint(oy) * p.outW + uint(ox)] / float(countW * countH);
+        }
+    }
+
+    inputGrad[(gid.z * p.inH + gid.y) * p.inW + gid.x] += sum;
+}
@@ -0,0 +1,115 @@
+package avgpool
+
+import (
+	"testing"
+
+	"github.com/atkhx/metal/mtl"
+	"github.com/atkhx/metal/nn/num"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAvgPool(t *testing.T) {
+	device := mtl.MustCreateSystemDefaultDevice()
+	defer device.Release()
+
+	newData := func(values []float32, dims mtl.MTLSize) *num.Data {
+		return &num.Data{
+			Data: device.NewBufferWithFloats(values, mtl.ResourceStorageModeShared),
+			Grad: device.NewBufferEmptyFloatsBuffer(dims.Length(), mtl.ResourceStorageModeShared),
+			Dims: dims,
+		}
+	}
+
+	image4x4 := []float32{
+		1, 2, 3, 4,
+		5, 6, 7, 8,
+		9, 10, 11, 12,
+		13, 14, 15, 16,
+	}
+
+	testCases := []struct {
+		name       string
+		input      []float32
+		inDims     mtl.MTLSize
+		params     Params
+		outputGrad []float32
+		expOutput  []float32
+		expGrad    []float32
+	}{
+		{
+			name:       "pool 2 stride 2",
+			input:      image4x4,
+			inDims:     mtl.NewMTLSize(4, 4, 1),
+			params:     Params{PoolW: 2, PoolH: 2, StrideW: 2, StrideH: 2},
+			outputGrad: []float32{1, 1, 1, 1},
+			expOutput:  []float32{3.5, 5.5, 11.5, 13.5},
+			expGrad: []float32{
+				0.25, 0.25, 0.25, 0.25,
+				0.25, 0.25, 0.25, 0.25,
+				0.25, 0.25, 0.25, 0.25,
+				0.25, 0.25, 0.25, 0.25,
+			},
+		},
+		{
+			name:       "padding excluded from divisor",
+			input:      image4x4,
+			inDims:     mtl.NewMTLSize(4, 4, 1),
+			params:     Params{PoolW: 3, PoolH: 3, StrideW: 2, StrideH: 2, PaddingW: 1, PaddingH: 1},
+			outputGrad: []float32{4, 0, 0, 0},
+			// windows: rows/cols [0,2) and [1,4)
+			expOutput: []float32{14.0 / 4, 30.0 / 6, 57.0 / 6, 99.0 / 9},
+			expGrad: []float32{
+				1, 1, 0, 0,
+				1, 1, 0, 0,
+				0, 0, 0, 0,
+				0, 0, 0, 0,
+			},
+		},
+		{
+			name:       "padding included in divisor",
+			input:      image4x4,
+			inDims:     mtl.NewMTLSize(4, 4, 1),
+			params:     Params{PoolW: 3, PoolH: 3, StrideW: 2, StrideH: 2, PaddingW: 1, PaddingH: 1, CountIncludePad: true},
+			outputGrad: []float32{9, 0, 0, 0},
+			expOutput:  []float32{14.0 / 9, 30.0 / 9, 57.0 / 9, 99.0 / 9},
+			expGrad: []float32{
+				1, 1, 0, 0,
+				1, 1, 0, 0,
+				0, 0, 0, 0,
+				0, 0, 0, 0,
+			},
+		},
+		{
+			name:       "global",
+			input:      []float32{1, 2, 3, 4, 5, 6, 7, 8},
+			inDims:     mtl.NewMTLSize(2, 2, 2),
+			params:     Params{PoolW: 2, PoolH: 2, StrideW: 1, StrideH: 1},
+			outputGrad: []float32{1, 2},
+			expOutput:  []float32{2.5, 6.5},
+			expGrad:    []float32{0.25, 0.25, 0.25, 0.25, 0.5, 0.5, 0.5, 0.5},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			outW, outH := tc.params.OutputSize(tc.inDims.W, tc.inDims.H)
+			outDims := mtl.NewMTLSize(outW, outH, tc.inDims.D)
+
+			input := newData(tc.input, tc.inDims)
+			output := newData(make([]float32, outDims.Length()), outDims)
+			copy(output.Grad.GetFloats(), tc.outputGrad)
+
+			kernel := New(device, input, output, tc.params)
+
+			cmd := device.NewCommandQueue().GetNewMTLCommandBuffer()
+			defer cmd.Release()
+			kernel.Forward(cmd)
+			kernel.Backward(cmd)
+			cmd.Commit()
+			cmd.WaitUntilCompleted()
+
+			require.InDeltaSlice(t, tc.expOutput, output.Data.GetFloats(), 1e-5)
+			require.InDeltaSlice(t, tc.expGrad, input.Grad.GetFloats(), 1e-5)
+		})
+	}
+}
@@ -0,0 +1,222 @@
+package batchnorm2d
+
+/*
+#cgo CFLAGS: -x objective-c
+#cgo LDFLAGS: -framework Metal -framework MetalPerformanceShaders -framework CoreGraphics -framework Foundation
+
+#include "kernel.h"
+
+void* batchNorm2dKernelCreate(void *device, const char *kernelSource) {
+    return [[BatchNorm2DKernelImpl alloc] initWithDevice:(id<MTLDevice>)device
+		kernelSource:[NSString stringWithUTF8String:kernelSource]];
+}
+
+void batchNorm2dForward(
+    void *kernel,
+    void *commandBuffer,
+    void *inputData,
+    void *outputData,
+    void *gammaData,
+    void *betaData,
+    void *runningMean,
+    void *runningVar,
+    void *meanData,
+    void *invStdData,
+    uint plane,
+    uint channels,
+    uint batchSize,
+    float eps,
+    float momentum,
+    uint training
+) {
+    [(__bridge BatchNorm2DKernelImpl*)kernel forward:(id<MTLCommandBuffer>)commandBuffer
+        inputData:(id<MTLBuffer>)inputData
+        outputData:(id<MTLBuffer>)outputData
+        gammaData:(id<MTLBuffer>)gammaData
+        betaData:(id<MTLBuffer>)betaData
+        runningMean:(id<MTLBuffer>)runningMean
+        runningVar:(id<MTLBuffer>)runningVar
+        meanData:(id<MTLBuffer>)meanData
+        invStdData:(id<MTLBuffer>)invStdData
+        plane:plane
+        channels:channels
+        batchSize:batchSize
+        eps:eps
+        momentum:momentum
+        training:training];
+}
+
+void batchNorm2dBackward(
+    void *kernel,
+    void *commandBuffer,
+    void *inputData,
+    void *inputGrad,
+    void *outputGrad,
+    void *gammaData,
+    void *gammaGrad,
+    void *betaGrad,
+    void *meanData,
+    void *invStdData,
+    void *sumDy,
+    void *sumDyXHat,
+    uint plane,
+    uint channels,
+    uint batchSize,
+    uint training
+) {
+    [(__bridge BatchNorm2DKernelImpl*)kernel backward:(id<MTLCommandBuffer>)commandBuffer
+        inputData:(id<MTLBuffer>)inputData
+        inputGrad:(id<MTLBuffer>)inputGrad
+        outputGrad:(id<MTLBuffer>)outputGrad
+        gammaData:(id<MTLBuffer>)gammaData
+        gammaGrad:(id<MTLBuffer>)gammaGrad
+        betaGrad:(id<MTLBuffer>)betaGrad
+        meanData:(id<MTLBuffer>)meanData
+        invStdData:(id<MTLBuffer>)invStdData
+        sumDy:(id<MTLBuffer>)sumDy
+        sumDyXHat:(id<MTLBuffer>)sumDyXHat
+        plane:plane
+        channels:channels
+        batchSize:batchSize
+        training:training];
+}
+*/
+import "C"
+import (
+	_ "embed"
+	"unsafe"
+
+	"github.com/atkhx/metal/mtl"
+	"github.com/atkhx/metal/nn/num"
+)
+
+//go:embed kernel.metal
+var metalFunctions string
+
+// New creates batch normalization over [W, H, channels*batchSize] input.
+// In training mode batch statistics are used and running statistics are updated with momentum,
+// otherwise running statistics are used. The training flag is read every time the kernel is encoded,
+// so the same graph can be switched between modes.
+func New(
+	device *mtl.Device,
+	input *num.Data,
+	output *num.Data,
+	gamma *num.Data,
+	beta *num.Data,
+	runningMean *num.Data,
+	runningVar *num.Data,
+	batchSize int,
+	eps float32,
+	momentum float32,
+	training *bool,
+) *Kernel {
+	cKernelString := C.CString(metalFunctions)
+	defer C.free(unsafe.Pointer(cKernelString))
+
+	channels := input.Dims.D / batchSize
+
+	newBuffer := func() *mtl.Buffer {
+		return device.NewBufferEmptyFloatsBuffer(channels, mtl.ResourceStorageModeShared)
+	}
+
+	return &Kernel{
+		kernelID:    C.batchNorm2dKernelCreate(device.GetID(), cKernelString),
+		input:       input,
+		output:      output,
+		gamma:       gamma,
+		beta:        beta,
+		runningMean: runningMean,
+		runningVar:  runningVar,
+		mean:        newBuffer(),
+		invStd:      newBuffer(),
+		sumDy:       newBuffer(),
+		sumDyXHat:   newBuffer(),
+		plane:       input.Dims.W * input.Dims.H,
+		channels:    channels,
+		batchSize:   batchSize,
+		eps:         eps,
+		momentum:    momentum,
+		training:    training,
+	}
+}
+
+type Kernel struct {
+	kernelID unsafe.Pointer
+
+	input       *num.Data
+	output      *num.Data
+	gamma       *num.Data
+	beta        *num.Data
+	runningMean *num.Data
+	runningVar  *num.Data
+
+	mean      *mtl.Buffer
+	invStd    *mtl.Buffer
+	sumDy     *mtl.Buffer
+	sumDyXHat *mtl.Buffer
+
+	plane     int
+	channels  int
+	batchSize int
+	eps       float32
+	momentum  float32
+	training  *bool
+}
+
+func (k *Kernel) isTraining() C.uint {
+	if k.training != nil && *k.training {
+		return 1
+	}
+	return 0
+}
+
+func (k *Kernel) Forward(b *mtl.CommandBuffer) {
+	k.forward(b, k.momentum)
+}
+
+// Replay computes the output again without updating running statistics.
+func (k *Kernel) Replay(b *mtl.CommandBuffer) {
+	k.forward(b, 0)
+}
+
+func (k *Kernel) forward(b *mtl.CommandBuffer, momentum float32) {
+	C.batchNorm2dForward(
+		k.kernelID,
+		b.GetID(),
+		k.input.Data.GetID(),
+		k.output.Data.GetID(),
+		k.gamma.Data.GetID(),
+		k.beta.Data.GetID(),
+		k.runningMean.Data.GetID(),
+		k.runningVar.Data.GetID(),
+		k.mean.GetID(),
+		k.invStd.GetID(),
+		C.uint(k.plane),
+		C.uint(k.channels),
+		C.uint(k.batchSize),
+		C.float(k.eps),
+		C.float(momentum),
+		k.isTraining(),
+	)
+}
+
+func (k *Kernel) Backward(b *mtl.CommandBuffer) {
+	C.batchNorm2dBackward(
+		k.kernelID,
+		b.GetID(),
+		k.input.Data.GetID(),
+		k.input.Grad.GetID(),
+		k.output.Grad.GetID(),
+		k.gamma.Data.GetID(),
+		k.gamma.Grad.GetID(),
+		k.beta.Grad.GetID(),
+		k.mean.GetID(),
+		k.invStd.GetID(),
+		k.sumDy.GetID(),
+		k.sumDyXHat.GetID(),
+		C.uint(k.plane),
+		C.uint(k.channels),
+		C.uint(k.batchSize),
+		k.isTraining(),
+	)
+}
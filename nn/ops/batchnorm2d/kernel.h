@@ -0,0 +1,49 @@
+#ifndef BatchNorm2DKernel_h
+#define BatchNorm2DKernel_h
+
+#import <Foundation/Foundation.h>
+#import <Metal/Metal.h>
+
+@protocol BatchNorm2DKernel <NSObject>
+
+- (instancetype) initWithDevice:(id<MTLDevice>)device kernelSource:(NSString*)kernelSource;
+
+- (void) forward:(id<MTLCommandBuffer>)commandBuffer
+        inputData:(id<MTLBuffer>)inputData
+        outputData:(id<MTLBuffer>)outputData
+        gammaData:(id<MTLBuffer>)gammaData
+        betaData:(id<MTLBuffer>)betaData
+        runningMean:(id<MTLBuffer>)runningMean
+        runningVar:(id<MTLBuffer>)runningVar
+        meanData:(id<MTLBuffer>)meanData
+        invStdData:(id<MTLBuffer>)invStdData
+        plane:(uint)plane
+        channels:(uint)channels
+        batchSize:(uint)batchSize
+        eps:(float)eps
+        momentum:(float)momentum
+        training:(uint)training;
+
+- (void) backward:(id<MTLCommandBuffer>)commandBuffer
+        inputData:(id<MTLBuffer>)inputData
+        inputGrad:(id<MTLBuffer>)inputGrad
+        outputGrad:(id<MTLBuffer>)outputGrad
+        gammaData:(id<MTLBuffer>)gammaData
+        gammaGrad:(id<MTLBuffer>)gammaGrad
+        betaGrad:(id<MTLBuffer>)betaGrad
+        meanData:(id<MTLBuffer>)meanData
+        invStdData:(id<MTLBuffer>)invStdData
+        sumDy:(id<MTLBuffer>)sumDy
+        sumDyXHat:(id<MTLBuffer>)sumDyXHat
+        plane:(uint)plane
+        channels:(uint)channels
+        batchSize:(uint)batchSize
+        training:(uint)training;
+
+@end
+
+@interface BatchNorm2DKernelImpl : NSObject <BatchNorm2DKernel>
+    @property (nonatomic, strong) id<MTLLibrary> library;
+@end
+
+#endif /* BatchNorm2DKernel_h */
@@ -0,0 +1,165 @@
+#include <metal_stdlib>
+
+using namespace metal;
+
+// Layout: [batch][channels][plane], plane = W*H.
+// Statistics are computed per channel over batch and plane.
+
+static float threadgroupSum(threadgroup float *buf, float value, uint tid, uint tgs) {
+    buf[tid] = value;
+    threadgroup_barrier(mem_flags::mem_threadgroup);
+
+    for (uint s = tgs / 2; s > 0; s >>= 1) {
+        if (tid < s) {
+            buf[tid] += buf[tid + s];
+        }
+        threadgroup_barrier(mem_flags::mem_threadgroup);
+    }
+
+    float result = buf[0];
+    threadgroup_barrier(mem_flags::mem_threadgroup);
+    return result;
+}
+
+kernel void batchNorm2dBatchStats(
+    device const float *inputData [[ buffer(0) ]],
+    device float *meanData [[ buffer(1) ]],
+    device float *invStdData [[ buffer(2) ]],
+    device float *runningMean [[ buffer(3) ]],
+    device float *runningVar [[ buffer(4) ]],
+    constant uint& plane [[ buffer(5) ]],
+    constant uint& channels [[ buffer(6) ]],
+    constant uint& batchSize [[ buffer(7) ]],
+    constant float& eps [[ buffer(8) ]],
+    constant float& momentum [[ buffer(9) ]],
+    const uint2 gid [[ thread_position_in_grid ]],
+    const uint2 tid [[ thread_position_in_threadgroup ]],
+    const uint2 tgs [[ threads_per_threadgroup ]] )
+{
+    uint c = gid.y;
+    uint n = plane * batchSize;
+    threadgroup float sumBuf[256];
+
+    float sum = 0.0;
+    for (uint i = tid.x; i < n; i += tgs.x) {
+        sum += inputData[((i / plane) * channels + c) * plane + i % plane];
+    }
+    float mean = threadgroupSum(sumBuf, sum, tid.x, tgs.x) / float(n);
+
+    float sq = 0.0;
+    for (uint i = tid.x; i < n; i += tgs.x) {
+        float d = inputData[((i / plane) * channels + c) * plane + i % plane] - mean;
+        sq += d * d;
+    }
+    float var = threadgroupSum(sumBuf, sq, tid.x, tgs.x) / float(n);
+
+    if (tid.x == 0) {
+        meanData[c] = mean;
+        invStdData[c] = rsqrt(var + eps);
+
+        // Running variance is unbiased like in the reference implementations.
+        float unbiased = n > 1 ? var * float(n) / float(n - 1) : var;
+        runningMean[c] = (1.0 - momentum) * runningMean[c] + momentum * mean;
+        runningVar[c] = (1.0 - momentum) * runningVar[c] + momentum * unbiased;
+    }
+}
+
+kernel void batchNorm2dRunningStats(
+    device float *meanData [[ buffer(0) ]],
+    device float *invStdData [[ buffer(1) ]],
+    device const float *runningMean [[ buffer(2) ]],
+    device const float *runningVar [[ buffer(3) ]],
+    constant float& eps [[ buffer(4) ]],
+    const uint id [[ thread_position_in_grid ]] )
+{
+    meanData[id] = runningMean[id];
+    invStdData[id] = rsqrt(runningVar[id] + eps);
+}
+
+kernel void batchNorm2dNormalize(
+    device const float *inputData [[ buffer(0) ]],
+    device float *outputData [[ buffer(1) ]],
+    device const float *gammaData [[ buffer(2) ]],
+    device const float *betaData [[ buffer(3) ]],
+    device const float *meanData [[ buffer(4) ]],
+    device const float *invStdData [[ buffer(5) ]],
+    constant uint& plane [[ buffer(6) ]],
+    constant uint& channels [[ buffer(7) ]],
+    const uint2 gid [[ thread_position_in_grid ]] )
+{
+    uint c = gid.y % channels;
+    uint idx = gid.y * plane + gid.x;
+    outputData[idx] = gammaData[c] * (inputData[idx] - meanData[c]) * invStdData[c] + betaData[c];
+}
+
+kernel void batchNorm2dParamsGrads(
+    device const float *inputData [[ buffer(0) ]],
+    device const float *outputGrad [[ buffer(1) ]],
+    device const float *meanData [[ buffer(2) ]],
+    device const float *invStdData [[ buffer(3) ]],
+    device float *gammaGrad [[ buffer(4) ]],
+    device float *betaGrad [[ buffer(5) ]],
+    device float *sumDy [[ buffer(6) ]],
+    device float *sumDyXHat [[ buffer(7) ]],
+    constant uint& plane [[ buffer(8) ]],
+    constant uint& channels [[ buffer(9) ]],
+    constant uint& batchSize [[ buffer(10) ]],
+    const uint2 gid [[ thread_position_in_grid ]],
+    const uint2 tid [[ thread_position_in_threadgroup ]],
+    const uint2 tgs [[ threads_per_threadgroup ]] )
+{
+    uint c = gid.y;
+    uint n = plane * batchSize;
+    threadgroup float sumBuf[256];
+
+    float mean = meanData[c];
+    float invStd = invStdData[c];
+
+    float dy = 0.0;
+    float dyXHat = 0.0;
+    for (uint i = tid.x; i < n; i += tgs.x) {
+        uint idx = ((i / plane) * channels + c) * plane + i % plane;
+        float g = outputGrad[idx];
+        dy += g;
+        dyXHat += g * (inputData[idx] - mean) * invStd;
+    }
+    dy = threadgroupSum(sumBuf, dy, tid.x, tgs.x);
+    dyXHat = threadgroupSum(sumBuf, dyXHat, tid.x, tgs.x);
+
+    if (tid.x == 0) {
+        sumDy[c] = dy;
+        sumDyXHat[c] = dyXHat;
+        gammaGrad[c] += dyXHat;
+        betaGrad[c] += dy;
+    }
+}
+
+kernel void batchNorm2dInputGrads(
+    device const float *inputData [[ buffer(0) ]],
+    device float *inputGrad [[ buffer(1) ]],
+    device const float *outputGrad [[ buffer(2) ]],
+    device const float *gammaData [[ buffer(3) ]],
+    device const float *meanData [[ buffer(4) ]],
+    device const float *invStdData [[ buffer(5) ]],
+    device const float *sumDy [[ buffer(6) ]],
+    device const float *sumDyXHat [[ buffer(7) ]],
+    constant uint& plane [[ buffer(8) ]],
+    constant uint& channels [[ buffer(9) ]],
+    constant uint& batchSize [[ buffer(10) ]],
+    constant uint& training [[ buffer(11) ]],
+    const uint2 gid [[ thread_position_in_grid ]] )
+{
+    uint c = gid.y % channels;
+    uint idx = gid.y * plane + gid.x;
+
+    float scale = gammaData[c] * invStdData[c];
+    if (training == 0) {
+        // Running statistics are constants.
+        inputGrad[idx] += scale * outputGrad[idx];
+        return;
+    }
+
+    float n = float(plane * batchSize);
+    float xHat = (inputData[idx] - meanData[c]) * invStdData[c];
+    inputGrad[idx] += scale * (outputGrad[idx] - sumDy[c] / n - xHat * sumDyXHat[c] / n);
+}
@@ -0,0 +1,191 @@
+package batchnorm2d
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/atkhx/metal/mtl"
+	"github.com/atkhx/metal/nn/num"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testPlane     = 6
+	testChannels  = 3
+	testBatchSize = 4
+	testEps       = 1e-5
+	testMomentum  = 0.1
+)
+
+// refForward normalizes x with batch statistics in float64.
+func refForward(x, gamma, beta []float64) (out, mean, variance []float64) {
+	n := float64(testPlane * testBatchSize)
+	out = make([]float64, len(x))
+	mean = make([]float64, testChannels)
+	variance = make([]float64, testChannels)
+
+	idx := func(b, c, i int) int { return (b*testChannels+c)*testPlane + i }
+
+	for c := 0; c < testChannels; c++ {
+		for b := 0; b < testBatchSize; b++ {
+			for i := 0; i < testPlane; i++ {
+				mean[c] += x[idx(b, c, i)]
+			}
+		}
+		mean[c] /= n
+		for b := 0; b < testBatchSize; b++ {
+			for i := 0; i < testPlane; i++ {
+				d := x[idx(b, c, i)] - mean[c]
+				variance[c] += d * d
+			}
+		}
+		variance[c] /= n
+
+		invStd := 1 / math.Sqrt(variance[c]+testEps)
+		for b := 0; b < testBatchSize; b++ {
+			for i := 0; i < testPlane; i++ {
+				out[idx(b, c, i)] = gamma[c]*(x[idx(b, c, i)]-mean[c])*invStd + beta[c]
+			}
+		}
+	}
+	return
+}
+
+func toFloat64(values []float32) []float64 {
+	res := make([]float64, len(values))
+	for i, v := range values {
+		res[i] = float64(v)
+	}
+	return res
+}
+
+func dot(a, b []float64) (res float64) {
+	for i := range a {
+		res += a[i] * b[i]
+	}
+	return
+}
+
+func TestKernel_Training(t *testing.T) {
+	device := mtl.MustCreateSystemDefaultDevice()
+	defer device.Release()
+
+	rnd := rand.New(rand.NewSource(1))
+	randomFloats := func(length int) []float32 {
+		values := make([]float32, length)
+		for i := range values {
+			values[i] = rnd.Float32()*4 - 1
+		}
+		return values
+	}
+	newData := func(values []float32, dims mtl.MTLSize) *num.Data {
+		return &num.Data{
+			Data: device.NewBufferWithFloats(values, mtl.ResourceStorageModeShared),
+			Grad: device.NewBufferEmptyFloatsBuffer(dims.Length(), mtl.ResourceStorageModeShared),
+			Dims: dims,
+		}
+	}
+
+	// 3x2 images
+	dims := mtl.NewMTLSize(3, 2, testChannels*testBatchSize)
+	pDims := mtl.NewMTLSize(1, 1, testChannels)
+
+	input := newData(randomFloats(dims.Length()), dims)
+	output := newData(make([]float32, dims.Length()), dims)
+	gamma := newData(randomFloats(testChannels), pDims)
+	beta := newData(randomFloats(testChannels), pDims)
+	runningMean := newData(make([]float32, testChannels), pDims)
+	runningVar := newData(make([]float32, testChannels), pDims)
+	copy(output.Grad.GetFloats(), randomFloats(dims.Length()))
+
+	x := toFloat64(input.Data.GetFloats())
+	g := toFloat64(gamma.Data.GetFloats())
+	bt := toFloat64(beta.Data.GetFloats())
+	dy := toFloat64(output.Grad.GetFloats())
+
+	training := true
+	kernel := New(device, input, output, gamma, beta, runningMean, runningVar, testBatchSize, testEps, testMomentum, &training)
+
+	cmd := device.NewCommandQueue().GetNewMTLCommandBuffer()
+	defer cmd.Release()
+	kernel.Forward(cmd)
+	kernel.Backward(cmd)
+	cmd.Commit()
+	cmd.WaitUntilCompleted()
+
+	expOutput, mean, variance := refForward(x, g, bt)
+	for i, v := range output.Data.GetFloats() {
+		require.InDelta(t, expOutput[i], float64(v), 1e-4)
+	}
+
+	n := float64(testPlane * testBatchSize)
+	for c := 0; c < testChannels; c++ {
+		require.InDelta(t, testMomentum*mean[c], float64(runningMean.Data.GetFloats()[c]), 1e-5)
+		require.InDelta(t, testMomentum*variance[c]*n/(n-1), float64(runningVar.Data.GetFloats()[c]), 1e-5)
+	}
+
+	// Gradients are checked against central differences of the float64 reference.
+	const h = 1e-4
+	numGrad := func(values []float64, i int, loss func() float64) float64 {
+		v := values[i]
+		values[i] = v + h
+		lp := loss()
+		values[i] = v - h
+		lm := loss()
+		values[i] = v
+		return (lp - lm) / (2 * h)
+	}
+	loss := func() float64 {
+		out, _, _ := refForward(x, g, bt)
+		return dot(out, dy)
+	}
+
+	for i, v := range input.Grad.GetFloats() {
+		require.InDelta(t, numGrad(x, i, loss), float64(v), 1e-3, "input grad %d", i)
+	}
+	for i, v := range gamma.Grad.GetFloats() {
+		require.InDelta(t, numGrad(g, i, loss), float64(v), 1e-3, "gamma grad %d", i)
+	}
+	for i, v := range beta.Grad.GetFloats() {
+		require.InDelta(t, numGrad(bt, i, loss), float64(v), 1e-3, "beta grad %d", i)
+	}
+}
+
+func TestKernel_InferenceUsesRunningStats(t *testing.T) {
+	device := mtl.MustCreateSystemDefaultDevice()
+	defer device.Release()
+
+	newData := func(values []float32, dims mtl.MTLSize) *num.Data {
+		return &num.Data{
+			Data: device.NewBufferWithFloats(values, mtl.ResourceStorageModeShared),
+			Grad: device.NewBufferEmptyFloatsBuffer(dims.Length(), mtl.ResourceStorageModeShared),
+			Dims: dims,
+		}
+	}
+
+	// 2x1 images, 2 channels, batch 1
+	input := newData([]float32{1, 3, 10, 20}, mtl.NewMTLSize(2, 1, 2))
+	output := newData(make([]float32, 4), input.Dims)
+	gamma := newData([]float32{2, 1}, mtl.NewMTLSize(1, 1, 2))
+	beta := newData([]float32{0, 1}, mtl.NewMTLSize(1, 1, 2))
+	runningMean := newData([]float32{1, 10}, mtl.NewMTLSize(1, 1, 2))
+	runningVar := newData([]float32{4, 100}, mtl.NewMTLSize(1, 1, 2))
+	copy(output.Grad.GetFloats(), []float32{1, 1, 1, 1})
+
+	training := false
+	kernel := New(device, input, output, gamma, beta, runningMean, runningVar, 1, 0, testMomentum, &training)
+
+	cmd := device.NewCommandQueue().GetNewMTLCommandBuffer()
+	defer cmd.Release()
+	kernel.Forward(cmd)
+	kernel.Backward(cmd)
+	cmd.Commit()
+	cmd.WaitUntilCompleted()
+
+	require.InDeltaSlice(t, []float32{0, 2, 1, 2}, output.Data.GetFloats(), 1e-5)
+	require.InDeltaSlice(t, []float32{1, 1, 0.1, 0.1}, input.Grad.GetFloats(), 1e-5)
+	// running statistics are not updated in inference mode
+	require.Equal(t, []float32{1, 10}, runningMean.Data.GetFloats())
+	require.Equal(t, []float32{4, 100}, runningVar.Data.GetFloats())
+}
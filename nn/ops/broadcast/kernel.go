@@ -0,0 +1,179 @@
+package broadcast
+
+/*
+#cgo CFLAGS: -x objective-c
+#cgo LDFLAGS: -framework Metal -framework MetalPerformanceShaders -framework CoreGraphics -framework Foundation
+
+#include "kernel.h"
+
+void* broadcastKernelCreate(void *device, const char *kernelSource) {
+    return [[BroadcastKernelImpl alloc] initWithDevice:(id<MTLDevice>)device
+		kernelSource:[NSString stringWithUTF8String:kernelSource]];
+}
+
+void broadcastForward(
+    void *kernel,
+    void *commandBuffer,
+    void *aData,
+    void *bData,
+    void *outputData,
+    BroadcastParams params
+) {
+    [(__bridge BroadcastKernelImpl*)kernel forward:(id<MTLCommandBuffer>)commandBuffer
+        aData:(id<MTLBuffer>)aData
+        bData:(id<MTLBuffer>)bData
+        outputData:(id<MTLBuffer>)outputData
+        params:params];
+}
+
+void broadcastBackward(
+    void *kernel,
+    void *commandBuffer,
+    void *aData,
+    void *aGrad,
+    void *bData,
+    void *bGrad,
+    void *outputGrad,
+    BroadcastParams params
+) {
+    [(__bridge BroadcastKernelImpl*)kernel backward:(id<MTLCommandBuffer>)commandBuffer
+        aData:(id<MTLBuffer>)aData
+        aGrad:(id<MTLBuffer>)aGrad
+        bData:(id<MTLBuffer>)bData
+        bGrad:(id<MTLBuffer>)bGrad
+        outputGrad:(id<MTLBuffer>)outputGrad
+        params:params];
+}
+*/
+import "C"
+import (
+	_ "embed"
+	"fmt"
+	"unsafe"
+
+	"github.com/atkhx/metal/mtl"
+	"github.com/atkhx/metal/nn/num"
+)
+
+//go:embed kernel.metal
+var metalFunctions string
+
+type Op int
+
+const (
+	OpAdd Op = iota
+	OpSub
+	OpMul
+	OpDiv
+)
+
+func (op Op) String() string {
+	switch op {
+	case OpAdd:
+		return "add"
+	case OpSub:
+		return "sub"
+	case OpMul:
+		return "mul"
+	case OpDiv:
+		return "div"
+	}
+	return fmt.Sprintf("Op(%d)", int(op))
+}
+
+// Dims returns the shape of the broadcast result. Every axis of a and b
+// must either be equal or be 1 in one of the operands.
+func Dims(a, b mtl.MTLSize) (mtl.MTLSize, error) {
+	axis := func(name string, a, b int) (int, error) {
+		switch {
+		case a == b:
+			return a, nil
+		case a == 1:
+			return b, nil
+		case b == 1:
+			return a, nil
+		}
+		return 0, fmt.Errorf("axis %s: %d and %d are not equal and neither is 1", name, a, b)
+	}
+
+	var res mtl.MTLSize
+	var err error
+	if res.W, err = axis("W", a.W, b.W); err != nil {
+		return res, fmt.Errorf("cannot broadcast %s and %s: %w", shape(a), shape(b), err)
+	}
+	if res.H, err = axis("H", a.H, b.H); err != nil {
+		return res, fmt.Errorf("cannot broadcast %s and %s: %w", shape(a), shape(b), err)
+	}
+	if res.D, err = axis("D", a.D, b.D); err != nil {
+		return res, fmt.Errorf("cannot broadcast %s and %s: %w", shape(a), shape(b), err)
+	}
+	return res, nil
+}
+
+func shape(s mtl.MTLSize) string {
+	return fmt.Sprintf("(%d, %d, %d)", s.W, s.H, s.D)
+}
+
+// New creates elementwise a <op> b with broadcasting over W, H and D.
+// Output dims must be equal to Dims(a.Dims, b.Dims).
+func New(
+	device *mtl.Device,
+	a *num.Data,
+	b *num.Data,
+	output *num.Data,
+	op Op,
+) *Kernel {
+	cKernelString := C.CString(metalFunctions)
+	defer C.free(unsafe.Pointer(cKernelString))
+
+	return &Kernel{
+		kernelID: C.broadcastKernelCreate(device.GetID(), cKernelString),
+		a:        a,
+		b:        b,
+		output:   output,
+		params: C.BroadcastParams{
+			aW: C.uint(a.Dims.W),
+			aH: C.uint(a.Dims.H),
+			aD: C.uint(a.Dims.D),
+			bW: C.uint(b.Dims.W),
+			bH: C.uint(b.Dims.H),
+			bD: C.uint(b.Dims.D),
+			oW: C.uint(output.Dims.W),
+			oH: C.uint(output.Dims.H),
+			oD: C.uint(output.Dims.D),
+			op: C.uint(op),
+		},
+	}
+}
+
+type Kernel struct {
+	kernelID unsafe.Pointer
+	a        *num.Data
+	b        *num.Data
+	output   *num.Data
+	params   C.BroadcastParams
+}
+
+func (k *Kernel) Forward(b *mtl.CommandBuffer) {
+	C.broadcastForward(
+		k.kernelID,
+		b.GetID(),
+		k.a.Data.GetID(),
+		k.b.Data.GetID(),
+		k.output.Data.GetID(),
+		k.params,
+	)
+}
+
+func (k *Kernel) Backward(b *mtl.CommandBuffer) {
+	C.broadcastBackward(
+		k.kernelID,
+		b.GetID(),
+		k.a.Data.GetID(),
+		k.a.Grad.GetID(),
+		k.b.Data.GetID(),
+		k.b.Grad.GetID(),
+		k.output.Grad.GetID(),
+		k.params,
+	)
+}
@@ -0,0 +1,44 @@
+#ifndef BroadcastKernel_h
+#define BroadcastKernel_h
+
+#import <Foundation/Foundation.h>
+#import <Metal/Metal.h>
+
+typedef struct {
+    uint aW;
+    uint aH;
+    uint aD;
+    uint bW;
+    uint bH;
+    uint bD;
+    uint oW;
+    uint oH;
+    uint oD;
+    uint op;
+} BroadcastParams;
+
+@protocol BroadcastKernel <NSObject>
+
+- (instancetype) initWithDevice:(id<MTLDevice>)device kernelSource:(NSString*)kernelSource;
+
+- (void) forward:(id<MTLCommandBuffer>)commandBuffer
+        aData:(id<MTLBuffer>)aData
+        bData:(id<MTLBuffer>)bData
+        outputData:(id<MTLBuffer>)outputData
+        params:(BroadcastParams)params;
+
+- (void) backward:(id<MTLCommandBuffer>)commandBuffer
+        aData:(id<MTLBuffer>)aData
+        aGrad:(id<MTLBuffer>)aGrad
+        bData:(id<MTLBuffer>)bData
+        bGrad:(id<MTLBuffer>)bGrad
+        outputGrad:(id<MTLBuffer>)outputGrad
+        params:(BroadcastParams)params;
+
+@end
+
+@interface BroadcastKernelImpl : NSObject <BroadcastKernel>
+    @property (nonatomic, strong) id<MTLLibrary> library;
+@end
+
+#endif /* BroadcastKernel_h */
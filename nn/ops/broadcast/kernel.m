@@ -0,0 +1,103 @@
+#import "kernel.h"
+#import <Foundation/Foundation.h>
+#include <stdio.h>
+
+static inline MTLSize threadgroupSize2D(id<MTLComputePipelineState> pso) {
+    NSUInteger w = pso.threadExecutionWidth;
+    NSUInteger max = pso.maxTotalThreadsPerThreadgroup;
+    NSUInteger h = max / w;
+    if (h < 1) {
+        h = 1;
+    }
+    return MTLSizeMake(w, h, 1);
+}
+
+@implementation BroadcastKernelImpl {
+    id<MTLDevice> _device;
+
+    id<MTLComputePipelineState> _forwardPSO;
+    id<MTLComputePipelineState> _aGradsPSO;
+    id<MTLComputePipelineState> _bGradsPSO;
+
+    NSError *error;
+}
+
+- (id<MTLComputePipelineState>)createPipelineStateWithFunctionName:(NSString *)functionName {
+    id<MTLFunction> function = [self.library newFunctionWithName:functionName];
+    if (!function) {
+        printf("Failed to load function %s!\n", [functionName UTF8String]);
+        return nil;
+    }
+
+    id<MTLComputePipelineState> pipelineState = [_device newComputePipelineStateWithFunction:function error:&error];
+    if (error != nil) {
+        const char *errorCString = [[error localizedDescription] UTF8String];
+        printf("Failed to create pipeline state: %s\n", errorCString);
+        return nil;
+    }
+    return pipelineState;
+}
+
+- (instancetype)initWithDevice:(id<MTLDevice>)device kernelSource:(NSString*)kernelSource {
+    self = [super init];
+    if (self) {
+        _device = device;
+
+        self.library = [_device newLibraryWithSource:kernelSource options:nil error:&error];
+
+        _forwardPSO = [self createPipelineStateWithFunctionName:@"broadcastForward"];
+        _aGradsPSO = [self createPipelineStateWithFunctionName:@"broadcastAGrads"];
+        _bGradsPSO = [self createPipelineStateWithFunctionName:@"broadcastBGrads"];
+    }
+    return self;
+}
+
+- (void) forward:(id<MTLCommandBuffer>)commandBuffer
+        aData:(id<MTLBuffer>)aData
+        bData:(id<MTLBuffer>)bData
+        outputData:(id<MTLBuffer>)outputData
+        params:(BroadcastParams)params
+{
+    id<MTLComputeCommandEncoder> forward = [commandBuffer computeCommandEncoder];
+    [forward setComputePipelineState:_forwardPSO];
+    [forward setBuffer:aData offset:0 atIndex:0];
+    [forward setBuffer:bData offset:0 atIndex:1];
+    [forward setBuffer:outputData offset:0 atIndex:2];
+    [forward setBytes:&params length:sizeof(BroadcastParams) atIndex:3];
+    [forward dispatchThreads:MTLSizeMake(params.oW, params.oH, params.oD)
+       threadsPerThreadgroup:threadgroupSize2D(_forwardPSO)];
+    [forward endEncoding];
+}
+
+- (void) backward:(id<MTLCommandBuffer>)commandBuffer
+        aData:(id<MTLBuffer>)aData
+        aGrad:(id<MTLBuffer>)aGrad
+        bData:(id<MTLBuffer>)bData
+        bGrad:(id<MTLBuffer>)bGrad
+        outputGrad:(id<MTLBuffer>)outputGrad
+        params:(BroadcastParams)params
+{
+    id<MTLComputeCommandEncoder> aGrads = [commandBuffer computeCommandEncoder];
+    [aGrads setComputePipelineState:_aGradsPSO];
+    [aGrads setBuffer:aData offset:0 atIndex:0];
+    [aGrads setBuffer:aGrad offset:0 atIndex:1];
+    [aGrads setBuffer:bData offset:0 atIndex:2];
+    [aGrads setBuffer:outputGrad offset:0 atIndex:3];
+    [aGrads setBytes:&params length:sizeof(BroadcastParams) atIndex:4];
+    [aGrads dispatchThreads:MTLSizeMake(params.aW, params.aH, params.aD)
+      threadsPerThreadgroup:threadgroupSize2D(_aGradsPSO)];
+    [aGrads endEncoding];
+
+    id<MTLComputeCommandEncoder> bGrads = [commandBuffer computeCommandEncoder];
+    [bGrads setComputePipelineState:_bGradsPSO];
+    [bGrads setBuffer:aData offset:0 atIndex:0];
+    [bGrads setBuffer:bGrad offset:0 atIndex:1];
+    [bGrads setBuffer:bData offset:0 atIndex:2];
+    [bGrads setBuffer:outputGrad offset:0 atIndex:3];
+    [bGrads setBytes:&params length:sizeof(BroadcastParams) atIndex:4];
+    [bGrads dispatchThreads:MTLSizeMake(params.bW, params.bH, params.bD)
+      threadsPerThreadgroup:threadgroupSize2D(_bGradsPSO)];
+    [bGrads endEncoding];
+}
+
+@end
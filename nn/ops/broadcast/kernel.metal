@@ -0,0 +1,131 @@
+#include <metal_stdlib>
+
+using namespace metal;
+
+struct BroadcastParams {
+    uint aW;
+    uint aH;
+    uint aD;
+    uint bW;
+    uint bH;
+    uint bD;
+    uint oW;
+    uint oH;
+    uint oD;
+    uint op;
+};
+
+constant uint opAdd = 0;
+constant uint opSub = 1;
+constant uint opMul = 2;
+constant uint opDiv = 3;
+
+// broadcastIndex maps output position to the index of an operand, axes of size 1 are repeated.
+static uint broadcastIndex(uint3 pos, uint w, uint h, uint d) {
+    uint x = w == 1 ? 0 : pos.x;
+    uint y = h == 1 ? 0 : pos.y;
+    uint z = d == 1 ? 0 : pos.z;
+    return (z * h + y) * w + x;
+}
+
+kernel void broadcastForward(
+    device const float *aData [[ buffer(0) ]],
+    device const float *bData [[ buffer(1) ]],
+    device float *outputData [[ buffer(2) ]],
+    constant BroadcastParams& p [[ buffer(3) ]],
+    const uint3 gid [[ thread_position_in_grid ]] )
+{
+    if (gid.x >= p.oW || gid.y >= p.oH || gid.z >= p.oD) {
+        return;
+    }
+
+    float a = aData[broadcastIndex(gid, p.aW, p.aH, p.aD)];
+    float b = bData[broadcastIndex(gid, p.bW, p.bH, p.bD)];
+
+    float res;
+    switch (p.op) {
+        case opAdd: res = a + b; break;
+        case opSub: res = a - b; break;
+        case opMul: res = a * b; break;
+        default:    res = a / b; break;
+    }
+    outputData[(gid.z * p.oH + gid.y) * p.oW + gid.x] = res;
+}
+
+// Every operand element sums gradients of all output positions it was broadcast to.
+// isA selects the operand which gradient is calculated.
+static float operandGrad(
+    device const float *aData,
+    device const float *bData,
+    device const float *outputGrad,
+    constant BroadcastParams& p,
+    uint3 pos,
+    bool isA
+) {
+    uint w = isA ? p.aW : p.bW;
+    uint h = isA ? p.aH : p.bH;
+    uint d = isA ? p.aD : p.bD;
+
+    uint x0 = w == 1 ? 0 : pos.x, x1 = w == 1 ? p.oW : pos.x + 1;
+    uint y0 = h == 1 ? 0 : pos.y, y1 = h == 1 ? p.oH : pos.y + 1;
+    uint z0 = d == 1 ? 0 : pos.z, z1 = d == 1 ? p.oD : pos.z + 1;
+
+    float sum = 0.0;
+    for (uint z = z0; z < z1; ++z) {
+        for (uint y = y0; y < y1; ++y) {
+            for (uint x = x0; x < x1; ++x) {
+                uint3 o = uint3(x, y, z);
+                float g = outputGrad[(z * p.oH + y) * p.oW + x];
+                switch (p.op) {
+                    case opAdd:
+                        sum += g;
+                        break;
+                    case opSub:
+                        sum += isA ? g : -g;
+                        break;
+                    case opMul:
+                        sum += g * (isA ? bData[broadcastIndex(o, p.bW, p.bH, p.bD)] : aData[broadcastIndex(o, p.aW, p.aH, p.aD)]);
+                        break;
+                    default: {
+                        float b = bData[broadcastIndex(o, p.bW, p.bH, p.bD)];
+                        if (isA) {
+                            sum += g / b;
+                        } else {
+                            sum -= g * aData[broadcastIndex(o, p.aW, p.aH, p.aD)] / (b * b);
+                        }
+                        break;
+                    }
+                }
+            }
+        }
+    }
+    return sum;
+}
+
+kernel void broadcastAGrads(
+    device const float *aData [[ buffer(0) ]],
+    device float *aGrad [[ buffer(1) ]],
+    device const float *bData [[ buffer(2) ]],
+    device const float *outputGrad [[ buffer(3) ]],
+    constant BroadcastParams& p [[ buffer(4) ]],
+    const uint3 gid [[ thread_position_in_grid ]] )
+{
+    if (gid.x >= p.aW || gid.y >= p.aH || gid.z >= p.aD) {
+        return;
+    }
+    aGrad[(gid.z * p.aH + gid.y) * p.aW + gid.x] += operandGrad(aData, bData, outputGrad, p, gid, true);
+}
+
+kernel void broadcastBGrads(
+    device const float *aData [[ buffer(0) ]],
+    device float *bGrad [[ buffer(1) ]],
+    device const float *bData [[ buffer(2) ]],
+    device const float *outputGrad [[ buffer(3) ]],
+    constant BroadcastParams& p [[ buffer(4) ]],
+    const uint3 gid [[ thread_position_in_grid ]] )
+{
+    if (gid.x >= p.bW || gid.y >= p.bH || gid.z >= p.bD) {
+        return;
+    }
+    bGrad[(gid.z * p.bH + gid.y) * p.bW + gid.x] += operandGrad(aData, bData, outputGrad, p, gid, false);
+}
@@ -0,0 +1,131 @@
+package broadcast
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/atkhx/metal/mtl"
+	"github.com/atkhx/metal/nn/num"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDims(t *testing.T) {
+	dims, err := Dims(mtl.NewMTLSize(4, 3, 2), mtl.NewMTLSize(1, 3, 1))
+	require.NoError(t, err)
+	require.Equal(t, mtl.NewMTLSize(4, 3, 2), dims)
+
+	dims, err = Dims(mtl.NewMTLSize(4, 1, 2), mtl.NewMTLSize(1, 3, 1))
+	require.NoError(t, err)
+	require.Equal(t, mtl.NewMTLSize(4, 3, 2), dims)
+
+	_, err = Dims(mtl.NewMTLSize(4, 3, 2), mtl.NewMTLSize(2, 3, 2))
+	require.EqualError(t, err, "cannot broadcast (4, 3, 2) and (2, 3, 2): axis W: 4 and 2 are not equal and neither is 1")
+}
+
+func TestKernel_MatchesReference(t *testing.T) {
+	device := mtl.MustCreateSystemDefaultDevice()
+	defer device.Release()
+
+	rnd := rand.New(rand.NewSource(1))
+	randomFloats := func(length int) []float32 {
+		values := make([]float32, length)
+		for i := range values {
+			// keep away from zero for division
+			values[i] = 0.5 + rnd.Float32()
+			if rnd.Intn(2) == 0 {
+				values[i] = -values[i]
+			}
+		}
+		return values
+	}
+	newData := func(values []float32, dims mtl.MTLSize) *num.Data {
+		return &num.Data{
+			Data: device.NewBufferWithFloats(values, mtl.ResourceStorageModeShared),
+			Grad: device.NewBufferEmptyFloatsBuffer(dims.Length(), mtl.ResourceStorageModeShared),
+			Dims: dims,
+		}
+	}
+
+	index := func(dims mtl.MTLSize, x, y, z int) int {
+		if dims.W == 1 {
+			x = 0
+		}
+		if dims.H == 1 {
+			y = 0
+		}
+		if dims.D == 1 {
+			z = 0
+		}
+		return (z*dims.H+y)*dims.W + x
+	}
+
+	shapes := [][2]mtl.MTLSize{
+		{mtl.NewMTLSize(4, 3, 2), mtl.NewMTLSize(4, 3, 2)},
+		{mtl.NewMTLSize(4, 3, 2), mtl.NewMTLSize(1, 3, 2)},
+		{mtl.NewMTLSize(4, 3, 2), mtl.NewMTLSize(1, 1, 2)},
+		{mtl.NewMTLSize(1, 3, 1), mtl.NewMTLSize(4, 1, 2)},
+		{mtl.NewMTLSize(1, 1, 1), mtl.NewMTLSize(4, 3, 2)},
+	}
+
+	for _, op := range []Op{OpAdd, OpSub, OpMul, OpDiv} {
+		for _, shape := range shapes {
+			aDims, bDims := shape[0], shape[1]
+			oDims, err := Dims(aDims, bDims)
+			require.NoError(t, err)
+
+			a := newData(randomFloats(aDims.Length()), aDims)
+			b := newData(randomFloats(bDims.Length()), bDims)
+			output := newData(make([]float32, oDims.Length()), oDims)
+			copy(output.Grad.GetFloats(), randomFloats(oDims.Length()))
+
+			kernel := New(device, a, b, output, op)
+
+			cmd := device.NewCommandQueue().GetNewMTLCommandBuffer()
+			kernel.Forward(cmd)
+			kernel.Backward(cmd)
+			cmd.Commit()
+			cmd.WaitUntilCompleted()
+			cmd.Release()
+
+			aValues, bValues := a.Data.GetFloats(), b.Data.GetFloats()
+			outGrad := output.Grad.GetFloats()
+
+			expOutput := make([]float32, oDims.Length())
+			expAGrad := make([]float32, aDims.Length())
+			expBGrad := make([]float32, bDims.Length())
+
+			for z := 0; z < oDims.D; z++ {
+				for y := 0; y < oDims.H; y++ {
+					for x := 0; x < oDims.W; x++ {
+						o := (z*oDims.H+y)*oDims.W + x
+						ai, bi := index(aDims, x, y, z), index(bDims, x, y, z)
+						av, bv, g := aValues[ai], bValues[bi], outGrad[o]
+
+						switch op {
+						case OpAdd:
+							expOutput[o] = av + bv
+							expAGrad[ai] += g
+							expBGrad[bi] += g
+						case OpSub:
+							expOutput[o] = av - bv
+							expAGrad[ai] += g
+							expBGrad[bi] -= g
+						case OpMul:
+							expOutput[o] = av * bv
+							expAGrad[ai] += g * bv
+							expBGrad[bi] += g * av
+						case OpDiv:
+							expOutput[o] = av / bv
+							expAGrad[ai] += g / bv
+							expBGrad[bi] -= g * av / (bv * bv)
+						}
+					}
+				}
+			}
+
+			require.InDeltaSlice(t, expOutput, output.Data.GetFloats(), 1e-4, "%s %v %v output", op, aDims, bDims)
+			require.InDeltaSlice(t, expAGrad, a.Grad.GetFloats(), 1e-3, "%s %v %v a grad", op, aDims, bDims)
+			require.InDeltaSlice(t, expBGrad, b.Grad.GetFloats(), 1e-3, "%s %v %v b grad", op, aDims, bDims)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+#ifndef Conv2DKernel_h
+#define Conv2DKernel_h
+
+#import <Foundation/Foundation.h>
+#import <Metal/Metal.h>
+
+typedef struct {
+    uint inW;
+    uint inH;
+    uint inC;
+    uint outW;
+    uint outH;
+    uint outC;
+    uint kW;
+    uint kH;
+    uint strideW;
+    uint strideH;
+    uint padW;
+    uint padH;
+    uint dilW;
+    uint dilH;
+    uint batchSize;
+    uint hasBias;
+} Conv2DParams;
+
+@protocol Conv2DKernel <NSObject>
+
+- (instancetype) initWithDevice:(id<MTLDevice>)device kernelSource:(NSString*)kernelSource;
+
+- (void) forward:(id<MTLCommandBuffer>)commandBuffer
+        inputData:(id<MTLBuffer>)inputData
+        weightsData:(id<MTLBuffer>)weightsData
+        biasesData:(id<MTLBuffer>)biasesData
+        outputData:(id<MTLBuffer>)outputData
+        params:(Conv2DParams)params;
+
+- (void) backward:(id<MTLCommandBuffer>)commandBuffer
+        inputData:(id<MTLBuffer>)inputData
+        inputGrad:(id<MTLBuffer>)inputGrad
+        weightsData:(id<MTLBuffer>)weightsData
+        weightsGrad:(id<MTLBuffer>)weightsGrad
+        biasesGrad:(id<MTLBuffer>)biasesGrad
+        outputGrad:(id<MTLBuffer>)outputGrad
+        params:(Conv2DParams)params;
+
+@end
+
+@interface Conv2DKernelImpl : NSObject <Conv2DKernel>
+    @property (nonatomic, strong) id<MTLLibrary> library;
+@end
+
+#endif /* Conv2DKernel_h */
@@ -0,0 +1,183 @@
+#include <metal_stdlib>
+
+using namespace metal;
+
+struct Conv2DParams {
+    uint inW;
+    uint inH;
+    uint inC;
+    uint outW;
+    uint outH;
+    uint outC;
+    uint kW;
+    uint kH;
+    uint strideW;
+    uint strideH;
+    uint padW;
+    uint padH;
+    uint dilW;
+    uint dilH;
+    uint batchSize;
+    uint hasBias;
+};
+
+// Layouts:
+//   input   [batch][inC][inH][inW]
+//   output  [batch][outC][outH][outW]
+//   weights [outC][kH][kW][inC] (OHWI, same as the MPS kernel)
+
+kernel void conv2dForward(
+    device const float *inputData [[ buffer(0) ]],
+    device const float *weightsData [[ buffer(1) ]],
+    device const float *biasesData [[ buffer(2) ]],
+    device float *outputData [[ buffer(3) ]],
+    constant Conv2DParams& p [[ buffer(4) ]],
+    const uint3 gid [[ thread_position_in_grid ]] )
+{
+    if (gid.x >= p.outW || gid.y >= p.outH || gid.z >= p.outC * p.batchSize) {
+        return;
+    }
+
+    uint oc = gid.z % p.outC;
+    uint b = gid.z / p.outC;
+
+    int iy0 = int(gid.y * p.strideH) - int(p.padH);
+    int ix0 = int(gid.x * p.strideW) - int(p.padW);
+
+    uint inPlane = p.inH * p.inW;
+    uint inBase = b * p.inC * inPlane;
+
+    float sum = p.hasBias != 0 ? biasesData[oc] : 0.0f;
+    for (uint ky = 0; ky < p.kH; ++ky) {
+        int iy = iy0 + int(ky * p.dilH);
+        if (iy < 0 || iy >= int(p.inH)) {
+            continue;
+        }
+        for (uint kx = 0; kx < p.kW; ++kx) {
+            int ix = ix0 + int(kx * p.dilW);
+            if (ix < 0 || ix >= int(p.inW)) {
+                continue;
+            }
+            uint wBase = ((oc * p.kH + ky) * p.kW + kx) * p.inC;
+            uint iBase = inBase + uint(iy) * p.inW + uint(ix);
+            for (uint ic = 0; ic < p.inC; ++ic) {
+                sum += inputData[iBase + ic * inPlane] * weightsData[wBase + ic];
+            }
+        }
+    }
+
+    outputData[(gid.z * p.outH + gid.y) * p.outW + gid.x] = sum;
+}
+
+kernel void conv2dInputGrads(
+    device float *inputGrad [[ buffer(0) ]],
+    device const float *weightsData [[ buffer(1) ]],
+    device const float *outputGrad [[ buffer(2) ]],
+    constant Conv2DParams& p [[ buffer(3) ]],
+    const uint3 gid [[ thread_position_in_grid ]] )
+{
+    if (gid.x >= p.inW || gid.y >= p.inH || gid.z >= p.inC * p.batchSize) {
+        return;
+    }
+
+    uint ic = gid.z % p.inC;
+    uint b = gid.z / p.inC;
+
+    uint outPlane = p.outH * p.outW;
+    uint outBase = b * p.outC * outPlane;
+
+    float sum = 0.0f;
+    for (uint ky = 0; ky < p.kH; ++ky) {
+        int ty = int(gid.y) + int(p.padH) - int(ky * p.dilH);
+        if (ty < 0 || uint(ty) % p.strideH != 0) {
+            continue;
+        }
+        uint oy = uint(ty) / p.strideH;
+        if (oy >= p.outH) {
+            continue;
+        }
+        for (uint kx = 0; kx < p.kW; ++kx) {
+            int tx = int(gid.x) + int(p.padW) - int(kx * p.dilW);
+            if (tx < 0 || uint(tx) % p.strideW != 0) {
+                continue;
+            }
+            uint ox = uint(tx) / p.strideW;
+            if (ox >= p.outW) {
+                continue;
+            }
+            uint oBase = outBase + oy * p.outW + ox;
+            uint wBase = (ky * p.kW + kx) * p.inC + ic;
+            uint wStride = p.kH * p.kW * p.inC;
+            for (uint oc = 0; oc < p.outC; ++oc) {
+                sum += outputGrad[oBase + oc * outPlane] * weightsData[wBase + oc * wStride];
+            }
+        }
+    }
+
+    inputGrad[(gid.z * p.inH + gid.y) * p.inW + gid.x] += sum;
+}
+
+kernel void conv2dWeightsGrads(
+    device const float *inputData [[ buffer(0) ]],
+    device float *weightsGrad [[ buffer(1) ]],
+    device const float *outputGrad [[ buffer(2) ]],
+    constant Conv2DParams& p [[ buffer(3) ]],
+    const uint3 gid [[ thread_position_in_grid ]] )
+{
+    // gid.x - input channel, gid.y - ky * kW + kx, gid.z - output channel
+    if (gid.x >= p.inC || gid.y >= p.kH * p.kW || gid.z >= p.outC) {
+        return;
+    }
+
+    uint ic = gid.x;
+    uint ky = gid.y / p.kW;
+    uint kx = gid.y % p.kW;
+    uint oc = gid.z;
+
+    uint inPlane = p.inH * p.inW;
+    uint outPlane = p.outH * p.outW;
+
+    float sum = 0.0f;
+    for (uint b = 0; b < p.batchSize; ++b) {
+        uint inBase = (b * p.inC + ic) * inPlane;
+        uint outBase = (b * p.outC + oc) * outPlane;
+        for (uint oy = 0; oy < p.outH; ++oy) {
+            int iy = int(oy * p.strideH + ky * p.dilH) - int(p.padH);
+            if (iy < 0 || iy >= int(p.inH)) {
+                continue;
+            }
+            for (uint ox = 0; ox < p.outW; ++ox) {
+                int ix = int(ox * p.strideW + kx * p.dilW) - int(p.padW);
+                if (ix < 0 || ix >= int(p.inW)) {
+                    continue;
+                }
+                sum += outputGrad[outBase + oy * p.outW + ox] * inputData[inBase + uint(iy) * p.inW + uint(ix)];
+            }
+        }
+    }
+
+    weightsGrad[(oc * p.kH * p.kW + gid.y) * p.inC + ic] += sum;
+}
+
+kernel void conv2dBiasesGrads(
+    device float *biasesGrad [[ buffer(0) ]],
+    device const float *outputGrad [[ buffer(1) ]],
+    constant Conv2DParams& p [[ buffer(2) ]],
+    const uint gid [[ thread_position_in_grid ]] )
+{
+    if (gid >= p.outC) {
+        return;
+    }
+
+    uint outPlane = p.outH * p.outW;
+
+    float sum = 0.0f;
+    for (uint b = 0; b < p.batchSize; ++b) {
+        uint outBase = (b * p.outC + gid) * outPlane;
+        for (uint i = 0; i < outPlane; ++i) {
+            sum += outputGrad[outBase + i];
+        }
+    }
+
+    biasesGrad[gid] += sum;
+}
@@ -0,0 +1,182 @@
+package conv2d
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/atkhx/metal/mtl"
+	"github.com/atkhx/metal/nn/num"
+	"github.com/stretchr/testify/require"
+)
+
+type naiveConv struct {
+	inW, inH, inC    int
+	outW, outH, outC int
+	kW, kH           int
+	batchSize        int
+	params           Params
+}
+
+func (c naiveConv) inputIdx(b, ic, y, x int) int {
+	return ((b*c.inC+ic)*c.inH+y)*c.inW + x
+}
+
+func (c naiveConv) outputIdx(b, oc, y, x int) int {
+	return ((b*c.outC+oc)*c.outH+y)*c.outW + x
+}
+
+func (c naiveConv) weightIdx(oc, ky, kx, ic int) int {
+	return ((oc*c.kH+ky)*c.kW+kx)*c.inC + ic
+}
+
+// each calls fn for every (output, weight, input) triple contributing to the result.
+func (c naiveConv) each(fn func(oIdx, wIdx, iIdx int)) {
+	p := c.params
+	for b := 0; b < c.batchSize; b++ {
+		for oc := 0; oc < c.outC; oc++ {
+			for oy := 0; oy < c.outH; oy++ {
+				for ox := 0; ox < c.outW; ox++ {
+					for ky := 0; ky < c.kH; ky++ {
+						iy := oy*p.StrideH - p.PaddingH + ky*p.DilationH
+						if iy < 0 || iy >= c.inH {
+							continue
+						}
+						for kx := 0; kx < c.kW; kx++ {
+							ix := ox*p.StrideW - p.PaddingW + kx*p.DilationW
+							if ix < 0 || ix >= c.inW {
+								continue
+							}
+							for ic := 0; ic < c.inC; ic++ {
+								fn(c.outputIdx(b, oc, oy, ox), c.weightIdx(oc, ky, kx, ic), c.inputIdx(b, ic, iy, ix))
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+func randomFloats(rnd *rand.Rand, n int) []float32 {
+	res := make([]float32, n)
+	for i := range res {
+		res[i] = rnd.Float32()*2 - 1
+	}
+	return res
+}
+
+func TestKernel_MatchesNaiveConvolution(t *testing.T) {
+	device := mtl.MustCreateSystemDefaultDevice()
+	defer device.Release()
+
+	testCases := []struct {
+		name      string
+		inW, inH  int
+		inC, outC int
+		kW, kH    int
+		batchSize int
+		params    Params
+	}{
+		{name: "valid 3x3", inW: 7, inH: 7, inC: 2, outC: 3, kW: 3, kH: 3, batchSize: 2},
+		{name: "stride 2 padding 1", inW: 8, inH: 9, inC: 3, outC: 2, kW: 3, kH: 3, batchSize: 2,
+			params: Params{StrideW: 2, StrideH: 2, PaddingW: 1, PaddingH: 1}},
+		{name: "padding 2 5x5", inW: 6, inH: 6, inC: 1, outC: 4, kW: 5, kH: 5, batchSize: 3,
+			params: Params{PaddingW: 2, PaddingH: 2}},
+		{name: "dilation 2", inW: 9, inH: 8, inC: 2, outC: 2, kW: 3, kH: 3, batchSize: 1,
+			params: Params{DilationW: 2, DilationH: 2, PaddingW: 1}},
+		{name: "rectangular asymmetric", inW: 10, inH: 7, inC: 2, outC: 3, kW: 5, kH: 2, batchSize: 2,
+			params: Params{StrideW: 3, StrideH: 1, PaddingW: 2, PaddingH: 0, DilationH: 2}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rnd := rand.New(rand.NewSource(1))
+
+			params := tc.params.Normalize()
+			outW, outH := params.OutputSize(tc.inW, tc.inH, tc.kW, tc.kH)
+			ref := naiveConv{
+				inW: tc.inW, inH: tc.inH, inC: tc.inC,
+				outW: outW, outH: outH, outC: tc.outC,
+				kW: tc.kW, kH: tc.kH,
+				batchSize: tc.batchSize,
+				params:    params,
+			}
+
+			newData := func(values []float32, dims mtl.MTLSize) *num.Data {
+				return &num.Data{
+					Data: device.NewBufferWithFloats(values, mtl.ResourceStorageModeShared),
+					Grad: device.NewBufferEmptyFloatsBuffer(dims.Length(), mtl.ResourceStorageModeShared),
+					Dims: dims,
+				}
+			}
+
+			inDims := mtl.NewMTLSize(tc.inW, tc.inH, tc.inC*tc.batchSize)
+			wDims := mtl.NewMTLSize(tc.kW, tc.kH, tc.inC*tc.outC)
+			bDims := mtl.NewMTLSize(1, 1, tc.outC)
+			outDims := mtl.NewMTLSize(outW, outH, tc.outC*tc.batchSize)
+
+			inputValues := randomFloats(rnd, inDims.Length())
+			weightsValues := randomFloats(rnd, wDims.Length())
+			biasesValues := randomFloats(rnd, bDims.Length())
+			outputGrad := randomFloats(rnd, outDims.Length())
+
+			input := newData(inputValues, inDims)
+			weights := newData(weightsValues, wDims)
+			biases := newData(biasesValues, bDims)
+			output := newData(make([]float32, outDims.Length()), outDims)
+			copy(output.Grad.GetFloats(), outputGrad)
+
+			kernel := New(device, input, weights, biases, output, tc.outC, tc.batchSize, tc.params)
+
+			cmd := device.NewCommandQueue().GetNewMTLCommandBuffer()
+			defer cmd.Release()
+			kernel.Forward(cmd)
+			kernel.Backward(cmd)
+			cmd.Commit()
+			cmd.WaitUntilCompleted()
+
+			expOutput := make([]float32, outDims.Length())
+			expInputGrad := make([]float32, inDims.Length())
+			expWeightsGrad := make([]float32, wDims.Length())
+			expBiasesGrad := make([]float32, bDims.Length())
+
+			for i := range expOutput {
+				oc := (i / (outW * outH)) % tc.outC
+				expOutput[i] = biasesValues[oc]
+				expBiasesGrad[oc] += outputGrad[i]
+			}
+			ref.each(func(oIdx, wIdx, iIdx int) {
+				expOutput[oIdx] += inputValues[iIdx] * weightsValues[wIdx]
+				expInputGrad[iIdx] += outputGrad[oIdx] * weightsValues[wIdx]
+				expWeightsGrad[wIdx] += outputGrad[oIdx] * inputValues[iIdx]
+			})
+
+			requireFloatsInDelta(t, expOutput, output.Data.GetFloats(), "output")
+			requireFloatsInDelta(t, expInputGrad, input.Grad.GetFloats(), "input grad")
+			requireFloatsInDelta(t, expWeightsGrad, weights.Grad.GetFloats(), "weights grad")
+			requireFloatsInDelta(t, expBiasesGrad, biases.Grad.GetFloats(), "biases grad")
+		})
+	}
+}
+
+func TestParams_OutputSize(t *testing.T) {
+	outW, outH := Params{}.OutputSize(28, 28, 3, 3)
+	require.Equal(t, 26, outW)
+	require.Equal(t, 26, outH)
+
+	outW, outH = Params{StrideW: 2, StrideH: 2, PaddingW: 1, PaddingH: 1}.OutputSize(32, 32, 3, 3)
+	require.Equal(t, 16, outW)
+	require.Equal(t, 16, outH)
+
+	outW, outH = Params{DilationW: 2, DilationH: 3, PaddingW: 2}.OutputSize(10, 10, 3, 3)
+	require.Equal(t, 10, outW)
+	require.Equal(t, 4, outH)
+}
+
+func requireFloatsInDelta(t *testing.T, expected, actual []float32, msg string) {
+	t.Helper()
+	require.Len(t, actual, len(expected), msg)
+	for i := range expected {
+		require.InDelta(t, float64(expected[i]), float64(actual[i]), 1e-4, "%s[%d]", msg, i)
+	}
+}
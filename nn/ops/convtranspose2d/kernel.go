@@ -0,0 +1,221 @@
+package convtranspose2d
+
+/*
+#cgo CFLAGS: -x objective-c
+#cgo LDFLAGS: -framework Metal -framework MetalPerformanceShaders -framework CoreGraphics -framework Foundation
+
+#include "kernel.h"
+
+void* convTranspose2dKernelCreate(void *device, const char *kernelSource) {
+    return [[ConvTranspose2DKernelImpl alloc] initWithDevice:(id<MTLDevice>)device
+		kernelSource:[NSString stringWithUTF8String:kernelSource]];
+}
+
+void convTranspose2dForward(
+    void *kernel,
+    void *commandBuffer,
+    void *inputData,
+    void *weightsData,
+    void *biasesData,
+    void *outputData,
+    ConvTranspose2DParams params
+) {
+    [(__bridge ConvTranspose2DKernelImpl*)kernel forward:(id<MTLCommandBuffer>)commandBuffer
+        inputData:(id<MTLBuffer>)inputData
+        weightsData:(id<MTLBuffer>)weightsData
+        biasesData:(id<MTLBuffer>)biasesData
+        outputData:(id<MTLBuffer>)outputData
+        params:params];
+}
+
+void convTranspose2dBackward(
+    void *kernel,
+    void *commandBuffer,
+    void *inputData,
+    void *inputGrad,
+    void *weightsData,
+    void *weightsGrad,
+    void *biasesGrad,
+    void *outputGrad,
+    ConvTranspose2DParams params
+) {
+    [(__bridge ConvTranspose2DKernelImpl*)kernel backward:(id<MTLCommandBuffer>)commandBuffer
+        inputData:(id<MTLBuffer>)inputData
+        inputGrad:(id<MTLBuffer>)inputGrad
+        weightsData:(id<MTLBuffer>)weightsData
+        weightsGrad:(id<MTLBuffer>)weightsGrad
+        biasesGrad:(id<MTLBuffer>)biasesGrad
+        outputGrad:(id<MTLBuffer>)outputGrad
+        params:params];
+}
+*/
+import "C"
+import (
+	_ "embed"
+	"fmt"
+	"unsafe"
+
+	"github.com/atkhx/metal/mtl"
+	"github.com/atkhx/metal/nn/num"
+)
+
+//go:embed kernel.metal
+var metalFunctions string
+
+// Params describes the transposed convolution geometry. Zero stride or dilation means 1.
+// OutputPadding adds extra rows and columns to one side of the output
+// to resolve the output size ambiguity when stride > 1.
+type Params struct {
+	StrideW        int
+	StrideH        int
+	PaddingW       int
+	PaddingH       int
+	OutputPaddingW int
+	OutputPaddingH int
+	DilationW      int
+	DilationH      int
+}
+
+// Normalize returns params with zero strides and dilations replaced by 1.
+func (p Params) Normalize() Params {
+	if p.StrideW < 1 {
+		p.StrideW = 1
+	}
+	if p.StrideH < 1 {
+		p.StrideH = 1
+	}
+	if p.DilationW < 1 {
+		p.DilationW = 1
+	}
+	if p.DilationH < 1 {
+		p.DilationH = 1
+	}
+	return p
+}
+
+// OutputSize returns the spatial size of the transposed convolution output:
+// out = (in-1)*stride - 2*padding + dilation*(kernel-1) + outputPadding + 1.
+func (p Params) OutputSize(inW, inH, kW, kH int) (outW, outH int) {
+	p = p.Normalize()
+	outW = (inW-1)*p.StrideW - 2*p.PaddingW + p.DilationW*(kW-1) + p.OutputPaddingW + 1
+	outH = (inH-1)*p.StrideH - 2*p.PaddingH + p.DilationH*(kH-1) + p.OutputPaddingH + 1
+	return
+}
+
+// New creates transposed convolution kernel.
+// Input dims: (inW, inH, inC*batchSize), weights dims: (kW, kH, inC*filtersCount) in [inC][kH][kW][outC] layout,
+// biases dims: (1, 1, filtersCount) or nil, output dims: (outW, outH, filtersCount*batchSize).
+// Gradients are accumulated into input, weights and biases grads.
+func New(
+	device *mtl.Device,
+	input *num.Data,
+	weights *num.Data,
+	biases *num.Data,
+	output *num.Data,
+	filtersCount int,
+	batchSize int,
+	params Params,
+) *Kernel {
+	params = params.Normalize()
+
+	if params.OutputPaddingW >= params.StrideW && params.OutputPaddingW >= params.DilationW ||
+		params.OutputPaddingH >= params.StrideH && params.OutputPaddingH >= params.DilationH {
+		panic("convtranspose2d: output padding must be smaller than stride or dilation")
+	}
+
+	kW, kH := weights.Dims.W, weights.Dims.H
+	inC := input.Dims.D / batchSize
+	outW, outH := params.OutputSize(input.Dims.W, input.Dims.H, kW, kH)
+
+	if outW < 1 || outH < 1 {
+		panic(fmt.Sprintf("convtranspose2d: empty output %dx%d", outW, outH))
+	}
+	if output.Dims.W != outW || output.Dims.H != outH || output.Dims.D != filtersCount*batchSize {
+		panic(fmt.Sprintf("convtranspose2d: invalid output dims %v", output.Dims))
+	}
+	if weights.Dims.D != inC*filtersCount {
+		panic(fmt.Sprintf("convtranspose2d: invalid weights dims %v", weights.Dims))
+	}
+
+	hasBias := 0
+	if biases != nil {
+		hasBias = 1
+	}
+
+	cKernelString := C.CString(metalFunctions)
+	defer C.free(unsafe.Pointer(cKernelString))
+
+	return &Kernel{
+		kernelID: C.convTranspose2dKernelCreate(device.GetID(), cKernelString),
+		input:    input,
+		weights:  weights,
+		biases:   biases,
+		output:   output,
+		params: C.ConvTranspose2DParams{
+			inW:       C.uint(input.Dims.W),
+			inH:       C.uint(input.Dims.H),
+			inC:       C.uint(inC),
+			outW:      C.uint(outW),
+			outH:      C.uint(outH),
+			outC:      C.uint(filtersCount),
+			kW:        C.uint(kW),
+			kH:        C.uint(kH),
+			strideW:   C.uint(params.StrideW),
+			strideH:   C.uint(params.StrideH),
+			padW:      C.uint(params.PaddingW),
+			padH:      C.uint(params.PaddingH),
+			dilW:      C.uint(params.DilationW),
+			dilH:      C.uint(params.DilationH),
+			batchSize: C.uint(batchSize),
+			hasBias:   C.uint(hasBias),
+		},
+	}
+}
+
+type Kernel struct {
+	kernelID unsafe.Pointer
+
+	input   *num.Data
+	weights *num.Data
+	biases  *num.Data
+	output  *num.Data
+
+	params C.ConvTranspose2DParams
+}
+
+func (k *Kernel) Forward(b *mtl.CommandBuffer) {
+	// Metal requires every declared buffer to be bound, weights stand in for missing biases.
+	biasesData := k.weights.Data.GetID()
+	if k.biases != nil {
+		biasesData = k.biases.Data.GetID()
+	}
+
+	C.convTranspose2dForward(
+		k.kernelID,
+		b.GetID(),
+		k.input.Data.GetID(),
+		k.weights.Data.GetID(),
+		biasesData,
+		k.output.Data.GetID(),
+		k.params,
+	)
+}
+
+func (k *Kernel) Backward(b *mtl.CommandBuffer) {
+	biasesGrad := k.weights.Grad.GetID()
+	if k.biases != nil {
+		biasesGrad = k.biases.Grad.GetID()
+	}
+
+	C.convTranspose2dBackward(
+		k.kernelID,
+		b.GetID(),
+		k.input.Data.GetID(),
+		k.input.Grad.GetID(),
+		k.weights.Data.GetID(),
+		k.weights.Grad.GetID(),
+		biasesGrad,
+		k.output.Grad.GetID(),
+		k.params,
+	)
+}
@@ -0,0 +1,52 @@
+#ifndef ConvTranspose2DKernel_h
+#define ConvTranspose2DKernel_h
+
+#import <Foundation/Foundation.h>
+#import <Metal/Metal.h>
+
+typedef struct {
+    uint inW;
+    uint inH;
+    uint inC;
+    uint outW;
+    uint outH;
+    uint outC;
+    uint kW;
+    uint kH;
+    uint strideW;
+    uint strideH;
+    uint padW;
+    uint padH;
+    uint dilW;
+    uint dilH;
+    uint batchSize;
+    uint hasBias;
+} ConvTranspose2DParams;
+
+@protocol ConvTranspose2DKernel <NSObject>
+
+- (instancetype) initWithDevice:(id<MTLDevice>)device kernelSource:(NSString*)kernelSource;
+
+- (void) forward:(id<MTLCommandBuffer>)commandBuffer
+        inputData:(id<MTLBuffer>)inputData
+        weightsData:(id<MTLBuffer>)weightsData
+        biasesData:(id<MTLBuffer>)biasesData
+        outputData:(id<MTLBuffer>)outputData
+        params:(ConvTranspose2DParams)params;
+
+- (void) backward:(id<MTLCommandBuffer>)commandBuffer
+        inputData:(id<MTLBuffer>)inputData
+        inputGrad:(id<MTLBuffer>)inputGrad
+        weightsData:(id<MTLBuffer>)weightsData
+        weightsGrad:(id<MTLBuffer>)weightsGrad
+        biasesGrad:(id<MTLBuffer>)biasesGrad
+        outputGrad:(id<MTLBuffer>)outputGrad
+        params:(ConvTranspose2DParams)params;
+
+@end
+
+@interface ConvTranspose2DKernelImpl : NSObject <ConvTranspose2DKernel>
+    @property (nonatomic, strong) id<MTLLibrary> library;
+@end
+
+#endif /* ConvTranspose2DKernel_h */
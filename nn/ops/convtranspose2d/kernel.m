@@ -0,0 +1,128 @@
+#import "kernel.h"
+#import <Foundation/Foundation.h>
+#include <stdio.h>
+
+static inline MTLSize threadgroupSize2D(id<MTLComputePipelineState> pso) {
+    NSUInteger w = pso.threadExecutionWidth;
+    NSUInteger max = pso.maxTotalThreadsPerThreadgroup;
+    NSUInteger h = max / w;
+    if (h < 1) {
+        h = 1;
+    }
+    return MTLSizeMake(w, h, 1);
+}
+
+static inline MTLSize threadgroupSize1D(id<MTLComputePipelineState> pso) {
+    NSUInteger w = pso.threadExecutionWidth;
+    NSUInteger max = pso.maxTotalThreadsPerThreadgroup;
+    if (w > max) {
+        w = max;
+    }
+    return MTLSizeMake(w, 1, 1);
+}
+
+@implementation ConvTranspose2DKernelImpl {
+    id<MTLDevice> _device;
+
+    id<MTLComputePipelineState> _forwardPSO;
+    id<MTLComputePipelineState> _inputGradsPSO;
+    id<MTLComputePipelineState> _weightsGradsPSO;
+    id<MTLComputePipelineState> _biasesGradsPSO;
+
+    NSError *error;
+}
+
+- (id<MTLComputePipelineState>)createPipelineStateWithFunctionName:(NSString *)functionName {
+    id<MTLFunction> function = [self.library newFunctionWithName:functionName];
+    if (!function) {
+        printf("Failed to load function %s!\n", [functionName UTF8String]);
+        return nil;
+    }
+
+    id<MTLComputePipelineState> pipelineState = [_device newComputePipelineStateWithFunction:function error:&error];
+    if (error != nil) {
+        const char *errorCString = [[error localizedDescription] UTF8String];
+        printf("Failed to create pipeline state: %s\n", errorCString);
+        return nil;
+    }
+    return pipelineState;
+}
+
+- (instancetype)initWithDevice:(id<MTLDevice>)device kernelSource:(NSString*)kernelSource {
+    self = [super init];
+    if (self) {
+        _device = device;
+
+        self.library = [_device newLibraryWithSource:kernelSource options:nil error:&error];
+
+        _forwardPSO = [self createPipelineStateWithFunctionName:@"convTranspose2dForward"];
+        _inputGradsPSO = [self createPipelineStateWithFunctionName:@"convTranspose2dInputGrads"];
+        _weightsGradsPSO = [self createPipelineStateWithFunctionName:@"convTranspose2dWeightsGrads"];
+        _biasesGradsPSO = [self createPipelineStateWithFunctionName:@"convTranspose2dBiasesGrads"];
+    }
+    return self;
+}
+
+- (void) forward:(id<MTLCommandBuffer>)commandBuffer
+        inputData:(id<MTLBuffer>)inputData
+        weightsData:(id<MTLBuffer>)weightsData
+        biasesData:(id<MTLBuffer>)biasesData
+        outputData:(id<MTLBuffer>)outputData
+        params:(ConvTranspose2DParams)params
+{
+    id<MTLComputeCommandEncoder> forward = [commandBuffer computeCommandEncoder];
+    [forward setComputePipelineState:_forwardPSO];
+    [forward setBuffer:inputData offset:0 atIndex:0];
+    [forward setBuffer:weightsData offset:0 atIndex:1];
+    [forward setBuffer:biasesData offset:0 atIndex:2];
+    [forward setBuffer:outputData offset:0 atIndex:3];
+    [forward setBytes:&params length:sizeof(ConvTranspose2DParams) atIndex:4];
+    [forward dispatchThreads:MTLSizeMake(params.outW, params.outH, params.outC * params.batchSize)
+       threadsPerThreadgroup:threadgroupSize2D(_forwardPSO)];
+    [forward endEncoding];
+}
+
+- (void) backward:(id<MTLCommandBuffer>)commandBuffer
+        inputData:(id<MTLBuffer>)inputData
+        inputGrad:(id<MTLBuffer>)inputGrad
+        weightsData:(id<MTLBuffer>)weightsData
+        weightsGrad:(id<MTLBuffer>)weightsGrad
+        biasesGrad:(id<MTLBuffer>)biasesGrad
+        outputGrad:(id<MTLBuffer>)outputGrad
+        params:(ConvTranspose2DParams)params
+{
+    id<MTLComputeCommandEncoder> inputGrads = [commandBuffer computeCommandEncoder];
+    [inputGrads setComputePipelineState:_inputGradsPSO];
+    [inputGrads setBuffer:inputGrad offset:0 atIndex:0];
+    [inputGrads setBuffer:weightsData offset:0 atIndex:1];
+    [inputGrads setBuffer:outputGrad offset:0 atIndex:2];
+    [inputGrads setBytes:&params length:sizeof(ConvTranspose2DParams) atIndex:3];
+    [inputGrads dispatchThreads:MTLSizeMake(params.inW, params.inH, params.inC * params.batchSize)
+          threadsPerThreadgroup:threadgroupSize2D(_inputGradsPSO)];
+    [inputGrads endEncoding];
+
+    id<MTLComputeCommandEncoder> weightsGrads = [commandBuffer computeCommandEncoder];
+    [weightsGrads setComputePipelineState:_weightsGradsPSO];
+    [weightsGrads setBuffer:inputData offset:0 atIndex:0];
+    [weightsGrads setBuffer:weightsGrad offset:0 atIndex:1];
+    [weightsGrads setBuffer:outputGrad offset:0 atIndex:2];
+    [weightsGrads setBytes:&params length:sizeof(ConvTranspose2DParams) atIndex:3];
+    [weightsGrads dispatchThreads:MTLSizeMake(params.outC, params.kW * params.kH, params.inC)
+            threadsPerThreadgroup:threadgroupSize2D(_weightsGradsPSO)];
+    [weightsGrads endEncoding];
+
+    if (params.hasBias == 0) {
+        return;
+    }
+
+    id<MTLComputeCommandEncoder> biasesGrads = [commandBuffer computeCommandEncoder];
+    [biasesGrads setComputePipelineState:_biasesGradsPSO];
+    [biasesGrads setBuffer:biasesGrad offset:0 atIndex:0];
+    [biasesGrads setBuffer:outputGrad offset:0 atIndex:1];
+    [biasesGrads setBytes:&params length:sizeof(ConvTranspose2DParams) atIndex:2];
+    [biasesGrads dispatchThreads:MTLSizeMake(params.outC, 1, 1)
+           threadsPerThreadgroup:threadgroupSize1D(_biasesGradsPSO)];
+    [biasesGrads endEncoding];
+}
+
+@end
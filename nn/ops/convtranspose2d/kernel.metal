@@ -0,0 +1,186 @@
+#include <metal_stdlib>
+
+using namespace metal;
+
+struct ConvTranspose2DParams {
+    uint inW;
+    uint inH;
+    uint inC;
+    uint outW;
+    uint outH;
+    uint outC;
+    uint kW;
+    uint kH;
+    uint strideW;
+    uint strideH;
+    uint padW;
+    uint padH;
+    uint dilW;
+    uint dilH;
+    uint batchSize;
+    uint hasBias;
+};
+
+// Layouts:
+//   input   [batch][inC][inH][inW]
+//   output  [batch][outC][outH][outW]
+//   weights [inC][kH][kW][outC]
+//
+// Input pixel (iy, ix) scatters into output pixel (iy*stride - pad + k*dil),
+// so the forward pass gathers from every input pixel that lands on the output pixel.
+
+kernel void convTranspose2dForward(
+    device const float *inputData [[ buffer(0) ]],
+    device const float *weightsData [[ buffer(1) ]],
+    device const float *biasesData [[ buffer(2) ]],
+    device float *outputData [[ buffer(3) ]],
+    constant ConvTranspose2DParams& p [[ buffer(4) ]],
+    const uint3 gid [[ thread_position_in_grid ]] )
+{
+    if (gid.x >= p.outW || gid.y >= p.outH || gid.z >= p.outC * p.batchSize) {
+        return;
+    }
+
+    uint oc = gid.z % p.outC;
+    uint b = gid.z / p.outC;
+
+    uint inPlane = p.inH * p.inW;
+    uint inBase = b * p.inC * inPlane;
+    uint wStride = p.kH * p.kW * p.outC;
+
+    float sum = p.hasBias != 0 ? biasesData[oc] : 0.0f;
+    for (uint ky = 0; ky < p.kH; ++ky) {
+        int ty = int(gid.y) + int(p.padH) - int(ky * p.dilH);
+        if (ty < 0 || uint(ty) % p.strideH != 0) {
+            continue;
+        }
+        uint iy = uint(ty) / p.strideH;
+        if (iy >= p.inH) {
+            continue;
+        }
+        for (uint kx = 0; kx < p.kW; ++kx) {
+            int tx = int(gid.x) + int(p.padW) - int(kx * p.dilW);
+            if (tx < 0 || uint(tx) % p.strideW != 0) {
+                continue;
+            }
+            uint ix = uint(tx) / p.strideW;
+            if (ix >= p.inW) {
+                continue;
+            }
+            uint iBase = inBase + iy * p.inW + ix;
+            uint wBase = (ky * p.kW + kx) * p.outC + oc;
+            for (uint ic = 0; ic < p.inC; ++ic) {
+                sum += inputData[iBase + ic * inPlane] * weightsData[wBase + ic * wStride];
+            }
+        }
+    }
+
+    outputData[(gid.z * p.outH + gid.y) * p.outW + gid.x] = sum;
+}
+
+kernel void convTranspose2dInputGrads(
+    device float *inputGrad [[ buffer(0) ]],
+    device const float *weightsData [[ buffer(1) ]],
+    device const float *outputGrad [[ buffer(2) ]],
+    constant ConvTranspose2DParams& p [[ buffer(3) ]],
+    const uint3 gid [[ thread_position_in_grid ]] )
+{
+    if (gid.x >= p.inW || gid.y >= p.inH || gid.z >= p.inC * p.batchSize) {
+        return;
+    }
+
+    uint ic = gid.z % p.inC;
+    uint b = gid.z / p.inC;
+
+    int oy0 = int(gid.y * p.strideH) - int(p.padH);
+    int ox0 = int(gid.x * p.strideW) - int(p.padW);
+
+    uint outPlane = p.outH * p.outW;
+    uint outBase = b * p.outC * outPlane;
+
+    float sum = 0.0f;
+    for (uint ky = 0; ky < p.kH; ++ky) {
+        int oy = oy0 + int(ky * p.dilH);
+        if (oy < 0 || oy >= int(p.outH)) {
+            continue;
+        }
+        for (uint kx = 0; kx < p.kW; ++kx) {
+            int ox = ox0 + int(kx * p.dilW);
+            if (ox < 0 || ox >= int(p.outW)) {
+                continue;
+            }
+            uint oBase = outBase + uint(oy) * p.outW + uint(ox);
+            uint wBase = ((ic * p.kH + ky) * p.kW + kx) * p.outC;
+            for (uint oc = 0; oc < p.outC; ++oc) {
+                sum += outputGrad[oBase + oc * outPlane] * weightsData[wBase + oc];
+            }
+        }
+    }
+
+    inputGrad[(gid.z * p.inH + gid.y) * p.inW + gid.x] += sum;
+}
+
+kernel void convTranspose2dWeightsGrads(
+    device const float *inputData [[ buffer(0) ]],
+    device float *weightsGrad [[ buffer(1) ]],
+    device const float *outputGrad [[ buffer(2) ]],
+    constant ConvTranspose2DParams& p [[ buffer(3) ]],
+    const uint3 gid [[ thread_position_in_grid ]] )
+{
+    // gid.x - output channel, gid.y - ky * kW + kx, gid.z - input channel
+    if (gid.x >= p.outC || gid.y >= p.kH * p.kW || gid.z >= p.inC) {
+        return;
+    }
+
+    uint oc = gid.x;
+    uint ky = gid.y / p.kW;
+    uint kx = gid.y % p.kW;
+    uint ic = gid.z;
+
+    uint inPlane = p.inH * p.inW;
+    uint outPlane = p.outH * p.outW;
+
+    float sum = 0.0f;
+    for (uint b = 0; b < p.batchSize; ++b) {
+        uint inBase = (b * p.inC + ic) * inPlane;
+        uint outBase = (b * p.outC + oc) * outPlane;
+        for (uint iy = 0; iy < p.inH; ++iy) {
+            int oy = int(iy * p.strideH + ky * p.dilH) - int(p.padH);
+            if (oy < 0 || oy >= int(p.outH)) {
+                continue;
+            }
+            for (uint ix = 0; ix < p.inW; ++ix) {
+                int ox = int(ix * p.strideW + kx * p.dilW) - int(p.padW);
+                if (ox < 0 || ox >= int(p.outW)) {
+                    continue;
+                }
+                sum += inputData[inBase + iy * p.inW + ix] * outputGrad[outBase + uint(oy) * p.outW + uint(ox)];
+            }
+        }
+    }
+
+    weightsGrad[(ic * p.kH * p.kW + gid.y) * p.outC + oc] += sum;
+}
+
+kernel void convTranspose2dBiasesGrads(
+    device float *biasesGrad [[ buffer(0) ]],
+    device const float *outputGrad [[ buffer(1) ]],
+    constant ConvTranspose2DParams& p [[ buffer(2) ]],
+    const uint gid [[ thread_position_in_grid ]] )
+{
+    if (gid >= p.outC) {
+        return;
+    }
+
+    uint outPlane = p.outH * p.outW;
+
+    float sum = 0.0f;
+    for (uint b = 0; b < p.batchSize; ++b) {
+        uint outBase = (b * p.outC + gid) * outPlane;
+        for (uint i = 0; i < outPlane; ++i) {
+            sum += outputGrad[outBase + i];
+        }
+    }
+
+    biasesGrad[gid] += sum;
+}
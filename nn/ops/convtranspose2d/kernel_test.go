@@ -0,0 +1,168 @@
+package convtranspose2d
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/atkhx/metal/mtl"
+	"github.com/atkhx/metal/nn/num"
+	"github.com/stretchr/testify/require"
+)
+
+type naiveConvTranspose struct {
+	inW, inH, inC    int
+	outW, outH, outC int
+	kW, kH           int
+	batchSize        int
+	params           Params
+}
+
+// each calls fn for every (input, weight, output) triple: input pixels scatter into the output.
+func (c naiveConvTranspose) each(fn func(iIdx, wIdx, oIdx int)) {
+	p := c.params
+	for b := 0; b < c.batchSize; b++ {
+		for ic := 0; ic < c.inC; ic++ {
+			for iy := 0; iy < c.inH; iy++ {
+				for ix := 0; ix < c.inW; ix++ {
+					for ky := 0; ky < c.kH; ky++ {
+						oy := iy*p.StrideH - p.PaddingH + ky*p.DilationH
+						if oy < 0 || oy >= c.outH {
+							continue
+						}
+						for kx := 0; kx < c.kW; kx++ {
+							ox := ix*p.StrideW - p.PaddingW + kx*p.DilationW
+							if ox < 0 || ox >= c.outW {
+								continue
+							}
+							for oc := 0; oc < c.outC; oc++ {
+								fn(
+									((b*c.inC+ic)*c.inH+iy)*c.inW+ix,
+									((ic*c.kH+ky)*c.kW+kx)*c.outC+oc,
+									((b*c.outC+oc)*c.outH+oy)*c.outW+ox,
+								)
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+func randomFloats(rnd *rand.Rand, n int) []float32 {
+	res := make([]float32, n)
+	for i := range res {
+		res[i] = rnd.Float32()*2 - 1
+	}
+	return res
+}
+
+func TestKernel_MatchesNaiveTransposedConvolution(t *testing.T) {
+	device := mtl.MustCreateSystemDefaultDevice()
+	defer device.Release()
+
+	testCases := []struct {
+		name      string
+		inW, inH  int
+		inC, outC int
+		kW, kH    int
+		batchSize int
+		params    Params
+	}{
+		{name: "stride 1", inW: 5, inH: 5, inC: 2, outC: 3, kW: 3, kH: 3, batchSize: 2},
+		{name: "stride 2 upsample", inW: 4, inH: 4, inC: 3, outC: 2, kW: 4, kH: 4, batchSize: 2,
+			params: Params{StrideW: 2, StrideH: 2, PaddingW: 1, PaddingH: 1}},
+		{name: "output padding", inW: 4, inH: 3, inC: 2, outC: 2, kW: 3, kH: 3, batchSize: 1,
+			params: Params{StrideW: 2, StrideH: 2, PaddingW: 1, PaddingH: 1, OutputPaddingW: 1, OutputPaddingH: 1}},
+		{name: "rectangular asymmetric", inW: 3, inH: 4, inC: 2, outC: 3, kW: 3, kH: 2, batchSize: 2,
+			params: Params{StrideW: 3, PaddingH: 1, OutputPaddingW: 2, DilationW: 2}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rnd := rand.New(rand.NewSource(1))
+
+			params := tc.params.Normalize()
+			outW, outH := params.OutputSize(tc.inW, tc.inH, tc.kW, tc.kH)
+			ref := naiveConvTranspose{
+				inW: tc.inW, inH: tc.inH, inC: tc.inC,
+				outW: outW, outH: outH, outC: tc.outC,
+				kW: tc.kW, kH: tc.kH,
+				batchSize: tc.batchSize,
+				params:    params,
+			}
+
+			newData := func(values []float32, dims mtl.MTLSize) *num.Data {
+				return &num.Data{
+					Data: device.NewBufferWithFloats(values, mtl.ResourceStorageModeShared),
+					Grad: device.NewBufferEmptyFloatsBuffer(dims.Length(), mtl.ResourceStorageModeShared),
+					Dims: dims,
+				}
+			}
+
+			inDims := mtl.NewMTLSize(tc.inW, tc.inH, tc.inC*tc.batchSize)
+			wDims := mtl.NewMTLSize(tc.kW, tc.kH, tc.inC*tc.outC)
+			bDims := mtl.NewMTLSize(1, 1, tc.outC)
+			outDims := mtl.NewMTLSize(outW, outH, tc.outC*tc.batchSize)
+
+			inputValues := randomFloats(rnd, inDims.Length())
+			weightsValues := randomFloats(rnd, wDims.Length())
+			biasesValues := randomFloats(rnd, bDims.Length())
+			outputGrad := randomFloats(rnd, outDims.Length())
+
+			input := newData(inputValues, inDims)
+			weights := newData(weightsValues, wDims)
+			biases := newData(biasesValues, bDims)
+			output := newData(make([]float32, outDims.Length()), outDims)
+			copy(output.Grad.GetFloats(), outputGrad)
+
+			kernel := New(device, input, weights, biases, output, tc.outC, tc.batchSize, tc.params)
+
+			cmd := device.NewCommandQueue().GetNewMTLCommandBuffer()
+			defer cmd.Release()
+			kernel.Forward(cmd)
+			kernel.Backward(cmd)
+			cmd.Commit()
+			cmd.WaitUntilCompleted()
+
+			expOutput := make([]float32, outDims.Length())
+			expInputGrad := make([]float32, inDims.Length())
+			expWeightsGrad := make([]float32, wDims.Length())
+			expBiasesGrad := make([]float32, bDims.Length())
+
+			for i := range expOutput {
+				oc := (i / (outW * outH)) % tc.outC
+				expOutput[i] = biasesValues[oc]
+				expBiasesGrad[oc] += outputGrad[i]
+			}
+			ref.each(func(iIdx, wIdx, oIdx int) {
+				expOutput[oIdx] += inputValues[iIdx] * weightsValues[wIdx]
+				expInputGrad[iIdx] += outputGrad[oIdx] * weightsValues[wIdx]
+				expWeightsGrad[wIdx] += outputGrad[oIdx] * inputValues[iIdx]
+			})
+
+			requireFloatsInDelta(t, expOutput, output.Data.GetFloats(), "output")
+			requireFloatsInDelta(t, expInputGrad, input.Grad.GetFloats(), "input grad")
+			requireFloatsInDelta(t, expWeightsGrad, weights.Grad.GetFloats(), "weights grad")
+			requireFloatsInDelta(t, expBiasesGrad, biases.Grad.GetFloats(), "biases grad")
+		})
+	}
+}
+
+func TestParams_OutputSize(t *testing.T) {
+	outW, outH := Params{StrideW: 2, StrideH: 2, PaddingW: 1, PaddingH: 1}.OutputSize(7, 7, 4, 4)
+	require.Equal(t, 14, outW)
+	require.Equal(t, 14, outH)
+
+	outW, outH = Params{StrideW: 2, StrideH: 2, PaddingW: 1, PaddingH: 1, OutputPaddingW: 1}.OutputSize(7, 7, 3, 3)
+	require.Equal(t, 14, outW)
+	require.Equal(t, 13, outH)
+}
+
+func requireFloatsInDelta(t *testing.T, expected, actual []float32, msg string) {
+	t.Helper()
+	require.Len(t, actual, len(expected), msg)
+	for i := range expected {
+		require.InDelta(t, float64(expected[i]), float64(actual[i]), 1e-4, "%s[%d]", msg, i)
+	}
+}
@@ -49,9 +49,9 @@ import (
 	_ "embed"
 	"unsafe"
 
-	"github.com/atkhx/metal/mps"
 	"github.com/atkhx/metal/mtl"
 	"github.com/atkhx/metal/nn/num"
+	"github.com/atkhx/metal/nn/ops/philox"
 )
 
 //go:embed kernel.metal
@@ -67,13 +67,7 @@ func New(
 	cKernelString := C.CString(metalFunctions)
 	defer C.free(unsafe.Pointer(cKernelString))
 
-	distribution := mps.CreateMatrixRandomDistributionDescriptor(0, 1)
-	randomizer := mps.CreateMatrixRandomMTGP32(device, distribution, seed)
-
 	maskBuffer := device.NewBufferEmptyFloatsBuffer(input.Dims.Length(), mtl.ResourceStorageModeShared)
-	maskDescriptor := mps.CreateMatrixDescriptorFloat32(input.Dims.W, input.Dims.H, input.Dims.D, input.Dims.W*input.Dims.H)
-
-	maskMatrix := mps.CreateMatrixWithBuffer(maskDescriptor, maskBuffer, 0)
 
 	return &Kernel{
 		kernelID: C.dropoutKernelCreate(device.GetID(), cKernelString),
@@ -82,8 +76,8 @@ func New(
 		input:  input,
 		output: output,
 
-		randomizer:  randomizer,
-		maskMatrix:  maskMatrix,
+		randomizer:  philox.New(device, seed),
+		maskBuffer:  maskBuffer,
 		probability: probability,
 	}
 }
@@ -95,21 +89,37 @@ type Kernel struct {
 	input  *num.Data
 	output *num.Data
 
-	randomizer *mps.MatrixRandomMTGP32
-	maskMatrix *mps.Matrix
+	randomizer *philox.Kernel
+	maskBuffer *mtl.Buffer
 
 	probability float32
+	draws       uint64
 }
 
 func (k *Kernel) Forward(b *mtl.CommandBuffer) {
-	k.randomizer.Encode(b, k.maskMatrix)
+	k.randomizer.Uniform(b, k.maskBuffer, k.draws)
+	k.draws++
+	k.Replay(b)
+}
+
+// Draws returns the number of masks drawn.
+func (k *Kernel) Draws() uint64 {
+	return k.draws
+}
+
+// SetDraws makes the next Forward draw the mask it would draw after draws calls of Forward.
+func (k *Kernel) SetDraws(draws uint64) {
+	k.draws = draws
+}
 
+// Replay applies the mask drawn by the last Forward again.
+func (k *Kernel) Replay(b *mtl.CommandBuffer) {
 	C.dropoutForward(
 		k.kernelID,
 		b.GetID(),
 		k.input.Data.GetID(),
 		k.output.Data.GetID(),
-		k.maskMatrix.GetData().GetID(),
+		k.maskBuffer.GetID(),
 		C.float(k.probability),
 	)
 }
@@ -120,7 +130,7 @@ func (k *Kernel) Backward(b *mtl.CommandBuffer) {
 		b.GetID(),
 		k.input.Grad.GetID(),
 		k.output.Grad.GetID(),
-		k.maskMatrix.GetData().GetID(),
+		k.maskBuffer.GetID(),
 		C.float(k.probability),
 	)
 }
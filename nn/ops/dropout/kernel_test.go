@@ -48,3 +48,44 @@ func TestDropout_InvertedScaling(t *testing.T) {
 		}
 	}
 }
+
+func TestDropout_SetDraws(t *testing.T) {
+	device := mtl.MustCreateSystemDefaultDevice()
+	defer device.Release()
+
+	newData := func() *num.Data {
+		values := make([]float32, 64)
+		for i := range values {
+			values[i] = float32(i + 1)
+		}
+		return &num.Data{
+			Data: device.NewBufferWithFloats(values, mtl.ResourceStorageModeShared),
+			Grad: device.NewBufferEmptyFloatsBuffer(64, mtl.ResourceStorageModeShared),
+			Dims: mtl.NewMTLSize(64),
+		}
+	}
+
+	run := func(draws, forward int) (*Kernel, []float32) {
+		output := newData()
+		kernel := New(device, newData(), output, 0.5, 7)
+
+		cmd := device.NewCommandQueue().GetNewMTLCommandBuffer()
+		defer cmd.Release()
+
+		kernel.SetDraws(uint64(draws))
+		for i := 0; i < forward; i++ {
+			kernel.Forward(cmd)
+		}
+		cmd.Commit()
+		cmd.WaitUntilCompleted()
+
+		return kernel, output.Data.GetFloats()
+	}
+
+	expKernel, expOutput := run(0, 3)
+	actKernel, actOutput := run(2, 1)
+
+	require.Equal(t, uint64(3), expKernel.Draws())
+	require.Equal(t, uint64(3), actKernel.Draws())
+	require.Equal(t, expOutput, actOutput)
+}
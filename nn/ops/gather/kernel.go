@@ -0,0 +1,117 @@
+package gather
+
+/*
+#cgo CFLAGS: -x objective-c
+#cgo LDFLAGS: -framework Metal -framework MetalPerformanceShaders -framework CoreGraphics -framework Foundation
+
+#include "kernel.h"
+
+void* gatherKernelCreate(void *device, const char *kernelSource) {
+    return [[GatherKernelImpl alloc] initWithDevice:(id<MTLDevice>)device
+		kernelSource:[NSString stringWithUTF8String:kernelSource]];
+}
+
+void gatherForward(
+    void *kernel,
+    void *commandBuffer,
+    void *inputData,
+    void *indicesData,
+    void *outputData,
+    GatherParams params
+) {
+    [(__bridge GatherKernelImpl*)kernel forward:(id<MTLCommandBuffer>)commandBuffer
+        inputData:(id<MTLBuffer>)inputData
+        indicesData:(id<MTLBuffer>)indicesData
+        outputData:(id<MTLBuffer>)outputData
+        params:params];
+}
+
+void gatherBackward(
+    void *kernel,
+    void *commandBuffer,
+    void *inputGrad,
+    void *indicesData,
+    void *outputGrad,
+    GatherParams params
+) {
+    [(__bridge GatherKernelImpl*)kernel backward:(id<MTLCommandBuffer>)commandBuffer
+        inputGrad:(id<MTLBuffer>)inputGrad
+        indicesData:(id<MTLBuffer>)indicesData
+        outputGrad:(id<MTLBuffer>)outputGrad
+        params:params];
+}
+*/
+import "C"
+import (
+	_ "embed"
+	"fmt"
+	"unsafe"
+
+	"github.com/atkhx/metal/mtl"
+	"github.com/atkhx/metal/nn/num"
+)
+
+//go:embed kernel.metal
+var metalFunctions string
+
+// New creates kernel which selects rows of input by indices along the middle axis
+// of the [outer][length][inner] view. Indices are stored as floats, out of range ones give zeros.
+// Gradients of rows selected several times are summed, indices get no gradient.
+func New(
+	device *mtl.Device,
+	input *num.Data,
+	indices *num.Data,
+	output *num.Data,
+	outer, length, inner int,
+) *Kernel {
+	count := indices.Dims.Length()
+	if output.Dims.Length() != outer*count*inner {
+		panic(fmt.Sprintf("gather: invalid output length %d, expected %d", output.Dims.Length(), outer*count*inner))
+	}
+
+	cKernelString := C.CString(metalFunctions)
+	defer C.free(unsafe.Pointer(cKernelString))
+
+	return &Kernel{
+		kernelID: C.gatherKernelCreate(device.GetID(), cKernelString),
+		input:    input,
+		indices:  indices,
+		output:   output,
+		params: C.GatherParams{
+			outer:  C.uint(outer),
+			length: C.uint(length),
+			inner:  C.uint(inner),
+			count:  C.uint(count),
+		},
+	}
+}
+
+type Kernel struct {
+	kernelID unsafe.Pointer
+	input    *num.Data
+	indices  *num.Data
+	output   *num.Data
+	params   C.GatherParams
+}
+
+func (k *Kernel) Forward(b *mtl.CommandBuffer) {
+	C.gatherForward(
+		k.kernelID,
+		b.GetID(),
+		k.input.Data.GetID(),
+		k.indices.Data.GetID(),
+		k.output.Data.GetID(),
+		k.params,
+	)
+}
+
+func (k *Kernel) Backward(b *mtl.CommandBuffer) {
+	C.gatherBackward(
+		k.kernelID,
+		b.GetID(),
+		k.input.Grad.GetID(),
+		k.indices.Data.GetID(),
+		k.output.Grad.GetID(),
+		k.params,
+	)
+}
@@ -0,0 +1,36 @@
+#ifndef GatherKernel_h
+#define GatherKernel_h
+
+#import <Foundation/Foundation.h>
+#import <Metal/Metal.h>
+
+typedef struct {
+    uint outer;
+    uint length;
+    uint inner;
+    uint count;
+} GatherParams;
+
+@protocol GatherKernel <NSObject>
+
+- (instancetype) initWithDevice:(id<MTLDevice>)device kernelSource:(NSString*)kernelSource;
+
+- (void) forward:(id<MTLCommandBuffer>)commandBuffer
+        inputData:(id<MTLBuffer>)inputData
+        indicesData:(id<MTLBuffer>)indicesData
+        outputData:(id<MTLBuffer>)outputData
+        params:(GatherParams)params;
+
+- (void) backward:(id<MTLCommandBuffer>)commandBuffer
+        inputGrad:(id<MTLBuffer>)inputGrad
+        indicesData:(id<MTLBuffer>)indicesData
+        outputGrad:(id<MTLBuffer>)outputGrad
+        params:(GatherParams)params;
+
+@end
+
+@interface GatherKernelImpl : NSObject <GatherKernel>
+    @property (nonatomic, strong) id<MTLLibrary> library;
+@end
+
+#endif /* GatherKernel_h */
@@ -0,0 +1,55 @@
+#include <metal_stdlib>
+
+using namespace metal;
+
+// Input is viewed as [outer][length][inner], output as [outer][count][inner]:
+// output row k along the middle axis is input row indices[k].
+struct GatherParams {
+    uint outer;
+    uint length;
+    uint inner;
+    uint count;
+};
+
+kernel void gatherForward(
+    device const float *inputData [[ buffer(0) ]],
+    device const float *indicesData [[ buffer(1) ]],
+    device float *outputData [[ buffer(2) ]],
+    constant GatherParams& p [[ buffer(3) ]],
+    const uint id [[ thread_position_in_grid ]] )
+{
+    if (id >= p.outer * p.count * p.inner) {
+        return;
+    }
+
+    uint o = id / (p.count * p.inner);
+    uint k = (id / p.inner) % p.count;
+    uint i = id % p.inner;
+    uint j = uint(indicesData[k]);
+
+    outputData[id] = j < p.length ? inputData[(o * p.length + j) * p.inner + i] : 0.0;
+}
+
+kernel void gatherBackward(
+    device float *inputGrad [[ buffer(0) ]],
+    device const float *indicesData [[ buffer(1) ]],
+    device const float *outputGrad [[ buffer(2) ]],
+    constant GatherParams& p [[ buffer(3) ]],
+    const uint id [[ thread_position_in_grid ]] )
+{
+    if (id >= p.outer * p.count * p.inner) {
+        return;
+    }
+
+    uint o = id / (p.count * p.inner);
+    uint k = (id / p.inner) % p.count;
+    uint i = id % p.inner;
+    uint j = uint(indicesData[k]);
+    if (j >= p.length) {
+        return;
+    }
+
+    // The same row may be selected several times.
+    device atomic_float* grad = (device atomic_float*)inputGrad;
+    atomic_fetch_add_explicit(&grad[(o * p.length + j) * p.inner + i], outputGrad[id], memory_order_relaxed);
+}
@@ -0,0 +1,107 @@
+package gather
+
+import (
+	"testing"
+
+	"github.com/atkhx/metal/mtl"
+	"github.com/atkhx/metal/nn/num"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKernel(t *testing.T) {
+	device := mtl.MustCreateSystemDefaultDevice()
+	defer device.Release()
+
+	newData := func(values []float32, dims mtl.MTLSize) *num.Data {
+		return &num.Data{
+			Data: device.NewBufferWithFloats(values, mtl.ResourceStorageModeShared),
+			Grad: device.NewBufferEmptyFloatsBuffer(dims.Length(), mtl.ResourceStorageModeShared),
+			Dims: dims,
+		}
+	}
+
+	// (3, 2, 2)
+	inputValues := []float32{
+		0, 1, 2,
+		3, 4, 5,
+
+		6, 7, 8,
+		9, 10, 11,
+	}
+
+	testCases := []struct {
+		name      string
+		indices   []float32
+		outDims   mtl.MTLSize
+		outer     int
+		length    int
+		inner     int
+		expOutput []float32
+		expGrad   []float32
+	}{
+		{
+			name:    "rows with repeats",
+			indices: []float32{1, 1, 0},
+			outDims: mtl.NewMTLSize(3, 3, 2),
+			outer:   2,
+			length:  2,
+			inner:   3,
+			expOutput: []float32{
+				3, 4, 5,
+				3, 4, 5,
+				0, 1, 2,
+
+				9, 10, 11,
+				9, 10, 11,
+				6, 7, 8,
+			},
+			expGrad: []float32{1, 1, 1, 2, 2, 2, 1, 1, 1, 2, 2, 2},
+		},
+		{
+			name:      "last column",
+			indices:   []float32{2},
+			outDims:   mtl.NewMTLSize(1, 2, 2),
+			outer:     4,
+			length:    3,
+			inner:     1,
+			expOutput: []float32{2, 5, 8, 11},
+			expGrad:   []float32{0, 0, 1, 0, 0, 1, 0, 0, 1, 0, 0, 1},
+		},
+		{
+			name:      "depth",
+			indices:   []float32{1},
+			outDims:   mtl.NewMTLSize(3, 2, 1),
+			outer:     1,
+			length:    2,
+			inner:     6,
+			expOutput: []float32{6, 7, 8, 9, 10, 11},
+			expGrad:   []float32{0, 0, 0, 0, 0, 0, 1, 1, 1, 1, 1, 1},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			input := newData(inputValues, mtl.NewMTLSize(3, 2, 2))
+			indices := newData(tc.indices, mtl.NewMTLSize(len(tc.indices)))
+			output := newData(make([]float32, tc.outDims.Length()), tc.outDims)
+
+			outputGrad := output.Grad.GetFloats()
+			for i := range outputGrad {
+				outputGrad[i] = 1
+			}
+
+			kernel := New(device, input, indices, output, tc.outer, tc.length, tc.inner)
+
+			cmd := device.NewCommandQueue().GetNewMTLCommandBuffer()
+			defer cmd.Release()
+			kernel.Forward(cmd)
+			kernel.Backward(cmd)
+			cmd.Commit()
+			cmd.WaitUntilCompleted()
+
+			require.Equal(t, tc.expOutput, output.Data.GetFloats())
+			require.Equal(t, tc.expGrad, input.Grad.GetFloats())
+			require.Equal(t, make([]float32, len(tc.indices)), indices.Grad.GetFloats())
+		})
+	}
+}
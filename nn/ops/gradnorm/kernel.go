@@ -0,0 +1,124 @@
+package gradnorm
+
+/*
+#cgo CFLAGS: -x objective-c
+#cgo LDFLAGS: -framework Metal -framework MetalPerformanceShaders -framework CoreGraphics -framework Foundation
+
+#include "kernel.h"
+
+void* gradNormKernelCreate(void *device, const char *kernelSource) {
+    return [[GradNormKernelImpl alloc] initWithDevice:(id<MTLDevice>)device
+		kernelSource:[NSString stringWithUTF8String:kernelSource]];
+}
+
+void gradNormSumSquares(
+    void *kernel,
+    void *commandBuffer,
+    void *gradBuffer,
+    void *partialBuffer,
+    void *statsBuffer,
+    GradNormParams params
+) {
+    [(__bridge GradNormKernelImpl*)kernel sumSquares:(id<MTLCommandBuffer>)commandBuffer
+        gradBuffer:(id<MTLBuffer>)gradBuffer
+        partialBuffer:(id<MTLBuffer>)partialBuffer
+        statsBuffer:(id<MTLBuffer>)statsBuffer
+        params:params];
+}
+
+void gradNormTotal(
+    void *kernel,
+    void *commandBuffer,
+    void *statsBuffer,
+    GradNormParams params
+) {
+    [(__bridge GradNormKernelImpl*)kernel total:(id<MTLCommandBuffer>)commandBuffer
+        statsBuffer:(id<MTLBuffer>)statsBuffer
+        params:params];
+}
+
+void gradNormScale(
+    void *kernel,
+    void *commandBuffer,
+    void *gradBuffer,
+    void *statsBuffer,
+    GradNormParams params
+) {
+    [(__bridge GradNormKernelImpl*)kernel scale:(id<MTLCommandBuffer>)commandBuffer
+        gradBuffer:(id<MTLBuffer>)gradBuffer
+        statsBuffer:(id<MTLBuffer>)statsBuffer
+        params:params];
+}
+*/
+import "C"
+import (
+	_ "embed"
+	"unsafe"
+
+	"github.com/atkhx/metal/mtl"
+)
+
+//go:embed kernel.metal
+var metalFunctions string
+
+// chunkSize is the number of values summed by one thread, it must match kernel.metal.
+const chunkSize = 256
+
+func New(device *mtl.Device) *Kernel {
+	cKernelString := C.CString(metalFunctions)
+	defer C.free(unsafe.Pointer(cKernelString))
+
+	return &Kernel{
+		kernelID: C.gradNormKernelCreate(device.GetID(), cKernelString),
+	}
+}
+
+type Kernel struct {
+	kernelID unsafe.Pointer
+}
+
+// PartialLength returns the length of the scratch buffer for SumSquares of length values.
+func PartialLength(length int) int {
+	return (length + chunkSize - 1) / chunkSize
+}
+
+// StatsLength returns the length of the stats buffer for count params:
+// sums of squares of every param, the global norm and the clip scale.
+func StatsLength(count int) int {
+	return count + 2
+}
+
+// SumSquares writes the sum of squared values of grad to stats[index].
+// Non-finite values are not filtered, they make the norm non-finite.
+func (k *Kernel) SumSquares(b *mtl.CommandBuffer, grad, partial, stats *mtl.Buffer, length, index int) {
+	C.gradNormSumSquares(
+		k.kernelID,
+		b.GetID(),
+		grad.GetID(),
+		partial.GetID(),
+		stats.GetID(),
+		C.GradNormParams{length: C.uint(length), index: C.uint(index)},
+	)
+}
+
+// Total writes the global norm of count params to stats[count] and the scale clipping it
+// to maxNorm to stats[count+1]. The scale is 1 for maxNorm 0 and for a non-finite norm.
+func (k *Kernel) Total(b *mtl.CommandBuffer, stats *mtl.Buffer, count int, maxNorm float32) {
+	C.gradNormTotal(
+		k.kernelID,
+		b.GetID(),
+		stats.GetID(),
+		C.GradNormParams{count: C.uint(count), maxNorm: C.float(maxNorm)},
+	)
+}
+
+// Scale multiplies grad by the scale computed by Total.
+func (k *Kernel) Scale(b *mtl.CommandBuffer, grad, stats *mtl.Buffer, length, count int) {
+	C.gradNormScale(
+		k.kernelID,
+		b.GetID(),
+		grad.GetID(),
+		stats.GetID(),
+		C.GradNormParams{length: C.uint(length), count: C.uint(count)},
+	)
+}
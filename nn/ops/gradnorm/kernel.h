@@ -0,0 +1,39 @@
+#ifndef GradNormKernel_h
+#define GradNormKernel_h
+
+#import <Foundation/Foundation.h>
+#import <Metal/Metal.h>
+
+typedef struct {
+    uint length;
+    uint index;
+    uint count;
+    float maxNorm;
+} GradNormParams;
+
+@protocol GradNormKernel <NSObject>
+
+- (instancetype) initWithDevice:(id<MTLDevice>)device kernelSource:(NSString*)kernelSource;
+
+- (void) sumSquares:(id<MTLCommandBuffer>)commandBuffer
+        gradBuffer:(id<MTLBuffer>)gradBuffer
+        partialBuffer:(id<MTLBuffer>)partialBuffer
+        statsBuffer:(id<MTLBuffer>)statsBuffer
+        params:(GradNormParams)params;
+
+- (void) total:(id<MTLCommandBuffer>)commandBuffer
+        statsBuffer:(id<MTLBuffer>)statsBuffer
+        params:(GradNormParams)params;
+
+- (void) scale:(id<MTLCommandBuffer>)commandBuffer
+        gradBuffer:(id<MTLBuffer>)gradBuffer
+        statsBuffer:(id<MTLBuffer>)statsBuffer
+        params:(GradNormParams)params;
+
+@end
+
+@interface GradNormKernelImpl : NSObject <GradNormKernel>
+    @property (nonatomic, strong) id<MTLLibrary> library;
+@end
+
+#endif /* GradNormKernel_h */
@@ -0,0 +1,109 @@
+#import "kernel.h"
+#import <Foundation/Foundation.h>
+#include <stdio.h>
+
+// Must match chunkSize in kernel.metal.
+static const NSUInteger chunkSize = 256;
+
+static inline MTLSize threadgroupSize1D(id<MTLComputePipelineState> pso) {
+    NSUInteger w = pso.threadExecutionWidth;
+    NSUInteger max = pso.maxTotalThreadsPerThreadgroup;
+    if (w > max) {
+        w = max;
+    }
+    return MTLSizeMake(w, 1, 1);
+}
+
+@implementation GradNormKernelImpl {
+    id<MTLDevice> _device;
+
+    id<MTLComputePipelineState> _partialPSO;
+    id<MTLComputePipelineState> _collectPSO;
+    id<MTLComputePipelineState> _totalPSO;
+    id<MTLComputePipelineState> _scalePSO;
+
+    NSError *error;
+}
+
+- (id<MTLComputePipelineState>)createPipelineStateWithFunctionName:(NSString *)functionName {
+    id<MTLFunction> function = [self.library newFunctionWithName:functionName];
+    if (!function) {
+        printf("Failed to load function %s!\n", [functionName UTF8String]);
+        return nil;
+    }
+
+    id<MTLComputePipelineState> pipelineState = [_device newComputePipelineStateWithFunction:function error:&error];
+    if (error != nil) {
+        const char *errorCString = [[error localizedDescription] UTF8String];
+        printf("Failed to create pipeline state: %s\n", errorCString);
+        return nil;
+    }
+    return pipelineState;
+}
+
+- (instancetype)initWithDevice:(id<MTLDevice>)device kernelSource:(NSString*)kernelSource {
+    self = [super init];
+    if (self) {
+        _device = device;
+
+        self.library = [_device newLibraryWithSource:kernelSource options:nil error:&error];
+
+        _partialPSO = [self createPipelineStateWithFunctionName:@"gradNormPartial"];
+        _collectPSO = [self createPipelineStateWithFunctionName:@"gradNormCollect"];
+        _totalPSO = [self createPipelineStateWithFunctionName:@"gradNormTotal"];
+        _scalePSO = [self createPipelineStateWithFunctionName:@"gradNormScale"];
+    }
+    return self;
+}
+
+// All passes share the same buffer indices, so every pass gets all of them.
+- (void) encode:(id<MTLCommandBuffer>)commandBuffer
+        pso:(id<MTLComputePipelineState>)pso
+        threads:(NSUInteger)threads
+        gradBuffer:(id<MTLBuffer>)gradBuffer
+        partialBuffer:(id<MTLBuffer>)partialBuffer
+        statsBuffer:(id<MTLBuffer>)statsBuffer
+        params:(GradNormParams)params
+{
+    id<MTLComputeCommandEncoder> encoder = [commandBuffer computeCommandEncoder];
+    [encoder setComputePipelineState:pso];
+    [encoder setBuffer:gradBuffer offset:0 atIndex:0];
+    [encoder setBuffer:partialBuffer offset:0 atIndex:1];
+    [encoder setBuffer:statsBuffer offset:0 atIndex:2];
+    [encoder setBytes:&params length:sizeof(GradNormParams) atIndex:3];
+    [encoder dispatchThreads:MTLSizeMake(threads, 1, 1) threadsPerThreadgroup:threadgroupSize1D(pso)];
+    [encoder endEncoding];
+}
+
+- (void) sumSquares:(id<MTLCommandBuffer>)commandBuffer
+        gradBuffer:(id<MTLBuffer>)gradBuffer
+        partialBuffer:(id<MTLBuffer>)partialBuffer
+        statsBuffer:(id<MTLBuffer>)statsBuffer
+        params:(GradNormParams)params
+{
+    NSUInteger chunks = (params.length + chunkSize - 1) / chunkSize;
+
+    [self encode:commandBuffer pso:_partialPSO threads:chunks
+        gradBuffer:gradBuffer partialBuffer:partialBuffer statsBuffer:statsBuffer params:params];
+    [self encode:commandBuffer pso:_collectPSO threads:1
+        gradBuffer:gradBuffer partialBuffer:partialBuffer statsBuffer:statsBuffer params:params];
+}
+
+- (void) total:(id<MTLCommandBuffer>)commandBuffer
+        statsBuffer:(id<MTLBuffer>)statsBuffer
+        params:(GradNormParams)params
+{
+    [self encode:commandBuffer pso:_totalPSO threads:1
+        gradBuffer:nil partialBuffer:nil statsBuffer:statsBuffer params:params];
+}
+
+- (void) scale:(id<MTLCommandBuffer>)commandBuffer
+        gradBuffer:(id<MTLBuffer>)gradBuffer
+        statsBuffer:(id<MTLBuffer>)statsBuffer
+        params:(GradNormParams)params
+{
+    [self encode:commandBuffer pso:_scalePSO threads:params.length
+        gradBuffer:gradBuffer partialBuffer:nil statsBuffer:statsBuffer params:params];
+}
+
+@end
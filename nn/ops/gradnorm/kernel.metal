@@ -0,0 +1,73 @@
+#include <metal_stdlib>
+
+using namespace metal;
+
+// Stats hold sums of squared gradients of count params, then the global norm
+// and the scale gradients are multiplied by to clip them.
+struct GradNormParams {
+    uint length;
+    uint index;
+    uint count;
+    float maxNorm;
+};
+
+constant uint chunkSize = 256;
+
+kernel void gradNormPartial(
+    device const float *gradBuffer [[ buffer(0) ]],
+    device float *partialBuffer [[ buffer(1) ]],
+    constant GradNormParams& p [[ buffer(3) ]],
+    const uint id [[ thread_position_in_grid ]] )
+{
+    uint end = min((id + 1) * chunkSize, p.length);
+
+    float sum = 0.0;
+    for (uint i = id * chunkSize; i < end; i++) {
+        sum += gradBuffer[i] * gradBuffer[i];
+    }
+    partialBuffer[id] = sum;
+}
+
+kernel void gradNormCollect(
+    device const float *partialBuffer [[ buffer(1) ]],
+    device float *statsBuffer [[ buffer(2) ]],
+    constant GradNormParams& p [[ buffer(3) ]],
+    const uint id [[ thread_position_in_grid ]] )
+{
+    uint chunks = (p.length + chunkSize - 1) / chunkSize;
+
+    float sum = 0.0;
+    for (uint i = 0; i < chunks; i++) {
+        sum += partialBuffer[i];
+    }
+    statsBuffer[p.index] = sum;
+}
+
+// Non-finite norms are not clipped: the step is expected to be skipped.
+kernel void gradNormTotal(
+    device float *statsBuffer [[ buffer(2) ]],
+    constant GradNormParams& p [[ buffer(3) ]],
+    const uint id [[ thread_position_in_grid ]] )
+{
+    float sum = 0.0;
+    for (uint i = 0; i < p.count; i++) {
+        sum += statsBuffer[i];
+    }
+    float norm = sqrt(sum);
+
+    float scale = 1.0;
+    if (p.maxNorm > 0 && isfinite(norm) && norm > p.maxNorm) {
+        scale = p.maxNorm / (norm + 1e-6);
+    }
+    statsBuffer[p.count] = norm;
+    statsBuffer[p.count + 1] = scale;
+}
+
+kernel void gradNormScale(
+    device float *gradBuffer [[ buffer(0) ]],
+    device const float *statsBuffer [[ buffer(2) ]],
+    constant GradNormParams& p [[ buffer(3) ]],
+    const uint id [[ thread_position_in_grid ]] )
+{
+    gradBuffer[id] *= statsBuffer[p.count + 1];
+}
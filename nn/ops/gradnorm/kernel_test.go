@@ -0,0 +1,112 @@
+package gradnorm
+
+import (
+	"math"
+	"testing"
+
+	"github.com/atkhx/metal/mtl"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKernel(t *testing.T) {
+	device := mtl.MustCreateSystemDefaultDevice()
+	defer device.Release()
+
+	kernel := New(device)
+
+	// the long gradient spans several chunks
+	long := make([]float32, 1000)
+	for i := range long {
+		long[i] = 0.1
+	}
+
+	testCases := []struct {
+		name      string
+		maxNorm   float32
+		grads     [][]float32
+		expStats  []float32
+		expScaled [][]float32
+	}{
+		{
+			name:      "no clipping",
+			grads:     [][]float32{{3, 4}, {12}},
+			expStats:  []float32{25, 144, 13, 1},
+			expScaled: [][]float32{{3, 4}, {12}},
+		},
+		{
+			name:      "clipping",
+			maxNorm:   6.5,
+			grads:     [][]float32{{3, 4}, {12}},
+			expStats:  []float32{25, 144, 13, 0.5},
+			expScaled: [][]float32{{1.5, 2}, {6}},
+		},
+		{
+			name:      "norm below max",
+			maxNorm:   20,
+			grads:     [][]float32{{3, 4}, {12}},
+			expStats:  []float32{25, 144, 13, 1},
+			expScaled: [][]float32{{3, 4}, {12}},
+		},
+		{
+			name:      "several chunks",
+			grads:     [][]float32{long},
+			expStats:  []float32{10, float32(math.Sqrt(10)), 1},
+			expScaled: [][]float32{long},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			count := len(tc.grads)
+			stats := device.NewBufferEmptyFloatsBuffer(StatsLength(count), mtl.ResourceStorageModeShared)
+			partial := device.NewBufferEmptyFloatsBuffer(PartialLength(1000), mtl.ResourceStorageModeShared)
+
+			grads := make([]*mtl.Buffer, count)
+			for i, values := range tc.grads {
+				grads[i] = device.NewBufferWithFloats(values, mtl.ResourceStorageModeShared)
+			}
+
+			cmd := device.NewCommandQueue().GetNewMTLCommandBuffer()
+			defer cmd.Release()
+
+			for i, grad := range grads {
+				kernel.SumSquares(cmd, grad, partial, stats, len(tc.grads[i]), i)
+			}
+			kernel.Total(cmd, stats, count, tc.maxNorm)
+			for i, grad := range grads {
+				kernel.Scale(cmd, grad, stats, len(tc.grads[i]), count)
+			}
+			cmd.Commit()
+			cmd.WaitUntilCompleted()
+
+			require.InDeltaSlice(t, tc.expStats, stats.GetFloats(), 1e-4)
+			for i, grad := range grads {
+				require.InDeltaSlice(t, tc.expScaled[i], grad.GetFloats(), 1e-5)
+			}
+		})
+	}
+}
+
+func TestKernel_NonFinite(t *testing.T) {
+	device := mtl.MustCreateSystemDefaultDevice()
+	defer device.Release()
+
+	kernel := New(device)
+
+	grad := device.NewBufferWithFloats([]float32{1, float32(math.Inf(1))}, mtl.ResourceStorageModeShared)
+	partial := device.NewBufferEmptyFloatsBuffer(PartialLength(2), mtl.ResourceStorageModeShared)
+	stats := device.NewBufferEmptyFloatsBuffer(StatsLength(1), mtl.ResourceStorageModeShared)
+
+	cmd := device.NewCommandQueue().GetNewMTLCommandBuffer()
+	defer cmd.Release()
+
+	kernel.SumSquares(cmd, grad, partial, stats, 2, 0)
+	kernel.Total(cmd, stats, 1, 1)
+	kernel.Scale(cmd, grad, stats, 2, 1)
+	cmd.Commit()
+	cmd.WaitUntilCompleted()
+
+	require.True(t, math.IsInf(float64(stats.GetFloats()[1]), 1))
+	require.Equal(t, float32(1), stats.GetFloats()[2])
+	require.Equal(t, float32(1), grad.GetFloats()[0])
+}
@@ -0,0 +1,187 @@
+package groupnorm
+
+/*
+#cgo CFLAGS: -x objective-c
+#cgo LDFLAGS: -framework Metal -framework MetalPerformanceShaders -framework CoreGraphics -framework Foundation
+
+#include "kernel.h"
+
+void* groupNormKernelCreate(void *device, const char *kernelSource) {
+    return [[GroupNormKernelImpl alloc] initWithDevice:(id<MTLDevice>)device
+		kernelSource:[NSString stringWithUTF8String:kernelSource]];
+}
+
+void groupNormForward(
+    void *kernel,
+    void *commandBuffer,
+    void *inputData,
+    void *outputData,
+    void *gammaData,
+    void *betaData,
+    void *meanData,
+    void *invStdData,
+    uint plane,
+    uint channels,
+    uint channelsPerGroup,
+    uint batchSize,
+    float eps
+) {
+    [(__bridge GroupNormKernelImpl*)kernel forward:(id<MTLCommandBuffer>)commandBuffer
+        inputData:(id<MTLBuffer>)inputData
+        outputData:(id<MTLBuffer>)outputData
+        gammaData:(id<MTLBuffer>)gammaData
+        betaData:(id<MTLBuffer>)betaData
+        meanData:(id<MTLBuffer>)meanData
+        invStdData:(id<MTLBuffer>)invStdData
+        plane:plane
+        channels:channels
+        channelsPerGroup:channelsPerGroup
+        batchSize:batchSize
+        eps:eps];
+}
+
+void groupNormBackward(
+    void *kernel,
+    void *commandBuffer,
+    void *inputData,
+    void *inputGrad,
+    void *outputGrad,
+    void *gammaData,
+    void *gammaGrad,
+    void *betaGrad,
+    void *meanData,
+    void *invStdData,
+    void *sumDy,
+    void *sumDyXHat,
+    uint plane,
+    uint channels,
+    uint channelsPerGroup,
+    uint batchSize
+) {
+    [(__bridge GroupNormKernelImpl*)kernel backward:(id<MTLCommandBuffer>)commandBuffer
+        inputData:(id<MTLBuffer>)inputData
+        inputGrad:(id<MTLBuffer>)inputGrad
+        outputGrad:(id<MTLBuffer>)outputGrad
+        gammaData:(id<MTLBuffer>)gammaData
+        gammaGrad:(id<MTLBuffer>)gammaGrad
+        betaGrad:(id<MTLBuffer>)betaGrad
+        meanData:(id<MTLBuffer>)meanData
+        invStdData:(id<MTLBuffer>)invStdData
+        sumDy:(id<MTLBuffer>)sumDy
+        sumDyXHat:(id<MTLBuffer>)sumDyXHat
+        plane:plane
+        channels:channels
+        channelsPerGroup:channelsPerGroup
+        batchSize:batchSize];
+}
+*/
+import "C"
+import (
+	_ "embed"
+	"unsafe"
+
+	"github.com/atkhx/metal/mtl"
+	"github.com/atkhx/metal/nn/num"
+)
+
+//go:embed kernel.metal
+var metalFunctions string
+
+// New creates group normalization over [W, H, channels*batchSize] input.
+// Channels of every batch item are split into groupsCount groups normalized independently,
+// gamma and beta are applied per channel.
+func New(
+	device *mtl.Device,
+	input *num.Data,
+	output *num.Data,
+	gamma *num.Data,
+	beta *num.Data,
+	groupsCount int,
+	batchSize int,
+	eps float32,
+) *Kernel {
+	cKernelString := C.CString(metalFunctions)
+	defer C.free(unsafe.Pointer(cKernelString))
+
+	channels := input.Dims.D / batchSize
+
+	newBuffer := func() *mtl.Buffer {
+		return device.NewBufferEmptyFloatsBuffer(groupsCount*batchSize, mtl.ResourceStorageModeShared)
+	}
+
+	return &Kernel{
+		kernelID:         C.groupNormKernelCreate(device.GetID(), cKernelString),
+		input:            input,
+		output:           output,
+		gamma:            gamma,
+		beta:             beta,
+		mean:             newBuffer(),
+		invStd:           newBuffer(),
+		sumDy:            newBuffer(),
+		sumDyXHat:        newBuffer(),
+		plane:            input.Dims.W * input.Dims.H,
+		channels:         channels,
+		channelsPerGroup: channels / groupsCount,
+		batchSize:        batchSize,
+		eps:              eps,
+	}
+}
+
+type Kernel struct {
+	kernelID unsafe.Pointer
+
+	input  *num.Data
+	output *num.Data
+	gamma  *num.Data
+	beta   *num.Data
+
+	mean      *mtl.Buffer
+	invStd    *mtl.Buffer
+	sumDy     *mtl.Buffer
+	sumDyXHat *mtl.Buffer
+
+	plane            int
+	channels         int
+	channelsPerGroup int
+	batchSize        int
+	eps              float32
+}
+
+func (k *Kernel) Forward(b *mtl.CommandBuffer) {
+	C.groupNormForward(
+		k.kernelID,
+		b.GetID(),
+		k.input.Data.GetID(),
+		k.output.Data.GetID(),
+		k.gamma.Data.GetID(),
+		k.beta.Data.GetID(),
+		k.mean.GetID(),
+		k.invStd.GetID(),
+		C.uint(k.plane),
+		C.uint(k.channels),
+		C.uint(k.channelsPerGroup),
+		C.uint(k.batchSize),
+		C.float(k.eps),
+	)
+}
+
+func (k *Kernel) Backward(b *mtl.CommandBuffer) {
+	C.groupNormBackward(
+		k.kernelID,
+		b.GetID(),
+		k.input.Data.GetID(),
+		k.input.Grad.GetID(),
+		k.output.Grad.GetID(),
+		k.gamma.Data.GetID(),
+		k.gamma.Grad.GetID(),
+		k.beta.Grad.GetID(),
+		k.mean.GetID(),
+		k.invStd.GetID(),
+		k.sumDy.GetID(),
+		k.sumDyXHat.GetID(),
+		C.uint(k.plane),
+		C.uint(k.channels),
+		C.uint(k.channelsPerGroup),
+		C.uint(k.batchSize),
+	)
+}
@@ -0,0 +1,46 @@
+#ifndef GroupNormKernel_h
+#define GroupNormKernel_h
+
+#import <Foundation/Foundation.h>
+#import <Metal/Metal.h>
+
+@protocol GroupNormKernel <NSObject>
+
+- (instancetype) initWithDevice:(id<MTLDevice>)device kernelSource:(NSString*)kernelSource;
+
+- (void) forward:(id<MTLCommandBuffer>)commandBuffer
+        inputData:(id<MTLBuffer>)inputData
+        outputData:(id<MTLBuffer>)outputData
+        gammaData:(id<MTLBuffer>)gammaData
+        betaData:(id<MTLBuffer>)betaData
+        meanData:(id<MTLBuffer>)meanData
+        invStdData:(id<MTLBuffer>)invStdData
+        plane:(uint)plane
+        channels:(uint)channels
+        channelsPerGroup:(uint)channelsPerGroup
+        batchSize:(uint)batchSize
+        eps:(float)eps;
+
+- (void) backward:(id<MTLCommandBuffer>)commandBuffer
+        inputData:(id<MTLBuffer>)inputData
+        inputGrad:(id<MTLBuffer>)inputGrad
+        outputGrad:(id<MTLBuffer>)outputGrad
+        gammaData:(id<MTLBuffer>)gammaData
+        gammaGrad:(id<MTLBuffer>)gammaGrad
+        betaGrad:(id<MTLBuffer>)betaGrad
+        meanData:(id<MTLBuffer>)meanData
+        invStdData:(id<MTLBuffer>)invStdData
+        sumDy:(id<MTLBuffer>)sumDy
+        sumDyXHat:(id<MTLBuffer>)sumDyXHat
+        plane:(uint)plane
+        channels:(uint)channels
+        channelsPerGroup:(uint)channelsPerGroup
+        batchSize:(uint)batchSize;
+
+@end
+
+@interface GroupNormKernelImpl : NSObject <GroupNormKernel>
+    @property (nonatomic, strong) id<MTLLibrary> library;
+@end
+
+#endif /* GroupNormKernel_h */
@@ -0,0 +1,194 @@
+#import "kernel.h"
+#import <Foundation/Foundation.h>
+#include <stdio.h>
+
+static inline MTLSize threadgroupSize2D(id<MTLComputePipelineState> pso) {
+    NSUInteger w = pso.threadExecutionWidth;
+    NSUInteger max = pso.maxTotalThreadsPerThreadgroup;
+    NSUInteger h = max / w;
+    if (h < 1) {
+        h = 1;
+    }
+    return MTLSizeMake(w, h, 1);
+}
+
+static inline MTLSize threadgroupSize1D(id<MTLComputePipelineState> pso) {
+    NSUInteger w = pso.threadExecutionWidth;
+    NSUInteger max = pso.maxTotalThreadsPerThreadgroup;
+    if (w > max) {
+        w = max;
+    }
+    return MTLSizeMake(w, 1, 1);
+}
+
+static inline NSUInteger pow2Down(NSUInteger x) {
+    NSUInteger p = 1;
+    while ((p << 1) <= x) {
+        p <<= 1;
+    }
+    return p;
+}
+
+static inline MTLSize threadgroupSizeRowReduce(id<MTLComputePipelineState> pso) {
+    NSUInteger max = pso.maxTotalThreadsPerThreadgroup;
+    if (max > 256) {
+        max = 256;
+    }
+    NSUInteger w = pow2Down(max);
+    return MTLSizeMake(w, 1, 1);
+}
+
+@implementation GroupNormKernelImpl {
+    id<MTLDevice> _device;
+
+    id<MTLComputePipelineState> _statsPSO;
+    id<MTLComputePipelineState> _normalizePSO;
+    id<MTLComputePipelineState> _groupGradsPSO;
+    id<MTLComputePipelineState> _paramsGradsPSO;
+    id<MTLComputePipelineState> _inputGradsPSO;
+
+    NSError *error;
+}
+
+- (id<MTLComputePipelineState>)createPipelineStateWithFunctionName:(NSString *)functionName {
+    id<MTLFunction> function = [self.library newFunctionWithName:functionName];
+    if (!function) {
+        printf("Failed to load function %s!\n", [functionName UTF8String]);
+        return nil;
+    }
+
+    id<MTLComputePipelineState> pipelineState = [_device newComputePipelineStateWithFunction:function error:&error];
+    if (error != nil) {
+        const char *errorCString = [[error localizedDescription] UTF8String];
+        printf("Failed to create pipeline state: %s\n", errorCString);
+        return nil;
+    }
+    return pipelineState;
+}
+
+- (instancetype)initWithDevice:(id<MTLDevice>)device kernelSource:(NSString*)kernelSource {
+    self = [super init];
+    if (self) {
+        _device = device;
+
+        self.library = [_device newLibraryWithSource:kernelSource options:nil error:&error];
+
+        _statsPSO = [self createPipelineStateWithFunctionName:@"groupNormStats"];
+        _normalizePSO = [self createPipelineStateWithFunctionName:@"groupNormNormalize"];
+        _groupGradsPSO = [self createPipelineStateWithFunctionName:@"groupNormGroupGrads"];
+        _paramsGradsPSO = [self createPipelineStateWithFunctionName:@"groupNormParamsGrads"];
+        _inputGradsPSO = [self createPipelineStateWithFunctionName:@"groupNormInputGrads"];
+    }
+    return self;
+}
+
+- (void) forward:(id<MTLCommandBuffer>)commandBuffer
+        inputData:(id<MTLBuffer>)inputData
+        outputData:(id<MTLBuffer>)outputData
+        gammaData:(id<MTLBuffer>)gammaData
+        betaData:(id<MTLBuffer>)betaData
+        meanData:(id<MTLBuffer>)meanData
+        invStdData:(id<MTLBuffer>)invStdData
+        plane:(uint)plane
+        channels:(uint)channels
+        channelsPerGroup:(uint)channelsPerGroup
+        batchSize:(uint)batchSize
+        eps:(float)eps
+{
+    uint groupSize = channelsPerGroup * plane;
+    uint groupsCount = (channels / channelsPerGroup) * batchSize;
+
+    id<MTLComputeCommandEncoder> stats = [commandBuffer computeCommandEncoder];
+    [stats setComputePipelineState:_statsPSO];
+    [stats setBuffer:inputData offset:0 atIndex:0];
+    [stats setBuffer:meanData offset:0 atIndex:1];
+    [stats setBuffer:invStdData offset:0 atIndex:2];
+    [stats setBytes:&groupSize length:sizeof(uint) atIndex:3];
+    [stats setBytes:&eps length:sizeof(float) atIndex:4];
+    MTLSize tg = threadgroupSizeRowReduce(_statsPSO);
+    [stats dispatchThreads:MTLSizeMake(tg.width, groupsCount, 1) threadsPerThreadgroup:tg];
+    [stats endEncoding];
+
+    id<MTLComputeCommandEncoder> normalize = [commandBuffer computeCommandEncoder];
+    [normalize setComputePipelineState:_normalizePSO];
+    [normalize setBuffer:inputData offset:0 atIndex:0];
+    [normalize setBuffer:outputData offset:0 atIndex:1];
+    [normalize setBuffer:gammaData offset:0 atIndex:2];
+    [normalize setBuffer:betaData offset:0 atIndex:3];
+    [normalize setBuffer:meanData offset:0 atIndex:4];
+    [normalize setBuffer:invStdData offset:0 atIndex:5];
+    [normalize setBytes:&plane length:sizeof(uint) atIndex:6];
+    [normalize setBytes:&channels length:sizeof(uint) atIndex:7];
+    [normalize setBytes:&channelsPerGroup length:sizeof(uint) atIndex:8];
+    [normalize dispatchThreads:MTLSizeMake(plane, channels * batchSize, 1) threadsPerThreadgroup:threadgroupSize2D(_normalizePSO)];
+    [normalize endEncoding];
+}
+
+- (void) backward:(id<MTLCommandBuffer>)commandBuffer
+        inputData:(id<MTLBuffer>)inputData
+        inputGrad:(id<MTLBuffer>)inputGrad
+        outputGrad:(id<MTLBuffer>)outputGrad
+        gammaData:(id<MTLBuffer>)gammaData
+        gammaGrad:(id<MTLBuffer>)gammaGrad
+        betaGrad:(id<MTLBuffer>)betaGrad
+        meanData:(id<MTLBuffer>)meanData
+        invStdData:(id<MTLBuffer>)invStdData
+        sumDy:(id<MTLBuffer>)sumDy
+        sumDyXHat:(id<MTLBuffer>)sumDyXHat
+        plane:(uint)plane
+        channels:(uint)channels
+        channelsPerGroup:(uint)channelsPerGroup
+        batchSize:(uint)batchSize
+{
+    uint groupsCount = (channels / channelsPerGroup) * batchSize;
+
+    id<MTLComputeCommandEncoder> groupGrads = [commandBuffer computeCommandEncoder];
+    [groupGrads setComputePipelineState:_groupGradsPSO];
+    [groupGrads setBuffer:inputData offset:0 atIndex:0];
+    [groupGrads setBuffer:outputGrad offset:0 atIndex:1];
+    [groupGrads setBuffer:gammaData offset:0 atIndex:2];
+    [groupGrads setBuffer:meanData offset:0 atIndex:3];
+    [groupGrads setBuffer:invStdData offset:0 atIndex:4];
+    [groupGrads setBuffer:sumDy offset:0 atIndex:5];
+    [groupGrads setBuffer:sumDyXHat offset:0 atIndex:6];
+    [groupGrads setBytes:&plane length:sizeof(uint) atIndex:7];
+    [groupGrads setBytes:&channels length:sizeof(uint) atIndex:8];
+    [groupGrads setBytes:&channelsPerGroup length:sizeof(uint) atIndex:9];
+    MTLSize tg = threadgroupSizeRowReduce(_groupGradsPSO);
+    [groupGrads dispatchThreads:MTLSizeMake(tg.width, groupsCount, 1) threadsPerThreadgroup:tg];
+    [groupGrads endEncoding];
+
+    id<MTLComputeCommandEncoder> paramsGrads = [commandBuffer computeCommandEncoder];
+    [paramsGrads setComputePipelineState:_paramsGradsPSO];
+    [paramsGrads setBuffer:inputData offset:0 atIndex:0];
+    [paramsGrads setBuffer:outputGrad offset:0 atIndex:1];
+    [paramsGrads setBuffer:meanData offset:0 atIndex:2];
+    [paramsGrads setBuffer:invStdData offset:0 atIndex:3];
+    [paramsGrads setBuffer:gammaGrad offset:0 atIndex:4];
+    [paramsGrads setBuffer:betaGrad offset:0 atIndex:5];
+    [paramsGrads setBytes:&plane length:sizeof(uint) atIndex:6];
+    [paramsGrads setBytes:&channels length:sizeof(uint) atIndex:7];
+    [paramsGrads setBytes:&channelsPerGroup length:sizeof(uint) atIndex:8];
+    [paramsGrads setBytes:&batchSize length:sizeof(uint) atIndex:9];
+    tg = threadgroupSizeRowReduce(_paramsGradsPSO);
+    [paramsGrads dispatchThreads:MTLSizeMake(tg.width, channels, 1) threadsPerThreadgroup:tg];
+    [paramsGrads endEncoding];
+
+    id<MTLComputeCommandEncoder> inputGrads = [commandBuffer computeCommandEncoder];
+    [inputGrads setComputePipelineState:_inputGradsPSO];
+    [inputGrads setBuffer:inputData offset:0 atIndex:0];
+    [inputGrads setBuffer:inputGrad offset:0 atIndex:1];
+    [inputGrads setBuffer:outputGrad offset:0 atIndex:2];
+    [inputGrads setBuffer:gammaData offset:0 atIndex:3];
+    [inputGrads setBuffer:meanData offset:0 atIndex:4];
+    [inputGrads setBuffer:invStdData offset:0 atIndex:5];
+    [inputGrads setBuffer:sumDy offset:0 atIndex:6];
+    [inputGrads setBuffer:sumDyXHat offset:0 atIndex:7];
+    [inputGrads setBytes:&plane length:sizeof(uint) atIndex:8];
+    [inputGrads setBytes:&channels length:sizeof(uint) atIndex:9];
+    [inputGrads setBytes:&channelsPerGroup length:sizeof(uint) atIndex:10];
+    [inputGrads dispatchThreads:MTLSizeMake(plane, channels * batchSize, 1) threadsPerThreadgroup:threadgroupSize2D(_inputGradsPSO)];
+    [inputGrads endEncoding];
+}
+
+@end
@@ -0,0 +1,179 @@
+#include <metal_stdlib>
+
+using namespace metal;
+
+// Layout: [batch][channels][plane], plane = W*H.
+// Channels of one batch item are split into groups, each group is normalized
+// over its channels and plane. A group is a contiguous block of groupSize = channelsPerGroup*plane floats.
+
+static float threadgroupSum(threadgroup float *buf, float value, uint tid, uint tgs) {
+    buf[tid] = value;
+    threadgroup_barrier(mem_flags::mem_threadgroup);
+
+    for (uint s = tgs / 2; s > 0; s >>= 1) {
+        if (tid < s) {
+            buf[tid] += buf[tid + s];
+        }
+        threadgroup_barrier(mem_flags::mem_threadgroup);
+    }
+
+    float result = buf[0];
+    threadgroup_barrier(mem_flags::mem_threadgroup);
+    return result;
+}
+
+kernel void groupNormStats(
+    device const float *inputData [[ buffer(0) ]],
+    device float *meanData [[ buffer(1) ]],
+    device float *invStdData [[ buffer(2) ]],
+    constant uint& groupSize [[ buffer(3) ]],
+    constant float& eps [[ buffer(4) ]],
+    const uint2 gid [[ thread_position_in_grid ]],
+    const uint2 tid [[ thread_position_in_threadgroup ]],
+    const uint2 tgs [[ threads_per_threadgroup ]] )
+{
+    uint group = gid.y;
+    uint start = group * groupSize;
+    threadgroup float sumBuf[256];
+
+    float sum = 0.0;
+    for (uint i = tid.x; i < groupSize; i += tgs.x) {
+        sum += inputData[start + i];
+    }
+    float mean = threadgroupSum(sumBuf, sum, tid.x, tgs.x) / float(groupSize);
+
+    float sq = 0.0;
+    for (uint i = tid.x; i < groupSize; i += tgs.x) {
+        float d = inputData[start + i] - mean;
+        sq += d * d;
+    }
+    float var = threadgroupSum(sumBuf, sq, tid.x, tgs.x) / float(groupSize);
+
+    if (tid.x == 0) {
+        meanData[group] = mean;
+        invStdData[group] = rsqrt(var + eps);
+    }
+}
+
+kernel void groupNormNormalize(
+    device const float *inputData [[ buffer(0) ]],
+    device float *outputData [[ buffer(1) ]],
+    device const float *gammaData [[ buffer(2) ]],
+    device const float *betaData [[ buffer(3) ]],
+    device const float *meanData [[ buffer(4) ]],
+    device const float *invStdData [[ buffer(5) ]],
+    constant uint& plane [[ buffer(6) ]],
+    constant uint& channels [[ buffer(7) ]],
+    constant uint& channelsPerGroup [[ buffer(8) ]],
+    const uint2 gid [[ thread_position_in_grid ]] )
+{
+    uint c = gid.y % channels;
+    uint group = gid.y / channelsPerGroup;
+    uint idx = gid.y * plane + gid.x;
+    outputData[idx] = gammaData[c] * (inputData[idx] - meanData[group]) * invStdData[group] + betaData[c];
+}
+
+kernel void groupNormGroupGrads(
+    device const float *inputData [[ buffer(0) ]],
+    device const float *outputGrad [[ buffer(1) ]],
+    device const float *gammaData [[ buffer(2) ]],
+    device const float *meanData [[ buffer(3) ]],
+    device const float *invStdData [[ buffer(4) ]],
+    device float *sumDy [[ buffer(5) ]],
+    device float *sumDyXHat [[ buffer(6) ]],
+    constant uint& plane [[ buffer(7) ]],
+    constant uint& channels [[ buffer(8) ]],
+    constant uint& channelsPerGroup [[ buffer(9) ]],
+    const uint2 gid [[ thread_position_in_grid ]],
+    const uint2 tid [[ thread_position_in_threadgroup ]],
+    const uint2 tgs [[ threads_per_threadgroup ]] )
+{
+    uint group = gid.y;
+    uint groupSize = channelsPerGroup * plane;
+    uint start = group * groupSize;
+    uint firstChannel = (group * channelsPerGroup) % channels;
+    threadgroup float sumBuf[256];
+
+    float mean = meanData[group];
+    float invStd = invStdData[group];
+
+    float dy = 0.0;
+    float dyXHat = 0.0;
+    for (uint i = tid.x; i < groupSize; i += tgs.x) {
+        float g = outputGrad[start + i] * gammaData[firstChannel + i / plane];
+        dy += g;
+        dyXHat += g * (inputData[start + i] - mean) * invStd;
+    }
+    dy = threadgroupSum(sumBuf, dy, tid.x, tgs.x);
+    dyXHat = threadgroupSum(sumBuf, dyXHat, tid.x, tgs.x);
+
+    if (tid.x == 0) {
+        sumDy[group] = dy;
+        sumDyXHat[group] = dyXHat;
+    }
+}
+
+kernel void groupNormParamsGrads(
+    device const float *inputData [[ buffer(0) ]],
+    device const float *outputGrad [[ buffer(1) ]],
+    device const float *meanData [[ buffer(2) ]],
+    device const float *invStdData [[ buffer(3) ]],
+    device float *gammaGrad [[ buffer(4) ]],
+    device float *betaGrad [[ buffer(5) ]],
+    constant uint& plane [[ buffer(6) ]],
+    constant uint& channels [[ buffer(7) ]],
+    constant uint& channelsPerGroup [[ buffer(8) ]],
+    constant uint& batchSize [[ buffer(9) ]],
+    const uint2 gid [[ thread_position_in_grid ]],
+    const uint2 tid [[ thread_position_in_threadgroup ]],
+    const uint2 tgs [[ threads_per_threadgroup ]] )
+{
+    uint c = gid.y;
+    uint n = plane * batchSize;
+    uint groups = channels / channelsPerGroup;
+    threadgroup float sumBuf[256];
+
+    float dy = 0.0;
+    float dyXHat = 0.0;
+    for (uint i = tid.x; i < n; i += tgs.x) {
+        uint b = i / plane;
+        uint group = b * groups + c / channelsPerGroup;
+        uint idx = (b * channels + c) * plane + i % plane;
+        float g = outputGrad[idx];
+        dy += g;
+        dyXHat += g * (inputData[idx] - meanData[group]) * invStdData[group];
+    }
+    dy = threadgroupSum(sumBuf, dy, tid.x, tgs.x);
+    dyXHat = threadgroupSum(sumBuf, dyXHat, tid.x, tgs.x);
+
+    if (tid.x == 0) {
+        gammaGrad[c] += dyXHat;
+        betaGrad[c] += dy;
+    }
+}
+
+kernel void groupNormInputGrads(
+    device const float *inputData [[ buffer(0) ]],
+    device float *inputGrad [[ buffer(1) ]],
+    device const float *outputGrad [[ buffer(2) ]],
+    device const float *gammaData [[ buffer(3) ]],
+    device const float *meanData [[ buffer(4) ]],
+    device const float *invStdData [[ buffer(5) ]],
+    device const float *sumDy [[ buffer(6) ]],
+    device const float *sumDyXHat [[ buffer(7) ]],
+    constant uint& plane [[ buffer(8) ]],
+    constant uint& channels [[ buffer(9) ]],
+    constant uint& channelsPerGroup [[ buffer(10) ]],
+    const uint2 gid [[ thread_position_in_grid ]] )
+{
+    uint c = gid.y % channels;
+    uint group = gid.y / channelsPerGroup;
+    uint idx = gid.y * plane + gid.x;
+
+    float n = float(channelsPerGroup * plane);
+    float invStd = invStdData[group];
+    float xHat = (inputData[idx] - meanData[group]) * invStd;
+    float g = outputGrad[idx] * gammaData[c];
+
+    inputGrad[idx] += invStd * (g - sumDy[group] / n - xHat * sumDyXHat[group] / n);
+}
@@ -0,0 +1,134 @@
+package groupnorm
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/atkhx/metal/mtl"
+	"github.com/atkhx/metal/nn/num"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testPlane     = 4
+	testChannels  = 6
+	testGroups    = 3
+	testBatchSize = 2
+	testEps       = 1e-5
+)
+
+// refForward normalizes x by groups in float64.
+func refForward(x, gamma, beta []float64) []float64 {
+	channelsPerGroup := testChannels / testGroups
+	groupSize := channelsPerGroup * testPlane
+
+	out := make([]float64, len(x))
+	for group := 0; group < testGroups*testBatchSize; group++ {
+		start := group * groupSize
+		values := x[start : start+groupSize]
+
+		var mean, variance float64
+		for _, v := range values {
+			mean += v
+		}
+		mean /= float64(groupSize)
+		for _, v := range values {
+			variance += (v - mean) * (v - mean)
+		}
+		variance /= float64(groupSize)
+
+		invStd := 1 / math.Sqrt(variance+testEps)
+		for i, v := range values {
+			c := (group%testGroups)*channelsPerGroup + i/testPlane
+			out[start+i] = gamma[c]*(v-mean)*invStd + beta[c]
+		}
+	}
+	return out
+}
+
+func toFloat64(values []float32) []float64 {
+	res := make([]float64, len(values))
+	for i, v := range values {
+		res[i] = float64(v)
+	}
+	return res
+}
+
+func TestKernel_MatchesReference(t *testing.T) {
+	device := mtl.MustCreateSystemDefaultDevice()
+	defer device.Release()
+
+	rnd := rand.New(rand.NewSource(1))
+	randomFloats := func(length int) []float32 {
+		values := make([]float32, length)
+		for i := range values {
+			values[i] = rnd.Float32()*4 - 1
+		}
+		return values
+	}
+	newData := func(values []float32, dims mtl.MTLSize) *num.Data {
+		return &num.Data{
+			Data: device.NewBufferWithFloats(values, mtl.ResourceStorageModeShared),
+			Grad: device.NewBufferEmptyFloatsBuffer(dims.Length(), mtl.ResourceStorageModeShared),
+			Dims: dims,
+		}
+	}
+
+	// 2x2 images
+	dims := mtl.NewMTLSize(2, 2, testChannels*testBatchSize)
+	pDims := mtl.NewMTLSize(1, 1, testChannels)
+
+	input := newData(randomFloats(dims.Length()), dims)
+	output := newData(make([]float32, dims.Length()), dims)
+	gamma := newData(randomFloats(testChannels), pDims)
+	beta := newData(randomFloats(testChannels), pDims)
+	copy(output.Grad.GetFloats(), randomFloats(dims.Length()))
+
+	x := toFloat64(input.Data.GetFloats())
+	g := toFloat64(gamma.Data.GetFloats())
+	bt := toFloat64(beta.Data.GetFloats())
+	dy := toFloat64(output.Grad.GetFloats())
+
+	kernel := New(device, input, output, gamma, beta, testGroups, testBatchSize, testEps)
+
+	cmd := device.NewCommandQueue().GetNewMTLCommandBuffer()
+	defer cmd.Release()
+	kernel.Forward(cmd)
+	kernel.Backward(cmd)
+	cmd.Commit()
+	cmd.WaitUntilCompleted()
+
+	expOutput := refForward(x, g, bt)
+	for i, v := range output.Data.GetFloats() {
+		require.InDelta(t, expOutput[i], float64(v), 1e-4)
+	}
+
+	// Gradients are checked against central differences of the float64 reference.
+	loss := func() (res float64) {
+		for i, v := range refForward(x, g, bt) {
+			res += v * dy[i]
+		}
+		return
+	}
+	const h = 1e-4
+	numGrad := func(values []float64, i int) float64 {
+		v := values[i]
+		values[i] = v + h
+		lp := loss()
+		values[i] = v - h
+		lm := loss()
+		values[i] = v
+		return (lp - lm) / (2 * h)
+	}
+
+	for i, v := range input.Grad.GetFloats() {
+		require.InDelta(t, numGrad(x, i), float64(v), 1e-3, "input grad %d", i)
+	}
+	for i, v := range gamma.Grad.GetFloats() {
+		require.InDelta(t, numGrad(g, i), float64(v), 1e-3, "gamma grad %d", i)
+	}
+	for i, v := range beta.Grad.GetFloats() {
+		require.InDelta(t, numGrad(bt, i), float64(v), 1e-3, "beta grad %d", i)
+	}
+}
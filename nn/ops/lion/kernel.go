@@ -0,0 +1,68 @@
+package lion
+
+/*
+#cgo CFLAGS: -x objective-c
+#cgo LDFLAGS: -framework Metal -framework MetalPerformanceShaders -framework CoreGraphics -framework Foundation
+
+#include "kernel.h"
+
+void* lionKernelCreate(void *device, const char *kernelSource) {
+    return [[LionKernelImpl alloc] initWithDevice:(id<MTLDevice>)device
+		kernelSource:[NSString stringWithUTF8String:kernelSource]];
+}
+
+void lionUpdate(
+    void *kernel,
+    void *commandBuffer,
+    void *dataBuffer,
+    void *gradBuffer,
+    void *expAvgBuffer,
+    LionParams params
+) {
+    [(__bridge LionKernelImpl*)kernel update:(id<MTLCommandBuffer>)commandBuffer
+        dataBuffer:(id<MTLBuffer>)dataBuffer
+        gradBuffer:(id<MTLBuffer>)gradBuffer
+        expAvgBuffer:(id<MTLBuffer>)expAvgBuffer
+        params:params];
+}
+*/
+import "C"
+import (
+	_ "embed"
+	"unsafe"
+
+	"github.com/atkhx/metal/mtl"
+)
+
+//go:embed kernel.metal
+var metalFunctions string
+
+func New(device *mtl.Device) *Kernel {
+	cKernelString := C.CString(metalFunctions)
+	defer C.free(unsafe.Pointer(cKernelString))
+
+	return &Kernel{
+		kernelID: C.lionKernelCreate(device.GetID(), cKernelString),
+	}
+}
+
+type Kernel struct {
+	kernelID unsafe.Pointer
+}
+
+// Update applies data -= learningRate * sign(beta1*m + (1-beta1)*grad),
+// then updates the momentum m = beta2*m + (1-beta2)*grad.
+func (k *Kernel) Update(b *mtl.CommandBuffer, data, grad, expAvg *mtl.Buffer, learningRate, beta1, beta2 float32) {
+	C.lionUpdate(
+		k.kernelID,
+		b.GetID(),
+		data.GetID(),
+		grad.GetID(),
+		expAvg.GetID(),
+		C.LionParams{
+			learningRate: C.float(learningRate),
+			beta1:        C.float(beta1),
+			beta2:        C.float(beta2),
+		},
+	)
+}
@@ -0,0 +1,29 @@
+#ifndef LionKernel_h
+#define LionKernel_h
+
+#import <Foundation/Foundation.h>
+#import <Metal/Metal.h>
+
+typedef struct {
+    float learningRate;
+    float beta1;
+    float beta2;
+} LionParams;
+
+@protocol LionKernel <NSObject>
+
+- (instancetype) initWithDevice:(id<MTLDevice>)device kernelSource:(NSString*)kernelSource;
+
+- (void) update:(id<MTLCommandBuffer>)commandBuffer
+        dataBuffer:(id<MTLBuffer>)dataBuffer
+        gradBuffer:(id<MTLBuffer>)gradBuffer
+        expAvgBuffer:(id<MTLBuffer>)expAvgBuffer
+        params:(LionParams)params;
+
+@end
+
+@interface LionKernelImpl : NSObject <LionKernel>
+    @property (nonatomic, strong) id<MTLLibrary> library;
+@end
+
+#endif /* LionKernel_h */
@@ -0,0 +1,67 @@
+#import "kernel.h"
+#import <Foundation/Foundation.h>
+#include <stdio.h>
+
+static inline MTLSize threadgroupSize1D(id<MTLComputePipelineState> pso) {
+    NSUInteger w = pso.threadExecutionWidth;
+    NSUInteger max = pso.maxTotalThreadsPerThreadgroup;
+    if (w > max) {
+        w = max;
+    }
+    return MTLSizeMake(w, 1, 1);
+}
+
+@implementation LionKernelImpl {
+    id<MTLDevice> _device;
+
+    id<MTLComputePipelineState> _updatePSO;
+
+    NSError *error;
+}
+
+- (id<MTLComputePipelineState>)createPipelineStateWithFunctionName:(NSString *)functionName {
+    id<MTLFunction> function = [self.library newFunctionWithName:functionName];
+    if (!function) {
+        printf("Failed to load function %s!\n", [functionName UTF8String]);
+        return nil;
+    }
+
+    id<MTLComputePipelineState> pipelineState = [_device newComputePipelineStateWithFunction:function error:&error];
+    if (error != nil) {
+        const char *errorCString = [[error localizedDescription] UTF8String];
+        printf("Failed to create pipeline state: %s\n", errorCString);
+        return nil;
+    }
+    return pipelineState;
+}
+
+- (instancetype)initWithDevice:(id<MTLDevice>)device kernelSource:(NSString*)kernelSource {
+    self = [super init];
+    if (self) {
+        _device = device;
+
+        self.library = [_device newLibraryWithSource:kernelSource options:nil error:&error];
+
+        _updatePSO = [self createPipelineStateWithFunctionName:@"lionUpdate"];
+    }
+    return self;
+}
+
+- (void) update:(id<MTLCommandBuffer>)commandBuffer
+        dataBuffer:(id<MTLBuffer>)dataBuffer
+        gradBuffer:(id<MTLBuffer>)gradBuffer
+        expAvgBuffer:(id<MTLBuffer>)expAvgBuffer
+        params:(LionParams)params
+{
+    id<MTLComputeCommandEncoder> update = [commandBuffer computeCommandEncoder];
+    [update setComputePipelineState:_updatePSO];
+    [update setBuffer:dataBuffer offset:0 atIndex:0];
+    [update setBuffer:gradBuffer offset:0 atIndex:1];
+    [update setBuffer:expAvgBuffer offset:0 atIndex:2];
+    [update setBytes:&params length:sizeof(LionParams) atIndex:3];
+    [update dispatchThreads:MTLSizeMake(dataBuffer.length / sizeof(float), 1, 1)
+      threadsPerThreadgroup:threadgroupSize1D(_updatePSO)];
+    [update endEncoding];
+}
+
+@end
@@ -0,0 +1,28 @@
+#include <metal_stdlib>
+
+using namespace metal;
+
+struct LionParams {
+    float learningRate;
+    float beta1;
+    float beta2;
+};
+
+// Non-finite gradients are treated as zeros like in adamw.
+static inline float finiteGrad(float g) {
+    return (isnan(g) || isinf(g)) ? 0.0 : g;
+}
+
+kernel void lionUpdate(
+    device float *dataBuffer [[ buffer(0) ]],
+    device const float *gradBuffer [[ buffer(1) ]],
+    device float *expAvgBuffer [[ buffer(2) ]],
+    constant LionParams& p [[ buffer(3) ]],
+    const uint id [[ thread_position_in_grid ]] )
+{
+    float g = finiteGrad(gradBuffer[id]);
+    float m = expAvgBuffer[id];
+
+    dataBuffer[id] -= p.learningRate * sign(p.beta1 * m + (1 - p.beta1) * g);
+    expAvgBuffer[id] = p.beta2 * m + (1 - p.beta2) * g;
+}
@@ -0,0 +1,30 @@
+package lion
+
+import (
+	"testing"
+
+	"github.com/atkhx/metal/mtl"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKernel(t *testing.T) {
+	device := mtl.MustCreateSystemDefaultDevice()
+	defer device.Release()
+
+	kernel := New(device)
+
+	data := device.NewBufferWithFloats([]float32{1, 2, 3, 4}, mtl.ResourceStorageModeShared)
+	grad := device.NewBufferWithFloats([]float32{0.5, -1, 0, 0.5}, mtl.ResourceStorageModeShared)
+	expAvg := device.NewBufferWithFloats([]float32{0.2, 0.5, 0, -0.1}, mtl.ResourceStorageModeShared)
+
+	cmd := device.NewCommandQueue().GetNewMTLCommandBuffer()
+	defer cmd.Release()
+
+	kernel.Update(cmd, data, grad, expAvg, 0.1, 0.9, 0.99)
+	cmd.Commit()
+	cmd.WaitUntilCompleted()
+
+	// interpolations 0.9*m + 0.1*grad are [0.23, 0.35, 0, -0.04]
+	require.InDeltaSlice(t, []float32{0.9, 1.9, 3, 4.1}, data.GetFloats(), 1e-6)
+	require.InDeltaSlice(t, []float32{0.203, 0.485, 0, -0.094}, expAvg.GetFloats(), 1e-6)
+}
@@ -11,7 +11,9 @@ type Kernel interface {
 	Backward(b *mtl.CommandBuffer)
 }
 
-func createMatrices3D(aData *num.Data, batchSize, batchStrideK int) (*mps.Matrix, *mps.Matrix) {
+// createMatrices3D binds matrices to the data and gradient buffers of the node. Buffers are
+// resolved when a command is encoded, so they can be replaced after the kernel is created.
+func createMatrices3D(aData *num.Data, batchSize, batchStrideK int) (*mps.MatrixBinding, *mps.MatrixBinding) {
 	aDesc := mps.CreateMatrixDescriptorFloat32(
 		aData.Dims.W,
 		aData.Dims.H,
@@ -19,8 +21,8 @@ func createMatrices3D(aData *num.Data, batchSize, batchStrideK int) (*mps.Matrix
 		aData.Dims.W*aData.Dims.H*batchStrideK,
 	)
 
-	return mps.CreateMatrixWithBuffer(aDesc, aData.Data, 0),
-		mps.CreateMatrixWithBuffer(aDesc, aData.Grad, 0)
+	return mps.NewMatrixBinding(aDesc, &aData.Data, 0),
+		mps.NewMatrixBinding(aDesc, &aData.Grad, 0)
 }
 
 func New(device *mtl.Device, aData, bData, cData *num.Data, alpha float32) Kernel {
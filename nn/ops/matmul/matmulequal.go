@@ -33,15 +33,15 @@ type Equal struct {
 	calcAGrad *mps.MatrixMultiplicationKernel
 	calcBGrad *mps.MatrixMultiplicationKernel
 
-	aDataM, bDataM, cDataM *mps.Matrix
-	aGradM, bGradM, cGradM *mps.Matrix
+	aDataM, bDataM, cDataM *mps.MatrixBinding
+	aGradM, bGradM, cGradM *mps.MatrixBinding
 }
 
 func (op *Equal) Forward(b *mtl.CommandBuffer) {
-	op.calcCData.Encode(b, op.aDataM, op.bDataM, op.cDataM)
+	op.calcCData.Encode(b, op.aDataM.Matrix(), op.bDataM.Matrix(), op.cDataM.Matrix())
 }
 
 func (op *Equal) Backward(b *mtl.CommandBuffer) {
-	op.calcAGrad.Encode(b, op.cGradM, op.bDataM, op.aGradM)
-	op.calcBGrad.Encode(b, op.aDataM, op.cGradM, op.bGradM)
+	op.calcAGrad.Encode(b, op.cGradM.Matrix(), op.bDataM.Matrix(), op.aGradM.Matrix())
+	op.calcBGrad.Encode(b, op.aDataM.Matrix(), op.cGradM.Matrix(), op.bGradM.Matrix())
 }
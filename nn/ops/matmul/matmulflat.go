@@ -27,15 +27,15 @@ func NewFlat(device *mtl.Device, aData, bData, cData *num.Data, alpha float32) *
 	op.calcBGrad = mps.CreateMatrixMultiplicationKernel(device, bH, bW, cH, alpha, 1.0, true, false)
 	op.calcAGrad = mps.CreateMatrixMultiplicationKernel(device, aH, aW, cW, alpha, 1.0, false, true)
 
-	op.bDataMs = make([]*mps.Matrix, 0, batchSize)
-	op.cGradMs = make([]*mps.Matrix, 0, batchSize)
+	op.bDataMs = make([]*mps.MatrixBinding, 0, batchSize)
+	op.cGradMs = make([]*mps.MatrixBinding, 0, batchSize)
 
 	bDescOne := mps.CreateMatrixDescriptorFloat32(bW, bH, 1, 0)
 	cDescOne := mps.CreateMatrixDescriptorFloat32(cW, cH, 1, 0)
 
 	for i := 0; i < batchSize; i++ {
-		op.bDataMs = append(op.bDataMs, mps.CreateMatrixWithBuffer(bDescOne, bData.Data, i*bW*bH))
-		op.cGradMs = append(op.cGradMs, mps.CreateMatrixWithBuffer(cDescOne, cData.Grad, i*cW*cH))
+		op.bDataMs = append(op.bDataMs, mps.NewMatrixBinding(bDescOne, &bData.Data, i*bW*bH))
+		op.cGradMs = append(op.cGradMs, mps.NewMatrixBinding(cDescOne, &cData.Grad, i*cW*cH))
 	}
 
 	return op
@@ -46,20 +46,20 @@ type FlatKernel struct {
 	calcAGrad *mps.MatrixMultiplicationKernel
 	calcBGrad *mps.MatrixMultiplicationKernel
 
-	aDataM, bDataM, cDataM *mps.Matrix
-	aGradM, bGradM, cGradM *mps.Matrix
+	aDataM, bDataM, cDataM *mps.MatrixBinding
+	aGradM, bGradM, cGradM *mps.MatrixBinding
 
-	cGradMs, bDataMs []*mps.Matrix
+	cGradMs, bDataMs []*mps.MatrixBinding
 }
 
 func (op *FlatKernel) Forward(b *mtl.CommandBuffer) {
-	op.calcCData.Encode(b, op.aDataM, op.bDataM, op.cDataM)
+	op.calcCData.Encode(b, op.aDataM.Matrix(), op.bDataM.Matrix(), op.cDataM.Matrix())
 }
 
 func (op *FlatKernel) Backward(b *mtl.CommandBuffer) {
-	op.calcBGrad.Encode(b, op.aDataM, op.cGradM, op.bGradM)
+	op.calcBGrad.Encode(b, op.aDataM.Matrix(), op.cGradM.Matrix(), op.bGradM.Matrix())
 	for i := 0; i < len(op.cGradMs); i++ {
 		i := i
-		op.calcAGrad.Encode(b, op.cGradMs[i], op.bDataMs[i], op.aGradM)
+		op.calcAGrad.Encode(b, op.cGradMs[i].Matrix(), op.bDataMs[i].Matrix(), op.aGradM.Matrix())
 	}
 }
@@ -26,8 +26,8 @@ func NewOnFlat(device *mtl.Device, aData, bData, cData *num.Data, alpha float32)
 	aDescOne := mps.CreateMatrixDescriptorFloat32(aW, aH*aD, 1, aData.Dims.Length())
 	cDescOne := mps.CreateMatrixDescriptorFloat32(cW, cH*cD, 1, cData.Dims.Length())
 
-	op.aDataMBig = mps.CreateMatrixWithBuffer(aDescOne, aData.Data, 0)
-	op.cGradMBig = mps.CreateMatrixWithBuffer(cDescOne, cData.Grad, 0)
+	op.aDataMBig = mps.NewMatrixBinding(aDescOne, &aData.Data, 0)
+	op.cGradMBig = mps.NewMatrixBinding(cDescOne, &cData.Grad, 0)
 
 	op.calcCData = mps.CreateMatrixMultiplicationKernel(device, aH, bW, aW, alpha, 0.0, false, false)
 	op.calcAGrad = mps.CreateMatrixMultiplicationKernel(device, aH, aW, cW, alpha, 1.0, false, true)
@@ -41,17 +41,17 @@ type OnFlatKernel struct {
 	calcAGrad *mps.MatrixMultiplicationKernel
 	calcBGrad *mps.MatrixMultiplicationKernel
 
-	aDataM, bDataM, cDataM *mps.Matrix
-	aGradM, bGradM, cGradM *mps.Matrix
+	aDataM, bDataM, cDataM *mps.MatrixBinding
+	aGradM, bGradM, cGradM *mps.MatrixBinding
 
-	aDataMBig, cGradMBig *mps.Matrix
+	aDataMBig, cGradMBig *mps.MatrixBinding
 }
 
 func (op *OnFlatKernel) Forward(b *mtl.CommandBuffer) {
-	op.calcCData.Encode(b, op.aDataM, op.bDataM, op.cDataM)
+	op.calcCData.Encode(b, op.aDataM.Matrix(), op.bDataM.Matrix(), op.cDataM.Matrix())
 }
 
 func (op *OnFlatKernel) Backward(b *mtl.CommandBuffer) {
-	op.calcAGrad.Encode(b, op.cGradM, op.bDataM, op.aGradM)
-	op.calcBGrad.Encode(b, op.aDataMBig, op.cGradMBig, op.bGradM)
+	op.calcAGrad.Encode(b, op.cGradM.Matrix(), op.bDataM.Matrix(), op.aGradM.Matrix())
+	op.calcBGrad.Encode(b, op.aDataMBig.Matrix(), op.cGradMBig.Matrix(), op.bGradM.Matrix())
 }
@@ -0,0 +1,94 @@
+package permute
+
+/*
+#cgo CFLAGS: -x objective-c
+#cgo LDFLAGS: -framework Metal -framework MetalPerformanceShaders -framework CoreGraphics -framework Foundation
+
+#include "kernel.h"
+
+void* permuteKernelCreate(void *device, const char *kernelSource) {
+    return [[PermuteKernelImpl alloc] initWithDevice:(id<MTLDevice>)device
+		kernelSource:[NSString stringWithUTF8String:kernelSource]];
+}
+
+void permuteForward(
+    void *kernel,
+    void *commandBuffer,
+    void *inputData,
+    void *outputData,
+    PermuteParams params
+) {
+    [(__bridge PermuteKernelImpl*)kernel forward:(id<MTLCommandBuffer>)commandBuffer
+        inputData:(id<MTLBuffer>)inputData
+        outputData:(id<MTLBuffer>)outputData
+        params:params];
+}
+
+void permuteBackward(
+    void *kernel,
+    void *commandBuffer,
+    void *inputGrad,
+    void *outputGrad,
+    PermuteParams params
+) {
+    [(__bridge PermuteKernelImpl*)kernel backward:(id<MTLCommandBuffer>)commandBuffer
+        inputGrad:(id<MTLBuffer>)inputGrad
+        outputGrad:(id<MTLBuffer>)outputGrad
+        params:params];
+}
+*/
+import "C"
+import (
+	_ "embed"
+	"fmt"
+	"unsafe"
+
+	"github.com/atkhx/metal/mtl"
+	"github.com/atkhx/metal/nn/num"
+)
+
+//go:embed kernel.metal
+var metalFunctions string
+
+// New creates kernel which copies the strided view of input.GetShape() into contiguous output.
+// The view must be a permutation: every element of the input buffer is visited once.
+func New(device *mtl.Device, input, output *num.Data) *Kernel {
+	shape := input.GetShape()
+	if output.Dims.Length() != shape.Length() {
+		panic(fmt.Sprintf("permute: invalid output length %d, expected %d", output.Dims.Length(), shape.Length()))
+	}
+
+	cKernelString := C.CString(metalFunctions)
+	defer C.free(unsafe.Pointer(cKernelString))
+
+	params := C.PermuteParams{
+		rank:   C.uint(shape.Rank),
+		length: C.uint(shape.Length()),
+	}
+	for i := 0; i < shape.Rank; i++ {
+		params.dims[i] = C.uint(shape.Dims[i])
+		params.strides[i] = C.uint(shape.Strides[i])
+	}
+
+	return &Kernel{
+		kernelID: C.permuteKernelCreate(device.GetID(), cKernelString),
+		input:    input,
+		output:   output,
+		params:   params,
+	}
+}
+
+type Kernel struct {
+	kernelID unsafe.Pointer
+	input    *num.Data
+	output   *num.Data
+	params   C.PermuteParams
+}
+
+func (k *Kernel) Forward(b *mtl.CommandBuffer) {
+	C.permuteForward(k.kernelID, b.GetID(), k.input.Data.GetID(), k.output.Data.GetID(), k.params)
+}
+
+func (k *Kernel) Backward(b *mtl.CommandBuffer) {
+	C.permuteBackward(k.kernelID, b.GetID(), k.input.Grad.GetID(), k.output.Grad.GetID(), k.params)
+}
@@ -0,0 +1,34 @@
+#ifndef PermuteKernel_h
+#define PermuteKernel_h
+
+#import <Foundation/Foundation.h>
+#import <Metal/Metal.h>
+
+typedef struct {
+    uint rank;
+    uint length;
+    uint dims[6];
+    uint strides[6];
+} PermuteParams;
+
+@protocol PermuteKernel <NSObject>
+
+- (instancetype) initWithDevice:(id<MTLDevice>)device kernelSource:(NSString*)kernelSource;
+
+- (void) forward:(id<MTLCommandBuffer>)commandBuffer
+        inputData:(id<MTLBuffer>)inputData
+        outputData:(id<MTLBuffer>)outputData
+        params:(PermuteParams)params;
+
+- (void) backward:(id<MTLCommandBuffer>)commandBuffer
+        inputGrad:(id<MTLBuffer>)inputGrad
+        outputGrad:(id<MTLBuffer>)outputGrad
+        params:(PermuteParams)params;
+
+@end
+
+@interface PermuteKernelImpl : NSObject <PermuteKernel>
+    @property (nonatomic, strong) id<MTLLibrary> library;
+@end
+
+#endif /* PermuteKernel_h */
@@ -0,0 +1,82 @@
+#import "kernel.h"
+#import <Foundation/Foundation.h>
+#include <stdio.h>
+
+static inline MTLSize threadgroupSize1D(id<MTLComputePipelineState> pso) {
+    NSUInteger w = pso.threadExecutionWidth;
+    NSUInteger max = pso.maxTotalThreadsPerThreadgroup;
+    if (w > max) {
+        w = max;
+    }
+    return MTLSizeMake(w, 1, 1);
+}
+
+@implementation PermuteKernelImpl {
+    id<MTLDevice> _device;
+
+    id<MTLComputePipelineState> _forwardPSO;
+    id<MTLComputePipelineState> _backwardPSO;
+
+    NSError *error;
+}
+
+- (id<MTLComputePipelineState>)createPipelineStateWithFunctionName:(NSString *)functionName {
+    id<MTLFunction> function = [self.library newFunctionWithName:functionName];
+    if (!function) {
+        printf("Failed to load function %s!\n", [functionName UTF8String]);
+        return nil;
+    }
+
+    id<MTLComputePipelineState> pipelineState = [_device newComputePipelineStateWithFunction:function error:&error];
+    if (error != nil) {
+        const char *errorCString = [[error localizedDescription] UTF8String];
+        printf("Failed to create pipeline state: %s\n", errorCString);
+        return nil;
+    }
+    return pipelineState;
+}
+
+- (instancetype)initWithDevice:(id<MTLDevice>)device kernelSource:(NSString*)kernelSource {
+    self = [super init];
+    if (self) {
+        _device = device;
+
+        self.library = [_device newLibraryWithSource:kernelSource options:nil error:&error];
+
+        _forwardPSO = [self createPipelineStateWithFunctionName:@"permuteForward"];
+        _backwardPSO = [self createPipelineStateWithFunctionName:@"permuteBackward"];
+    }
+    return self;
+}
+
+- (void) forward:(id<MTLCommandBuffer>)commandBuffer
+        inputData:(id<MTLBuffer>)inputData
+        outputData:(id<MTLBuffer>)outputData
+        params:(PermuteParams)params
+{
+    id<MTLComputeCommandEncoder> forward = [commandBuffer computeCommandEncoder];
+    [forward setComputePipelineState:_forwardPSO];
+    [forward setBuffer:inputData offset:0 atIndex:0];
+    [forward setBuffer:outputData offset:0 atIndex:1];
+    [forward setBytes:&params length:sizeof(PermuteParams) atIndex:2];
+    [forward dispatchThreads:MTLSizeMake(params.length, 1, 1)
+       threadsPerThreadgroup:threadgroupSize1D(_forwardPSO)];
+    [forward endEncoding];
+}
+
+- (void) backward:(id<MTLCommandBuffer>)commandBuffer
+        inputGrad:(id<MTLBuffer>)inputGrad
+        outputGrad:(id<MTLBuffer>)outputGrad
+        params:(PermuteParams)params
+{
+    id<MTLComputeCommandEncoder> backward = [commandBuffer computeCommandEncoder];
+    [backward setComputePipelineState:_backwardPSO];
+    [backward setBuffer:inputGrad offset:0 atIndex:0];
+    [backward setBuffer:outputGrad offset:0 atIndex:1];
+    [backward setBytes:&params length:sizeof(PermuteParams) atIndex:2];
+    [backward dispatchThreads:MTLSizeMake(params.length, 1, 1)
+        threadsPerThreadgroup:threadgroupSize1D(_backwardPSO)];
+    [backward endEncoding];
+}
+
+@end
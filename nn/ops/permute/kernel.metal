@@ -0,0 +1,46 @@
+#include <metal_stdlib>
+
+using namespace metal;
+
+// Output is contiguous with dims, strides are input strides of the same axes.
+// Axes go from the innermost one.
+struct PermuteParams {
+    uint rank;
+    uint length;
+    uint dims[6];
+    uint strides[6];
+};
+
+inline uint sourceIndex(constant PermuteParams& p, uint id) {
+    uint offset = 0;
+    for (uint i = 0; i < p.rank; ++i) {
+        offset += (id % p.dims[i]) * p.strides[i];
+        id /= p.dims[i];
+    }
+    return offset;
+}
+
+kernel void permuteForward(
+    device const float *inputData [[ buffer(0) ]],
+    device float *outputData [[ buffer(1) ]],
+    constant PermuteParams& p [[ buffer(2) ]],
+    const uint id [[ thread_position_in_grid ]] )
+{
+    if (id >= p.length) {
+        return;
+    }
+    outputData[id] = inputData[sourceIndex(p, id)];
+}
+
+// Every input element has exactly one output element, so there are no races.
+kernel void permuteBackward(
+    device float *inputGrad [[ buffer(0) ]],
+    device const float *outputGrad [[ buffer(1) ]],
+    constant PermuteParams& p [[ buffer(2) ]],
+    const uint id [[ thread_position_in_grid ]] )
+{
+    if (id >= p.length) {
+        return;
+    }
+    inputGrad[sourceIndex(p, id)] += outputGrad[id];
+}
@@ -0,0 +1,80 @@
+package permute
+
+import (
+	"testing"
+
+	"github.com/atkhx/metal/mtl"
+	"github.com/atkhx/metal/nn/num"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKernel(t *testing.T) {
+	device := mtl.MustCreateSystemDefaultDevice()
+	defer device.Release()
+
+	testCases := []struct {
+		name      string
+		shape     num.Shape
+		expOutput []float32
+	}{
+		{
+			name:      "transpose",
+			shape:     num.NewShape(3, 2).Permute(1, 0),
+			expOutput: []float32{0, 3, 1, 4, 2, 5},
+		},
+		{
+			name:  "swap heads and rows",
+			shape: num.NewShape(2, 3, 2, 2).Permute(0, 2, 1, 3),
+			expOutput: []float32{
+				0, 1, 6, 7,
+				2, 3, 8, 9,
+				4, 5, 10, 11,
+
+				12, 13, 18, 19,
+				14, 15, 20, 21,
+				16, 17, 22, 23,
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			length := tc.shape.Length()
+			values := make([]float32, length)
+			outputGrad := make([]float32, length)
+			for i := range values {
+				values[i] = float32(i)
+				outputGrad[i] = float32(i)
+			}
+
+			input := &num.Data{
+				Data:  device.NewBufferWithFloats(values, mtl.ResourceStorageModeShared),
+				Grad:  device.NewBufferEmptyFloatsBuffer(length, mtl.ResourceStorageModeShared),
+				Dims:  tc.shape.MTLSize(),
+				Shape: tc.shape,
+			}
+			output := &num.Data{
+				Data: device.NewBufferEmptyFloatsBuffer(length, mtl.ResourceStorageModeShared),
+				Grad: device.NewBufferWithFloats(outputGrad, mtl.ResourceStorageModeShared),
+				Dims: tc.shape.MTLSize(),
+			}
+
+			kernel := New(device, input, output)
+
+			cmd := device.NewCommandQueue().GetNewMTLCommandBuffer()
+			defer cmd.Release()
+			kernel.Forward(cmd)
+			kernel.Backward(cmd)
+			cmd.Commit()
+			cmd.WaitUntilCompleted()
+
+			require.Equal(t, tc.expOutput, output.Data.GetFloats())
+
+			// the gradient goes back to the place the value was taken from
+			inputGrad := input.Grad.GetFloats()
+			for i, v := range tc.expOutput {
+				require.Equal(t, float32(i), inputGrad[int(v)])
+			}
+		})
+	}
+}
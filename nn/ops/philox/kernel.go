@@ -0,0 +1,66 @@
+package philox
+
+/*
+#cgo CFLAGS: -x objective-c
+#cgo LDFLAGS: -framework Metal -framework MetalPerformanceShaders -framework CoreGraphics -framework Foundation
+
+#include "kernel.h"
+
+void* philoxKernelCreate(void *device, const char *kernelSource) {
+    return [[PhiloxKernelImpl alloc] initWithDevice:(id<MTLDevice>)device
+		kernelSource:[NSString stringWithUTF8String:kernelSource]];
+}
+
+void philoxUniform(
+    void *kernel,
+    void *commandBuffer,
+    void *outputData,
+    uint64_t seed,
+    uint64_t draw
+) {
+    [(__bridge PhiloxKernelImpl*)kernel uniform:(id<MTLCommandBuffer>)commandBuffer
+		outputData:(id<MTLBuffer>)outputData
+        seed:seed
+        draw:draw
+	];
+}
+
+*/
+import "C"
+import (
+	_ "embed"
+	"unsafe"
+
+	"github.com/atkhx/metal/mtl"
+)
+
+//go:embed kernel.metal
+var metalFunctions string
+
+// New creates the counter-based generator: values of a draw depend only on the seed,
+// the number of the draw and their positions, so any draw can be made without the previous ones.
+func New(device *mtl.Device, seed uint64) *Kernel {
+	cKernelString := C.CString(metalFunctions)
+	defer C.free(unsafe.Pointer(cKernelString))
+
+	return &Kernel{
+		kernelID: C.philoxKernelCreate(device.GetID(), cKernelString),
+		seed:     seed,
+	}
+}
+
+type Kernel struct {
+	kernelID unsafe.Pointer
+	seed     uint64
+}
+
+// Uniform fills output with values of the draw uniformly distributed in [0, 1).
+func (k *Kernel) Uniform(b *mtl.CommandBuffer, output *mtl.Buffer, draw uint64) {
+	C.philoxUniform(
+		k.kernelID,
+		b.GetID(),
+		output.GetID(),
+		C.uint64_t(k.seed),
+		C.uint64_t(draw),
+	)
+}
@@ -0,0 +1,23 @@
+#ifndef PhiloxKernel_h
+#define PhiloxKernel_h
+
+#import <Foundation/Foundation.h>
+#import <Metal/Metal.h>
+
+@protocol PhiloxKernel <NSObject>
+
+- (instancetype) initWithDevice:(id<MTLDevice>)device kernelSource:(NSString*)kernelSource;
+
+- (void) uniform:(id<MTLCommandBuffer>)commandBuffer
+        outputData:(id<MTLBuffer>)outputData
+        seed:(uint64_t)seed
+        draw:(uint64_t)draw;
+
+@end
+
+
+@interface PhiloxKernelImpl : NSObject <PhiloxKernel>
+    @property (nonatomic, strong) id<MTLLibrary> library;
+@end
+
+#endif /* PhiloxKernel_h */
@@ -0,0 +1,71 @@
+#import "kernel.h"
+#import <Foundation/Foundation.h>
+#include <stdio.h>
+
+static inline MTLSize threadgroupSize1D(id<MTLComputePipelineState> pso) {
+    NSUInteger w = pso.threadExecutionWidth;
+    NSUInteger max = pso.maxTotalThreadsPerThreadgroup;
+    if (w > max) {
+        w = max;
+    }
+    return MTLSizeMake(w, 1, 1);
+}
+
+@implementation PhiloxKernelImpl {
+    id<MTLDevice> _device;
+
+    id<MTLComputePipelineState> _uniformPSO;
+
+    NSError *error;
+}
+
+- (id<MTLComputePipelineState>)createPipelineStateWithFunctionName:(NSString *)functionName {
+    id<MTLFunction> function = [self.library newFunctionWithName:functionName];
+    if (!function) {
+        printf("Failed to load function %s!\n", [functionName UTF8String]);
+        return nil;
+    }
+
+    id<MTLComputePipelineState> pipelineState = [_device newComputePipelineStateWithFunction:function error:&error];
+    if (error != nil) {
+        const char *errorCString = [[error localizedDescription] UTF8String];
+        printf("Failed to create pipeline state: %s\n", errorCString);
+        return nil;
+    }
+    return pipelineState;
+}
+
+- (instancetype)initWithDevice:(id<MTLDevice>)device kernelSource:(NSString*)kernelSource {
+    self = [super init];
+    if (self) {
+        _device = device;
+
+        self.library = [_device newLibraryWithSource:kernelSource options:nil error:&error];
+
+        _uniformPSO = [self createPipelineStateWithFunctionName:@"philoxUniform"];
+    }
+    return self;
+}
+
+- (void) uniform:(id<MTLCommandBuffer>)commandBuffer
+        outputData:(id<MTLBuffer>)outputData
+        seed:(uint64_t)seed
+        draw:(uint64_t)draw
+{
+    uint length = (uint)(outputData.length / sizeof(float));
+    uint seedWords[2] = {(uint)seed, (uint)(seed >> 32)};
+    uint drawWords[2] = {(uint)draw, (uint)(draw >> 32)};
+
+    id<MTLComputeCommandEncoder> uniform = [commandBuffer computeCommandEncoder];
+
+    [uniform setComputePipelineState:_uniformPSO];
+    [uniform setBuffer:outputData offset:0 atIndex:0];
+    [uniform setBytes:seedWords length:sizeof(seedWords) atIndex:1];
+    [uniform setBytes:drawWords length:sizeof(drawWords) atIndex:2];
+    [uniform setBytes:&length length:sizeof(uint) atIndex:3];
+
+    [uniform dispatchThreads:MTLSizeMake((length + 3) / 4, 1, 1) threadsPerThreadgroup:threadgroupSize1D(_uniformPSO)];
+    [uniform endEncoding];
+}
+
+@end
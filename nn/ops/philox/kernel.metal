@@ -0,0 +1,45 @@
+#include <metal_stdlib>
+
+using namespace metal;
+
+// Philox4x32-10, see "Parallel random numbers: as easy as 1, 2, 3" (Salmon et al., 2011).
+constant uint philoxM0 = 0xD2511F53;
+constant uint philoxM1 = 0xCD9E8D57;
+constant uint philoxW0 = 0x9E3779B9;
+constant uint philoxW1 = 0xBB67AE85;
+
+uint4 philoxRound(uint4 ctr, uint2 key) {
+    uint hi0 = mulhi(philoxM0, ctr.x);
+    uint lo0 = philoxM0 * ctr.x;
+    uint hi1 = mulhi(philoxM1, ctr.z);
+    uint lo1 = philoxM1 * ctr.z;
+    return uint4(hi1 ^ ctr.y ^ key.x, lo1, hi0 ^ ctr.w ^ key.y, lo0);
+}
+
+uint4 philox(uint4 ctr, uint2 key) {
+    for (int i = 0; i < 9; i++) {
+        ctr = philoxRound(ctr, key);
+        key += uint2(philoxW0, philoxW1);
+    }
+    return philoxRound(ctr, key);
+}
+
+float toUniform(uint x) {
+    return float(x >> 8) * (1.0 / 16777216.0);
+}
+
+// Every thread fills 4 values: the counter is (thread, 0, draw) and the key is the seed.
+kernel void philoxUniform(
+    device float *output [[ buffer(0) ]],
+    constant uint2& seed [[ buffer(1) ]],
+    constant uint2& draw [[ buffer(2) ]],
+    constant uint& length [[ buffer(3) ]],
+    const uint id [[ thread_position_in_grid ]] )
+{
+    uint4 random = philox(uint4(id, 0, draw.x, draw.y), seed);
+
+    uint offset = id * 4;
+    for (uint i = 0; i < 4 && offset + i < length; i++) {
+        output[offset + i] = toUniform(random[i]);
+    }
+}
@@ -0,0 +1,56 @@
+package philox
+
+import (
+	"math/bits"
+	"testing"
+
+	"github.com/atkhx/metal/mtl"
+	"github.com/stretchr/testify/require"
+)
+
+// philoxUniform is the CPU reference of the kernel: value i of the draw.
+func philoxUniform(seed, draw uint64, i int) float32 {
+	ctr := [4]uint32{uint32(i / 4), 0, uint32(draw), uint32(draw >> 32)}
+	key := [2]uint32{uint32(seed), uint32(seed >> 32)}
+
+	for round := 0; round < 10; round++ {
+		if round > 0 {
+			key[0] += 0x9E3779B9
+			key[1] += 0xBB67AE85
+		}
+		hi0, lo0 := bits.Mul32(0xD2511F53, ctr[0])
+		hi1, lo1 := bits.Mul32(0xCD9E8D57, ctr[2])
+		ctr = [4]uint32{hi1 ^ ctr[1] ^ key[0], lo1, hi0 ^ ctr[3] ^ key[1], lo0}
+	}
+	return float32(ctr[i%4]>>8) * (1.0 / 16777216.0)
+}
+
+func TestPhilox_Uniform(t *testing.T) {
+	device := mtl.MustCreateSystemDefaultDevice()
+	defer device.Release()
+
+	const length = 1001
+	const seed = 0x123456789
+
+	uniform := func(draw uint64) []float32 {
+		output := device.NewBufferEmptyFloatsBuffer(length, mtl.ResourceStorageModeShared)
+
+		cmd := device.NewCommandQueue().GetNewMTLCommandBuffer()
+		defer cmd.Release()
+
+		New(device, seed).Uniform(cmd, output, draw)
+		cmd.Commit()
+		cmd.WaitUntilCompleted()
+		return output.GetFloats()
+	}
+
+	// any draw can be made without the previous ones
+	for _, draw := range []uint64{0, 1, 1 << 40} {
+		values := uniform(draw)
+		for i, value := range values {
+			require.Equal(t, philoxUniform(seed, draw, i), value)
+			require.True(t, value >= 0 && value < 1)
+		}
+	}
+	require.NotEqual(t, uniform(0), uniform(1))
+}
@@ -0,0 +1,176 @@
+package reduce
+
+/*
+#cgo CFLAGS: -x objective-c
+#cgo LDFLAGS: -framework Metal -framework MetalPerformanceShaders -framework CoreGraphics -framework Foundation
+
+#include "kernel.h"
+
+void* reduceKernelCreate(void *device, const char *kernelSource) {
+    return [[ReduceKernelImpl alloc] initWithDevice:(id<MTLDevice>)device
+		kernelSource:[NSString stringWithUTF8String:kernelSource]];
+}
+
+void reduceForward(
+    void *kernel,
+    void *commandBuffer,
+    void *inputData,
+    void *outputData,
+    void *auxData,
+    ReduceParams params
+) {
+    [(__bridge ReduceKernelImpl*)kernel forward:(id<MTLCommandBuffer>)commandBuffer
+        inputData:(id<MTLBuffer>)inputData
+        outputData:(id<MTLBuffer>)outputData
+        auxData:(id<MTLBuffer>)auxData
+        params:params];
+}
+
+void reduceBackward(
+    void *kernel,
+    void *commandBuffer,
+    void *inputData,
+    void *inputGrad,
+    void *outputGrad,
+    void *auxData,
+    ReduceParams params
+) {
+    [(__bridge ReduceKernelImpl*)kernel backward:(id<MTLCommandBuffer>)commandBuffer
+        inputData:(id<MTLBuffer>)inputData
+        inputGrad:(id<MTLBuffer>)inputGrad
+        outputGrad:(id<MTLBuffer>)outputGrad
+        auxData:(id<MTLBuffer>)auxData
+        params:params];
+}
+*/
+import "C"
+import (
+	_ "embed"
+	"fmt"
+	"unsafe"
+
+	"github.com/atkhx/metal/mtl"
+	"github.com/atkhx/metal/nn/num"
+)
+
+//go:embed kernel.metal
+var metalFunctions string
+
+type Axis int
+
+const (
+	AxisW Axis = iota
+	AxisH
+	AxisD
+)
+
+type Op int
+
+const (
+	OpSum Op = iota
+	OpMean
+	OpMax
+	OpArgMax
+	// OpVar is the population variance (divided by the axis length).
+	OpVar
+)
+
+// Dims returns the shape of the reduction result. With keepDim the reduced axis becomes 1,
+// otherwise it is removed and the following axes are shifted: reducing W of (W, H, D) gives (H, D, 1).
+// The memory layout is the same in both cases.
+func Dims(dims mtl.MTLSize, axis Axis, keepDim bool) mtl.MTLSize {
+	switch axis {
+	case AxisW:
+		if keepDim {
+			return mtl.MTLSize{W: 1, H: dims.H, D: dims.D}
+		}
+		return mtl.MTLSize{W: dims.H, H: dims.D, D: 1}
+	case AxisH:
+		if keepDim {
+			return mtl.MTLSize{W: dims.W, H: 1, D: dims.D}
+		}
+		return mtl.MTLSize{W: dims.W, H: dims.D, D: 1}
+	case AxisD:
+		return mtl.MTLSize{W: dims.W, H: dims.H, D: 1}
+	}
+	panic(fmt.Sprintf("reduce: unknown axis %d", axis))
+}
+
+// layout views dims as [outer][length][inner] with the reduced axis in the middle.
+func layout(dims mtl.MTLSize, axis Axis) (outer, length, inner int) {
+	switch axis {
+	case AxisW:
+		return dims.H * dims.D, dims.W, 1
+	case AxisH:
+		return dims.D, dims.H, dims.W
+	case AxisD:
+		return 1, dims.D, dims.W * dims.H
+	}
+	panic(fmt.Sprintf("reduce: unknown axis %d", axis))
+}
+
+// New creates reduction of input along axis. ArgMax writes indices as floats and has no gradient.
+func New(
+	device *mtl.Device,
+	input *num.Data,
+	output *num.Data,
+	axis Axis,
+	op Op,
+) *Kernel {
+	cKernelString := C.CString(metalFunctions)
+	defer C.free(unsafe.Pointer(cKernelString))
+
+	outer, length, inner := layout(input.Dims, axis)
+	if output.Dims.Length() != outer*inner {
+		panic(fmt.Sprintf("reduce: invalid output length %d, expected %d", output.Dims.Length(), outer*inner))
+	}
+
+	return &Kernel{
+		kernelID: C.reduceKernelCreate(device.GetID(), cKernelString),
+		input:    input,
+		output:   output,
+		aux:      device.NewBufferEmptyFloatsBuffer(outer*inner, mtl.ResourceStorageModeShared),
+		op:       op,
+		params: C.ReduceParams{
+			outer:  C.uint(outer),
+			length: C.uint(length),
+			inner:  C.uint(inner),
+			op:     C.uint(op),
+		},
+	}
+}
+
+type Kernel struct {
+	kernelID unsafe.Pointer
+	input    *num.Data
+	output   *num.Data
+	aux      *mtl.Buffer
+	op       Op
+	params   C.ReduceParams
+}
+
+func (k *Kernel) Forward(b *mtl.CommandBuffer) {
+	C.reduceForward(
+		k.kernelID,
+		b.GetID(),
+		k.input.Data.GetID(),
+		k.output.Data.GetID(),
+		k.aux.GetID(),
+		k.params,
+	)
+}
+
+func (k *Kernel) Backward(b *mtl.CommandBuffer) {
+	if k.op == OpArgMax {
+		return
+	}
+	C.reduceBackward(
+		k.kernelID,
+		b.GetID(),
+		k.input.Data.GetID(),
+		k.input.Grad.GetID(),
+		k.output.Grad.GetID(),
+		k.aux.GetID(),
+		k.params,
+	)
+}
@@ -0,0 +1,37 @@
+#ifndef ReduceKernel_h
+#define ReduceKernel_h
+
+#import <Foundation/Foundation.h>
+#import <Metal/Metal.h>
+
+typedef struct {
+    uint outer;
+    uint length;
+    uint inner;
+    uint op;
+} ReduceParams;
+
+@protocol ReduceKernel <NSObject>
+
+- (instancetype) initWithDevice:(id<MTLDevice>)device kernelSource:(NSString*)kernelSource;
+
+- (void) forward:(id<MTLCommandBuffer>)commandBuffer
+        inputData:(id<MTLBuffer>)inputData
+        outputData:(id<MTLBuffer>)outputData
+        auxData:(id<MTLBuffer>)auxData
+        params:(ReduceParams)params;
+
+- (void) backward:(id<MTLCommandBuffer>)commandBuffer
+        inputData:(id<MTLBuffer>)inputData
+        inputGrad:(id<MTLBuffer>)inputGrad
+        outputGrad:(id<MTLBuffer>)outputGrad
+        auxData:(id<MTLBuffer>)auxData
+        params:(ReduceParams)params;
+
+@end
+
+@interface ReduceKernelImpl : NSObject <ReduceKernel>
+    @property (nonatomic, strong) id<MTLLibrary> library;
+@end
+
+#endif /* ReduceKernel_h */
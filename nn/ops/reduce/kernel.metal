@@ -0,0 +1,107 @@
+#include <metal_stdlib>
+
+using namespace metal;
+
+// Input is viewed as [outer][length][inner], the middle axis is reduced:
+// output is [outer][inner].
+struct ReduceParams {
+    uint outer;
+    uint length;
+    uint inner;
+    uint op;
+};
+
+constant uint opSum = 0;
+constant uint opMean = 1;
+constant uint opMax = 2;
+constant uint opArgMax = 3;
+constant uint opVar = 4;
+
+kernel void reduceForward(
+    device const float *inputData [[ buffer(0) ]],
+    device float *outputData [[ buffer(1) ]],
+    device float *auxData [[ buffer(2) ]],
+    constant ReduceParams& p [[ buffer(3) ]],
+    const uint id [[ thread_position_in_grid ]] )
+{
+    if (id >= p.outer * p.inner) {
+        return;
+    }
+
+    uint start = (id / p.inner) * p.length * p.inner + id % p.inner;
+
+    if (p.op == opMax || p.op == opArgMax) {
+        float maxValue = inputData[start];
+        uint maxIndex = 0;
+        for (uint k = 1; k < p.length; ++k) {
+            float v = inputData[start + k * p.inner];
+            if (v > maxValue) {
+                maxValue = v;
+                maxIndex = k;
+            }
+        }
+        // aux keeps the winner position for the max backward pass.
+        auxData[id] = float(maxIndex);
+        outputData[id] = p.op == opMax ? maxValue : float(maxIndex);
+        return;
+    }
+
+    float sum = 0.0;
+    for (uint k = 0; k < p.length; ++k) {
+        sum += inputData[start + k * p.inner];
+    }
+
+    if (p.op == opSum) {
+        outputData[id] = sum;
+        return;
+    }
+
+    float mean = sum / float(p.length);
+    if (p.op == opMean) {
+        outputData[id] = mean;
+        return;
+    }
+
+    float sq = 0.0;
+    for (uint k = 0; k < p.length; ++k) {
+        float d = inputData[start + k * p.inner] - mean;
+        sq += d * d;
+    }
+    // aux keeps the mean for the variance backward pass.
+    auxData[id] = mean;
+    outputData[id] = sq / float(p.length);
+}
+
+kernel void reduceBackward(
+    device const float *inputData [[ buffer(0) ]],
+    device float *inputGrad [[ buffer(1) ]],
+    device const float *outputGrad [[ buffer(2) ]],
+    device const float *auxData [[ buffer(3) ]],
+    constant ReduceParams& p [[ buffer(4) ]],
+    const uint id [[ thread_position_in_grid ]] )
+{
+    if (id >= p.outer * p.length * p.inner) {
+        return;
+    }
+
+    uint k = (id / p.inner) % p.length;
+    uint o = (id / (p.length * p.inner)) * p.inner + id % p.inner;
+    float g = outputGrad[o];
+
+    switch (p.op) {
+        case opSum:
+            inputGrad[id] += g;
+            break;
+        case opMean:
+            inputGrad[id] += g / float(p.length);
+            break;
+        case opMax:
+            if (k == uint(auxData[o])) {
+                inputGrad[id] += g;
+            }
+            break;
+        case opVar:
+            inputGrad[id] += g * 2.0 * (inputData[id] - auxData[o]) / float(p.length);
+            break;
+    }
+}
@@ -0,0 +1,133 @@
+package reduce
+
+import (
+	"testing"
+
+	"github.com/atkhx/metal/mtl"
+	"github.com/atkhx/metal/nn/num"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDims(t *testing.T) {
+	dims := mtl.NewMTLSize(3, 4, 5)
+	require.Equal(t, mtl.NewMTLSize(1, 4, 5), Dims(dims, AxisW, true))
+	require.Equal(t, mtl.NewMTLSize(4, 5, 1), Dims(dims, AxisW, false))
+	require.Equal(t, mtl.NewMTLSize(3, 1, 5), Dims(dims, AxisH, true))
+	require.Equal(t, mtl.NewMTLSize(3, 5, 1), Dims(dims, AxisH, false))
+	require.Equal(t, mtl.NewMTLSize(3, 4, 1), Dims(dims, AxisD, true))
+	require.Equal(t, mtl.NewMTLSize(3, 4, 1), Dims(dims, AxisD, false))
+}
+
+func TestKernel(t *testing.T) {
+	device := mtl.MustCreateSystemDefaultDevice()
+	defer device.Release()
+
+	// (3, 2, 2)
+	inputValues := []float32{
+		1, 5, 2,
+		4, 0, 3,
+
+		7, 7, 1,
+		-1, 2, 8,
+	}
+
+	testCases := []struct {
+		name       string
+		op         Op
+		axis       Axis
+		keepDim    bool
+		outputGrad []float32
+		expDims    mtl.MTLSize
+		expOutput  []float32
+		expGrad    []float32
+	}{
+		{
+			name:       "sum W",
+			op:         OpSum,
+			axis:       AxisW,
+			keepDim:    true,
+			outputGrad: []float32{1, 1, 1, 1},
+			expDims:    mtl.NewMTLSize(1, 2, 2),
+			expOutput:  []float32{8, 7, 15, 9},
+			expGrad:    []float32{1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1},
+		},
+		{
+			name:       "sum H",
+			op:         OpSum,
+			axis:       AxisH,
+			outputGrad: []float32{1, 2, 3, 4, 5, 6},
+			expDims:    mtl.NewMTLSize(3, 2, 1),
+			expOutput:  []float32{5, 5, 5, 6, 9, 9},
+			expGrad:    []float32{1, 2, 3, 1, 2, 3, 4, 5, 6, 4, 5, 6},
+		},
+		{
+			name:       "mean D",
+			op:         OpMean,
+			axis:       AxisD,
+			outputGrad: []float32{1, 1, 1, 1, 1, 1},
+			expDims:    mtl.NewMTLSize(3, 2, 1),
+			expOutput:  []float32{4, 6, 1.5, 1.5, 1, 5.5},
+			expGrad:    []float32{0.5, 0.5, 0.5, 0.5, 0.5, 0.5, 0.5, 0.5, 0.5, 0.5, 0.5, 0.5},
+		},
+		{
+			name:       "max W",
+			op:         OpMax,
+			axis:       AxisW,
+			outputGrad: []float32{1, 2, 3, 4},
+			expDims:    mtl.NewMTLSize(2, 2, 1),
+			expOutput:  []float32{5, 4, 7, 8},
+			expGrad:    []float32{0, 1, 0, 2, 0, 0, 3, 0, 0, 0, 0, 4},
+		},
+		{
+			name:       "argmax D",
+			op:         OpArgMax,
+			axis:       AxisD,
+			keepDim:    true,
+			outputGrad: []float32{1, 1, 1, 1, 1, 1},
+			expDims:    mtl.NewMTLSize(3, 2, 1),
+			expOutput:  []float32{1, 1, 0, 0, 1, 1},
+			expGrad:    make([]float32, 12),
+		},
+		{
+			name:       "var W",
+			op:         OpVar,
+			axis:       AxisW,
+			outputGrad: []float32{1, 0, 0, 0},
+			expDims:    mtl.NewMTLSize(2, 2, 1),
+			expOutput:  []float32{26.0 / 9, 26.0 / 9, 8, 14},
+			expGrad:    []float32{-10.0 / 9, 14.0 / 9, -4.0 / 9, 0, 0, 0, 0, 0, 0, 0, 0, 0},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			inDims := mtl.NewMTLSize(3, 2, 2)
+			input := &num.Data{
+				Data: device.NewBufferWithFloats(inputValues, mtl.ResourceStorageModeShared),
+				Grad: device.NewBufferEmptyFloatsBuffer(inDims.Length(), mtl.ResourceStorageModeShared),
+				Dims: inDims,
+			}
+
+			outDims := Dims(inDims, tc.axis, tc.keepDim)
+			require.Equal(t, tc.expDims, outDims)
+
+			output := &num.Data{
+				Data: device.NewBufferEmptyFloatsBuffer(outDims.Length(), mtl.ResourceStorageModeShared),
+				Grad: device.NewBufferWithFloats(tc.outputGrad, mtl.ResourceStorageModeShared),
+				Dims: outDims,
+			}
+
+			kernel := New(device, input, output, tc.axis, tc.op)
+
+			cmd := device.NewCommandQueue().GetNewMTLCommandBuffer()
+			defer cmd.Release()
+			kernel.Forward(cmd)
+			kernel.Backward(cmd)
+			cmd.Commit()
+			cmd.WaitUntilCompleted()
+
+			require.InDeltaSlice(t, tc.expOutput, output.Data.GetFloats(), 1e-5)
+			require.InDeltaSlice(t, tc.expGrad, input.Grad.GetFloats(), 1e-5)
+		})
+	}
+}
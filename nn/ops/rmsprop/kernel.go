@@ -0,0 +1,68 @@
+package rmsprop
+
+/*
+#cgo CFLAGS: -x objective-c
+#cgo LDFLAGS: -framework Metal -framework MetalPerformanceShaders -framework CoreGraphics -framework Foundation
+
+#include "kernel.h"
+
+void* rmspropKernelCreate(void *device, const char *kernelSource) {
+    return [[RMSpropKernelImpl alloc] initWithDevice:(id<MTLDevice>)device
+		kernelSource:[NSString stringWithUTF8String:kernelSource]];
+}
+
+void rmspropUpdate(
+    void *kernel,
+    void *commandBuffer,
+    void *dataBuffer,
+    void *gradBuffer,
+    void *squareAvgBuffer,
+    RMSpropParams params
+) {
+    [(__bridge RMSpropKernelImpl*)kernel update:(id<MTLCommandBuffer>)commandBuffer
+        dataBuffer:(id<MTLBuffer>)dataBuffer
+        gradBuffer:(id<MTLBuffer>)gradBuffer
+        squareAvgBuffer:(id<MTLBuffer>)squareAvgBuffer
+        params:params];
+}
+*/
+import "C"
+import (
+	_ "embed"
+	"unsafe"
+
+	"github.com/atkhx/metal/mtl"
+)
+
+//go:embed kernel.metal
+var metalFunctions string
+
+func New(device *mtl.Device) *Kernel {
+	cKernelString := C.CString(metalFunctions)
+	defer C.free(unsafe.Pointer(cKernelString))
+
+	return &Kernel{
+		kernelID: C.rmspropKernelCreate(device.GetID(), cKernelString),
+	}
+}
+
+type Kernel struct {
+	kernelID unsafe.Pointer
+}
+
+// Update keeps the running average of squared gradients v = alpha*v + (1-alpha)*grad^2
+// and applies data -= learningRate * grad / (sqrt(v) + eps).
+func (k *Kernel) Update(b *mtl.CommandBuffer, data, grad, squareAvg *mtl.Buffer, learningRate, alpha, eps float32) {
+	C.rmspropUpdate(
+		k.kernelID,
+		b.GetID(),
+		data.GetID(),
+		grad.GetID(),
+		squareAvg.GetID(),
+		C.RMSpropParams{
+			learningRate: C.float(learningRate),
+			alpha:        C.float(alpha),
+			eps:          C.float(eps),
+		},
+	)
+}
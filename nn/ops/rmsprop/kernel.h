@@ -0,0 +1,29 @@
+#ifndef RMSpropKernel_h
+#define RMSpropKernel_h
+
+#import <Foundation/Foundation.h>
+#import <Metal/Metal.h>
+
+typedef struct {
+    float learningRate;
+    float alpha;
+    float eps;
+} RMSpropParams;
+
+@protocol RMSpropKernel <NSObject>
+
+- (instancetype) initWithDevice:(id<MTLDevice>)device kernelSource:(NSString*)kernelSource;
+
+- (void) update:(id<MTLCommandBuffer>)commandBuffer
+        dataBuffer:(id<MTLBuffer>)dataBuffer
+        gradBuffer:(id<MTLBuffer>)gradBuffer
+        squareAvgBuffer:(id<MTLBuffer>)squareAvgBuffer
+        params:(RMSpropParams)params;
+
+@end
+
+@interface RMSpropKernelImpl : NSObject <RMSpropKernel>
+    @property (nonatomic, strong) id<MTLLibrary> library;
+@end
+
+#endif /* RMSpropKernel_h */
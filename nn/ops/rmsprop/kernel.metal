@@ -0,0 +1,28 @@
+#include <metal_stdlib>
+
+using namespace metal;
+
+struct RMSpropParams {
+    float learningRate;
+    float alpha;
+    float eps;
+};
+
+// Non-finite gradients are treated as zeros like in adamw.
+static inline float finiteGrad(float g) {
+    return (isnan(g) || isinf(g)) ? 0.0 : g;
+}
+
+kernel void rmspropUpdate(
+    device float *dataBuffer [[ buffer(0) ]],
+    device const float *gradBuffer [[ buffer(1) ]],
+    device float *squareAvgBuffer [[ buffer(2) ]],
+    constant RMSpropParams& p [[ buffer(3) ]],
+    const uint id [[ thread_position_in_grid ]] )
+{
+    float g = finiteGrad(gradBuffer[id]);
+    float v = p.alpha * squareAvgBuffer[id] + (1 - p.alpha) * g * g;
+    squareAvgBuffer[id] = v;
+
+    dataBuffer[id] -= p.learningRate * g / (sqrt(v) + p.eps);
+}
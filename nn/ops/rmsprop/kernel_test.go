@@ -0,0 +1,30 @@
+package rmsprop
+
+import (
+	"testing"
+
+	"github.com/atkhx/metal/mtl"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKernel(t *testing.T) {
+	device := mtl.MustCreateSystemDefaultDevice()
+	defer device.Release()
+
+	kernel := New(device)
+
+	data := device.NewBufferWithFloats([]float32{1, 2}, mtl.ResourceStorageModeShared)
+	grad := device.NewBufferWithFloats([]float32{0.5, -1}, mtl.ResourceStorageModeShared)
+	squareAvg := device.NewBufferWithFloats([]float32{0, 1}, mtl.ResourceStorageModeShared)
+
+	cmd := device.NewCommandQueue().GetNewMTLCommandBuffer()
+	defer cmd.Release()
+
+	kernel.Update(cmd, data, grad, squareAvg, 0.1, 0.9, 0)
+	cmd.Commit()
+	cmd.WaitUntilCompleted()
+
+	// v = 0.9*[0, 1] + 0.1*[0.25, 1], data -= 0.1 * grad / sqrt(v)
+	require.InDeltaSlice(t, []float32{0.025, 1}, squareAvg.GetFloats(), 1e-6)
+	require.InDeltaSlice(t, []float32{0.6837722, 2.1}, data.GetFloats(), 1e-6)
+}
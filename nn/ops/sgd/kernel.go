@@ -0,0 +1,101 @@
+package sgd
+
+/*
+#cgo CFLAGS: -x objective-c
+#cgo LDFLAGS: -framework Metal -framework MetalPerformanceShaders -framework CoreGraphics -framework Foundation
+
+#include "kernel.h"
+
+void* sgdKernelCreate(void *device, const char *kernelSource) {
+    return [[SGDKernelImpl alloc] initWithDevice:(id<MTLDevice>)device
+		kernelSource:[NSString stringWithUTF8String:kernelSource]];
+}
+
+void sgdUpdate(
+    void *kernel,
+    void *commandBuffer,
+    void *dataBuffer,
+    void *gradBuffer,
+    SGDParams params
+) {
+    [(__bridge SGDKernelImpl*)kernel update:(id<MTLCommandBuffer>)commandBuffer
+        dataBuffer:(id<MTLBuffer>)dataBuffer
+        gradBuffer:(id<MTLBuffer>)gradBuffer
+        params:params];
+}
+
+void sgdUpdateWithMomentum(
+    void *kernel,
+    void *commandBuffer,
+    void *dataBuffer,
+    void *gradBuffer,
+    void *velocityBuffer,
+    SGDParams params
+) {
+    [(__bridge SGDKernelImpl*)kernel updateWithMomentum:(id<MTLCommandBuffer>)commandBuffer
+        dataBuffer:(id<MTLBuffer>)dataBuffer
+        gradBuffer:(id<MTLBuffer>)gradBuffer
+        velocityBuffer:(id<MTLBuffer>)velocityBuffer
+        params:params];
+}
+*/
+import "C"
+import (
+	_ "embed"
+	"unsafe"
+
+	"github.com/atkhx/metal/mtl"
+)
+
+//go:embed kernel.metal
+var metalFunctions string
+
+func New(device *mtl.Device) *Kernel {
+	cKernelString := C.CString(metalFunctions)
+	defer C.free(unsafe.Pointer(cKernelString))
+
+	return &Kernel{
+		kernelID: C.sgdKernelCreate(device.GetID(), cKernelString),
+	}
+}
+
+type Kernel struct {
+	kernelID unsafe.Pointer
+}
+
+// Update applies plain gradient descent: data -= learningRate * grad.
+func (k *Kernel) Update(b *mtl.CommandBuffer, data, grad *mtl.Buffer, learningRate float32) {
+	C.sgdUpdate(
+		k.kernelID,
+		b.GetID(),
+		data.GetID(),
+		grad.GetID(),
+		C.SGDParams{learningRate: C.float(learningRate)},
+	)
+}
+
+// UpdateWithMomentum keeps the velocity v = momentum*v + grad and applies data -= learningRate * v,
+// with Nesterov momentum data -= learningRate * (grad + momentum*v).
+func (k *Kernel) UpdateWithMomentum(
+	b *mtl.CommandBuffer,
+	data, grad, velocity *mtl.Buffer,
+	learningRate, momentum float32,
+	nesterov bool,
+) {
+	params := C.SGDParams{
+		learningRate: C.float(learningRate),
+		momentum:     C.float(momentum),
+	}
+	if nesterov {
+		params.nesterov = 1
+	}
+
+	C.sgdUpdateWithMomentum(
+		k.kernelID,
+		b.GetID(),
+		data.GetID(),
+		grad.GetID(),
+		velocity.GetID(),
+		params,
+	)
+}
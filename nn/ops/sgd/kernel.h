@@ -0,0 +1,34 @@
+#ifndef SGDKernel_h
+#define SGDKernel_h
+
+#import <Foundation/Foundation.h>
+#import <Metal/Metal.h>
+
+typedef struct {
+    float learningRate;
+    float momentum;
+    uint nesterov;
+} SGDParams;
+
+@protocol SGDKernel <NSObject>
+
+- (instancetype) initWithDevice:(id<MTLDevice>)device kernelSource:(NSString*)kernelSource;
+
+- (void) update:(id<MTLCommandBuffer>)commandBuffer
+        dataBuffer:(id<MTLBuffer>)dataBuffer
+        gradBuffer:(id<MTLBuffer>)gradBuffer
+        params:(SGDParams)params;
+
+- (void) updateWithMomentum:(id<MTLCommandBuffer>)commandBuffer
+        dataBuffer:(id<MTLBuffer>)dataBuffer
+        gradBuffer:(id<MTLBuffer>)gradBuffer
+        velocityBuffer:(id<MTLBuffer>)velocityBuffer
+        params:(SGDParams)params;
+
+@end
+
+@interface SGDKernelImpl : NSObject <SGDKernel>
+    @property (nonatomic, strong) id<MTLLibrary> library;
+@end
+
+#endif /* SGDKernel_h */
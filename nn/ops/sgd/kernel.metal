@@ -0,0 +1,37 @@
+#include <metal_stdlib>
+
+using namespace metal;
+
+struct SGDParams {
+    float learningRate;
+    float momentum;
+    uint nesterov;
+};
+
+// Non-finite gradients are treated as zeros like in adamw.
+static inline float finiteGrad(float g) {
+    return (isnan(g) || isinf(g)) ? 0.0 : g;
+}
+
+kernel void sgdUpdate(
+    device float *dataBuffer [[ buffer(0) ]],
+    device const float *gradBuffer [[ buffer(1) ]],
+    constant SGDParams& p [[ buffer(2) ]],
+    const uint id [[ thread_position_in_grid ]] )
+{
+    dataBuffer[id] -= p.learningRate * finiteGrad(gradBuffer[id]);
+}
+
+kernel void sgdUpdateWithMomentum(
+    device float *dataBuffer [[ buffer(0) ]],
+    device const float *gradBuffer [[ buffer(1) ]],
+    device float *velocityBuffer [[ buffer(2) ]],
+    constant SGDParams& p [[ buffer(3) ]],
+    const uint id [[ thread_position_in_grid ]] )
+{
+    float g = finiteGrad(gradBuffer[id]);
+    float v = p.momentum * velocityBuffer[id] + g;
+    velocityBuffer[id] = v;
+
+    dataBuffer[id] -= p.learningRate * (p.nesterov ? g + p.momentum * v : v);
+}
@@ -0,0 +1,64 @@
+package sgd
+
+import (
+	"testing"
+
+	"github.com/atkhx/metal/mtl"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKernel(t *testing.T) {
+	device := mtl.MustCreateSystemDefaultDevice()
+	defer device.Release()
+
+	kernel := New(device)
+
+	testCases := []struct {
+		name        string
+		momentum    float32
+		nesterov    bool
+		expData     []float32
+		expVelocity []float32
+	}{
+		{
+			name:        "plain",
+			expData:     []float32{0.95, 2.1},
+			expVelocity: []float32{1, 0},
+		},
+		{
+			name:        "momentum",
+			momentum:    0.9,
+			expData:     []float32{0.86, 2.1},
+			expVelocity: []float32{1.4, -1},
+		},
+		{
+			name:        "nesterov",
+			momentum:    0.9,
+			nesterov:    true,
+			expData:     []float32{0.824, 2.19},
+			expVelocity: []float32{1.4, -1},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			data := device.NewBufferWithFloats([]float32{1, 2}, mtl.ResourceStorageModeShared)
+			grad := device.NewBufferWithFloats([]float32{0.5, -1}, mtl.ResourceStorageModeShared)
+			velocity := device.NewBufferWithFloats([]float32{1, 0}, mtl.ResourceStorageModeShared)
+
+			cmd := device.NewCommandQueue().GetNewMTLCommandBuffer()
+			defer cmd.Release()
+
+			if tc.momentum == 0 {
+				kernel.Update(cmd, data, grad, 0.1)
+			} else {
+				kernel.UpdateWithMomentum(cmd, data, grad, velocity, 0.1, tc.momentum, tc.nesterov)
+			}
+			cmd.Commit()
+			cmd.WaitUntilCompleted()
+
+			require.InDeltaSlice(t, tc.expData, data.GetFloats(), 1e-6)
+			require.InDeltaSlice(t, tc.expVelocity, velocity.GetFloats(), 1e-6)
+		})
+	}
+}
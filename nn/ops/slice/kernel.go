@@ -0,0 +1,127 @@
+package slice
+
+/*
+#cgo CFLAGS: -x objective-c
+#cgo LDFLAGS: -framework Metal -framework MetalPerformanceShaders -framework CoreGraphics -framework Foundation
+
+#include "kernel.h"
+
+void* sliceKernelCreate(void *device, const char *kernelSource) {
+    return [[SliceKernelImpl alloc] initWithDevice:(id<MTLDevice>)device
+		kernelSource:[NSString stringWithUTF8String:kernelSource]];
+}
+
+void sliceGather(
+    void *kernel,
+    void *commandBuffer,
+    void *bigData,
+    void *windowData,
+    SliceParams params
+) {
+    [(__bridge SliceKernelImpl*)kernel gather:(id<MTLCommandBuffer>)commandBuffer
+        bigData:(id<MTLBuffer>)bigData
+        windowData:(id<MTLBuffer>)windowData
+        params:params];
+}
+
+void sliceScatter(
+    void *kernel,
+    void *commandBuffer,
+    void *windowData,
+    void *bigData,
+    SliceParams params
+) {
+    [(__bridge SliceKernelImpl*)kernel scatter:(id<MTLCommandBuffer>)commandBuffer
+        windowData:(id<MTLBuffer>)windowData
+        bigData:(id<MTLBuffer>)bigData
+        params:params];
+}
+*/
+import "C"
+import (
+	_ "embed"
+	"fmt"
+	"unsafe"
+
+	"github.com/atkhx/metal/mtl"
+	"github.com/atkhx/metal/nn/num"
+)
+
+//go:embed kernel.metal
+var metalFunctions string
+
+// New creates kernel which copies the box of output.Dims at offset out of input.
+// Gradients are accumulated back into the same box of input.Grad.
+func New(device *mtl.Device, input, output *num.Data, offset mtl.MTLSize) *Kernel {
+	return newKernel(device, input, output, input.Dims, output.Dims, offset, false)
+}
+
+// NewInsert creates kernel which writes input into the box at offset of output,
+// the rest of output is left untouched. It is the building block of concatenation.
+func NewInsert(device *mtl.Device, input, output *num.Data, offset mtl.MTLSize) *Kernel {
+	return newKernel(device, input, output, output.Dims, input.Dims, offset, true)
+}
+
+func newKernel(
+	device *mtl.Device,
+	input *num.Data,
+	output *num.Data,
+	big mtl.MTLSize,
+	window mtl.MTLSize,
+	offset mtl.MTLSize,
+	insert bool,
+) *Kernel {
+	if offset.W+window.W > big.W || offset.H+window.H > big.H || offset.D+window.D > big.D {
+		panic(fmt.Sprintf("slice: window %v at offset %v is out of %v", window, offset, big))
+	}
+
+	cKernelString := C.CString(metalFunctions)
+	defer C.free(unsafe.Pointer(cKernelString))
+
+	return &Kernel{
+		kernelID: C.sliceKernelCreate(device.GetID(), cKernelString),
+		input:    input,
+		output:   output,
+		insert:   insert,
+		params: C.SliceParams{
+			bigW:    C.uint(big.W),
+			bigH:    C.uint(big.H),
+			windowW: C.uint(window.W),
+			windowH: C.uint(window.H),
+			windowD: C.uint(window.D),
+			offsetW: C.uint(offset.W),
+			offsetH: C.uint(offset.H),
+			offsetD: C.uint(offset.D),
+		},
+	}
+}
+
+type Kernel struct {
+	kernelID unsafe.Pointer
+	input    *num.Data
+	output   *num.Data
+	insert   bool
+	params   C.SliceParams
+}
+
+func (k *Kernel) Forward(b *mtl.CommandBuffer) {
+	params := k.params
+	params.accumulate = 0
+
+	if k.insert {
+		C.sliceScatter(k.kernelID, b.GetID(), k.input.Data.GetID(), k.output.Data.GetID(), params)
+	} else {
+		C.sliceGather(k.kernelID, b.GetID(), k.input.Data.GetID(), k.output.Data.GetID(), params)
+	}
+}
+
+func (k *Kernel) Backward(b *mtl.CommandBuffer) {
+	params := k.params
+	params.accumulate = 1
+
+	if k.insert {
+		C.sliceGather(k.kernelID, b.GetID(), k.output.Grad.GetID(), k.input.Grad.GetID(), params)
+	} else {
+		C.sliceScatter(k.kernelID, b.GetID(), k.output.Grad.GetID(), k.input.Grad.GetID(), params)
+	}
+}
@@ -0,0 +1,39 @@
+#ifndef SliceKernel_h
+#define SliceKernel_h
+
+#import <Foundation/Foundation.h>
+#import <Metal/Metal.h>
+
+typedef struct {
+    uint bigW;
+    uint bigH;
+    uint windowW;
+    uint windowH;
+    uint windowD;
+    uint offsetW;
+    uint offsetH;
+    uint offsetD;
+    uint accumulate;
+} SliceParams;
+
+@protocol SliceKernel <NSObject>
+
+- (instancetype) initWithDevice:(id<MTLDevice>)device kernelSource:(NSString*)kernelSource;
+
+- (void) gather:(id<MTLCommandBuffer>)commandBuffer
+        bigData:(id<MTLBuffer>)bigData
+        windowData:(id<MTLBuffer>)windowData
+        params:(SliceParams)params;
+
+- (void) scatter:(id<MTLCommandBuffer>)commandBuffer
+        windowData:(id<MTLBuffer>)windowData
+        bigData:(id<MTLBuffer>)bigData
+        params:(SliceParams)params;
+
+@end
+
+@interface SliceKernelImpl : NSObject <SliceKernel>
+    @property (nonatomic, strong) id<MTLLibrary> library;
+@end
+
+#endif /* SliceKernel_h */
@@ -0,0 +1,82 @@
+#import "kernel.h"
+#import <Foundation/Foundation.h>
+#include <stdio.h>
+
+static inline MTLSize threadgroupSize1D(id<MTLComputePipelineState> pso) {
+    NSUInteger w = pso.threadExecutionWidth;
+    NSUInteger max = pso.maxTotalThreadsPerThreadgroup;
+    if (w > max) {
+        w = max;
+    }
+    return MTLSizeMake(w, 1, 1);
+}
+
+@implementation SliceKernelImpl {
+    id<MTLDevice> _device;
+
+    id<MTLComputePipelineState> _gatherPSO;
+    id<MTLComputePipelineState> _scatterPSO;
+
+    NSError *error;
+}
+
+- (id<MTLComputePipelineState>)createPipelineStateWithFunctionName:(NSString *)functionName {
+    id<MTLFunction> function = [self.library newFunctionWithName:functionName];
+    if (!function) {
+        printf("Failed to load function %s!\n", [functionName UTF8String]);
+        return nil;
+    }
+
+    id<MTLComputePipelineState> pipelineState = [_device newComputePipelineStateWithFunction:function error:&error];
+    if (error != nil) {
+        const char *errorCString = [[error localizedDescription] UTF8String];
+        printf("Failed to create pipeline state: %s\n", errorCString);
+        return nil;
+    }
+    return pipelineState;
+}
+
+- (instancetype)initWithDevice:(id<MTLDevice>)device kernelSource:(NSString*)kernelSource {
+    self = [super init];
+    if (self) {
+        _device = device;
+
+        self.library = [_device newLibraryWithSource:kernelSource options:nil error:&error];
+
+        _gatherPSO = [self createPipelineStateWithFunctionName:@"sliceGather"];
+        _scatterPSO = [self createPipelineStateWithFunctionName:@"sliceScatter"];
+    }
+    return self;
+}
+
+- (void) gather:(id<MTLCommandBuffer>)commandBuffer
+        bigData:(id<MTLBuffer>)bigData
+        windowData:(id<MTLBuffer>)windowData
+        params:(SliceParams)params
+{
+    id<MTLComputeCommandEncoder> gather = [commandBuffer computeCommandEncoder];
+    [gather setComputePipelineState:_gatherPSO];
+    [gather setBuffer:bigData offset:0 atIndex:0];
+    [gather setBuffer:windowData offset:0 atIndex:1];
+    [gather setBytes:&params length:sizeof(SliceParams) atIndex:2];
+    [gather dispatchThreads:MTLSizeMake(params.windowW * params.windowH * params.windowD, 1, 1)
+      threadsPerThreadgroup:threadgroupSize1D(_gatherPSO)];
+    [gather endEncoding];
+}
+
+- (void) scatter:(id<MTLCommandBuffer>)commandBuffer
+        windowData:(id<MTLBuffer>)windowData
+        bigData:(id<MTLBuffer>)bigData
+        params:(SliceParams)params
+{
+    id<MTLComputeCommandEncoder> scatter = [commandBuffer computeCommandEncoder];
+    [scatter setComputePipelineState:_scatterPSO];
+    [scatter setBuffer:windowData offset:0 atIndex:0];
+    [scatter setBuffer:bigData offset:0 atIndex:1];
+    [scatter setBytes:&params length:sizeof(SliceParams) atIndex:2];
+    [scatter dispatchThreads:MTLSizeMake(params.windowW * params.windowH * params.windowD, 1, 1)
+       threadsPerThreadgroup:threadgroupSize1D(_scatterPSO)];
+    [scatter endEncoding];
+}
+
+@end
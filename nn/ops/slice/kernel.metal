@@ -0,0 +1,62 @@
+#include <metal_stdlib>
+
+using namespace metal;
+
+// The window is a box of windowW x windowH x windowD elements
+// placed at offset inside the big tensor of bigW x bigH x (any) elements.
+struct SliceParams {
+    uint bigW;
+    uint bigH;
+    uint windowW;
+    uint windowH;
+    uint windowD;
+    uint offsetW;
+    uint offsetH;
+    uint offsetD;
+    uint accumulate;
+};
+
+inline uint bigIndex(constant SliceParams& p, uint id) {
+    uint x = id % p.windowW;
+    uint y = (id / p.windowW) % p.windowH;
+    uint z = id / (p.windowW * p.windowH);
+    return ((z + p.offsetD) * p.bigH + y + p.offsetH) * p.bigW + x + p.offsetW;
+}
+
+// sliceGather copies the window out of the big tensor.
+kernel void sliceGather(
+    device const float *bigData [[ buffer(0) ]],
+    device float *windowData [[ buffer(1) ]],
+    constant SliceParams& p [[ buffer(2) ]],
+    const uint id [[ thread_position_in_grid ]] )
+{
+    if (id >= p.windowW * p.windowH * p.windowD) {
+        return;
+    }
+
+    float v = bigData[bigIndex(p, id)];
+    if (p.accumulate) {
+        windowData[id] += v;
+    } else {
+        windowData[id] = v;
+    }
+}
+
+// sliceScatter copies the window into its place in the big tensor.
+kernel void sliceScatter(
+    device const float *windowData [[ buffer(0) ]],
+    device float *bigData [[ buffer(1) ]],
+    constant SliceParams& p [[ buffer(2) ]],
+    const uint id [[ thread_position_in_grid ]] )
+{
+    if (id >= p.windowW * p.windowH * p.windowD) {
+        return;
+    }
+
+    uint i = bigIndex(p, id);
+    if (p.accumulate) {
+        bigData[i] += windowData[id];
+    } else {
+        bigData[i] = windowData[id];
+    }
+}
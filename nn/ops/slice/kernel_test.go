@@ -0,0 +1,80 @@
+package slice
+
+import (
+	"testing"
+
+	"github.com/atkhx/metal/mtl"
+	"github.com/atkhx/metal/nn/num"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKernel(t *testing.T) {
+	device := mtl.MustCreateSystemDefaultDevice()
+	defer device.Release()
+
+	newData := func(values []float32, dims mtl.MTLSize) *num.Data {
+		return &num.Data{
+			Data: device.NewBufferWithFloats(values, mtl.ResourceStorageModeShared),
+			Grad: device.NewBufferEmptyFloatsBuffer(dims.Length(), mtl.ResourceStorageModeShared),
+			Dims: dims,
+		}
+	}
+
+	t.Run("slice", func(t *testing.T) {
+		inputValues := make([]float32, 24)
+		for i := range inputValues {
+			inputValues[i] = float32(i)
+		}
+
+		input := newData(inputValues, mtl.NewMTLSize(4, 3, 2))
+		output := newData(make([]float32, 8), mtl.NewMTLSize(2, 2, 2))
+		copy(output.Grad.GetFloats(), []float32{1, 2, 3, 4, 5, 6, 7, 8})
+
+		kernel := New(device, input, output, mtl.NewMTLSize(1, 1, 0))
+
+		cmd := device.NewCommandQueue().GetNewMTLCommandBuffer()
+		defer cmd.Release()
+		kernel.Forward(cmd)
+		kernel.Backward(cmd)
+		cmd.Commit()
+		cmd.WaitUntilCompleted()
+
+		require.Equal(t, []float32{5, 6, 9, 10, 17, 18, 21, 22}, output.Data.GetFloats())
+		require.Equal(t, []float32{
+			0, 0, 0, 0,
+			0, 1, 2, 0,
+			0, 3, 4, 0,
+
+			0, 0, 0, 0,
+			0, 5, 6, 0,
+			0, 7, 8, 0,
+		}, input.Grad.GetFloats())
+	})
+
+	t.Run("insert", func(t *testing.T) {
+		input := newData([]float32{7, 8}, mtl.NewMTLSize(2, 1, 1))
+		output := newData([]float32{-1, -1, -1, -1, -1, -1}, mtl.NewMTLSize(3, 2, 1))
+		copy(output.Grad.GetFloats(), []float32{0, 1, 2, 3, 4, 5})
+
+		kernel := NewInsert(device, input, output, mtl.NewMTLSize(1, 1, 0))
+
+		cmd := device.NewCommandQueue().GetNewMTLCommandBuffer()
+		defer cmd.Release()
+		kernel.Forward(cmd)
+		kernel.Backward(cmd)
+		cmd.Commit()
+		cmd.WaitUntilCompleted()
+
+		require.Equal(t, []float32{-1, -1, -1, -1, 7, 8}, output.Data.GetFloats())
+		require.Equal(t, []float32{4, 5}, input.Grad.GetFloats())
+	})
+
+	t.Run("out of bounds", func(t *testing.T) {
+		input := newData(make([]float32, 6), mtl.NewMTLSize(3, 2, 1))
+		output := newData(make([]float32, 4), mtl.NewMTLSize(2, 2, 1))
+
+		require.Panics(t, func() {
+			New(device, input, output, mtl.NewMTLSize(2, 0, 0))
+		})
+	})
+}
@@ -13,10 +13,10 @@ func New(device *mtl.Device, input, output *num.Data) *Kernel {
 		forwardKernel:  mps.CreateMatrixSoftMaxKernel(device),
 		backwardKernel: mps.CreateMatrixSoftMaxGradientKernel(device),
 
-		inputDataMatrix:  mps.CreateMatrixWithBuffer(descriptor, input.Data, 0),
-		inputGradMatrix:  mps.CreateMatrixWithBuffer(descriptor, input.Grad, 0),
-		outputDataMatrix: mps.CreateMatrixWithBuffer(descriptor, output.Data, 0),
-		outputGradMatrix: mps.CreateMatrixWithBuffer(descriptor, output.Grad, 0),
+		inputDataMatrix:  mps.NewMatrixBinding(descriptor, &input.Data, 0),
+		inputGradMatrix:  mps.NewMatrixBinding(descriptor, &input.Grad, 0),
+		outputDataMatrix: mps.NewMatrixBinding(descriptor, &output.Data, 0),
+		outputGradMatrix: mps.NewMatrixBinding(descriptor, &output.Grad, 0),
 	}
 }
 
@@ -24,16 +24,16 @@ type Kernel struct {
 	forwardKernel  *mps.MatrixSoftMaxKernel
 	backwardKernel *mps.MatrixSoftMaxGradientKernel
 
-	inputDataMatrix  *mps.Matrix
-	inputGradMatrix  *mps.Matrix
-	outputDataMatrix *mps.Matrix
-	outputGradMatrix *mps.Matrix
+	inputDataMatrix  *mps.MatrixBinding
+	inputGradMatrix  *mps.MatrixBinding
+	outputDataMatrix *mps.MatrixBinding
+	outputGradMatrix *mps.MatrixBinding
 }
 
 func (op *Kernel) Forward(b *mtl.CommandBuffer) {
-	op.forwardKernel.Encode(b, op.inputDataMatrix, op.outputDataMatrix)
+	op.forwardKernel.Encode(b, op.inputDataMatrix.Matrix(), op.outputDataMatrix.Matrix())
 }
 
 func (op *Kernel) Backward(b *mtl.CommandBuffer) {
-	op.backwardKernel.Encode(b, op.outputGradMatrix, op.outputDataMatrix, op.inputGradMatrix)
+	op.backwardKernel.Encode(b, op.outputGradMatrix.Matrix(), op.outputDataMatrix.Matrix(), op.inputGradMatrix.Matrix())
 }
@@ -63,12 +63,11 @@ void vaeSampleBackward(
 import "C"
 import (
 	_ "embed"
-	"time"
 	"unsafe"
 
-	"github.com/atkhx/metal/mps"
 	"github.com/atkhx/metal/mtl"
 	"github.com/atkhx/metal/nn/num"
+	"github.com/atkhx/metal/nn/ops/philox"
 )
 
 //go:embed kernel.metal
@@ -78,21 +77,13 @@ func New(
 	device *mtl.Device,
 	input *num.Data,
 	output *num.Data,
+	seed uint64,
 ) *Kernel {
 	cKernelString := C.CString(metalFunctions)
 	defer C.free(unsafe.Pointer(cKernelString))
 
-	distribution := mps.CreateMatrixRandomDistributionDescriptor(0, 1)
-	randomizer := mps.CreateMatrixRandomMTGP32(device, distribution, uint64(time.Now().UnixNano()))
-
+	// two uniform values per output for the Box-Muller transform
 	randomBuffer := device.NewBufferEmptyFloatsBuffer(output.Dims.Length()*2, mtl.ResourceStorageModeShared)
-	randomDescriptor := mps.CreateMatrixDescriptorFloat32(
-		output.Dims.W*2,
-		output.Dims.H*output.Dims.D,
-		1,
-		output.Dims.W*output.Dims.H*output.Dims.D*2,
-	)
-	randomMatrix := mps.CreateMatrixWithBuffer(randomDescriptor, randomBuffer, 0)
 
 	epsBuffer := device.NewBufferEmptyFloatsBuffer(output.Dims.Length(), mtl.ResourceStorageModeShared)
 
@@ -103,8 +94,8 @@ func New(
 		input:  input,
 		output: output,
 
-		randomizer:   randomizer,
-		randomMatrix: randomMatrix,
+		randomizer:   philox.New(device, seed),
+		randomBuffer: randomBuffer,
 		epsBuffer:    epsBuffer,
 	}
 }
@@ -116,21 +107,38 @@ type Kernel struct {
 	input  *num.Data
 	output *num.Data
 
-	randomizer   *mps.MatrixRandomMTGP32
-	randomMatrix *mps.Matrix
+	randomizer   *philox.Kernel
+	randomBuffer *mtl.Buffer
 	epsBuffer    *mtl.Buffer
+
+	draws uint64
 }
 
 func (k *Kernel) Forward(b *mtl.CommandBuffer) {
-	k.randomizer.Encode(b, k.randomMatrix)
+	k.randomizer.Uniform(b, k.randomBuffer, k.draws)
+	k.draws++
+	k.Replay(b)
+}
+
+// Draws returns the number of times the noise has been drawn.
+func (k *Kernel) Draws() uint64 {
+	return k.draws
+}
+
+// SetDraws makes the next Forward draw the noise it would draw after draws calls of Forward.
+func (k *Kernel) SetDraws(draws uint64) {
+	k.draws = draws
+}
 
+// Replay samples again with the noise drawn by the last Forward.
+func (k *Kernel) Replay(b *mtl.CommandBuffer) {
 	C.vaeSampleForward(
 		k.kernelID,
 		b.GetID(),
 		k.input.Data.GetID(),
 		k.output.Data.GetID(),
 		k.epsBuffer.GetID(),
-		k.randomMatrix.GetData().GetID(),
+		k.randomBuffer.GetID(),
 		C.uint(k.input.Dims.W),
 		C.uint(k.input.Dims.H),
 		C.uint(k.output.Dims.W),
@@ -0,0 +1,130 @@
+package optimizer
+
+import (
+	"github.com/atkhx/metal/mtl"
+	"github.com/atkhx/metal/nn/num"
+	"github.com/atkhx/metal/nn/ops/adafactor"
+	"github.com/atkhx/metal/nn/proc"
+	"github.com/atkhx/metal/nn/schedule"
+)
+
+type AdafactorConfig struct {
+	LearningRate float32
+	// Beta2 is the decay of the second moment averages, usually 0.999.
+	Beta2 float32
+	// Eps is added to squared gradients, usually 1e-30.
+	Eps float32
+	// ClipThreshold limits the RMS of the update, usually 1. Zero disables clipping.
+	ClipThreshold float32
+	// Schedule scales LearningRate every step, nil keeps it constant.
+	Schedule schedule.Schedule
+}
+
+// adafactorShape returns the matrix the second moments of a node with dims are factored by:
+// rows are H*D, columns are W. Vectors are not factored.
+func adafactorShape(dims mtl.MTLSize) (rows, cols int, factored bool) {
+	rows, cols = dims.H*dims.D, dims.W
+	return rows, cols, rows > 1 && cols > 1
+}
+
+// Adafactor keeps second moments of matrices factored into averages by rows and by columns
+// (Shazeer and Stern, 2018), so its state takes rows+cols values instead of rows*cols.
+// Vectors keep the full second moment. The update is not scaled by the parameter RMS
+// and has no first moment.
+func Adafactor(device *mtl.Device, cfg AdafactorConfig, groups ...ParamGroup[AdafactorConfig]) proc.Optimizer {
+	kernel := adafactor.New(device)
+
+	return func(nodes []*num.Data) (proc.Optimize, proc.OptimizerState) {
+		configs, _ := groupConfigs(nodes, cfg, groups)
+		rowAvg := make([]*mtl.Buffer, len(nodes))
+		colAvg := make([]*mtl.Buffer, len(nodes))
+		stats := make([]*mtl.Buffer, len(nodes))
+
+		for i, node := range nodes {
+			rows, cols, factored := adafactorShape(node.Dims)
+			if factored {
+				rowAvg[i] = device.NewBufferEmptyFloatsBuffer(rows, mtl.ResourceStorageModeShared)
+				colAvg[i] = device.NewBufferEmptyFloatsBuffer(cols, mtl.ResourceStorageModeShared)
+				stats[i] = device.NewBufferEmptyFloatsBuffer(adafactor.StatsLength(rows), mtl.ResourceStorageModeShared)
+			} else {
+				rowAvg[i] = device.NewBufferEmptyFloatsBuffer(node.Dims.Length(), mtl.ResourceStorageModeShared)
+				stats[i] = device.NewBufferEmptyFloatsBuffer(adafactor.StatsLength(1), mtl.ResourceStorageModeShared)
+			}
+		}
+
+		return func(b *mtl.CommandBuffer, iteration int) {
+			for i, node := range nodes {
+				c := configs[i]
+				lr := c.LearningRate * schedule.FactorAt(c.Schedule, iteration)
+				rows, cols, factored := adafactorShape(node.Dims)
+				if factored {
+					kernel.UpdateFactored(b, node.Data, node.Grad, rowAvg[i], colAvg[i], stats[i], rows, cols,
+						lr, c.Beta2, c.Eps, c.ClipThreshold)
+				} else {
+					kernel.Update(b, node.Data, node.Grad, rowAvg[i], stats[i],
+						lr, c.Beta2, c.Eps, c.ClipThreshold)
+				}
+			}
+		}, proc.OptimizerState{"rowAvg": rowAvg, "colAvg": colAvg}
+	}
+}
+
+// AdafactorReference updates data viewed as a rows x cols matrix in place. With colAvg the second
+// moments are factored: rowAvg and colAvg hold averages by rows and by columns. Without it
+// rowAvg holds the full second moment.
+func AdafactorReference(cfg AdafactorConfig, data, grad []float32, rows, cols int, rowAvg, colAvg []float32) {
+	factored := colAvg != nil
+
+	g2 := make([]float32, len(data))
+	for i := range data {
+		g := finiteGrad(grad[i])
+		g2[i] = g*g + cfg.Eps
+	}
+
+	var rowMean float32
+	if factored {
+		for i := 0; i < rows; i++ {
+			var sum float32
+			for j := 0; j < cols; j++ {
+				sum += g2[i*cols+j]
+			}
+			rowAvg[i] = cfg.Beta2*rowAvg[i] + (1-cfg.Beta2)*sum/float32(cols)
+			rowMean += rowAvg[i] / float32(rows)
+		}
+		for j := 0; j < cols; j++ {
+			var sum float32
+			for i := 0; i < rows; i++ {
+				sum += g2[i*cols+j]
+			}
+			colAvg[j] = cfg.Beta2*colAvg[j] + (1-cfg.Beta2)*sum/float32(rows)
+		}
+	} else {
+		for i := range rowAvg {
+			rowAvg[i] = cfg.Beta2*rowAvg[i] + (1-cfg.Beta2)*g2[i]
+		}
+	}
+
+	update := make([]float32, len(data))
+	var sumSquares float32
+	for i := 0; i < rows; i++ {
+		for j := 0; j < cols; j++ {
+			var v float32
+			if factored {
+				v = rowAvg[i] * colAvg[j] / rowMean
+			} else {
+				v = rowAvg[i*cols+j]
+			}
+			u := finiteGrad(grad[i*cols+j]) / sqrt(v)
+			update[i*cols+j] = u
+			sumSquares += u * u
+		}
+	}
+
+	scale := float32(1)
+	if rms := sqrt(sumSquares / float32(len(data))); cfg.ClipThreshold > 0 && rms > cfg.ClipThreshold {
+		scale = rms / cfg.ClipThreshold
+	}
+	for i := range data {
+		data[i] -= cfg.LearningRate * update[i] / scale
+	}
+}
@@ -0,0 +1,79 @@
+package optimizer
+
+import (
+	"math"
+
+	"github.com/atkhx/metal/mtl"
+	"github.com/atkhx/metal/nn/num"
+	"github.com/atkhx/metal/nn/ops/adamw"
+	"github.com/atkhx/metal/nn/proc"
+	"github.com/atkhx/metal/nn/schedule"
+)
+
+type AdamWConfig struct {
+	LearningRate float32
+	Beta1        float32
+	Beta2        float32
+	Eps          float32
+	// WeightDecay shrinks params by LearningRate*WeightDecay every step apart from the gradient.
+	// The default config decays only weights: biases, norm gains and embeddings are not decayed.
+	// Groups decay all params they match.
+	WeightDecay float32
+	// Schedule scales LearningRate every step, nil keeps it constant.
+	Schedule schedule.Schedule
+}
+
+// adamWConfigs returns the config of every node with the weight decay of the default config
+// applied only to weights.
+func adamWConfigs(nodes []*num.Data, cfg AdamWConfig, groups []ParamGroup[AdamWConfig]) []AdamWConfig {
+	configs, grouped := groupConfigs(nodes, cfg, groups)
+	for i, node := range nodes {
+		if !grouped[i] && node.GetParamKind() != num.ParamWeight {
+			configs[i].WeightDecay = 0
+		}
+	}
+	return configs
+}
+
+// biasCorrection returns 1 / (1 - beta^step).
+func biasCorrection(beta float32, step int) float32 {
+	return float32(1 / (1 - math.Pow(float64(beta), float64(step))))
+}
+
+// AdamW is Adam with decoupled weight decay (Loshchilov and Hutter, 2019).
+// Bias corrections are computed for every step, so training length is not limited.
+func AdamW(device *mtl.Device, cfg AdamWConfig, groups ...ParamGroup[AdamWConfig]) proc.Optimizer {
+	kernel := adamw.New(device)
+
+	return func(nodes []*num.Data) (proc.Optimize, proc.OptimizerState) {
+		configs := adamWConfigs(nodes, cfg, groups)
+		m := newStateBuffers(device, nodes)
+		v := newStateBuffers(device, nodes)
+
+		return func(b *mtl.CommandBuffer, iteration int) {
+			step := iteration + 1
+			for i, node := range nodes {
+				c := configs[i]
+				kernel.UpdateWithAdamW(b, node.Data, node.Grad, m[i], v[i],
+					c.LearningRate*schedule.FactorAt(c.Schedule, iteration), c.Beta1, c.Beta2,
+					biasCorrection(c.Beta1, step), biasCorrection(c.Beta2, step),
+					c.Eps, c.WeightDecay)
+			}
+		}, proc.OptimizerState{"m": m, "v": v}
+	}
+}
+
+// AdamWReference updates data, m and v in place for the step counted from 1.
+func AdamWReference(cfg AdamWConfig, step int, data, grad, m, v []float32) {
+	bc1 := biasCorrection(cfg.Beta1, step)
+	bc2 := biasCorrection(cfg.Beta2, step)
+
+	for i := range data {
+		g := finiteGrad(grad[i])
+		m[i] = cfg.Beta1*m[i] + (1-cfg.Beta1)*g
+		v[i] = cfg.Beta2*v[i] + (1-cfg.Beta2)*g*g
+
+		data[i] *= 1 - cfg.LearningRate*cfg.WeightDecay
+		data[i] -= cfg.LearningRate * m[i] * bc1 / (sqrt(v[i]*bc2) + cfg.Eps)
+	}
+}
@@ -0,0 +1,84 @@
+package optimizer
+
+import (
+	"math"
+
+	"github.com/atkhx/metal/mtl"
+	"github.com/atkhx/metal/nn/num"
+	"github.com/atkhx/metal/nn/ops/gradnorm"
+)
+
+// GradStats are gradient norms computed by GradClipper, taken before clipping.
+type GradStats struct {
+	// Norms are L2 norms of gradients of every param in the order of the params.
+	Norms []float32
+	// TotalNorm is the global L2 norm over all params.
+	TotalNorm float32
+	// Scale is the factor gradients were multiplied by, 1 when they were not clipped.
+	Scale float32
+}
+
+// IsFinite reports whether the gradients have no NaN or Inf values,
+// training loops skip the update otherwise.
+func (s GradStats) IsFinite() bool {
+	return !math.IsNaN(float64(s.TotalNorm)) && !math.IsInf(float64(s.TotalNorm), 0)
+}
+
+// GradClipper computes the global L2 norm of gradients of params and scales them down
+// when it exceeds maxNorm (0 disables clipping). It runs between backward and update,
+// e.g. TrainingPipeline.ComputeGrads(clipper.Encode). Gradients with a non-finite norm
+// are not clipped.
+type GradClipper struct {
+	kernel  *gradnorm.Kernel
+	nodes   []*num.Data
+	maxNorm float32
+
+	partial *mtl.Buffer
+	stats   *mtl.Buffer
+}
+
+func NewGradClipper(device *mtl.Device, nodes []*num.Data, maxNorm float32) *GradClipper {
+	maxLength := 1
+	for _, node := range nodes {
+		maxLength = max(maxLength, node.Dims.Length())
+	}
+
+	return &GradClipper{
+		kernel:  gradnorm.New(device),
+		nodes:   nodes,
+		maxNorm: maxNorm,
+		partial: device.NewBufferEmptyFloatsBuffer(gradnorm.PartialLength(maxLength), mtl.ResourceStorageModeShared),
+		stats:   device.NewBufferEmptyFloatsBuffer(gradnorm.StatsLength(len(nodes)), mtl.ResourceStorageModeShared),
+	}
+}
+
+func (c *GradClipper) Encode(b *mtl.CommandBuffer) {
+	for i, node := range c.nodes {
+		c.kernel.SumSquares(b, node.Grad, c.partial, c.stats, node.Dims.Length(), i)
+	}
+
+	c.kernel.Total(b, c.stats, len(c.nodes), c.maxNorm)
+	if c.maxNorm == 0 {
+		return
+	}
+
+	for _, node := range c.nodes {
+		c.kernel.Scale(b, node.Grad, c.stats, node.Dims.Length(), len(c.nodes))
+	}
+}
+
+// Stats returns the norms computed by the last encoded pass once its command buffer is completed.
+func (c *GradClipper) Stats() GradStats {
+	values := c.stats.GetFloats()
+	count := len(c.nodes)
+
+	stats := GradStats{
+		Norms:     make([]float32, count),
+		TotalNorm: values[count],
+		Scale:     values[count+1],
+	}
+	for i := range stats.Norms {
+		stats.Norms[i] = sqrt(values[i])
+	}
+	return stats
+}
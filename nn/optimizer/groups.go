@@ -0,0 +1,53 @@
+package optimizer
+
+import "github.com/atkhx/metal/nn/num"
+
+// ParamGroup gives the params selected by Match their own hyperparameters.
+// Optimizers take groups after the default config, a param gets the config
+// of the first group matching it, params matching no group get the default one.
+type ParamGroup[C any] struct {
+	Match  func(node *num.Data) bool
+	Config C
+}
+
+// ByKind matches params of the kinds, see num.Data.GetParamKind.
+func ByKind(kinds ...num.ParamKind) func(node *num.Data) bool {
+	return func(node *num.Data) bool {
+		kind := node.GetParamKind()
+		for _, k := range kinds {
+			if k == kind {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// ByNodes matches the given nodes.
+func ByNodes(nodes ...*num.Data) func(node *num.Data) bool {
+	set := make(map[*num.Data]bool, len(nodes))
+	for _, node := range nodes {
+		set[node] = true
+	}
+	return func(node *num.Data) bool {
+		return set[node]
+	}
+}
+
+// groupConfigs returns the config of every node and whether it comes from a group.
+func groupConfigs[C any](nodes []*num.Data, cfg C, groups []ParamGroup[C]) (configs []C, grouped []bool) {
+	configs = make([]C, len(nodes))
+	grouped = make([]bool, len(nodes))
+
+	for i, node := range nodes {
+		configs[i] = cfg
+		for _, group := range groups {
+			if group.Match == nil || group.Match(node) {
+				configs[i] = group.Config
+				grouped[i] = true
+				break
+			}
+		}
+	}
+	return configs, grouped
+}
@@ -0,0 +1,52 @@
+package optimizer
+
+import (
+	"github.com/atkhx/metal/mtl"
+	"github.com/atkhx/metal/nn/num"
+	"github.com/atkhx/metal/nn/ops/lion"
+	"github.com/atkhx/metal/nn/proc"
+	"github.com/atkhx/metal/nn/schedule"
+)
+
+type LionConfig struct {
+	// LearningRate is usually 3-10 times smaller than for Adam, because every step has the unit size.
+	LearningRate float32
+	Beta1        float32
+	Beta2        float32
+	// Schedule scales LearningRate every step, nil keeps it constant.
+	Schedule schedule.Schedule
+}
+
+// Lion applies the sign of the interpolation between momentum and gradient (Chen et al., 2023).
+func Lion(device *mtl.Device, cfg LionConfig, groups ...ParamGroup[LionConfig]) proc.Optimizer {
+	kernel := lion.New(device)
+
+	return func(nodes []*num.Data) (proc.Optimize, proc.OptimizerState) {
+		configs, _ := groupConfigs(nodes, cfg, groups)
+		expAvg := newStateBuffers(device, nodes)
+
+		return func(b *mtl.CommandBuffer, iteration int) {
+			for i, node := range nodes {
+				c := configs[i]
+				lr := c.LearningRate * schedule.FactorAt(c.Schedule, iteration)
+				kernel.Update(b, node.Data, node.Grad, expAvg[i], lr, c.Beta1, c.Beta2)
+			}
+		}, proc.OptimizerState{"expAvg": expAvg}
+	}
+}
+
+// LionReference updates data and expAvg in place.
+func LionReference(cfg LionConfig, data, grad, expAvg []float32) {
+	for i := range data {
+		g := finiteGrad(grad[i])
+		c := cfg.Beta1*expAvg[i] + (1-cfg.Beta1)*g
+
+		switch {
+		case c > 0:
+			data[i] -= cfg.LearningRate
+		case c < 0:
+			data[i] += cfg.LearningRate
+		}
+		expAvg[i] = cfg.Beta2*expAvg[i] + (1-cfg.Beta2)*g
+	}
+}
@@ -0,0 +1,32 @@
+// Package optimizer implements proc.Optimizer with update kernels running on the device.
+// Every optimizer has a reference implementation of its update working on CPU slices,
+// it documents the math and is used to check the kernels.
+package optimizer
+
+import (
+	"math"
+
+	"github.com/atkhx/metal/mtl"
+	"github.com/atkhx/metal/nn/num"
+)
+
+// newStateBuffers creates zeroed buffers of the nodes' lengths.
+func newStateBuffers(device *mtl.Device, nodes []*num.Data) []*mtl.Buffer {
+	buffers := make([]*mtl.Buffer, len(nodes))
+	for i, node := range nodes {
+		buffers[i] = device.NewBufferEmptyFloatsBuffer(node.Dims.Length(), mtl.ResourceStorageModeShared)
+	}
+	return buffers
+}
+
+// finiteGrad treats non-finite gradients as zeros like the kernels do.
+func finiteGrad(g float32) float32 {
+	if math.IsNaN(float64(g)) || math.IsInf(float64(g), 0) {
+		return 0
+	}
+	return g
+}
+
+func sqrt(v float32) float32 {
+	return float32(math.Sqrt(float64(v)))
+}
@@ -0,0 +1,324 @@
+package optimizer
+
+import (
+	"math"
+	"testing"
+
+	"github.com/atkhx/metal/mtl"
+	"github.com/atkhx/metal/nn/num"
+	"github.com/atkhx/metal/nn/proc"
+	"github.com/atkhx/metal/nn/schedule"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReferences(t *testing.T) {
+	grad := []float32{0.5, -1}
+
+	testCases := []struct {
+		name      string
+		update    func(data, state []float32)
+		state     []float32
+		expData   []float32
+		expState  []float32
+		dataDelta float64
+	}{
+		{
+			name: "sgd",
+			update: func(data, state []float32) {
+				SGDReference(SGDConfig{LearningRate: 0.1}, data, grad, state)
+			},
+			state:    []float32{1, 0},
+			expData:  []float32{0.95, 2.1},
+			expState: []float32{1, 0},
+		},
+		{
+			name: "sgd momentum",
+			update: func(data, state []float32) {
+				SGDReference(SGDConfig{LearningRate: 0.1, Momentum: 0.9}, data, grad, state)
+			},
+			state:    []float32{1, 0},
+			expData:  []float32{0.86, 2.1},
+			expState: []float32{1.4, -1},
+		},
+		{
+			name: "sgd nesterov",
+			update: func(data, state []float32) {
+				SGDReference(SGDConfig{LearningRate: 0.1, Momentum: 0.9, Nesterov: true}, data, grad, state)
+			},
+			state:    []float32{1, 0},
+			expData:  []float32{0.824, 2.19},
+			expState: []float32{1.4, -1},
+		},
+		{
+			name: "rmsprop",
+			update: func(data, state []float32) {
+				RMSpropReference(RMSpropConfig{LearningRate: 0.1, Alpha: 0.9}, data, grad, state)
+			},
+			state:    []float32{0, 1},
+			expData:  []float32{0.6837722, 2.1},
+			expState: []float32{0.025, 1},
+		},
+		{
+			name: "lion",
+			update: func(data, state []float32) {
+				LionReference(LionConfig{LearningRate: 0.1, Beta1: 0.9, Beta2: 0.99}, data, grad, state)
+			},
+			state:    []float32{0.2, -0.5},
+			expData:  []float32{0.9, 2.1},
+			expState: []float32{0.203, -0.505},
+		},
+		{
+			name: "adafactor vector",
+			update: func(data, state []float32) {
+				AdafactorReference(AdafactorConfig{LearningRate: 0.1, Beta2: 0.5}, data, grad, 1, 2, state, nil)
+			},
+			state:    []float32{0, 0},
+			expData:  []float32{0.8585786, 2.1414214},
+			expState: []float32{0.125, 0.5},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			data := []float32{1, 2}
+			tc.update(data, tc.state)
+
+			require.InDeltaSlice(t, tc.expData, data, 1e-6)
+			require.InDeltaSlice(t, tc.expState, tc.state, 1e-6)
+		})
+	}
+}
+
+func TestAdafactorReference_Factored(t *testing.T) {
+	data := []float32{1, 1, 1, 1}
+	grad := []float32{1, 2, 3, 4}
+	rowAvg, colAvg := []float32{0, 0}, []float32{0, 0}
+
+	AdafactorReference(AdafactorConfig{LearningRate: 0.1, Beta2: 0.5, ClipThreshold: 1}, data, grad, 2, 2, rowAvg, colAvg)
+
+	require.InDeltaSlice(t, []float32{1.25, 6.25}, rowAvg, 1e-6)
+	require.InDeltaSlice(t, []float32{2.5, 5}, colAvg, 1e-6)
+	require.InDeltaSlice(t, []float32{0.9209431, 0.8881966, 0.8939340, 0.9}, data, 1e-6)
+}
+
+func TestAdamWReference(t *testing.T) {
+	data := []float32{1, 2}
+	m, v := []float32{0, 0}, []float32{0, 0}
+
+	cfg := AdamWConfig{LearningRate: 0.1, Beta1: 0.9, Beta2: 0.999, WeightDecay: 0.5}
+	AdamWReference(cfg, 1, data, []float32{0.5, -1}, m, v)
+
+	require.InDeltaSlice(t, []float32{0.05, -0.1}, m, 1e-6)
+	require.InDeltaSlice(t, []float32{0.00025, 0.001}, v, 1e-6)
+	require.InDeltaSlice(t, []float32{0.85, 2}, data, 1e-5)
+}
+
+func TestAdamWConfigs(t *testing.T) {
+	weight := &num.Data{Dims: mtl.NewMTLSize(3, 2)}
+	bias := &num.Data{Dims: mtl.NewMTLSize(1, 1, 3)}
+	norm := &num.Data{Dims: mtl.NewMTLSize(3), Param: num.ParamNorm}
+	embedding := &num.Data{Dims: mtl.NewMTLSize(3, 4), Param: num.ParamEmbedding}
+
+	cfg := AdamWConfig{LearningRate: 0.01, Beta1: 0.9, Beta2: 0.999, WeightDecay: 0.1}
+	normCfg := AdamWConfig{LearningRate: 0.1, Beta1: 0.8, Beta2: 0.99, WeightDecay: 0.2}
+
+	configs := adamWConfigs(
+		[]*num.Data{weight, bias, norm, embedding},
+		cfg,
+		[]ParamGroup[AdamWConfig]{{Match: ByKind(num.ParamNorm), Config: normCfg}},
+	)
+
+	noDecay := cfg
+	noDecay.WeightDecay = 0
+
+	require.Equal(t, []AdamWConfig{cfg, noDecay, normCfg, noDecay}, configs)
+}
+
+// TestOptimizers runs optimizers on the device for several iterations and checks them against
+// the reference implementations.
+func TestOptimizers(t *testing.T) {
+	device := proc.NewWithSystemDefaultDevice()
+	defer device.Release()
+
+	mtlDevice := device.GetMTLDevice()
+
+	matrixValues := []float32{0.5, -0.2, 0.1, 0.3, -0.4, 0.9}
+	matrixGrad := []float32{0.3, -1.2, 0.05, 0.7, -0.1, 0.4}
+	vectorValues := []float32{0.1, 0.2, 0.3}
+	vectorGrad := []float32{-0.6, 0.2, 0.9}
+
+	sgdCfg := SGDConfig{LearningRate: 0.1, Momentum: 0.9, Nesterov: true}
+	rmspropCfg := RMSpropConfig{LearningRate: 0.01, Alpha: 0.99, Eps: 1e-8}
+	lionCfg := LionConfig{LearningRate: 0.01, Beta1: 0.9, Beta2: 0.99}
+	adafactorCfg := AdafactorConfig{LearningRate: 0.01, Beta2: 0.999, Eps: 1e-30, ClipThreshold: 1}
+	adamwCfg := AdamWConfig{LearningRate: 0.01, Beta1: 0.9, Beta2: 0.999, Eps: 1e-8, WeightDecay: 0.1}
+	scheduledCfg := SGDConfig{LearningRate: 0.1, Momentum: 0.9, Schedule: schedule.Warmup(2, schedule.Step(1, 0.5))}
+	adamCfg := AdamWConfig{LearningRate: 0.01, Beta1: 0.9, Beta2: 0.999, Eps: 1e-8}
+	adamSchedule := schedule.Cosine(3, 0.1)
+
+	testCases := []struct {
+		name      string
+		optimizer proc.Optimizer
+		reference func(data, grad []float32, rows, cols int) func()
+	}{
+		{
+			name:      "sgd",
+			optimizer: SGD(mtlDevice, sgdCfg),
+			reference: func(data, grad []float32, rows, cols int) func() {
+				velocity := make([]float32, len(data))
+				return func() { SGDReference(sgdCfg, data, grad, velocity) }
+			},
+		},
+		{
+			name:      "rmsprop",
+			optimizer: RMSprop(mtlDevice, rmspropCfg),
+			reference: func(data, grad []float32, rows, cols int) func() {
+				squareAvg := make([]float32, len(data))
+				return func() { RMSpropReference(rmspropCfg, data, grad, squareAvg) }
+			},
+		},
+		{
+			name:      "lion",
+			optimizer: Lion(mtlDevice, lionCfg),
+			reference: func(data, grad []float32, rows, cols int) func() {
+				expAvg := make([]float32, len(data))
+				return func() { LionReference(lionCfg, data, grad, expAvg) }
+			},
+		},
+		{
+			name:      "adafactor",
+			optimizer: Adafactor(mtlDevice, adafactorCfg),
+			reference: func(data, grad []float32, rows, cols int) func() {
+				if rows == 1 {
+					secondMoment := make([]float32, len(data))
+					return func() { AdafactorReference(adafactorCfg, data, grad, rows, cols, secondMoment, nil) }
+				}
+				rowAvg, colAvg := make([]float32, rows), make([]float32, cols)
+				return func() { AdafactorReference(adafactorCfg, data, grad, rows, cols, rowAvg, colAvg) }
+			},
+		},
+		{
+			name:      "adamw",
+			optimizer: AdamW(mtlDevice, adamwCfg),
+			reference: func(data, grad []float32, rows, cols int) func() {
+				cfg := adamwCfg
+				if rows == 1 {
+					// The vector is untagged, it is taken for a bias and is not decayed.
+					cfg.WeightDecay = 0
+				}
+				m, v := make([]float32, len(data)), make([]float32, len(data))
+				step := 0
+				return func() {
+					step++
+					AdamWReference(cfg, step, data, grad, m, v)
+				}
+			},
+		},
+		{
+			name:      "sgd scheduled",
+			optimizer: SGD(mtlDevice, scheduledCfg),
+			reference: func(data, grad []float32, rows, cols int) func() {
+				velocity := make([]float32, len(data))
+				iteration := 0
+				return func() {
+					cfg := scheduledCfg
+					cfg.LearningRate *= cfg.Schedule.Factor(iteration)
+					SGDReference(cfg, data, grad, velocity)
+					iteration++
+				}
+			},
+		},
+		{
+			name:      "proc adam scheduled",
+			optimizer: device.GetOptimizerAdamWithSchedule(adamCfg.Beta1, adamCfg.Beta2, adamCfg.LearningRate, adamCfg.Eps, adamSchedule),
+			reference: func(data, grad []float32, rows, cols int) func() {
+				m, v := make([]float32, len(data)), make([]float32, len(data))
+				iteration := 0
+				return func() {
+					cfg := adamCfg
+					cfg.LearningRate *= adamSchedule.Factor(iteration)
+					iteration++
+					AdamWReference(cfg, iteration, data, grad, m, v)
+				}
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			matrix := device.NewDataWithValues(mtl.NewMTLSize(3, 2), matrixValues)
+			vector := device.NewDataWithValues(mtl.NewMTLSize(3), vectorValues)
+			copy(matrix.Grad.GetFloats(), matrixGrad)
+			copy(vector.Grad.GetFloats(), vectorGrad)
+
+			expMatrix := append([]float32(nil), matrixValues...)
+			expVector := append([]float32(nil), vectorValues...)
+			references := []func(){
+				tc.reference(expMatrix, matrixGrad, 2, 3),
+				tc.reference(expVector, vectorGrad, 1, 3),
+			}
+
+			optimize, _ := tc.optimizer([]*num.Data{matrix, vector})
+			queue := mtlDevice.NewCommandQueue()
+
+			for iteration := 0; iteration < 3; iteration++ {
+				b := queue.GetNewMTLCommandBuffer()
+				optimize(b, iteration)
+				b.Commit()
+				b.WaitUntilCompleted()
+				b.Release()
+
+				for _, reference := range references {
+					reference()
+				}
+
+				require.InDeltaSlice(t, expMatrix, matrix.Data.GetFloats(), 1e-5)
+				require.InDeltaSlice(t, expVector, vector.Data.GetFloats(), 1e-5)
+			}
+		})
+	}
+}
+
+func TestGradClipper(t *testing.T) {
+	device := proc.NewWithSystemDefaultDevice()
+	defer device.Release()
+
+	mtlDevice := device.GetMTLDevice()
+	queue := mtlDevice.NewCommandQueue()
+
+	matrix := device.NewData(mtl.NewMTLSize(2, 1))
+	vector := device.NewData(mtl.NewMTLSize(1))
+
+	clip := func(clipper *GradClipper, matrixGrad, vectorGrad []float32) GradStats {
+		copy(matrix.Grad.GetFloats(), matrixGrad)
+		copy(vector.Grad.GetFloats(), vectorGrad)
+
+		b := queue.GetNewMTLCommandBuffer()
+		defer b.Release()
+		clipper.Encode(b)
+		b.Commit()
+		b.WaitUntilCompleted()
+
+		return clipper.Stats()
+	}
+
+	nodes := []*num.Data{matrix, vector}
+
+	stats := clip(NewGradClipper(mtlDevice, nodes, 0), []float32{3, 4}, []float32{12})
+	require.True(t, stats.IsFinite())
+	require.InDeltaSlice(t, []float32{5, 12}, stats.Norms, 1e-5)
+	require.InDelta(t, 13, stats.TotalNorm, 1e-5)
+	require.Equal(t, float32(1), stats.Scale)
+	require.Equal(t, []float32{3, 4}, matrix.Grad.GetFloats())
+
+	stats = clip(NewGradClipper(mtlDevice, nodes, 6.5), []float32{3, 4}, []float32{12})
+	require.InDelta(t, 13, stats.TotalNorm, 1e-5)
+	require.InDelta(t, 0.5, stats.Scale, 1e-6)
+	require.InDeltaSlice(t, []float32{1.5, 2}, matrix.Grad.GetFloats(), 1e-5)
+	require.InDeltaSlice(t, []float32{6}, vector.Grad.GetFloats(), 1e-5)
+
+	stats = clip(NewGradClipper(mtlDevice, nodes, 6.5), []float32{3, float32(math.NaN())}, []float32{12})
+	require.False(t, stats.IsFinite())
+	require.Equal(t, float32(1), stats.Scale)
+	require.Equal(t, float32(12), vector.Grad.GetFloats()[0])
+}
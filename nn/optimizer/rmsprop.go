@@ -0,0 +1,45 @@
+package optimizer
+
+import (
+	"github.com/atkhx/metal/mtl"
+	"github.com/atkhx/metal/nn/num"
+	"github.com/atkhx/metal/nn/ops/rmsprop"
+	"github.com/atkhx/metal/nn/proc"
+	"github.com/atkhx/metal/nn/schedule"
+)
+
+type RMSpropConfig struct {
+	LearningRate float32
+	// Alpha is the decay of the running average of squared gradients, usually 0.99.
+	Alpha float32
+	Eps   float32
+	// Schedule scales LearningRate every step, nil keeps it constant.
+	Schedule schedule.Schedule
+}
+
+// RMSprop divides gradients by the root of the running average of their squares.
+func RMSprop(device *mtl.Device, cfg RMSpropConfig, groups ...ParamGroup[RMSpropConfig]) proc.Optimizer {
+	kernel := rmsprop.New(device)
+
+	return func(nodes []*num.Data) (proc.Optimize, proc.OptimizerState) {
+		configs, _ := groupConfigs(nodes, cfg, groups)
+		squareAvg := newStateBuffers(device, nodes)
+
+		return func(b *mtl.CommandBuffer, iteration int) {
+			for i, node := range nodes {
+				c := configs[i]
+				lr := c.LearningRate * schedule.FactorAt(c.Schedule, iteration)
+				kernel.Update(b, node.Data, node.Grad, squareAvg[i], lr, c.Alpha, c.Eps)
+			}
+		}, proc.OptimizerState{"squareAvg": squareAvg}
+	}
+}
+
+// RMSpropReference updates data and squareAvg in place.
+func RMSpropReference(cfg RMSpropConfig, data, grad, squareAvg []float32) {
+	for i := range data {
+		g := finiteGrad(grad[i])
+		squareAvg[i] = cfg.Alpha*squareAvg[i] + (1-cfg.Alpha)*g*g
+		data[i] -= cfg.LearningRate * g / (sqrt(squareAvg[i]) + cfg.Eps)
+	}
+}
@@ -0,0 +1,63 @@
+package optimizer
+
+import (
+	"github.com/atkhx/metal/mtl"
+	"github.com/atkhx/metal/nn/num"
+	"github.com/atkhx/metal/nn/ops/sgd"
+	"github.com/atkhx/metal/nn/proc"
+	"github.com/atkhx/metal/nn/schedule"
+)
+
+type SGDConfig struct {
+	LearningRate float32
+	// Momentum enables the velocity buffer, 0 gives plain gradient descent.
+	Momentum float32
+	Nesterov bool
+	// Schedule scales LearningRate every step, nil keeps it constant.
+	Schedule schedule.Schedule
+}
+
+// SGD creates stochastic gradient descent with optional (Nesterov) momentum.
+func SGD(device *mtl.Device, cfg SGDConfig, groups ...ParamGroup[SGDConfig]) proc.Optimizer {
+	kernel := sgd.New(device)
+
+	return func(nodes []*num.Data) (proc.Optimize, proc.OptimizerState) {
+		configs, _ := groupConfigs(nodes, cfg, groups)
+		velocity := make([]*mtl.Buffer, len(nodes))
+		for i, node := range nodes {
+			if configs[i].Momentum != 0 {
+				velocity[i] = device.NewBufferEmptyFloatsBuffer(node.Dims.Length(), mtl.ResourceStorageModeShared)
+			}
+		}
+
+		return func(b *mtl.CommandBuffer, iteration int) {
+			for i, node := range nodes {
+				c := configs[i]
+				lr := c.LearningRate * schedule.FactorAt(c.Schedule, iteration)
+				if c.Momentum == 0 {
+					kernel.Update(b, node.Data, node.Grad, lr)
+				} else {
+					kernel.UpdateWithMomentum(b, node.Data, node.Grad, velocity[i], lr, c.Momentum, c.Nesterov)
+				}
+			}
+		}, proc.OptimizerState{"velocity": velocity}
+	}
+}
+
+// SGDReference updates data in place, velocity is used only with momentum.
+func SGDReference(cfg SGDConfig, data, grad, velocity []float32) {
+	for i := range data {
+		g := finiteGrad(grad[i])
+		if cfg.Momentum == 0 {
+			data[i] -= cfg.LearningRate * g
+			continue
+		}
+
+		velocity[i] = cfg.Momentum*velocity[i] + g
+		if cfg.Nesterov {
+			data[i] -= cfg.LearningRate * (g + cfg.Momentum*velocity[i])
+		} else {
+			data[i] -= cfg.LearningRate * velocity[i]
+		}
+	}
+}
@@ -1,7 +1,9 @@
 package pipeline
 
 import (
+	"github.com/atkhx/metal/mtl"
 	"github.com/atkhx/metal/nn/num"
+	"github.com/atkhx/metal/nn/ops/fill"
 )
 
 type Nodes []*num.Data
@@ -78,9 +80,12 @@ func getForwardNodeLayers(aData *num.Data) NodeLayers {
 	})
 }
 
+// getBackwardNodeLayers returns nodes to run CalcGrad of in backward order. Nodes whose grads
+// flow only to frozen leaves are skipped, see getRequiresGrad.
 func getBackwardNodeLayers(aData *num.Data) NodeLayers {
+	requiresGrad := getRequiresGrad(aData)
 	nodes := getNodeLayers(aData, func(node *num.Data) bool {
-		return node.CalcGrad == nil
+		return node.CalcGrad == nil && node.Checkpoint == nil || !requiresGrad[node]
 	})
 
 	bwdNodes := make(NodeLayers, 0, len(nodes))
@@ -90,15 +95,130 @@ func getBackwardNodeLayers(aData *num.Data) NodeLayers {
 	return bwdNodes
 }
 
-func getResetGradsNodes(aData *num.Data) Nodes {
+// getRequiresGrad returns nodes which need grads: leaves which are not frozen
+// and nodes depending on them.
+func getRequiresGrad(aData *num.Data) map[*num.Data]bool {
+	result := map[*num.Data]bool{}
+	for _, node := range getDistinctNodes(aData) {
+		if len(node.Deps) == 0 {
+			result[node] = !node.Frozen
+			continue
+		}
+		for _, dep := range node.Deps {
+			if result[dep] {
+				result[node] = true
+				break
+			}
+		}
+	}
+	return result
+}
+
+// getResetGradsNodes returns nodes whose grads are reset before backward,
+// except for the nodes reset by their checkpoint segments and the nodes
+// whose grads are not written by backwardLayers. The first one is the last node.
+func getResetGradsNodes(aData *num.Data, checkpointResets map[*num.Data]Nodes, backwardLayers NodeLayers) Nodes {
 	nodes := getDistinctNodes(aData)
 
+	// Views share grads with their sources, so grads are checked by buffers.
+	written := map[*mtl.Buffer]struct{}{aData.Grad: {}}
+	for _, layerNodes := range backwardLayers {
+		for _, node := range layerNodes {
+			for _, dep := range node.Deps {
+				written[dep.Grad] = struct{}{}
+			}
+		}
+	}
+
+	resetBySegment := map[*num.Data]struct{}{}
+	for _, segmentNodes := range checkpointResets {
+		for _, node := range segmentNodes {
+			resetBySegment[node] = struct{}{}
+		}
+	}
+
 	var result Nodes
 	for i := len(nodes); i > 0; i-- {
 		if nodes[i-1].SkipResetGrad {
 			continue
 		}
+		if _, ok := resetBySegment[nodes[i-1]]; ok {
+			continue
+		}
+		if _, ok := written[nodes[i-1].Grad]; !ok {
+			continue
+		}
 		result = append(result, nodes[i-1])
 	}
 	return result
 }
+
+// mustHaveGrads panics if the graph was built without gradient buffers,
+// such graphs can only be run by the inference pipeline.
+func mustHaveGrads(aData *num.Data) {
+	for _, node := range getDistinctNodes(aData) {
+		if node.Grad == nil {
+			panic("pipeline: graph has nodes without gradients, it was built in no-grad mode and supports inference only")
+		}
+	}
+}
+
+// getCheckpointResets returns for every checkpoint node the nodes of its segment whose grads
+// can be reset right before the backward pass of the segment instead of the reset pass,
+// so they don't live through the whole backward pass. These are the grads nothing outside
+// of the segment accumulates to.
+func getCheckpointResets(aData *num.Data) map[*num.Data]Nodes {
+	nodes := getDistinctNodes(aData)
+
+	consumers := map[*num.Data]Nodes{}
+	for _, node := range nodes {
+		for _, dep := range node.Deps {
+			consumers[dep] = append(consumers[dep], node)
+		}
+	}
+
+	result := map[*num.Data]Nodes{}
+	for _, node := range nodes {
+		if len(node.Checkpoint) == 0 {
+			continue
+		}
+
+		segment := map[*num.Data]struct{}{node: {}}
+		for _, inner := range node.Checkpoint {
+			segment[inner] = struct{}{}
+		}
+
+		// Views share grads with their sources, so grads are checked by buffers.
+		escaped := map[*mtl.Buffer]struct{}{}
+		for segmentNode := range segment {
+			for _, consumer := range consumers[segmentNode] {
+				if _, ok := segment[consumer]; !ok {
+					escaped[segmentNode.Grad] = struct{}{}
+				}
+			}
+		}
+
+		for _, inner := range node.Checkpoint {
+			if _, ok := escaped[inner.Grad]; ok || inner.SkipResetGrad || inner.Grad == node.Grad {
+				continue
+			}
+			result[node] = append(result[node], inner)
+		}
+	}
+	return result
+}
+
+// recalcData computes Data of the checkpoint segment ending at node again
+// and resets grads of the segment, then CalcGrad of the node can be run.
+func recalcData(b *mtl.CommandBuffer, fillKernel *fill.Kernel, node *num.Data, resets Nodes) {
+	for _, inner := range node.Checkpoint {
+		if inner.RecalcData != nil {
+			inner.RecalcData(b)
+		} else {
+			inner.CalcData(b)
+		}
+	}
+	for _, inner := range resets {
+		fillKernel.Fill(b, inner.Grad, 0.0, 0, inner.Dims.Length())
+	}
+}
@@ -0,0 +1,56 @@
+package pipeline
+
+import (
+	"testing"
+
+	"github.com/atkhx/metal/mtl"
+	"github.com/atkhx/metal/nn/num"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrainingPipeline_FrozenLeaves(t *testing.T) {
+	device := mtl.MustCreateSystemDefaultDevice()
+	defer device.Release()
+
+	var calcGrads []string
+	newNode := func(name string, deps ...*num.Data) *num.Data {
+		node := &num.Data{
+			Data: device.NewBufferEmptyFloatsBuffer(4, mtl.ResourceStorageModeShared),
+			Grad: device.NewBufferEmptyFloatsBuffer(4, mtl.ResourceStorageModeShared),
+			Dims: mtl.NewMTLSize(4),
+			Deps: deps,
+		}
+		if len(deps) > 0 {
+			node.CalcData = func(b *mtl.CommandBuffer) {}
+			node.CalcGrad = func(b *mtl.CommandBuffer) {
+				calcGrads = append(calcGrads, name)
+			}
+		}
+		return node
+	}
+
+	// x and w1 are frozen, so "a" needs no grads and only "b" and "loss" run backward
+	x := newNode("x")
+	w1 := newNode("w1")
+	w2 := newNode("w2")
+	a := newNode("a", x, w1)
+	b := newNode("b", a, w2)
+	loss := newNode("loss", b)
+	num.SetFrozen(true, x, w1)
+
+	p := NewTrainingPipeline(device, loss)
+	require.Equal(t, Nodes{loss, b, a, w2}, p.resetGradsNodes)
+
+	p.TrainIteration(func(b *mtl.CommandBuffer) {})
+	require.Equal(t, []string{"loss", "b"}, calcGrads)
+
+	// without frozen leaves everything runs
+	num.SetFrozen(false, x, w1)
+	calcGrads = nil
+
+	p = NewTrainingPipeline(device, loss)
+	require.ElementsMatch(t, Nodes{loss, b, a, w2, w1, x}, p.resetGradsNodes)
+
+	p.TrainIteration(func(b *mtl.CommandBuffer) {})
+	require.Equal(t, []string{"loss", "b", "a"}, calcGrads)
+}
@@ -37,3 +37,15 @@ func (p *InferencePipeline) Forward() {
 		}
 	})
 }
+
+// PlanMemory shares Data buffers between intermediate nodes whose lifetimes in Forward
+// don't overlap. Data of the last node and of keep nodes is preserved, other intermediates
+// must not be read after Forward. Grad buffers are left as they are.
+func (p *InferencePipeline) PlanMemory(keep ...*num.Data) MemoryPlan {
+	m := newMemoryPlanner()
+	m.addLayers(p.forwardLayers)
+	m.pinNodes(lastNodes(p.forwardLayers)...)
+	m.pinNodes(keep...)
+	m.scheduleForward(0, p.forwardLayers)
+	return m.apply()
+}
@@ -0,0 +1,268 @@
+package pipeline
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/atkhx/metal/mtl"
+	"github.com/atkhx/metal/nn/num"
+)
+
+// MemoryPlan reports buffers of the graph before and after sharing them between nodes.
+// All buffers live until process exit, so their total size is the peak memory.
+type MemoryPlan struct {
+	BuffersBefore int
+	BuffersAfter  int
+	BytesBefore   uint64
+	BytesAfter    uint64
+}
+
+func (p MemoryPlan) String() string {
+	return fmt.Sprintf(
+		"buffers: %d -> %d, memory: %.2f MB -> %.2f MB",
+		p.BuffersBefore,
+		p.BuffersAfter,
+		float64(p.BytesBefore)/(1<<20),
+		float64(p.BytesAfter)/(1<<20),
+	)
+}
+
+// bufferRange is an interval of steps of the schedule, both ends are included.
+type bufferRange struct {
+	first, last int
+}
+
+func (r bufferRange) overlaps(o bufferRange) bool {
+	return r.first <= o.last && o.first <= r.last
+}
+
+// bufferUse is a buffer with the ranges of steps its content is alive at.
+// A buffer gets a new range when it is written from scratch: recomputed by a checkpoint
+// segment or reset, so it can hold other data in between.
+// Views share buffers with their inputs, so one buffer can be referenced by several nodes.
+type bufferUse struct {
+	buffer *mtl.Buffer
+	refs   []**mtl.Buffer
+	ranges []bufferRange
+	pinned bool
+}
+
+func (u *bufferUse) overlaps(ranges []bufferRange) bool {
+	for _, a := range u.ranges {
+		for _, b := range ranges {
+			if a.overlaps(b) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// memoryPlanner assigns the same buffer to nodes whose lifetimes don't overlap.
+//
+// Lifetimes are conservative: an op is assumed to use Data and Grad of its node and its deps.
+// Buffers of leaves (nodes without CalcData), of nodes with KeepBuffers and of kept nodes
+// are never replaced. Buffers are shared only between nodes of the same buffer size,
+// because some kernels take lengths from buffers.
+type memoryPlanner struct {
+	uses  map[*mtl.Buffer]*bufferUse
+	order []*bufferUse
+	nodes map[*num.Data]struct{}
+}
+
+func newMemoryPlanner() *memoryPlanner {
+	return &memoryPlanner{
+		uses:  map[*mtl.Buffer]*bufferUse{},
+		nodes: map[*num.Data]struct{}{},
+	}
+}
+
+func (m *memoryPlanner) addNode(node *num.Data) {
+	if _, ok := m.nodes[node]; ok {
+		return
+	}
+	m.nodes[node] = struct{}{}
+
+	pinned := node.CalcData == nil || node.KeepBuffers
+	m.addRef(&node.Data, pinned)
+	m.addRef(&node.Grad, pinned)
+
+	for _, dep := range node.Deps {
+		m.addNode(dep)
+	}
+}
+
+func (m *memoryPlanner) addRef(ref **mtl.Buffer, pinned bool) {
+	if *ref == nil {
+		return
+	}
+	use, ok := m.uses[*ref]
+	if !ok {
+		use = &bufferUse{buffer: *ref}
+		m.uses[*ref] = use
+		m.order = append(m.order, use)
+	}
+	use.refs = append(use.refs, ref)
+	use.pinned = use.pinned || pinned
+}
+
+func (m *memoryPlanner) pin(buffer *mtl.Buffer) {
+	if use, ok := m.uses[buffer]; ok {
+		use.pinned = true
+	}
+}
+
+// define starts a new range of buffers: they are written at step and previous content is not used.
+func (m *memoryPlanner) define(step int, buffers ...*mtl.Buffer) {
+	for _, buffer := range buffers {
+		if use, ok := m.uses[buffer]; ok {
+			use.ranges = append(use.ranges, bufferRange{first: step, last: step})
+		}
+	}
+}
+
+// touch extends the last range of buffers to step.
+func (m *memoryPlanner) touch(step int, buffers ...*mtl.Buffer) {
+	for _, buffer := range buffers {
+		use, ok := m.uses[buffer]
+		if !ok {
+			continue
+		}
+		if len(use.ranges) == 0 {
+			use.ranges = append(use.ranges, bufferRange{first: step, last: step})
+			continue
+		}
+		last := &use.ranges[len(use.ranges)-1]
+		last.first = min(last.first, step)
+		last.last = max(last.last, step)
+	}
+}
+
+func (m *memoryPlanner) apply() MemoryPlan {
+	plan := MemoryPlan{}
+
+	var candidates []*bufferUse
+	for _, use := range m.order {
+		plan.BuffersBefore++
+		plan.BytesBefore += use.buffer.GetLengthBytes()
+
+		// Untouched buffers belong to the other pass (grads in inference).
+		if !use.pinned && len(use.ranges) > 0 {
+			candidates = append(candidates, use)
+		}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].ranges[0].first < candidates[j].ranges[0].first
+	})
+
+	// Every slot is a buffer with the ranges of all the uses assigned to it.
+	var slots []*bufferUse
+
+	for _, use := range candidates {
+		var slot *bufferUse
+		for _, s := range slots {
+			if s.buffer.GetLengthBytes() == use.buffer.GetLengthBytes() && !s.overlaps(use.ranges) {
+				slot = s
+				break
+			}
+		}
+
+		if slot == nil {
+			slots = append(slots, &bufferUse{buffer: use.buffer, ranges: use.ranges})
+			continue
+		}
+
+		slot.ranges = append(slot.ranges, use.ranges...)
+		use.buffer.Release()
+		use.buffer = slot.buffer
+		for _, ref := range use.refs {
+			*ref = slot.buffer
+		}
+	}
+
+	distinct := map[*mtl.Buffer]struct{}{}
+	for _, use := range m.order {
+		if _, ok := distinct[use.buffer]; ok {
+			continue
+		}
+		distinct[use.buffer] = struct{}{}
+		plan.BuffersAfter++
+		plan.BytesAfter += use.buffer.GetLengthBytes()
+	}
+	return plan
+}
+
+func (m *memoryPlanner) pinNodes(nodes ...*num.Data) {
+	for _, node := range nodes {
+		m.pin(node.Data)
+		m.pin(node.Grad)
+	}
+}
+
+func (m *memoryPlanner) addLayers(layers NodeLayers) {
+	for _, nodes := range layers {
+		for _, node := range nodes {
+			m.addNode(node)
+		}
+	}
+}
+
+// calcData schedules CalcData of the node at step: Data of the node is written, Data of deps is read.
+// Views don't write Data, they share it with their deps.
+func (m *memoryPlanner) calcData(step int, node *num.Data) {
+	isView := false
+	for _, dep := range node.Deps {
+		m.touch(step, dep.Data)
+		isView = isView || dep.Data == node.Data
+	}
+	if !isView {
+		m.define(step, node.Data)
+	}
+	m.touch(step, node.Data)
+}
+
+// scheduleForward extends lifetimes by the forward pass starting at step, returns the next step.
+func (m *memoryPlanner) scheduleForward(step int, layers NodeLayers) int {
+	for _, nodes := range layers {
+		for _, node := range nodes {
+			m.calcData(step, node)
+			step++
+		}
+	}
+	return step
+}
+
+// scheduleBackward extends lifetimes by the backward pass starting at step, returns the next step.
+// Checkpoint segments are computed again before CalcGrad of their nodes, their grads are reset.
+func (m *memoryPlanner) scheduleBackward(step int, layers NodeLayers, checkpointResets map[*num.Data]Nodes) int {
+	for _, nodes := range layers {
+		for _, node := range nodes {
+			if node.Checkpoint != nil {
+				for _, inner := range node.Checkpoint {
+					m.calcData(step, inner)
+					step++
+				}
+				for _, inner := range checkpointResets[node] {
+					m.define(step, inner.Grad)
+				}
+				step++
+			}
+
+			m.touch(step, node.Data, node.Grad)
+			for _, dep := range node.Deps {
+				m.touch(step, dep.Data, dep.Grad)
+			}
+			step++
+		}
+	}
+	return step
+}
+
+// lastNodes returns the nodes of the last layer, it is the node the pipeline was built for.
+func lastNodes(layers NodeLayers) Nodes {
+	if len(layers) == 0 {
+		return nil
+	}
+	return layers[len(layers)-1]
+}
@@ -0,0 +1,141 @@
+package pipeline
+
+import (
+	"testing"
+
+	"github.com/atkhx/metal/mtl"
+	"github.com/atkhx/metal/nn/num"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInferencePipeline_PlanMemory(t *testing.T) {
+	device := mtl.MustCreateSystemDefaultDevice()
+	defer device.Release()
+
+	newNode := func(length int, deps ...*num.Data) *num.Data {
+		node := &num.Data{
+			Data: device.NewBufferEmptyFloatsBuffer(length, mtl.ResourceStorageModeShared),
+			Grad: device.NewBufferEmptyFloatsBuffer(length, mtl.ResourceStorageModeShared),
+			Dims: mtl.NewMTLSize(length),
+			Deps: deps,
+		}
+		if len(deps) > 0 {
+			node.CalcData = func(b *mtl.CommandBuffer) {}
+			node.CalcGrad = func(b *mtl.CommandBuffer) {}
+		}
+		return node
+	}
+
+	// x -> a -> b -> c -> d -> e, "wide" has another size
+	x := newNode(4)
+	a := newNode(4, x)
+	b := newNode(4, a)
+	c := newNode(4, b)
+	wide := newNode(8, c)
+	d := newNode(4, wide)
+	e := newNode(4, d)
+
+	xData, aData, bData, eData := x.Data, a.Data, b.Data, e.Data
+	gradsBefore := []*mtl.Buffer{a.Grad, b.Grad, c.Grad, d.Grad}
+
+	plan := NewInferencePipeline(device, e).PlanMemory()
+
+	require.Equal(t, MemoryPlan{
+		BuffersBefore: 14,
+		BuffersAfter:  12,
+		BytesBefore:   4 * (6*2*4 + 2*8),
+		BytesAfter:    4 * (6*2*4 + 2*8 - 2*4),
+	}, plan)
+
+	// c reuses the buffer of a which is not needed anymore, then d reuses it after c
+	require.Same(t, aData, c.Data)
+	require.Same(t, aData, d.Data)
+	require.Same(t, bData, b.Data)
+
+	// leaves, the last node and grads are not touched
+	require.Same(t, xData, x.Data)
+	require.Same(t, eData, e.Data)
+	require.Equal(t, gradsBefore, []*mtl.Buffer{a.Grad, b.Grad, c.Grad, d.Grad})
+}
+
+func TestInferencePipeline_PlanMemory_KeepBuffers(t *testing.T) {
+	device := mtl.MustCreateSystemDefaultDevice()
+	defer device.Release()
+
+	newNode := func(deps ...*num.Data) *num.Data {
+		node := &num.Data{
+			Data: device.NewBufferEmptyFloatsBuffer(4, mtl.ResourceStorageModeShared),
+			Grad: device.NewBufferEmptyFloatsBuffer(4, mtl.ResourceStorageModeShared),
+			Dims: mtl.NewMTLSize(4),
+			Deps: deps,
+		}
+		if len(deps) > 0 {
+			node.CalcData = func(b *mtl.CommandBuffer) {}
+		}
+		return node
+	}
+
+	x := newNode()
+	a := newNode(x)
+	b := newNode(a)
+	c := newNode(b)
+	d := newNode(c)
+
+	a.KeepBuffers = true
+	bData := b.Data
+
+	plan := NewInferencePipeline(device, d).PlanMemory(b)
+
+	require.Equal(t, plan.BuffersBefore, plan.BuffersAfter)
+	require.Same(t, bData, b.Data)
+	require.NotSame(t, a.Data, c.Data)
+	require.NotSame(t, b.Data, c.Data)
+}
+
+func TestTrainingPipeline_PlanMemory_Checkpoint(t *testing.T) {
+	device := mtl.MustCreateSystemDefaultDevice()
+	defer device.Release()
+
+	newNode := func(deps ...*num.Data) *num.Data {
+		node := &num.Data{
+			Data: device.NewBufferEmptyFloatsBuffer(4, mtl.ResourceStorageModeShared),
+			Grad: device.NewBufferEmptyFloatsBuffer(4, mtl.ResourceStorageModeShared),
+			Dims: mtl.NewMTLSize(4),
+			Deps: deps,
+		}
+		if len(deps) > 0 {
+			node.CalcData = func(b *mtl.CommandBuffer) {}
+			node.CalcGrad = func(b *mtl.CommandBuffer) {}
+		}
+		return node
+	}
+
+	// x -> [a -> b -> c] -> d -> e, a and b are recomputed before CalcGrad of c
+	x := newNode()
+	a := newNode(x)
+	b := newNode(a)
+	c := newNode(b)
+	d := newNode(c)
+	e := newNode(d)
+	c.Checkpoint = []*num.Data{a, b}
+
+	aData, bData, cData, cGrad := a.Data, b.Data, c.Data, c.Grad
+
+	p := NewTrainingPipeline(device, e)
+	require.Equal(t, map[*num.Data]Nodes{c: {a, b}}, p.checkpointResets)
+	require.NotContains(t, p.resetGradsNodes, a)
+	require.NotContains(t, p.resetGradsNodes, b)
+
+	plan := p.PlanMemory()
+	require.Equal(t, 12, plan.BuffersBefore)
+	require.Equal(t, 10, plan.BuffersAfter)
+
+	// d lives between forward of a and its recomputation
+	require.Same(t, aData, d.Data)
+	// grad of d lives between forward of b and its recomputation
+	require.Same(t, bData, d.Grad)
+
+	// the segment output is kept
+	require.Same(t, cData, c.Data)
+	require.Same(t, cGrad, c.Grad)
+}
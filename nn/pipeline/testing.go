@@ -7,22 +7,31 @@ import (
 )
 
 func NewTestingPipeline(device *mtl.Device, lastNode *num.Data) *TestingPipeline {
+	mustHaveGrads(lastNode)
+
+	checkpointResets := getCheckpointResets(lastNode)
+	backwardLayers := getBackwardNodeLayers(lastNode)
+
 	return &TestingPipeline{
-		device:          device,
-		forwardLayers:   getForwardNodeLayers(lastNode),
-		backwardLayers:  getBackwardNodeLayers(lastNode),
-		resetGradsNodes: getResetGradsNodes(lastNode),
-		commandQueue:    device.NewCommandQueue(),
+		device:           device,
+		forwardLayers:    getForwardNodeLayers(lastNode),
+		backwardLayers:   backwardLayers,
+		resetGradsNodes:  getResetGradsNodes(lastNode, checkpointResets, backwardLayers),
+		checkpointResets: checkpointResets,
+		fillKernel:       fill.New(device),
+		commandQueue:     device.NewCommandQueue(),
 	}
 }
 
 type TestingPipeline struct {
 	device *mtl.Device
 
-	forwardLayers   NodeLayers
-	backwardLayers  NodeLayers
-	resetGradsNodes Nodes
-	commandQueue    *mtl.CommandQueue
+	forwardLayers    NodeLayers
+	backwardLayers   NodeLayers
+	resetGradsNodes  Nodes
+	checkpointResets map[*num.Data]Nodes
+	fillKernel       *fill.Kernel
+	commandQueue     *mtl.CommandQueue
 }
 
 func (p *TestingPipeline) withCommandBuffer(callback func(b *mtl.CommandBuffer)) {
@@ -54,12 +63,11 @@ func (p *TestingPipeline) forward(b *mtl.CommandBuffer) {
 }
 
 func (p *TestingPipeline) reset(b *mtl.CommandBuffer) {
-	fillKernel := fill.New(p.device)
 	for i, node := range p.resetGradsNodes {
 		if i == 0 {
-			fillKernel.Fill(b, node.Grad, 1.0, 0, node.Dims.Length())
+			p.fillKernel.Fill(b, node.Grad, 1.0, 0, node.Dims.Length())
 		} else {
-			fillKernel.Fill(b, node.Grad, 0.0, 0, node.Dims.Length())
+			p.fillKernel.Fill(b, node.Grad, 0.0, 0, node.Dims.Length())
 		}
 	}
 }
@@ -67,7 +75,12 @@ func (p *TestingPipeline) reset(b *mtl.CommandBuffer) {
 func (p *TestingPipeline) backward(b *mtl.CommandBuffer) {
 	for _, nodes := range p.backwardLayers {
 		for _, node := range nodes {
-			node.CalcGrad(b)
+			if node.Checkpoint != nil {
+				recalcData(b, p.fillKernel, node, p.checkpointResets[node])
+			}
+			if node.CalcGrad != nil {
+				node.CalcGrad(b)
+			}
 		}
 	}
 }
@@ -7,22 +7,31 @@ import (
 )
 
 func NewTrainingPipeline(device *mtl.Device, lastNode *num.Data) *TrainingPipeline {
+	mustHaveGrads(lastNode)
+
+	checkpointResets := getCheckpointResets(lastNode)
+	backwardLayers := getBackwardNodeLayers(lastNode)
+
 	return &TrainingPipeline{
-		device:          device,
-		forwardLayers:   getForwardNodeLayers(lastNode),
-		backwardLayers:  getBackwardNodeLayers(lastNode),
-		resetGradsNodes: getResetGradsNodes(lastNode),
-		commandQueue:    device.NewCommandQueue(),
+		device:           device,
+		forwardLayers:    getForwardNodeLayers(lastNode),
+		backwardLayers:   backwardLayers,
+		resetGradsNodes:  getResetGradsNodes(lastNode, checkpointResets, backwardLayers),
+		checkpointResets: checkpointResets,
+		fillKernel:       fill.New(device),
+		commandQueue:     device.NewCommandQueue(),
 	}
 }
 
 type TrainingPipeline struct {
 	device *mtl.Device
 
-	forwardLayers   NodeLayers
-	backwardLayers  NodeLayers
-	resetGradsNodes Nodes
-	commandQueue    *mtl.CommandQueue
+	forwardLayers    NodeLayers
+	backwardLayers   NodeLayers
+	resetGradsNodes  Nodes
+	checkpointResets map[*num.Data]Nodes
+	fillKernel       *fill.Kernel
+	commandQueue     *mtl.CommandQueue
 }
 
 func (p *TrainingPipeline) withCommandBuffer(callback func(b *mtl.CommandBuffer)) {
@@ -42,12 +51,20 @@ func (p *TrainingPipeline) forward(b *mtl.CommandBuffer) {
 }
 
 func (p *TrainingPipeline) reset(b *mtl.CommandBuffer) {
-	fillKernel := fill.New(p.device)
+	p.resetGrads(b, 1.0, true)
+}
+
+// resetGrads sets the grad of the last node to lossGrad and zeroes other grads,
+// grads of leaves (params and inputs) are zeroed only with resetLeaves.
+func (p *TrainingPipeline) resetGrads(b *mtl.CommandBuffer, lossGrad float32, resetLeaves bool) {
 	for i, node := range p.resetGradsNodes {
-		if i == 0 {
-			fillKernel.Fill(b, node.Grad, 1.0, 0, node.Dims.Length())
-		} else {
-			fillKernel.Fill(b, node.Grad, 0.0, 0, node.Dims.Length())
+		switch {
+		case i == 0:
+			p.fillKernel.Fill(b, node.Grad, lossGrad, 0, node.Dims.Length())
+		case node.CalcData == nil && !resetLeaves:
+			continue
+		default:
+			p.fillKernel.Fill(b, node.Grad, 0.0, 0, node.Dims.Length())
 		}
 	}
 }
@@ -55,7 +72,12 @@ func (p *TrainingPipeline) reset(b *mtl.CommandBuffer) {
 func (p *TrainingPipeline) backward(b *mtl.CommandBuffer) {
 	for _, nodes := range p.backwardLayers {
 		for _, node := range nodes {
-			node.CalcGrad(b)
+			if node.Checkpoint != nil {
+				recalcData(b, p.fillKernel, node, p.checkpointResets[node])
+			}
+			if node.CalcGrad != nil {
+				node.CalcGrad(b)
+			}
 		}
 	}
 }
@@ -68,3 +90,62 @@ func (p *TrainingPipeline) TrainIteration(update func(b *mtl.CommandBuffer)) {
 		update(b)
 	})
 }
+
+// ComputeGrads runs forward and backward without update, afterBackward passes are encoded
+// right after backward (e.g. gradient clipping). Grads can be read when it returns,
+// Update applies them.
+func (p *TrainingPipeline) ComputeGrads(afterBackward ...func(b *mtl.CommandBuffer)) {
+	p.withCommandBuffer(func(b *mtl.CommandBuffer) {
+		p.forward(b)
+		p.reset(b)
+		p.backward(b)
+		for _, pass := range afterBackward {
+			pass(b)
+		}
+	})
+}
+
+// AccumulateGrads runs forward and backward of the micro-batch with index microBatch out of
+// microBatches. Grads of params are accumulated over micro-batches, they are reset by the first one,
+// grads of activations are reset by every one. The grad of the loss is 1/microBatches,
+// so after the last micro-batch params have the grads of the loss averaged over micro-batches,
+// as for one large batch. afterBackward passes are encoded after the last micro-batch,
+// then Update applies the grads.
+func (p *TrainingPipeline) AccumulateGrads(microBatch, microBatches int, afterBackward ...func(b *mtl.CommandBuffer)) {
+	if microBatch < 0 || microBatch >= microBatches {
+		panic("pipeline: micro-batch index out of range")
+	}
+
+	p.withCommandBuffer(func(b *mtl.CommandBuffer) {
+		p.forward(b)
+		p.resetGrads(b, 1/float32(microBatches), microBatch == 0)
+		p.backward(b)
+		if microBatch == microBatches-1 {
+			for _, pass := range afterBackward {
+				pass(b)
+			}
+		}
+	})
+}
+
+// Update runs the update of grads computed by ComputeGrads, a training loop
+// may skip it, e.g. for non-finite gradients.
+func (p *TrainingPipeline) Update(update func(b *mtl.CommandBuffer)) {
+	p.withCommandBuffer(update)
+}
+
+// PlanMemory shares Data and Grad buffers between intermediate nodes whose lifetimes
+// in TrainIteration don't overlap. Buffers of the last node and of keep nodes are preserved.
+func (p *TrainingPipeline) PlanMemory(keep ...*num.Data) MemoryPlan {
+	m := newMemoryPlanner()
+	m.addLayers(p.forwardLayers)
+	m.pinNodes(lastNodes(p.forwardLayers)...)
+	m.pinNodes(keep...)
+
+	step := m.scheduleForward(0, p.forwardLayers)
+	for _, node := range p.resetGradsNodes {
+		m.define(step, node.Grad)
+	}
+	m.scheduleBackward(step+1, p.backwardLayers, p.checkpointResets)
+	return m.apply()
+}
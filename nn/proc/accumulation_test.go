@@ -0,0 +1,49 @@
+package proc
+
+import (
+	"testing"
+
+	"github.com/atkhx/metal/mtl"
+	"github.com/atkhx/metal/nn/num"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrainingPipeline_AccumulateGrads(t *testing.T) {
+	device := NewWithSystemDefaultDevice()
+	defer device.Release()
+
+	inputs := []float32{1, -2, 3, -4, 5, -6, 0.5, 0.25, -1, 2, 0, 1}
+	targets := []float32{0.1, 0.9, 0.3, 0.7, 0.5, 0.5, 0.8, 0.2}
+
+	build := func(rows int) (x, y *num.Data, loss *num.Data, params []*num.Data) {
+		x = device.NewData(mtl.NewMTLSize(3, rows))
+		y = device.NewData(mtl.NewMTLSize(2, rows))
+		w := device.NewDataWithValues(mtl.NewMTLSize(2, 3), []float32{0.1, -0.2, 0.3, 0.05, -0.4, 0.2})
+		bias := device.NewDataWithValues(mtl.NewMTLSize(2), []float32{0.1, -0.1})
+
+		output := device.Sigmoid(device.AddRow(device.MatrixMultiply(x, w, 1), bias, 2))
+		diff := device.Sub(output, y)
+		return x, y, device.Mean(device.Mul(diff, diff)), []*num.Data{w, bias}
+	}
+
+	x, y, loss, expParams := build(4)
+	copy(x.Data.GetFloats(), inputs)
+	copy(y.Data.GetFloats(), targets)
+	device.GetTrainingPipeline(loss).TrainIteration(func(b *mtl.CommandBuffer) {})
+
+	microX, microY, microLoss, actParams := build(2)
+	trainingPipeline := device.GetTrainingPipeline(microLoss)
+
+	// the second round checks param grads are reset by the first micro-batch
+	for round := 0; round < 2; round++ {
+		for i := 0; i < 2; i++ {
+			copy(microX.Data.GetFloats(), inputs[i*6:(i+1)*6])
+			copy(microY.Data.GetFloats(), targets[i*4:(i+1)*4])
+			trainingPipeline.AccumulateGrads(i, 2)
+		}
+
+		for j := range expParams {
+			require.InDeltaSlice(t, expParams[j].Grad.GetFloats(), actParams[j].Grad.GetFloats(), 1e-6)
+		}
+	}
+}
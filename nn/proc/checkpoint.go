@@ -0,0 +1,47 @@
+package proc
+
+import "github.com/atkhx/metal/nn/num"
+
+// Checkpoint makes the nodes between input and output a checkpoint segment: their activations
+// are not needed after the forward pass, training and testing pipelines compute them again
+// right before the backward pass of the segment. Memory is saved once buffers are shared
+// by TrainingPipeline.PlanMemory.
+//
+// Only nodes depending on input are recomputed, other nodes used by the segment (weights,
+// masks computed outside) are kept. The graph between input and output must be deterministic,
+// ops drawing random values or updating statistics set RecalcData for that.
+func (d *Device) Checkpoint(input, output *num.Data) *num.Data {
+	if d.noGrad || input == output {
+		return output
+	}
+
+	var segment []*num.Data
+	depends := map[*num.Data]bool{input: true}
+
+	var visit func(node *num.Data) bool
+	visit = func(node *num.Data) bool {
+		if result, ok := depends[node]; ok {
+			return result
+		}
+
+		result := false
+		for _, dep := range node.Deps {
+			if visit(dep) {
+				result = true
+			}
+		}
+		depends[node] = result
+
+		if result && node != output && node.CalcData != nil {
+			segment = append(segment, node)
+		}
+		return result
+	}
+
+	if !visit(output) {
+		panic("checkpoint: output does not depend on input")
+	}
+
+	output.Checkpoint = segment
+	return output
+}
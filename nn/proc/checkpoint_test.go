@@ -0,0 +1,57 @@
+package proc
+
+import (
+	"testing"
+
+	"github.com/atkhx/metal/mtl"
+	"github.com/atkhx/metal/nn/num"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDevice_Checkpoint(t *testing.T) {
+	device := NewWithSystemDefaultDevice()
+	defer device.Release()
+
+	newWeights := func(w, h int) *num.Data {
+		values := make([]float32, w*h)
+		for i := range values {
+			values[i] = float32(i%5)*0.1 - 0.2
+		}
+		return device.NewDataWithValues(mtl.NewMTLSize(w, h), values)
+	}
+
+	build := func(checkpoint bool) (loss *num.Data, params []*num.Data, segment []*num.Data) {
+		x := device.NewDataWithValues(mtl.NewMTLSize(3, 2), []float32{1, -2, 3, -4, 5, -6})
+		w1, w2 := newWeights(4, 3), newWeights(4, 4)
+
+		h := device.MatrixMultiply(x, w1, 1)
+		relu := device.Relu(h)
+		mm := device.MatrixMultiply(relu, w2, 1)
+		sigmoid := device.Sigmoid(mm)
+		output := device.Add(h, sigmoid)
+		if checkpoint {
+			output = device.Checkpoint(h, output)
+		}
+		return device.Mean(output), []*num.Data{x, w1, w2}, []*num.Data{relu, mm, sigmoid}
+	}
+
+	expLoss, expParams, _ := build(false)
+	device.GetTrainingPipeline(expLoss).TrainIteration(func(b *mtl.CommandBuffer) {})
+
+	actLoss, actParams, segment := build(true)
+	require.Equal(t, segment, actLoss.Deps[0].Checkpoint)
+
+	trainingPipeline := device.GetTrainingPipeline(actLoss)
+	plan := trainingPipeline.PlanMemory()
+	require.Less(t, plan.BuffersAfter, plan.BuffersBefore)
+
+	// grads must be the same as without recomputation, the second iteration checks reset of the segment
+	for i := 0; i < 2; i++ {
+		trainingPipeline.TrainIteration(func(b *mtl.CommandBuffer) {})
+
+		require.InDeltaSlice(t, expLoss.Data.GetFloats(), actLoss.Data.GetFloats(), 1e-6)
+		for j := range expParams {
+			require.InDeltaSlice(t, expParams[j].Grad.GetFloats(), actParams[j].Grad.GetFloats(), 1e-6)
+		}
+	}
+}
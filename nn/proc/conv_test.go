@@ -0,0 +1,78 @@
+package proc
+
+import (
+	"testing"
+
+	"github.com/atkhx/metal/mtl"
+	"github.com/atkhx/metal/nn/num"
+	"github.com/stretchr/testify/require"
+)
+
+func newConvTestData(device *Device, dims mtl.MTLSize) *num.Data {
+	values := make([]float32, dims.Length())
+	for i := range values {
+		values[i] = float32(i%7)*0.1 - 0.3
+	}
+	return device.NewDataWithValues(dims, values)
+}
+
+func TestDevice_Conv2D_NilBias(t *testing.T) {
+	device := NewWithSystemDefaultDevice()
+	defer device.Release()
+
+	// stride 2 keeps both convolutions on the direct kernel, zero biases must not change the result
+	params := ConvParams{StrideW: 2, StrideH: 2, PaddingW: 1, PaddingH: 1}
+
+	build := func(withBias bool) (*num.Data, []*num.Data) {
+		input := newConvTestData(device, mtl.NewMTLSize(5, 5, 2))
+		weights := newConvTestData(device, mtl.NewMTLSize(3, 3, 4))
+
+		var biases *num.Data
+		if withBias {
+			biases = device.NewData(mtl.NewMTLSize(1, 1, 2))
+		}
+		output := device.Conv2D(input, weights, biases, 2, 1, params)
+		return device.Mean(device.Mul(output, output)), []*num.Data{input, weights}
+	}
+
+	expLoss, expParams := build(true)
+	device.GetTrainingPipeline(expLoss).TrainIteration(func(b *mtl.CommandBuffer) {})
+
+	actLoss, actParams := build(false)
+	device.GetTrainingPipeline(actLoss).TrainIteration(func(b *mtl.CommandBuffer) {})
+
+	require.InDeltaSlice(t, expLoss.Data.GetFloats(), actLoss.Data.GetFloats(), 1e-6)
+	for i := range expParams {
+		require.InDeltaSlice(t, expParams[i].Grad.GetFloats(), actParams[i].Grad.GetFloats(), 1e-6)
+	}
+}
+
+func TestDevice_ConvTranspose2D_NilBias(t *testing.T) {
+	device := NewWithSystemDefaultDevice()
+	defer device.Release()
+
+	params := ConvTransposeParams{StrideW: 2, StrideH: 2, PaddingW: 1, PaddingH: 1, OutputPaddingW: 1, OutputPaddingH: 1}
+
+	build := func(withBias bool) (*num.Data, []*num.Data) {
+		input := newConvTestData(device, mtl.NewMTLSize(3, 3, 2))
+		weights := newConvTestData(device, mtl.NewMTLSize(3, 3, 4))
+
+		var biases *num.Data
+		if withBias {
+			biases = device.NewData(mtl.NewMTLSize(1, 1, 2))
+		}
+		output := device.ConvTranspose2D(input, weights, biases, 2, 1, params)
+		return device.Mean(device.Mul(output, output)), []*num.Data{input, weights}
+	}
+
+	expLoss, expParams := build(true)
+	device.GetTrainingPipeline(expLoss).TrainIteration(func(b *mtl.CommandBuffer) {})
+
+	actLoss, actParams := build(false)
+	device.GetTrainingPipeline(actLoss).TrainIteration(func(b *mtl.CommandBuffer) {})
+
+	require.InDeltaSlice(t, expLoss.Data.GetFloats(), actLoss.Data.GetFloats(), 1e-6)
+	for i := range expParams {
+		require.InDeltaSlice(t, expParams[i].Grad.GetFloats(), actParams[i].Grad.GetFloats(), 1e-6)
+	}
+}
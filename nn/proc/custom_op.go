@@ -0,0 +1,104 @@
+package proc
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/atkhx/metal/mtl"
+	"github.com/atkhx/metal/nn/num"
+)
+
+// CustomOp describes a user op which takes part in pipelines the same way as the built-in ones.
+//
+// Forward and Backward encode GPU work into the command buffer. Backward must add
+// gradients to the Grad buffers of inputs: they are reset by the pipeline, not by the op.
+//
+// CPUForward and CPUBackward are pure-Go fallbacks used when the GPU function is nil.
+// All buffers are shared, so they work directly on GetFloats of Data and Grad.
+// Before a fallback is called the command buffer is flushed: the work encoded
+// before it is completed and the work after it goes to a new command buffer.
+//
+// An op without both Backward and CPUBackward does not pass gradients to its inputs.
+// Implementations which capture buffers at construction must set KeepBuffers
+// on those nodes, otherwise the memory planner may replace the buffers.
+type CustomOp struct {
+	Name string
+	// Dims returns the output dims for the inputs, it may panic if they are not valid.
+	Dims func(inputs ...*num.Data) mtl.MTLSize
+
+	Forward  func(b *mtl.CommandBuffer, output *num.Data, inputs ...*num.Data)
+	Backward func(b *mtl.CommandBuffer, output *num.Data, inputs ...*num.Data)
+
+	CPUForward  func(output *num.Data, inputs ...*num.Data)
+	CPUBackward func(output *num.Data, inputs ...*num.Data)
+}
+
+var (
+	ErrCustomOpNoName    = errors.New("custom op has no name")
+	ErrCustomOpNoDims    = errors.New("custom op has no dims function")
+	ErrCustomOpNoForward = errors.New("custom op has neither Forward nor CPUForward")
+	ErrCustomOpExists    = errors.New("custom op is already registered")
+)
+
+// RegisterOp makes op available by its name for CustomOp.
+func (d *Device) RegisterOp(op CustomOp) error {
+	if op.Name == "" {
+		return ErrCustomOpNoName
+	}
+	if op.Dims == nil {
+		return fmt.Errorf("%w: %s", ErrCustomOpNoDims, op.Name)
+	}
+	if op.Forward == nil && op.CPUForward == nil {
+		return fmt.Errorf("%w: %s", ErrCustomOpNoForward, op.Name)
+	}
+	if _, ok := d.customOps[op.Name]; ok {
+		return fmt.Errorf("%w: %s", ErrCustomOpExists, op.Name)
+	}
+
+	if d.customOps == nil {
+		d.customOps = map[string]CustomOp{}
+	}
+	d.customOps[op.Name] = op
+	return nil
+}
+
+// CustomOp applies the registered op to inputs, the inputs become dependencies of the output.
+func (d *Device) CustomOp(name string, inputs ...*num.Data) *num.Data {
+	op, ok := d.customOps[name]
+	if !ok {
+		panic(fmt.Sprintf("custom op %q is not registered", name))
+	}
+
+	output := d.newDataFor(name, op.Dims(inputs...), inputs...)
+	kernel := &customOpKernel{op: op, output: output, inputs: inputs}
+	d.assocKernel(output, kernel)
+
+	if op.Backward == nil && op.CPUBackward == nil {
+		output.CalcGrad = nil
+	}
+	return output
+}
+
+type customOpKernel struct {
+	op     CustomOp
+	output *num.Data
+	inputs []*num.Data
+}
+
+func (k *customOpKernel) Forward(b *mtl.CommandBuffer) {
+	if k.op.Forward != nil {
+		k.op.Forward(b, k.output, k.inputs...)
+		return
+	}
+	b.Flush()
+	k.op.CPUForward(k.output, k.inputs...)
+}
+
+func (k *customOpKernel) Backward(b *mtl.CommandBuffer) {
+	if k.op.Backward != nil {
+		k.op.Backward(b, k.output, k.inputs...)
+		return
+	}
+	b.Flush()
+	k.op.CPUBackward(k.output, k.inputs...)
+}
@@ -0,0 +1,53 @@
+package proc
+
+import (
+	"testing"
+
+	"github.com/atkhx/metal/mtl"
+	"github.com/atkhx/metal/nn/num"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDevice_CustomOp(t *testing.T) {
+	device := NewWithSystemDefaultDevice()
+	defer device.Release()
+
+	square := CustomOp{
+		Name: "square",
+		Dims: func(inputs ...*num.Data) mtl.MTLSize {
+			return inputs[0].Dims
+		},
+		CPUForward: func(output *num.Data, inputs ...*num.Data) {
+			outputData := output.Data.GetFloats()
+			for i, v := range inputs[0].Data.GetFloats() {
+				outputData[i] = v * v
+			}
+		},
+		CPUBackward: func(output *num.Data, inputs ...*num.Data) {
+			inputData := inputs[0].Data.GetFloats()
+			inputGrad := inputs[0].Grad.GetFloats()
+			for i, g := range output.Grad.GetFloats() {
+				inputGrad[i] += 2 * inputData[i] * g
+			}
+		},
+	}
+
+	require.NoError(t, device.RegisterOp(square))
+	require.ErrorIs(t, device.RegisterOp(square), ErrCustomOpExists)
+	require.ErrorIs(t, device.RegisterOp(CustomOp{}), ErrCustomOpNoName)
+	require.ErrorIs(t, device.RegisterOp(CustomOp{Name: "noDims"}), ErrCustomOpNoDims)
+	require.ErrorIs(t, device.RegisterOp(CustomOp{Name: "noForward", Dims: square.Dims}), ErrCustomOpNoForward)
+
+	require.Panics(t, func() {
+		device.CustomOp("unknown")
+	})
+
+	// GPU ops before and after the CPU one run in the same pipeline iteration.
+	input := device.NewDataWithValues(mtl.NewMTLSize(3), []float32{1, -2, 3})
+	loss := device.Mean(device.Relu(device.CustomOp("square", device.Relu(input))))
+
+	device.GetTrainingPipeline(loss).TrainIteration(func(b *mtl.CommandBuffer) {})
+
+	require.InDelta(t, float32(10.0/3), loss.Data.GetFloats()[0], 1e-6)
+	require.InDeltaSlice(t, []float32{2.0 / 3, 0, 2}, input.Grad.GetFloats(), 1e-6)
+}
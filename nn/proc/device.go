@@ -2,6 +2,7 @@ package proc
 
 import (
 	"fmt"
+	"math"
 	"math/rand"
 	"time"
 
@@ -11,12 +12,19 @@ import (
 	"github.com/atkhx/metal/nn/ops/addcols"
 	"github.com/atkhx/metal/nn/ops/addequal"
 	"github.com/atkhx/metal/nn/ops/addrows"
+	"github.com/atkhx/metal/nn/ops/avgpool"
+	"github.com/atkhx/metal/nn/ops/batchnorm2d"
 	"github.com/atkhx/metal/nn/ops/bce"
+	"github.com/atkhx/metal/nn/ops/broadcast"
 	"github.com/atkhx/metal/nn/ops/conv"
+	"github.com/atkhx/metal/nn/ops/conv2d"
+	"github.com/atkhx/metal/nn/ops/convtranspose2d"
 	"github.com/atkhx/metal/nn/ops/dropout"
 	"github.com/atkhx/metal/nn/ops/embeddings"
+	"github.com/atkhx/metal/nn/ops/gather"
 	"github.com/atkhx/metal/nn/ops/gelu"
 	"github.com/atkhx/metal/nn/ops/gelunew"
+	"github.com/atkhx/metal/nn/ops/groupnorm"
 	"github.com/atkhx/metal/nn/ops/layernormrows"
 	"github.com/atkhx/metal/nn/ops/layernormrows_opt"
 	"github.com/atkhx/metal/nn/ops/matmul"
@@ -26,7 +34,9 @@ import (
 	"github.com/atkhx/metal/nn/ops/mulequal"
 	"github.com/atkhx/metal/nn/ops/mulrows"
 	"github.com/atkhx/metal/nn/ops/nllpos"
+	"github.com/atkhx/metal/nn/ops/permute"
 	"github.com/atkhx/metal/nn/ops/positionaladd"
+	"github.com/atkhx/metal/nn/ops/reduce"
 	"github.com/atkhx/metal/nn/ops/relu"
 	"github.com/atkhx/metal/nn/ops/rmsnormrows"
 	"github.com/atkhx/metal/nn/ops/rmsnormrows_opt"
@@ -34,6 +44,7 @@ import (
 	"github.com/atkhx/metal/nn/ops/sanitize"
 	"github.com/atkhx/metal/nn/ops/sigmoid"
 	"github.com/atkhx/metal/nn/ops/silu"
+	"github.com/atkhx/metal/nn/ops/slice"
 	"github.com/atkhx/metal/nn/ops/softmax"
 	"github.com/atkhx/metal/nn/ops/transpose"
 	"github.com/atkhx/metal/nn/ops/trilmask"
@@ -41,18 +52,35 @@ import (
 	"github.com/atkhx/metal/nn/ops/vaekl"
 	"github.com/atkhx/metal/nn/ops/vaesample"
 	"github.com/atkhx/metal/nn/pipeline"
+	"github.com/atkhx/metal/nn/schedule"
 )
 
 type Device struct {
 	mtlDevice *mtl.Device
+	customOps map[string]CustomOp
+	noGrad    bool
+
+	seed      int64
+	randomOps []randomOp
 }
 
 func New(mtlDevice *mtl.Device) *Device {
-	return &Device{mtlDevice: mtlDevice}
+	return &Device{mtlDevice: mtlDevice, seed: time.Now().UnixNano()}
 }
 
 func NewWithSystemDefaultDevice() *Device {
-	return &Device{mtl.MustCreateSystemDefaultDevice()}
+	return New(mtl.MustCreateSystemDefaultDevice())
+}
+
+// SetNoGrad switches construction of inference-only graphs: data created in this mode
+// gets no Grad buffer and ops get no CalcGrad. Such graphs can be run with
+// the inference pipeline only, training and testing pipelines refuse them.
+func (d *Device) SetNoGrad(noGrad bool) {
+	d.noGrad = noGrad
+}
+
+func (d *Device) IsNoGrad() bool {
+	return d.noGrad
 }
 
 func (d *Device) Release() {
@@ -75,10 +103,42 @@ func (d *Device) GetTrainingPipeline(lastNode *num.Data) *pipeline.TrainingPipel
 	return pipeline.NewTrainingPipeline(d.mtlDevice, lastNode)
 }
 
+// ViewError is the panic value of an op which gets a view it can't work with: a non-contiguous
+// input of an op which relies on Dims, or inputs of an elementwise op with different layouts.
+type ViewError struct {
+	// Op is the name of the Device method which builds the op.
+	Op     string
+	Shapes []num.Shape
+}
+
+func (e *ViewError) Error() string {
+	if len(e.Shapes) == 1 {
+		return fmt.Sprintf("%s: input %v is a non-contiguous view, use Contiguous", e.Op, e.Shapes[0])
+	}
+	return fmt.Sprintf("%s: views %v and %v have different layouts", e.Op, e.Shapes[0], e.Shapes[1])
+}
+
+// NewData creates output of an op. Deps must be contiguous: permuted views have to be
+// copied with Contiguous before they are passed to kernels which rely on Dims.
+// A non-contiguous dep panics with *ViewError, nil deps are skipped.
 func (d *Device) NewData(dims mtl.MTLSize, deps ...*num.Data) *num.Data {
+	return d.newDataFor("NewData", dims, deps...)
+}
+
+// newDataFor is NewData of the op named in *ViewError.
+func (d *Device) newDataFor(op string, dims mtl.MTLSize, deps ...*num.Data) *num.Data {
+	for _, dep := range deps {
+		if dep != nil && !dep.IsContiguous() {
+			panic(&ViewError{Op: op, Shapes: []num.Shape{dep.GetShape()}})
+		}
+	}
+	return d.newData(dims, deps...)
+}
+
+func (d *Device) newData(dims mtl.MTLSize, deps ...*num.Data) *num.Data {
 	return &num.Data{
 		Data: d.mtlDevice.NewBufferEmptyFloatsBuffer(dims.Length(), mtl.ResourceStorageModeShared),
-		Grad: d.mtlDevice.NewBufferEmptyFloatsBuffer(dims.Length(), mtl.ResourceStorageModeShared),
+		Grad: d.newGradBuffer(dims),
 		Dims: dims,
 		Deps: deps,
 	}
@@ -87,13 +147,33 @@ func (d *Device) NewData(dims mtl.MTLSize, deps ...*num.Data) *num.Data {
 func (d *Device) NewDataWithValues(dims mtl.MTLSize, values []float32) *num.Data {
 	return &num.Data{
 		Data: d.mtlDevice.NewBufferWithFloats(values, mtl.ResourceStorageModeShared),
-		Grad: d.mtlDevice.NewBufferEmptyFloatsBuffer(dims.Length(), mtl.ResourceStorageModeShared),
+		Grad: d.newGradBuffer(dims),
 		Dims: dims,
 	}
 }
 
-func (d *Device) newLinkedCopy(data *num.Data, links ...*num.Data) *num.Data {
-	return d.NewData(data.Dims, append([]*num.Data{data}, links...)...)
+func (d *Device) newGradBuffer(dims mtl.MTLSize) *mtl.Buffer {
+	if d.noGrad {
+		return nil
+	}
+	return d.mtlDevice.NewBufferEmptyFloatsBuffer(dims.Length(), mtl.ResourceStorageModeShared)
+}
+
+func (d *Device) newLinkedCopy(op string, data *num.Data, links ...*num.Data) *num.Data {
+	return d.newDataFor(op, data.Dims, append([]*num.Data{data}, links...)...)
+}
+
+// newElementwise creates output for ops which treat data as a flat array.
+// They keep the memory layout, so the output of a permuted view is the same view.
+func (d *Device) newElementwise(op string, data *num.Data, links ...*num.Data) *num.Data {
+	for _, link := range links {
+		if !(data.IsContiguous() && link.IsContiguous()) && data.GetShape() != link.GetShape() {
+			panic(&ViewError{Op: op, Shapes: []num.Shape{data.GetShape(), link.GetShape()}})
+		}
+	}
+	output := d.newData(data.Dims, append([]*num.Data{data}, links...)...)
+	output.Shape = data.Shape
+	return output
 }
 
 // NewDataRandUniformWeighted fills data with U(-w, w).
@@ -123,57 +203,177 @@ type Kernel interface {
 	Backward(b *mtl.CommandBuffer)
 }
 
+// kernels runs several kernels producing parts of the same output.
+type kernels []Kernel
+
+func (k kernels) Forward(b *mtl.CommandBuffer) {
+	for _, kernel := range k {
+		kernel.Forward(b)
+	}
+}
+
+func (k kernels) Backward(b *mtl.CommandBuffer) {
+	for _, kernel := range k {
+		kernel.Backward(b)
+	}
+}
+
 func (d *Device) assocKernel(output *num.Data, kernel Kernel) *num.Data {
 	output.CalcData = kernel.Forward
-	output.CalcGrad = kernel.Backward
+	if !d.noGrad {
+		output.CalcGrad = kernel.Backward
+	}
 	return output
 }
 
 func (d *Device) Mean(input *num.Data) *num.Data {
-	output := d.NewData(mtl.NewMTLSize(), input)
+	output := d.newDataFor("Mean", mtl.NewMTLSize(), input)
 	kernel := mean.New(d.mtlDevice, input, output, input.Dims.Length())
 	return d.assocKernel(output, kernel)
 }
 
+// Axis selects the dimension of a reduction.
+type Axis = reduce.Axis
+
+const (
+	AxisW = reduce.AxisW
+	AxisH = reduce.AxisH
+	AxisD = reduce.AxisD
+)
+
+// GetReduceDims returns the shape of a reduction along axis.
+// With keepDim the axis becomes 1, otherwise it is dropped and the following axes are shifted.
+func (d *Device) GetReduceDims(dims mtl.MTLSize, axis Axis, keepDim bool) mtl.MTLSize {
+	return reduce.Dims(dims, axis, keepDim)
+}
+
+func (d *Device) ReduceSum(input *num.Data, axis Axis, keepDim bool) *num.Data {
+	return d.reduce("ReduceSum", input, axis, keepDim, reduce.OpSum)
+}
+
+func (d *Device) ReduceMean(input *num.Data, axis Axis, keepDim bool) *num.Data {
+	return d.reduce("ReduceMean", input, axis, keepDim, reduce.OpMean)
+}
+
+// ReduceMax passes gradient to the first maximal element only.
+func (d *Device) ReduceMax(input *num.Data, axis Axis, keepDim bool) *num.Data {
+	return d.reduce("ReduceMax", input, axis, keepDim, reduce.OpMax)
+}
+
+// ReduceVar is the population variance along axis.
+func (d *Device) ReduceVar(input *num.Data, axis Axis, keepDim bool) *num.Data {
+	return d.reduce("ReduceVar", input, axis, keepDim, reduce.OpVar)
+}
+
+// ArgMax returns positions of the first maximal elements along axis as floats.
+// It is not differentiable: gradients are not propagated to input.
+func (d *Device) ArgMax(input *num.Data, axis Axis, keepDim bool) *num.Data {
+	return d.reduce("ArgMax", input, axis, keepDim, reduce.OpArgMax)
+}
+
+func (d *Device) reduce(name string, input *num.Data, axis Axis, keepDim bool, op reduce.Op) *num.Data {
+	output := d.newDataFor(name, reduce.Dims(input.Dims, axis, keepDim), input)
+	kernel := reduce.New(d.mtlDevice, input, output, axis, op)
+	return d.assocKernel(output, kernel)
+}
+
+// Add is elementwise a + b with NumPy-style broadcasting over W, H and D:
+// every axis must either be equal or be 1 in one of the operands.
+// Gradients of broadcast operands are summed over the repeated axes.
+// Operands of the same Dims and layout may be views, the result keeps their layout.
+// Other views are copied with Contiguous and broadcast over their folded Dims.
 func (d *Device) Add(aData, bData *num.Data) *num.Data {
 	if aData.Dims == bData.Dims {
-		return d.AddEqual(aData, bData)
+		return d.AddEqual(d.sameLayout(aData, bData))
 	}
-	if aData.Dims.W == bData.Dims.W && bData.Dims.H == 1 && bData.Dims.D == 1 {
+	aData, bData = d.Contiguous(aData), d.Contiguous(bData)
+	if isRowOf(aData.Dims, bData.Dims) {
 		return d.AddRow(aData, bData, aData.Dims.W)
 	}
-	panic("not implemented")
+	return d.broadcast("Add", aData, bData, broadcast.OpAdd)
+}
+
+// Sub is elementwise a - b with broadcasting, see Add.
+func (d *Device) Sub(aData, bData *num.Data) *num.Data {
+	return d.broadcast("Sub", aData, bData, broadcast.OpSub)
+}
+
+// Mul is elementwise a * b with broadcasting, see Add.
+func (d *Device) Mul(aData, bData *num.Data) *num.Data {
+	if aData.Dims == bData.Dims {
+		return d.MulEqual(d.sameLayout(aData, bData))
+	}
+	aData, bData = d.Contiguous(aData), d.Contiguous(bData)
+	if isRowOf(aData.Dims, bData.Dims) {
+		return d.MulRow(aData, bData, aData.Dims.W)
+	}
+	return d.broadcast("Mul", aData, bData, broadcast.OpMul)
+}
+
+// Div is elementwise a / b with broadcasting, see Add.
+func (d *Device) Div(aData, bData *num.Data) *num.Data {
+	return d.broadcast("Div", aData, bData, broadcast.OpDiv)
+}
+
+// sameLayout returns operands of an elementwise op as is when they are laid out the same way
+// and their contiguous copies otherwise.
+func (d *Device) sameLayout(aData, bData *num.Data) (*num.Data, *num.Data) {
+	if aData.GetShape() == bData.GetShape() || aData.IsContiguous() && bData.IsContiguous() {
+		return aData, bData
+	}
+	return d.Contiguous(aData), d.Contiguous(bData)
+}
+
+// GetBroadcastDims returns the shape of a broadcast elementwise op result or an error if shapes are incompatible.
+func (d *Device) GetBroadcastDims(aDims, bDims mtl.MTLSize) (mtl.MTLSize, error) {
+	return broadcast.Dims(aDims, bDims)
+}
+
+func (d *Device) broadcast(name string, aData, bData *num.Data, op broadcast.Op) *num.Data {
+	dims, err := broadcast.Dims(aData.Dims, bData.Dims)
+	if err != nil {
+		panic(fmt.Sprintf("%s: %v", op, err))
+	}
+	aData, bData = d.Contiguous(aData), d.Contiguous(bData)
+	output := d.newDataFor(name, dims, aData, bData)
+	kernel := broadcast.New(d.mtlDevice, aData, bData, output, op)
+	return d.assocKernel(output, kernel)
+}
+
+// isRowOf reports whether row is a single row of the full tensor, the case handled by the row kernels.
+func isRowOf(full, row mtl.MTLSize) bool {
+	return full.W == row.W && row.H == 1 && row.D == 1
 }
 
 func (d *Device) AddEqual(input, weights *num.Data) *num.Data {
 	if input.Dims != weights.Dims {
 		panic("dimensions are not equal")
 	}
-	output := d.newLinkedCopy(input, weights)
+	output := d.newElementwise("AddEqual", input, weights)
 	kernel := addequal.New(d.mtlDevice, input, weights, output)
 	return d.assocKernel(output, kernel)
 }
 
 func (d *Device) AddRow(input, weights *num.Data, width int) *num.Data {
-	output := d.newLinkedCopy(input, weights)
+	output := d.newLinkedCopy("AddRow", input, weights)
 	kernel := addrows.New(d.mtlDevice, input, weights, output, width)
 	return d.assocKernel(output, kernel)
 }
 
 func (d *Device) AddCol(input, weights *num.Data, width, height int) *num.Data {
-	output := d.newLinkedCopy(input, weights)
+	output := d.newLinkedCopy("AddCol", input, weights)
 	kernel := addcols.New(d.mtlDevice, input, weights, output, width, height)
 	return d.assocKernel(output, kernel)
 }
 
 func (d *Device) MulCol(input, weights *num.Data, width, height int) *num.Data {
-	output := d.newLinkedCopy(input, weights)
+	output := d.newLinkedCopy("MulCol", input, weights)
 	kernel := mulcols.New(d.mtlDevice, input, weights, output, width, height)
 	return d.assocKernel(output, kernel)
 }
 
 func (d *Device) MulRow(input, weights *num.Data, width int) *num.Data {
-	output := d.newLinkedCopy(input, weights)
+	output := d.newLinkedCopy("MulRow", input, weights)
 	kernel := mulrows.New(d.mtlDevice, input, weights, output, width)
 	return d.assocKernel(output, kernel)
 }
@@ -182,79 +382,120 @@ func (d *Device) MulEqual(input, weights *num.Data) *num.Data {
 	if input.Dims.Length() != weights.Dims.Length() {
 		panic("input size != weights size")
 	}
-	output := d.newLinkedCopy(input, weights)
+	output := d.newElementwise("MulEqual", input, weights)
 	kernel := mulequal.New(d.mtlDevice, input, weights, output)
 	return d.assocKernel(output, kernel)
 }
 
 func (d *Device) RMSNorm(input *num.Data, width int) *num.Data {
-	output := d.newLinkedCopy(input)
+	output := d.newLinkedCopy("RMSNorm", input)
 	kernel := rmsnormrows.New(d.mtlDevice, input, output, width)
 	return d.assocKernel(output, kernel)
 }
 
 func (d *Device) RMSNormOpt(input *num.Data, width int) *num.Data {
-	output := d.newLinkedCopy(input)
+	output := d.newLinkedCopy("RMSNormOpt", input)
 	kernel := rmsnormrowsopt.New(d.mtlDevice, input, output, width)
 	return d.assocKernel(output, kernel)
 }
 
 func (d *Device) LayerNorm(input *num.Data, width int, eps float32) *num.Data {
-	output := d.newLinkedCopy(input)
+	output := d.newLinkedCopy("LayerNorm", input)
 	kernel := layernormrows.New(d.mtlDevice, input, output, width, eps)
 	return d.assocKernel(output, kernel)
 }
 
 func (d *Device) LayerNormOpt(input *num.Data, width int, eps float32) *num.Data {
-	output := d.newLinkedCopy(input)
+	output := d.newLinkedCopy("LayerNormOpt", input)
 	kernel := layernormrowsopt.New(d.mtlDevice, input, output, width, eps)
 	return d.assocKernel(output, kernel)
 }
 
+// BatchNorm2D normalizes every channel of (W, H, channels*batchSize) input over batch and spatial dims.
+// When *training is true batch statistics are used and runningMean/runningVar (1, 1, channels) are updated
+// with momentum, otherwise the running statistics are used. The flag is read on every forward pass.
+func (d *Device) BatchNorm2D(
+	input, gamma, beta, runningMean, runningVar *num.Data,
+	batchSize int,
+	eps, momentum float32,
+	training *bool,
+) *num.Data {
+	if input.Dims.D%batchSize != 0 {
+		panic(fmt.Sprintf("input depth %d must be divisible by batchSize %d", input.Dims.D, batchSize))
+	}
+	if channels := input.Dims.D / batchSize; gamma.Dims.Length() != channels || beta.Dims.Length() != channels {
+		panic(fmt.Sprintf("gamma and beta must have %d values", channels))
+	}
+
+	output := d.newDataFor("BatchNorm2D", input.Dims, input, gamma, beta)
+	kernel := batchnorm2d.New(d.mtlDevice, input, output, gamma, beta, runningMean, runningVar, batchSize, eps, momentum, training)
+	output.RecalcData = kernel.Replay
+	return d.assocKernel(output, kernel)
+}
+
+// GroupNorm splits channels of every batch item of (W, H, channels*batchSize) input into groupsCount groups
+// and normalizes each group over its channels and spatial dims. Gamma and beta are applied per channel.
+func (d *Device) GroupNorm(input, gamma, beta *num.Data, groupsCount, batchSize int, eps float32) *num.Data {
+	if input.Dims.D%batchSize != 0 {
+		panic(fmt.Sprintf("input depth %d must be divisible by batchSize %d", input.Dims.D, batchSize))
+	}
+	channels := input.Dims.D / batchSize
+	if groupsCount < 1 || channels%groupsCount != 0 {
+		panic(fmt.Sprintf("channels %d must be divisible by groupsCount %d", channels, groupsCount))
+	}
+	if gamma.Dims.Length() != channels || beta.Dims.Length() != channels {
+		panic(fmt.Sprintf("gamma and beta must have %d values", channels))
+	}
+
+	output := d.newDataFor("GroupNorm", input.Dims, input, gamma, beta)
+	kernel := groupnorm.New(d.mtlDevice, input, output, gamma, beta, groupsCount, batchSize, eps)
+	return d.assocKernel(output, kernel)
+}
+
 func (d *Device) RopeCols(input *num.Data, featuresCount, headSize, contextLength int) *num.Data {
-	output := d.newLinkedCopy(input)
+	output := d.newLinkedCopy("RopeCols", input)
 	kernel := ropecols.New(d.mtlDevice, input, output, featuresCount, headSize, contextLength)
 	return d.assocKernel(output, kernel)
 }
 
 func (d *Device) PositionalAdd(input, weights *num.Data, colsCount, rowsCount int) *num.Data {
-	output := d.newLinkedCopy(input, weights)
+	output := d.newLinkedCopy("PositionalAdd", input, weights)
 	kernel := positionaladd.New(d.mtlDevice, input, weights, output, colsCount, rowsCount)
 	return d.assocKernel(output, kernel)
 }
 
 func (d *Device) Relu(input *num.Data) *num.Data {
-	output := d.newLinkedCopy(input)
+	output := d.newElementwise("Relu", input)
 	kernel := relu.New(d.mtlDevice, input, output)
 	return d.assocKernel(output, kernel)
 }
 
 func (d *Device) Sanitize(input *num.Data) *num.Data {
-	output := d.newLinkedCopy(input)
+	output := d.newElementwise("Sanitize", input)
 	kernel := sanitize.New(d.mtlDevice, input, output)
 	return d.assocKernel(output, kernel)
 }
 
 func (d *Device) SiLu(input *num.Data) *num.Data {
-	output := d.newLinkedCopy(input)
+	output := d.newElementwise("SiLu", input)
 	kernel := silu.New(d.mtlDevice, input, output)
 	return d.assocKernel(output, kernel)
 }
 
 func (d *Device) Sigmoid(input *num.Data) *num.Data {
-	output := d.newLinkedCopy(input)
+	output := d.newElementwise("Sigmoid", input)
 	kernel := sigmoid.New(d.mtlDevice, input, output)
 	return d.assocKernel(output, kernel)
 }
 
 func (d *Device) GeLu(input *num.Data) *num.Data {
-	output := d.newLinkedCopy(input)
+	output := d.newElementwise("GeLu", input)
 	kernel := gelu.New(d.mtlDevice, input, output)
 	return d.assocKernel(output, kernel)
 }
 
 func (d *Device) GeLuNew(input *num.Data) *num.Data {
-	output := d.newLinkedCopy(input)
+	output := d.newElementwise("GeLuNew", input)
 	kernel := gelunew.New(d.mtlDevice, input, output)
 	return d.assocKernel(output, kernel)
 }
@@ -264,11 +505,14 @@ func (d *Device) Dropout(input *num.Data, prob float32) *num.Data {
 		return input
 	}
 
-	output := d.newLinkedCopy(input)
-	kernel := dropout.New(d.mtlDevice, input, output, prob, uint64(time.Now().UnixNano()))
+	output := d.newElementwise("Dropout", input)
+	kernel := dropout.New(d.mtlDevice, input, output, prob, d.nextSeed())
+	output.RecalcData = kernel.Replay
+	d.randomOps = append(d.randomOps, kernel)
 	return d.assocKernel(output, kernel)
 }
 
+// Reshape changes dims without copying, a non-contiguous view is copied first.
 func (d *Device) Reshape(input *num.Data, dims mtl.MTLSize) *num.Data {
 	if input.Dims.Length() != dims.Length() {
 		fmt.Println("input.Dims.Length()", input.Dims.Length())
@@ -276,23 +520,72 @@ func (d *Device) Reshape(input *num.Data, dims mtl.MTLSize) *num.Data {
 		panic("total dimension size must be equal with original")
 	}
 
+	input = d.Contiguous(input)
+
 	output := *input
 	output.Dims = dims
+	output.Shape = num.Shape{}
+	output.Deps = []*num.Data{input}
+	output.SkipResetGrad = true
+	output.CalcData = func(b *mtl.CommandBuffer) {}
+	output.CalcGrad = func(b *mtl.CommandBuffer) {}
+	if d.noGrad {
+		output.CalcGrad = nil
+	}
+	return &output
+}
+
+// View gives input an N-dimensional shape of up to num.MaxDims axes, innermost first.
+// Like Reshape it shares the buffers, Dims of the result are the folded shape:
+// ops other than elementwise ones see only the folded Dims.
+func (d *Device) View(input *num.Data, dims ...int) *num.Data {
+	shape := num.NewShape(dims...)
+	output := d.Reshape(input, shape.MTLSize())
+	output.Shape = shape
+	return output
+}
+
+// Permute reorders axes of input without copying: axis i of the result is axis axes[i] of input.
+// The result can be passed to elementwise ops, Add, Sub, Mul, Div and Reshape,
+// other ops need Contiguous and panic with *ViewError otherwise.
+func (d *Device) Permute(input *num.Data, axes ...int) *num.Data {
+	shape := input.GetShape().Permute(axes...)
+
+	output := *input
+	output.Dims = shape.MTLSize()
+	output.Shape = shape
 	output.Deps = []*num.Data{input}
 	output.SkipResetGrad = true
 	output.CalcData = func(b *mtl.CommandBuffer) {}
 	output.CalcGrad = func(b *mtl.CommandBuffer) {}
+	if d.noGrad {
+		output.CalcGrad = nil
+	}
 	return &output
 }
 
+// Contiguous copies a permuted view into its own buffer laid out as its shape says.
+// Contiguous input is returned as is.
+func (d *Device) Contiguous(input *num.Data) *num.Data {
+	if input.IsContiguous() {
+		return input
+	}
+
+	shape := input.GetShape()
+	output := d.newData(input.Dims, input)
+	output.Shape = num.NewShape(shape.Dims[:shape.Rank]...)
+	kernel := permute.New(d.mtlDevice, input, output)
+	return d.assocKernel(output, kernel)
+}
+
 func (d *Device) TrilMask(input *num.Data) *num.Data {
-	output := d.newLinkedCopy(input)
+	output := d.newLinkedCopy("TrilMask", input)
 	kernel := trilmask.New(d.mtlDevice, input, output, input.Dims.W, input.Dims.H)
 	return d.assocKernel(output, kernel)
 }
 
 func (d *Device) Softmax(input *num.Data) *num.Data {
-	output := d.newLinkedCopy(input)
+	output := d.newLinkedCopy("Softmax", input)
 	kernel := softmax.New(d.mtlDevice, input, output)
 	return d.assocKernel(output, kernel)
 }
@@ -302,7 +595,7 @@ func (d *Device) TriangleLowerSoftmax(input *num.Data) *num.Data {
 }
 
 func (d *Device) Transpose(input *num.Data) *num.Data {
-	output := d.newLinkedCopy(input)
+	output := d.newLinkedCopy("Transpose", input)
 	output.Dims.W = input.Dims.H
 	output.Dims.H = input.Dims.W
 
@@ -310,12 +603,118 @@ func (d *Device) Transpose(input *num.Data) *num.Data {
 	return d.assocKernel(output, kernel)
 }
 
+// Slice returns the box of input from the "from" corner inclusive to the "to" corner exclusive.
+func (d *Device) Slice(input *num.Data, from, to mtl.MTLSize) *num.Data {
+	dims := mtl.NewMTLSize(to.W-from.W, to.H-from.H, to.D-from.D)
+	if from.W < 0 || from.H < 0 || from.D < 0 ||
+		dims.W < 1 || dims.H < 1 || dims.D < 1 ||
+		to.W > input.Dims.W || to.H > input.Dims.H || to.D > input.Dims.D {
+		panic(fmt.Sprintf("invalid slice from %v to %v of %v", from, to, input.Dims))
+	}
+
+	output := d.newDataFor("Slice", dims, input)
+	kernel := slice.New(d.mtlDevice, input, output, from)
+	return d.assocKernel(output, kernel)
+}
+
+// Concat joins inputs along axis, all other axes must be equal.
+func (d *Device) Concat(axis Axis, inputs ...*num.Data) *num.Data {
+	if len(inputs) == 0 {
+		panic("concat: no inputs")
+	}
+
+	dims := inputs[0].Dims
+	size := 0
+	for _, input := range inputs {
+		if withAxisSize(input.Dims, axis, 1) != withAxisSize(dims, axis, 1) {
+			panic(fmt.Sprintf("concat: dims %v and %v differ outside of axis %d", dims, input.Dims, axis))
+		}
+		size += axisSize(input.Dims, axis)
+	}
+
+	output := d.newDataFor("Concat", withAxisSize(dims, axis, size), inputs...)
+	kernel := make(kernels, 0, len(inputs))
+	offset := 0
+	for _, input := range inputs {
+		kernel = append(kernel, slice.NewInsert(d.mtlDevice, input, output, withAxisSize(mtl.MTLSize{}, axis, offset)))
+		offset += axisSize(input.Dims, axis)
+	}
+	return d.assocKernel(output, kernel)
+}
+
+// Split cuts input along axis into parts of the given sizes, the sizes must sum up to the axis size.
+func (d *Device) Split(input *num.Data, axis Axis, sizes ...int) []*num.Data {
+	total := 0
+	for _, size := range sizes {
+		total += size
+	}
+	if total != axisSize(input.Dims, axis) {
+		panic(fmt.Sprintf("split: sizes %v do not sum up to %d", sizes, axisSize(input.Dims, axis)))
+	}
+
+	outputs := make([]*num.Data, 0, len(sizes))
+	offset := 0
+	for _, size := range sizes {
+		from := withAxisSize(mtl.MTLSize{}, axis, offset)
+		to := withAxisSize(input.Dims, axis, offset+size)
+		outputs = append(outputs, d.Slice(input, from, to))
+		offset += size
+	}
+	return outputs
+}
+
+// Gather selects slices of input along axis by indices stored as floats, like index_select.
+// The axis of the output has the length of indices. Indices get no gradient.
+func (d *Device) Gather(input, indices *num.Data, axis Axis) *num.Data {
+	var outer, length, inner int
+	switch axis {
+	case AxisW:
+		outer, length, inner = input.Dims.H*input.Dims.D, input.Dims.W, 1
+	case AxisH:
+		outer, length, inner = input.Dims.D, input.Dims.H, input.Dims.W
+	case AxisD:
+		outer, length, inner = 1, input.Dims.D, input.Dims.W*input.Dims.H
+	default:
+		panic(fmt.Sprintf("gather: unknown axis %d", axis))
+	}
+
+	output := d.newDataFor("Gather", withAxisSize(input.Dims, axis, indices.Dims.Length()), input, indices)
+	kernel := gather.New(d.mtlDevice, input, indices, output, outer, length, inner)
+	return d.assocKernel(output, kernel)
+}
+
+func axisSize(dims mtl.MTLSize, axis Axis) int {
+	switch axis {
+	case AxisW:
+		return dims.W
+	case AxisH:
+		return dims.H
+	case AxisD:
+		return dims.D
+	}
+	panic(fmt.Sprintf("unknown axis %d", axis))
+}
+
+func withAxisSize(dims mtl.MTLSize, axis Axis, size int) mtl.MTLSize {
+	switch axis {
+	case AxisW:
+		dims.W = size
+	case AxisH:
+		dims.H = size
+	case AxisD:
+		dims.D = size
+	default:
+		panic(fmt.Sprintf("unknown axis %d", axis))
+	}
+	return dims
+}
+
 func (d *Device) Embeddings(input *num.Data, tEmbeddings *num.Data) *num.Data {
 	featuresCount := tEmbeddings.Dims.W
 	contextSize := input.Dims.W
 	batchSize := input.Dims.H
 
-	output := d.NewData(mtl.NewMTLSize(featuresCount, contextSize, batchSize), tEmbeddings)
+	output := d.newDataFor("Embeddings", mtl.NewMTLSize(featuresCount, contextSize, batchSize), tEmbeddings)
 	kernel := embeddings.New(d.mtlDevice, input, output, tEmbeddings, featuresCount, contextSize)
 	return d.assocKernel(output, kernel)
 }
@@ -334,7 +733,7 @@ func (d *Device) CrossEntropyPos(input, targets *num.Data) *num.Data {
 	}
 
 	inputSoftmax := d.Softmax(d.Sanitize(input))
-	output := d.NewData(targets.Dims, inputSoftmax)
+	output := d.newDataFor("CrossEntropyPos", targets.Dims, inputSoftmax)
 	kernel := nllpos.New(d.mtlDevice, inputSoftmax, output, targets, input.Dims.W)
 	return d.assocKernel(output, kernel)
 }
@@ -344,7 +743,7 @@ func (d *Device) BinaryCrossEntropy(input, targets *num.Data) *num.Data {
 		panic("input dims must be equal target dims")
 	}
 
-	output := d.NewData(input.Dims, input, targets)
+	output := d.newDataFor("BinaryCrossEntropy", input.Dims, input, targets)
 	kernel := bce.New(d.mtlDevice, input, targets, output)
 	return d.assocKernel(output, kernel)
 }
@@ -360,7 +759,7 @@ func (d *Device) VAEKLDivergence(input *num.Data, latentDim int) *num.Data {
 	out := input.Dims
 	out.W = latentDim
 
-	output := d.NewData(out, input)
+	output := d.newDataFor("VAEKLDivergence", out, input)
 	kernel := vaekl.New(d.mtlDevice, input, output)
 	return d.assocKernel(output, kernel)
 }
@@ -382,7 +781,7 @@ func (d *Device) MatrixMultiply(aData, bData *num.Data, alpha float32) *num.Data
 	oW := bData.Dims.W
 	oH := aData.Dims.H
 
-	output := d.NewData(mtl.MTLSize{W: oW, H: oH, D: oD}, aData, bData)
+	output := d.newDataFor("MatrixMultiply", mtl.MTLSize{W: oW, H: oH, D: oD}, aData, bData)
 	kernel := matmul.New(d.mtlDevice, aData, bData, output, alpha)
 	return d.assocKernel(output, kernel)
 }
@@ -403,9 +802,85 @@ func (d *Device) GetPoolSize(iDims mtl.MTLSize, poolSize, padding, stride int) m
 }
 
 func (d *Device) Conv(input, weights, biases *num.Data, filtersCount, batchSize, padding, stride int) *num.Data {
-	convSize := d.GetConvSize(input.Dims.W, weights.Dims.W, filtersCount, batchSize, padding, stride)
-	output := d.NewData(convSize, input, weights, biases)
-	kernel := conv.New(d.mtlDevice, input, weights, biases, output, filtersCount, batchSize, padding, stride)
+	return d.Conv2D(input, weights, biases, filtersCount, batchSize, ConvParams{
+		StrideW:  stride,
+		StrideH:  stride,
+		PaddingW: padding,
+		PaddingH: padding,
+	})
+}
+
+// ConvParams describes stride, zero padding and dilation of a 2D convolution.
+type ConvParams = conv2d.Params
+
+func (d *Device) GetConv2DSize(iDims mtl.MTLSize, filterW, filterH, filtersCount, batchSize int, params ConvParams) mtl.MTLSize {
+	ow, oh := params.OutputSize(iDims.W, iDims.H, filterW, filterH)
+	return mtl.MTLSize{W: ow, H: oh, D: filtersCount * batchSize}
+}
+
+// Conv2D convolves input (W, H, channels*batchSize) with weights (kW, kH, channels*filtersCount)
+// stored in OHWI layout. Biases (1, 1, filtersCount) are optional.
+// Square kernels with stride 1 and no or "same" padding run on MPS, everything else
+// runs on the direct convolution kernel.
+func (d *Device) Conv2D(input, weights, biases *num.Data, filtersCount, batchSize int, params ConvParams) *num.Data {
+	params = params.Normalize()
+
+	convSize := d.GetConv2DSize(input.Dims, weights.Dims.W, weights.Dims.H, filtersCount, batchSize, params)
+	if convSize.W < 1 || convSize.H < 1 {
+		panic(fmt.Sprintf("conv output size must be positive, got %dx%d", convSize.W, convSize.H))
+	}
+
+	output := d.newDataFor("Conv2D", convSize, convDeps(input, weights, biases)...)
+
+	var kernel Kernel
+	if canUseMPSConv(weights.Dims, biases, params) {
+		kernel = conv.New(d.mtlDevice, input, weights, biases, output, filtersCount, batchSize, params.PaddingW, 1)
+	} else {
+		kernel = conv2d.New(d.mtlDevice, input, weights, biases, output, filtersCount, batchSize, params)
+	}
+	return d.assocKernel(output, kernel)
+}
+
+// convDeps returns deps of a convolution output without missing biases.
+func convDeps(input, weights, biases *num.Data) []*num.Data {
+	if biases == nil {
+		return []*num.Data{input, weights}
+	}
+	return []*num.Data{input, weights, biases}
+}
+
+func canUseMPSConv(wDims mtl.MTLSize, biases *num.Data, params ConvParams) bool {
+	if biases == nil || wDims.W != wDims.H {
+		return false
+	}
+	if params.StrideW != 1 || params.StrideH != 1 || params.DilationW != 1 || params.DilationH != 1 {
+		return false
+	}
+	if params.PaddingW != params.PaddingH {
+		return false
+	}
+	return params.PaddingW == 0 || 2*params.PaddingW == wDims.W-1
+}
+
+// ConvTransposeParams describes stride, padding, output padding and dilation of a transposed 2D convolution.
+type ConvTransposeParams = convtranspose2d.Params
+
+func (d *Device) GetConvTranspose2DSize(iDims mtl.MTLSize, filterW, filterH, filtersCount, batchSize int, params ConvTransposeParams) mtl.MTLSize {
+	ow, oh := params.OutputSize(iDims.W, iDims.H, filterW, filterH)
+	return mtl.MTLSize{W: ow, H: oh, D: filtersCount * batchSize}
+}
+
+// ConvTranspose2D is the gradient of Conv2D with respect to its input used as a forward op (learned upsampling).
+// Input (W, H, channels*batchSize), weights (kW, kH, channels*filtersCount) in [in][kH][kW][out] layout,
+// biases (1, 1, filtersCount) are optional.
+func (d *Device) ConvTranspose2D(input, weights, biases *num.Data, filtersCount, batchSize int, params ConvTransposeParams) *num.Data {
+	convSize := d.GetConvTranspose2DSize(input.Dims, weights.Dims.W, weights.Dims.H, filtersCount, batchSize, params)
+	if convSize.W < 1 || convSize.H < 1 {
+		panic(fmt.Sprintf("conv transpose output size must be positive, got %dx%d", convSize.W, convSize.H))
+	}
+
+	output := d.newDataFor("ConvTranspose2D", convSize, convDeps(input, weights, biases)...)
+	kernel := convtranspose2d.New(d.mtlDevice, input, weights, biases, output, filtersCount, batchSize, params)
 	return d.assocKernel(output, kernel)
 }
 
@@ -422,11 +897,61 @@ func (d *Device) MaxPool2D(input *num.Data, poolSize, padding, stride int) *num.
 
 	out := d.GetPoolSize(input.Dims, poolSize, padding, stride)
 
-	output := d.NewData(out, input)
+	output := d.newDataFor("MaxPool2D", out, input)
 	kernel := maxpool.New(d.mtlDevice, input, output, poolSize, stride, padding)
 	return d.assocKernel(output, kernel)
 }
 
+// AvgPoolParams describes the average pooling window.
+type AvgPoolParams = avgpool.Params
+
+func (d *Device) AvgPool2D(input *num.Data, poolSize, padding, stride int, countIncludePad bool) *num.Data {
+	return d.AvgPool2DWithParams(input, AvgPoolParams{
+		PoolW:           poolSize,
+		PoolH:           poolSize,
+		StrideW:         stride,
+		StrideH:         stride,
+		PaddingW:        padding,
+		PaddingH:        padding,
+		CountIncludePad: countIncludePad,
+	})
+}
+
+func (d *Device) AvgPool2DWithParams(input *num.Data, params AvgPoolParams) *num.Data {
+	if params.PoolW < 1 || params.PoolH < 1 {
+		panic("poolSize must be >= 1")
+	}
+	if params.StrideW < 1 || params.StrideH < 1 {
+		panic("stride must be >= 1")
+	}
+	if params.PaddingW < 0 || params.PaddingH < 0 {
+		panic("padding must be >= 0")
+	}
+	if 2*params.PaddingW > params.PoolW || 2*params.PaddingH > params.PoolH {
+		panic("padding must be at most half of poolSize")
+	}
+
+	oDims := input.Dims
+	oDims.W, oDims.H = params.OutputSize(input.Dims.W, input.Dims.H)
+	if oDims.W < 1 || oDims.H < 1 {
+		panic(fmt.Sprintf("pool output size must be positive, got %dx%d", oDims.W, oDims.H))
+	}
+
+	output := d.newDataFor("AvgPool2D", oDims, input)
+	kernel := avgpool.New(d.mtlDevice, input, output, params)
+	return d.assocKernel(output, kernel)
+}
+
+// GlobalAvgPool collapses every (W, H) plane into one value: (W, H, D) -> (1, 1, D).
+func (d *Device) GlobalAvgPool(input *num.Data) *num.Data {
+	return d.AvgPool2DWithParams(input, AvgPoolParams{
+		PoolW:   input.Dims.W,
+		PoolH:   input.Dims.H,
+		StrideW: 1,
+		StrideH: 1,
+	})
+}
+
 func (d *Device) UpSample2D(input *num.Data, scale int) *num.Data {
 	if scale < 1 {
 		panic("scale must be >= 1")
@@ -436,7 +961,7 @@ func (d *Device) UpSample2D(input *num.Data, scale int) *num.Data {
 	out.W *= scale
 	out.H *= scale
 
-	output := d.NewData(out, input)
+	output := d.newDataFor("UpSample2D", out, input)
 	kernel := upsample2d.New(d.mtlDevice, input, output, scale)
 	return d.assocKernel(output, kernel)
 }
@@ -452,19 +977,31 @@ func (d *Device) VAESample(input *num.Data, latentDim int) *num.Data {
 	out := input.Dims
 	out.W = latentDim
 
-	output := d.NewData(out, input)
-	kernel := vaesample.New(d.mtlDevice, input, output)
+	output := d.newDataFor("VAESample", out, input)
+	kernel := vaesample.New(d.mtlDevice, input, output, d.nextSeed())
+	output.RecalcData = kernel.Replay
+	d.randomOps = append(d.randomOps, kernel)
 	return d.assocKernel(output, kernel)
 }
 
 type Optimize func(b *mtl.CommandBuffer, iteration int)
-type Optimizer func(nodes []*num.Data) Optimize
+type Optimizer func(nodes []*num.Data) (Optimize, OptimizerState)
+
+// OptimizerState holds buffers an optimizer keeps between steps by name, every name has a buffer
+// per updated node (nil when the node does not need it). Restoring them resumes training.
+type OptimizerState map[string][]*mtl.Buffer
+
+// GetOptimizerAdam creates Adam with a constant learning rate.
+func (d *Device) GetOptimizerAdam(beta1, beta2, learningRate, eps float32) Optimizer {
+	return d.GetOptimizerAdamWithSchedule(beta1, beta2, learningRate, eps, nil)
+}
 
-func (d *Device) GetOptimizerAdam(iterations int, beta1, beta2, learningRate, eps float32) Optimizer {
-	iterations++
+// GetOptimizerAdamWithSchedule creates Adam with the learning rate scaled by lrSchedule every step.
+// Bias corrections are computed for every iteration, so the training length is not limited.
+func (d *Device) GetOptimizerAdamWithSchedule(beta1, beta2, learningRate, eps float32, lrSchedule schedule.Schedule) Optimizer {
 	kernel := adamw.New(d.mtlDevice)
 
-	return func(nodes []*num.Data) Optimize {
+	return func(nodes []*num.Data) (Optimize, OptimizerState) {
 
 		mm := make([]*mtl.Buffer, len(nodes))
 		vv := make([]*mtl.Buffer, len(nodes))
@@ -474,27 +1011,15 @@ func (d *Device) GetOptimizerAdam(iterations int, beta1, beta2, learningRate, ep
 			vv[i] = d.mtlDevice.NewBufferEmptyFloatsBuffer(node.Dims.Length(), mtl.ResourceStorageModeShared)
 		}
 
-		beta1pow := make([]float32, iterations)
-		beta2pow := make([]float32, iterations)
-
-		for i := 0; i < iterations; i++ {
-			if i == 0 {
-				beta1pow[i] = beta1
-				beta2pow[i] = beta2
-			} else {
-				beta1pow[i] = beta1pow[i-1] * beta1
-				beta2pow[i] = beta2pow[i-1] * beta2
-			}
-		}
-
-		for i := 0; i < iterations; i++ {
-			beta1pow[i] = 1 / (1 - beta1pow[i])
-			beta2pow[i] = 1 / (1 - beta2pow[i])
-		}
+		state := OptimizerState{"m": mm, "v": vv}
 
 		return func(b *mtl.CommandBuffer, iteration int) {
-			beta1powIterationLR := learningRate * beta1pow[iteration]
-			beta2powIteration := beta2pow[iteration]
+			step := float64(iteration + 1)
+			beta1pow := 1 / (1 - math.Pow(float64(beta1), step))
+			beta2pow := 1 / (1 - math.Pow(float64(beta2), step))
+
+			beta1powIterationLR := learningRate * schedule.FactorAt(lrSchedule, iteration) * float32(beta1pow)
+			beta2powIteration := float32(beta2pow)
 
 			for i, node := range nodes {
 				kernel.UpdateWithAdam(
@@ -510,6 +1035,6 @@ func (d *Device) GetOptimizerAdam(iterations int, beta1, beta2, learningRate, ep
 					eps,
 				)
 			}
-		}
+		}, state
 	}
 }
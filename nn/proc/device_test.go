@@ -0,0 +1,104 @@
+package proc
+
+import (
+	"testing"
+
+	"github.com/atkhx/metal/mtl"
+	"github.com/atkhx/metal/nn/num"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDevice_SetNoGrad(t *testing.T) {
+	device := NewWithSystemDefaultDevice()
+	defer device.Release()
+
+	device.SetNoGrad(true)
+
+	input := device.NewDataWithValues(mtl.NewMTLSize(2, 1), []float32{1, 2})
+	weights := device.NewDataWithValues(mtl.NewMTLSize(2, 2), []float32{1, 0, 0, 1})
+	output := device.Softmax(device.Relu(device.MatrixMultiply(input, weights, 1)))
+
+	for _, node := range []*num.Data{input, weights, output} {
+		require.Nil(t, node.Grad)
+		require.Nil(t, node.CalcGrad)
+	}
+	require.NotNil(t, output.CalcData)
+
+	device.GetInferencePipeline(output).Forward()
+	require.InDeltaSlice(t, []float32{0.26894142, 0.7310586}, output.Data.GetFloats(), 1e-6)
+
+	require.Panics(t, func() {
+		device.GetTrainingPipeline(output)
+	})
+	require.Panics(t, func() {
+		device.GetTestingPipeline(output)
+	})
+
+	device.SetNoGrad(false)
+
+	trainable := device.Relu(input)
+	require.NotNil(t, trainable.Grad)
+	require.NotNil(t, trainable.CalcGrad)
+}
+
+func TestDevice_ViewError(t *testing.T) {
+	device := NewWithSystemDefaultDevice()
+	defer device.Release()
+
+	input := device.NewData(mtl.NewMTLSize(3, 2))
+	permuted := device.Permute(input, 1, 0, 2)
+
+	viewError := func(build func()) (viewErr *ViewError) {
+		defer func() {
+			err, ok := recover().(error)
+			require.True(t, ok)
+			require.ErrorAs(t, err, &viewErr)
+		}()
+		build()
+		return nil
+	}
+
+	err := viewError(func() { device.Softmax(permuted) })
+	require.Equal(t, "Softmax", err.Op)
+	require.EqualError(t, err, "Softmax: input (2, 3, 1) is a non-contiguous view, use Contiguous")
+
+	err = viewError(func() { device.MatrixMultiply(permuted, input, 1) })
+	require.Equal(t, "MatrixMultiply", err.Op)
+
+	err = viewError(func() { device.AddEqual(permuted, device.NewData(permuted.Dims)) })
+	require.EqualError(t, err, "AddEqual: views (2, 3, 1) and (2, 3, 1) have different layouts")
+
+	// elementwise ops keep the view, other ops take a copy
+	require.Equal(t, permuted.Shape, device.Relu(permuted).Shape)
+	require.NotPanics(t, func() { device.Softmax(device.Contiguous(permuted)) })
+
+	// missing optional deps like biases are skipped by the check
+	require.NotPanics(t, func() { device.NewData(input.Dims, input, nil) })
+}
+
+func TestDevice_BroadcastViews(t *testing.T) {
+	device := NewWithSystemDefaultDevice()
+	defer device.Release()
+
+	input := device.NewDataWithValues(mtl.NewMTLSize(3, 2), []float32{0, 1, 2, 3, 4, 5})
+	permuted := device.Permute(input, 1, 0, 2)
+	row := device.NewDataWithValues(mtl.NewMTLSize(2), []float32{10, 20})
+	weights := device.NewDataWithValues(mtl.NewMTLSize(2, 3), []float32{1, 1, 1, 1, 1, 2})
+
+	add := device.Add(permuted, row)
+	device.GetInferencePipeline(add).Forward()
+	require.Equal(t, []float32{10, 23, 11, 24, 12, 25}, add.Data.GetFloats())
+
+	sub := device.Sub(permuted, row)
+	device.GetInferencePipeline(sub).Forward()
+	require.Equal(t, []float32{-10, -17, -9, -16, -8, -15}, sub.Data.GetFloats())
+
+	// operands of different layouts are copied, gradients go back through the copy
+	mul := device.Mul(permuted, weights)
+	device.GetTrainingPipeline(device.Mean(mul)).TrainIteration(func(b *mtl.CommandBuffer) {})
+	require.Equal(t, []float32{0, 3, 1, 4, 2, 10}, mul.Data.GetFloats())
+	require.InDeltaSlice(t, []float32{1. / 6, 1. / 6, 1. / 6, 1. / 6, 1. / 6, 2. / 6}, input.Grad.GetFloats(), 1e-6)
+
+	// operands of the same layout stay views
+	require.Equal(t, permuted.Shape, device.Add(permuted, permuted).Shape)
+}
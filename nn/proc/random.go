@@ -0,0 +1,52 @@
+package proc
+
+import "fmt"
+
+// randomOp is a kernel drawing new random values on every forward, e.g. a dropout mask.
+// Its generator is counter-based and seeded at creation, so the state is the number of draws made.
+type randomOp interface {
+	Draws() uint64
+	SetDraws(draws uint64)
+}
+
+// RandomState is the state of random ops of the device: the seed they were created with
+// and the number of draws of every op in creation order.
+type RandomState struct {
+	Seed  int64
+	Draws []uint64
+}
+
+// SetSeed makes random ops created after it reproducible. By default the seed is taken
+// from the time the device is created.
+func (d *Device) SetSeed(seed int64) {
+	d.seed = seed
+}
+
+// nextSeed returns the seed of the next random op, ops get different sequences.
+func (d *Device) nextSeed() uint64 {
+	return uint64(d.seed) + uint64(len(d.randomOps))*0x9E3779B97F4A7C15
+}
+
+func (d *Device) GetRandomState() RandomState {
+	state := RandomState{Seed: d.seed, Draws: make([]uint64, len(d.randomOps))}
+	for i, op := range d.randomOps {
+		state.Draws[i] = op.Draws()
+	}
+	return state
+}
+
+// RestoreRandomState sets random ops to the state, they must be created with the same
+// seed and in the same order, i.e. the graph is built after SetSeed(state.Seed).
+// Nothing is replayed: the next draws are derived from the seed and the numbers of draws.
+func (d *Device) RestoreRandomState(state RandomState) error {
+	if state.Seed != d.seed {
+		return fmt.Errorf("random ops are created with seed %d, state has seed %d", d.seed, state.Seed)
+	}
+	if len(state.Draws) != len(d.randomOps) {
+		return fmt.Errorf("device has %d random ops, state has %d", len(d.randomOps), len(state.Draws))
+	}
+	for i, op := range d.randomOps {
+		op.SetDraws(state.Draws[i])
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+// Package schedule implements learning rate schedules. A schedule returns the factor
+// the learning rate of an optimizer is multiplied by, optimizers consult it every step.
+package schedule
+
+import (
+	"fmt"
+	"math"
+)
+
+// Schedule returns the learning rate factor for the iteration counted from 0.
+type Schedule interface {
+	Factor(iteration int) float32
+}
+
+// Func adapts a function to Schedule.
+type Func func(iteration int) float32
+
+func (f Func) Factor(iteration int) float32 {
+	return f(iteration)
+}
+
+// FactorAt returns the factor of the schedule, 1 for nil.
+func FactorAt(s Schedule, iteration int) float32 {
+	if s == nil {
+		return 1
+	}
+	return s.Factor(iteration)
+}
+
+// Warmup rises the factor linearly from 1/steps to 1 during the first steps iterations,
+// then follows the next schedule started from 0. Nil next keeps the factor at 1.
+func Warmup(steps int, next Schedule) Schedule {
+	return Func(func(iteration int) float32 {
+		if iteration < steps {
+			return float32(iteration+1) / float32(steps)
+		}
+		return FactorAt(next, iteration-steps)
+	})
+}
+
+// Cosine decays the factor from 1 to minFactor by a half-cosine over steps iterations
+// and keeps minFactor after them.
+func Cosine(steps int, minFactor float32) Schedule {
+	return Func(func(iteration int) float32 {
+		if iteration >= steps {
+			return minFactor
+		}
+		cos := math.Cos(math.Pi * float64(iteration) / float64(steps))
+		return minFactor + (1-minFactor)*float32(1+cos)/2
+	})
+}
+
+// Step multiplies the factor by gamma every stepSize iterations.
+func Step(stepSize int, gamma float32) Schedule {
+	if stepSize < 1 {
+		panic(fmt.Sprintf("schedule: step size must be >= 1, got %d", stepSize))
+	}
+	return Func(func(iteration int) float32 {
+		return float32(math.Pow(float64(gamma), float64(iteration/stepSize)))
+	})
+}
+
+// OneCycle rises the factor from 1/divFactor to 1 during the first pctStart of steps
+// and anneals it to 1/(divFactor*finalDivFactor) by the end, both by cosine (Smith, 2018).
+// The learning rate of the optimizer is the maximal one.
+func OneCycle(steps int, pctStart, divFactor, finalDivFactor float32) Schedule {
+	initial := 1 / divFactor
+	final := initial / finalDivFactor
+	upSteps := int(float32(steps) * pctStart)
+
+	anneal := func(from, to float32, pct float64) float32 {
+		return to + (from-to)*float32(1+math.Cos(math.Pi*pct))/2
+	}
+
+	return Func(func(iteration int) float32 {
+		switch {
+		case iteration >= steps:
+			return final
+		case iteration < upSteps:
+			return anneal(initial, 1, float64(iteration)/float64(upSteps))
+		default:
+			return anneal(1, final, float64(iteration-upSteps)/float64(steps-upSteps))
+		}
+	})
+}
+
+// InverseSqrt warms up linearly for warmupSteps and then decays the factor
+// proportionally to the inverse square root of the step (Vaswani et al., 2017).
+func InverseSqrt(warmupSteps int) Schedule {
+	if warmupSteps < 1 {
+		panic(fmt.Sprintf("schedule: warmup steps must be >= 1, got %d", warmupSteps))
+	}
+	return Func(func(iteration int) float32 {
+		step := float64(iteration + 1)
+		warmup := float64(warmupSteps)
+		return float32(math.Min(step/warmup, math.Sqrt(warmup/step)))
+	})
+}
+
+// NewReduceOnPlateau creates a schedule multiplying the factor by decay when the observed
+// metric has not improved by more than threshold (relative) for patience observations.
+// The factor does not go below minFactor.
+func NewReduceOnPlateau(decay float32, patience int, threshold, minFactor float32) *ReduceOnPlateau {
+	return &ReduceOnPlateau{
+		decay:     decay,
+		patience:  patience,
+		threshold: threshold,
+		minFactor: minFactor,
+		factor:    1,
+		best:      float32(math.Inf(1)),
+	}
+}
+
+type ReduceOnPlateau struct {
+	decay     float32
+	patience  int
+	threshold float32
+	minFactor float32
+
+	factor    float32
+	best      float32
+	badEpochs int
+}
+
+// Observe takes the metric to minimize, e.g. the validation loss of an epoch.
+func (s *ReduceOnPlateau) Observe(metric float32) {
+	if metric < s.best*(1-s.threshold) {
+		s.best = metric
+		s.badEpochs = 0
+		return
+	}
+
+	s.badEpochs++
+	if s.badEpochs > s.patience {
+		s.factor = max(s.factor*s.decay, s.minFactor)
+		s.badEpochs = 0
+	}
+}
+
+func (s *ReduceOnPlateau) Factor(int) float32 {
+	return s.factor
+}
+
+// PlateauState is the state of ReduceOnPlateau saved to resume training, see model.TrainingState.
+type PlateauState struct {
+	Factor float32
+	// Best is the best observed metric, nil before the first observation.
+	Best      *float32
+	BadEpochs int
+}
+
+func (s *ReduceOnPlateau) State() PlateauState {
+	state := PlateauState{Factor: s.factor, BadEpochs: s.badEpochs}
+	if !math.IsInf(float64(s.best), 1) {
+		best := s.best
+		state.Best = &best
+	}
+	return state
+}
+
+// SetState restores the state returned by State, the config of the schedule is not a part of it.
+func (s *ReduceOnPlateau) SetState(state PlateauState) {
+	s.factor = state.Factor
+	s.badEpochs = state.BadEpochs
+	s.best = float32(math.Inf(1))
+	if state.Best != nil {
+		s.best = *state.Best
+	}
+}
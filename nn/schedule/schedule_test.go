@@ -0,0 +1,111 @@
+package schedule
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func factors(s Schedule, iterations int) []float32 {
+	result := make([]float32, iterations)
+	for i := range result {
+		result[i] = s.Factor(i)
+	}
+	return result
+}
+
+func TestSchedules(t *testing.T) {
+	testCases := []struct {
+		name     string
+		schedule Schedule
+		expected []float32
+	}{
+		{
+			name:     "warmup",
+			schedule: Warmup(4, nil),
+			expected: []float32{0.25, 0.5, 0.75, 1, 1, 1},
+		},
+		{
+			name:     "warmup then step",
+			schedule: Warmup(2, Step(2, 0.5)),
+			expected: []float32{0.5, 1, 1, 1, 0.5, 0.5, 0.25},
+		},
+		{
+			name:     "cosine",
+			schedule: Cosine(4, 0.2),
+			expected: []float32{1, 0.8828427, 0.6, 0.3171573, 0.2, 0.2},
+		},
+		{
+			name:     "step",
+			schedule: Step(3, 0.1),
+			expected: []float32{1, 1, 1, 0.1, 0.1, 0.1, 0.01},
+		},
+		{
+			name:     "one cycle",
+			schedule: OneCycle(6, 0.5, 10, 10),
+			expected: []float32{0.1, 0.325, 0.775, 1, 0.7525, 0.2575, 0.01},
+		},
+		{
+			name:     "inverse sqrt",
+			schedule: InverseSqrt(4),
+			expected: []float32{0.25, 0.5, 0.75, 1, 0.8944272, 0.8164966},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.InDeltaSlice(t, tc.expected, factors(tc.schedule, len(tc.expected)), 1e-6)
+		})
+	}
+}
+
+func TestFactorAt(t *testing.T) {
+	require.Equal(t, float32(1), FactorAt(nil, 100))
+	require.Equal(t, float32(0.5), FactorAt(Step(1, 0.5), 1))
+}
+
+func TestSchedules_InvalidSteps(t *testing.T) {
+	require.PanicsWithValue(t, "schedule: step size must be >= 1, got 0", func() { Step(0, 0.5) })
+	require.PanicsWithValue(t, "schedule: warmup steps must be >= 1, got 0", func() { InverseSqrt(0) })
+	require.PanicsWithValue(t, "schedule: warmup steps must be >= 1, got -1", func() { InverseSqrt(-1) })
+}
+
+func TestReduceOnPlateau(t *testing.T) {
+	s := NewReduceOnPlateau(0.5, 1, 0.01, 0.2)
+	require.Equal(t, float32(1), s.Factor(0))
+
+	var result []float32
+	for _, loss := range []float32{1, 0.9, 0.895, 0.9, 0.8, 0.85, 0.85, 0.85, 0.85, 0.85, 0.85} {
+		s.Observe(loss)
+		result = append(result, s.Factor(0))
+	}
+
+	// 0.895 is not better than 0.9 by 1%: the second bad observation halves the factor.
+	require.Equal(t, []float32{1, 1, 1, 0.5, 0.5, 0.5, 0.25, 0.25, 0.2, 0.2, 0.2}, result)
+}
+
+func TestReduceOnPlateau_State(t *testing.T) {
+	s := NewReduceOnPlateau(0.5, 1, 0.01, 0.2)
+	require.Equal(t, PlateauState{Factor: 1}, s.State())
+
+	for _, loss := range []float32{1, 0.9, 0.95, 0.95} {
+		s.Observe(loss)
+	}
+	best := float32(0.9)
+	require.Equal(t, PlateauState{Factor: 0.5, Best: &best}, s.State())
+	s.Observe(0.95)
+
+	// the restored schedule continues as the original one
+	restored := NewReduceOnPlateau(0.5, 1, 0.01, 0.2)
+	restored.SetState(PlateauState{Factor: 0.5, Best: &best})
+	restored.Observe(0.95)
+	require.Equal(t, s.State(), restored.State())
+
+	s.Observe(0.95)
+	restored.Observe(0.95)
+	require.Equal(t, float32(0.25), restored.Factor(0))
+	require.Equal(t, s.State(), restored.State())
+
+	restored.SetState(PlateauState{Factor: 1})
+	require.Equal(t, PlateauState{Factor: 1}, restored.State())
+}